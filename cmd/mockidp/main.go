@@ -0,0 +1,45 @@
+// mockidp — минимальный провайдер OpenID Connect для локальной проверки входа через SSO (см. internal/mockidp).
+// Страницы входа нет: /authorize сразу «входит» пользователем из флагов и возвращает код.
+//
+//	go run ./cmd/mockidp -sub alice -email alice@example.com
+//
+// В .env тасктрекера: OIDC_ISSUER=http://localhost:9000, OIDC_CLIENT_ID=tasker, OIDC_CLIENT_SECRET=secret.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"tasker/internal/mockidp"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL")
+	clientID := flag.String("client-id", "tasker", "client id")
+	clientSecret := flag.String("client-secret", "secret", "client secret (empty — public client)")
+	sub := flag.String("sub", "mock-user-1", "subject of the signed-in user")
+	email := flag.String("email", "mock.user@example.com", "email claim")
+	emailVerified := flag.Bool("email-verified", true, "email_verified claim")
+	givenName := flag.String("given-name", "Mock", "given_name claim")
+	familyName := flag.String("family-name", "User", "family_name claim")
+	username := flag.String("username", "mock.user", "preferred_username claim")
+	flag.Parse()
+
+	p, err := mockidp.New(*issuer, *clientID, *clientSecret, map[string]any{
+		"sub":                *sub,
+		"email":              *email,
+		"email_verified":     *emailVerified,
+		"name":               strings.TrimSpace(*givenName + " " + *familyName),
+		"given_name":         *givenName,
+		"family_name":        *familyName,
+		"preferred_username": *username,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("mock OIDC provider %s listening on %s, user %q", p.Issuer, *addr, *sub)
+	log.Fatal(http.ListenAndServe(*addr, p))
+}
@@ -0,0 +1,55 @@
+// mockldap — минимальный LDAP-сервер для локальной проверки входа через каталог (см. internal/mockldap).
+//
+//	go run ./cmd/mockldap -ldif cmd/mockldap/directory.ldif
+//
+// В .env тасктрекера: LDAP_URL=ldap://localhost:3389, LDAP_BASE_DN=ou=people,dc=example,dc=org,
+// LDAP_GROUP_BASE_DN=ou=groups,dc=example,dc=org (см. Endpoints.md).
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"log"
+	"net"
+
+	"tasker/internal/mockldap"
+)
+
+func main() {
+	addr := flag.String("addr", ":3389", "listen address (ldap://)")
+	ldapsAddr := flag.String("ldaps-addr", "", "listen address for ldaps:// (needs -tls-cert and -tls-key)")
+	ldifFile := flag.String("ldif", "cmd/mockldap/directory.ldif", "directory entries")
+	certFile := flag.String("tls-cert", "", "certificate for StartTLS and ldaps (PEM)")
+	keyFile := flag.String("tls-key", "", "private key for StartTLS and ldaps (PEM)")
+	flag.Parse()
+
+	d, err := mockldap.Load(*ldifFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *certFile != "" {
+		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		d.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	if *ldapsAddr != "" {
+		if d.TLS == nil {
+			log.Fatal("-ldaps-addr needs -tls-cert and -tls-key")
+		}
+		l, err := tls.Listen("tcp", *ldapsAddr, d.TLS)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("mockldap: ldaps on %s", *ldapsAddr)
+		go func() { log.Fatal(d.Serve(l)) }()
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("mockldap: %d entries from %s, ldap on %s", d.Len(), *ldifFile, *addr)
+	log.Fatal(d.Serve(l))
+}
@@ -4,14 +4,17 @@ import (
 	"context"
 	"log"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"tasker/internal/config"
 	"tasker/internal/database"
 	"tasker/internal/handler"
+	"tasker/internal/mail"
 	"tasker/internal/middleware"
 	"tasker/internal/service"
+	"tasker/internal/storage"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -31,14 +34,167 @@ func main() {
 	}
 	defer dbPool.Close()
 
+	// Шина доменных событий; пока события только пишутся в лог
+	events := service.NewEventBus()
+	events.Subscribe(func(_ context.Context, e service.Event) {
+		slog.Info("Domain event", "type", e.Type, "taskID", e.TaskID, "spaceID", e.SpaceID, "payload", e.Payload)
+	})
+
+	// Хранилище вложений
+	var blobs storage.BlobStore
+	switch cfg.Attachments.Backend {
+	case "local":
+		blobs, err = storage.NewLocalStore(cfg.Attachments.LocalDir)
+	case "s3":
+		blobs, err = storage.NewS3Store(cfg.Attachments.S3, &http.Client{Timeout: cfg.Attachments.S3.Timeout})
+	default:
+		log.Fatalf("Unknown attachments backend: %q", cfg.Attachments.Backend)
+	}
+	if err != nil {
+		log.Fatalf("Attachments storage error: %v", err)
+	}
+
 	// Инициализация сервисов
-	spaceService := service.NewSpaceService(dbPool)
-	authService := service.NewAuthService(dbPool, cfg.JWTSecret)
-	taskService := service.NewTaskService(dbPool, spaceService)
-	userService := service.NewUserService(dbPool)
+	spaceService := service.NewSpaceService(dbPool, blobs)
+	jwtKeys, err := service.LoadKeySet(service.KeySetConfig{
+		Algorithm:      cfg.JWT.Algorithm,
+		Secret:         cfg.JWTSecret,
+		SigningKeyFile: cfg.JWT.SigningKeyFile,
+		VerifyKeyFiles: cfg.JWT.VerifyKeyFiles,
+		Issuer:         cfg.JWT.Issuer,
+		Audience:       cfg.JWT.Audience,
+	})
+	if err != nil {
+		log.Fatalf("JWT keys error: %v", err)
+	}
+	var loginAttempts storage.AttemptStore
+	switch cfg.Login.AttemptsBackend {
+	case "postgres":
+		loginAttempts = storage.NewPgAttemptStore(dbPool)
+	case "memory":
+		loginAttempts = storage.NewMemoryAttemptStore()
+	default:
+		log.Fatalf("Unknown login attempts backend: %q", cfg.Login.AttemptsBackend)
+	}
+	loginGuard := service.NewLoginGuard(dbPool, loginAttempts, service.LoginPolicy{
+		MaxFailures:           cfg.Login.MaxFailures,
+		MaxIPFailures:         cfg.Login.MaxIPFailures,
+		BaseDelay:             cfg.Login.BackoffBase,
+		Lockout:               cfg.Login.Lockout,
+		Window:                cfg.Login.FailureWindow,
+		PasswordLoginDisabled: !cfg.Login.PasswordEnabled,
+	})
+	passwordPolicy, err := service.LoadPasswordPolicy(cfg.Password.MinLength, cfg.Password.BcryptCost, cfg.Password.BreachedFile)
+	if err != nil {
+		log.Fatalf("Password policy error: %v", err)
+	}
+	var mailer mail.Mailer
+	switch cfg.Mail.Backend {
+	case "file":
+		mailer, err = mail.NewFileMailer(cfg.Mail.Dir, cfg.Mail.From)
+	case "smtp":
+		mailer, err = mail.NewSMTPMailer(cfg.Mail.SMTP)
+	default:
+		log.Fatalf("Unknown mail backend: %q", cfg.Mail.Backend)
+	}
+	if err != nil {
+		log.Fatalf("Mailer error: %v", err)
+	}
+	twoFactorService := service.NewTwoFactorService(dbPool, loginGuard, cfg.Auth.TwoFactorIssuer, cfg.Auth.ChallengeTTL)
+	// источники учётных данных: локальные пароли всегда, OIDC и LDAP — если настроены
+	providers := []service.CredentialProvider{service.NewLocalCredentials(dbPool, loginGuard, passwordPolicy)}
+	var oidcService *service.OIDCService
+	if cfg.OIDC.Issuer != "" {
+		oidcService, err = service.NewOIDCService(dbPool, loginGuard, service.OIDCConfig{
+			Issuer:        cfg.OIDC.Issuer,
+			ClientID:      cfg.OIDC.ClientID,
+			ClientSecret:  cfg.OIDC.ClientSecret,
+			RedirectURL:   cfg.OIDC.RedirectURL,
+			Scopes:        cfg.OIDC.Scopes,
+			LinkByEmail:   cfg.OIDC.LinkByEmail,
+			AutoProvision: cfg.OIDC.AutoProvision,
+			StateTTL:      cfg.OIDC.StateTTL,
+			PostLoginURL:  cfg.OIDC.PostLoginURL,
+		}, nil)
+		if err != nil {
+			log.Fatalf("OIDC error: %v", err)
+		}
+		providers = append(providers, oidcService)
+	}
+	if cfg.LDAP.URL != "" {
+		ldapService, err := service.NewLDAPService(dbPool, loginGuard, service.LDAPConfig{
+			URL:                cfg.LDAP.URL,
+			StartTLS:           cfg.LDAP.StartTLS,
+			CAFile:             cfg.LDAP.CAFile,
+			InsecureSkipVerify: cfg.LDAP.InsecureSkipVerify,
+			Timeout:            cfg.LDAP.Timeout,
+			BindDNTemplate:     cfg.LDAP.BindDNTemplate,
+			BindDN:             cfg.LDAP.BindDN,
+			BindPassword:       cfg.LDAP.BindPassword,
+			BaseDN:             cfg.LDAP.BaseDN,
+			UserFilter:         cfg.LDAP.UserFilter,
+			IDAttribute:        cfg.LDAP.IDAttribute,
+			LoginAttribute:     cfg.LDAP.LoginAttribute,
+			EmailAttribute:     cfg.LDAP.EmailAttribute,
+			NameAttribute:      cfg.LDAP.NameAttribute,
+			SurnameAttribute:   cfg.LDAP.SurnameAttribute,
+			MiddleAttribute:    cfg.LDAP.MiddleAttribute,
+			GroupBaseDN:        cfg.LDAP.GroupBaseDN,
+			GroupFilter:        cfg.LDAP.GroupFilter,
+			RequiredGroup:      cfg.LDAP.RequiredGroup,
+			SyncGroups:         cfg.LDAP.SyncGroups,
+			LinkByLogin:        cfg.LDAP.LinkByLogin,
+		})
+		if err != nil {
+			log.Fatalf("LDAP error: %v", err)
+		}
+		providers = append(providers, ldapService)
+	}
+	identityService := service.NewIdentityService(dbPool, jwtKeys, loginGuard, twoFactorService, passwordPolicy, cfg.Auth.AccessTTL, cfg.Auth.RefreshTTL, providers...)
+	passwordService := service.NewPasswordService(dbPool, passwordPolicy, loginGuard, mailer, cfg.Password.ResetTTL, cfg.Password.ResetLinkBase)
+	emailVerificationService := service.NewEmailVerificationService(dbPool, mailer, cfg.Profile.EmailVerifyTTL, cfg.Profile.EmailVerifyLinkBase)
+	workflowService := service.NewWorkflowService(dbPool)
+	taskService := service.NewTaskService(dbPool, spaceService, workflowService, events)
+	approvalService := service.NewApprovalService(dbPool, spaceService, workflowService)
+	reportService := service.NewReportService(dbPool, workflowService)
+	commentService := service.NewCommentService(dbPool, spaceService)
+	attachmentService := service.NewAttachmentService(dbPool, blobs, spaceService, service.AttachmentLimits{
+		MaxFileSize:  cfg.Attachments.MaxFileSize,
+		SpaceQuota:   cfg.Attachments.SpaceQuota,
+		AllowedTypes: cfg.Attachments.AllowedTypes,
+	})
+	trashService := service.NewTrashService(dbPool, taskService, blobs, cfg.Trash.Retention)
+	searchService := service.NewSearchService(dbPool)
+	policyService := service.NewPolicyService(dbPool)
+	roleService := service.NewRoleService(dbPool)
+	userService := service.NewUserService(dbPool, blobs, service.ProfileLimits{
+		AvatarMaxSize: cfg.Profile.AvatarMaxSize,
+		Locales:       cfg.Profile.Locales,
+	})
+	scimService := service.NewSCIMService(dbPool, passwordPolicy)
 	dashboardService := service.NewDashboardService(dbPool)
+	accessTokenService := service.NewAccessTokenService(dbPool)
+	invitationService := service.NewInvitationService(dbPool, cfg.Invitations.TTL, cfg.Invitations.LinkBase)
 
-	app := fiber.New()
+	if err := roleService.EnsureBuiltinRoles(context.Background()); err != nil {
+		log.Fatalf("Roles init error: %v", err)
+	}
+	if cfg.AdminLogin != "" {
+		if err := roleService.BootstrapAdmin(context.Background(), cfg.AdminLogin); err != nil {
+			slog.Warn("Failed to assign admin role", "login", cfg.AdminLogin, "error", err)
+		}
+	}
+
+	// большие тела принимаются только при загрузке файлов; запас сверх максимального файла —
+	// на остальные части multipart-запроса
+	uploadRoutes := []middleware.BodyRoute{
+		{Method: fiber.MethodPost, Path: "/task/:id/attachments", Limit: int(cfg.Attachments.MaxFileSize) + 1<<20},
+		{Method: fiber.MethodPut, Path: "/users/me/avatar", Limit: int(cfg.Profile.AvatarMaxSize) + 1<<20},
+	}
+	app := fiber.New(fiber.Config{
+		BodyLimit: middleware.MaxBodyLimit(fiber.DefaultBodyLimit, uploadRoutes...),
+	})
+	app.Use(middleware.BodyLimit(fiber.DefaultBodyLimit, uploadRoutes...))
 	//healthchek
 	app.Get("/health", func(c fiber.Ctx) error {
 		if err := dbPool.Ping(context.Background()); err != nil {
@@ -58,20 +214,62 @@ func main() {
 	}))
 
 	// Инициализация обработчиков
-	authHandler := handler.NewAuthHandler(authService)
-	taskHandler := handler.NewTaskHandler(taskService)
-	userHandler := handler.NewUserHandler(userService)
-	spaceHandler := handler.NewSpaceHandler(spaceService)
-	dashboardsHandler := handler.NewDashboardsHandler(dashboardService)
+	authHandler := handler.NewAuthHandler(identityService, emailVerificationService)
+	taskHandler := handler.NewTaskHandler(taskService, policyService)
+	userHandler := handler.NewUserHandler(userService, policyService)
+	spaceHandler := handler.NewSpaceHandler(spaceService, policyService)
+	dashboardsHandler := handler.NewDashboardsHandler(dashboardService, policyService)
+	workflowHandler := handler.NewWorkflowHandler(workflowService, policyService)
+	approvalHandler := handler.NewApprovalHandler(approvalService, policyService)
+	reportHandler := handler.NewReportHandler(reportService)
+	commentHandler := handler.NewCommentHandler(commentService, policyService)
+	trashHandler := handler.NewTrashHandler(trashService, policyService)
+	searchHandler := handler.NewSearchHandler(searchService)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService, policyService)
+	roleHandler := handler.NewRoleHandler(roleService, policyService)
+	invitationHandler := handler.NewInvitationHandler(invitationService)
+	accessTokenHandler := handler.NewAccessTokenHandler(accessTokenService)
+	loginGuardHandler := handler.NewLoginGuardHandler(loginGuard, policyService)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService)
+	passwordHandler := handler.NewPasswordHandler(passwordService)
+	emailVerificationHandler := handler.NewEmailVerificationHandler(emailVerificationService)
+	oidcHandler := handler.NewOIDCHandler(oidcService, identityService, loginGuard, cfg.OIDC.StateTTL)
+	scimHandler := handler.NewSCIMHandler(scimService, policyService)
 
 	// Регистрация маршрутов
 	authHandler.RegisterRoutes(app)
-	app.Use(middleware.AuthMiddleware(authService))
-	app.Get("/api/getuserbyJWT", authHandler.GetUserHandler)
+	passwordHandler.RegisterRoutes(app)
+	emailVerificationHandler.RegisterRoutes(app)
+	oidcHandler.RegisterRoutes(app)
+	app.Use(middleware.AuthMiddleware(identityService, accessTokenService))
+	app.Get("/api/getuserbyJWT", handler.Deprecated("/users/me"), authHandler.GetUserHandler)
+	authHandler.RegisterAccountRoutes(app)
+	passwordHandler.RegisterAccountRoutes(app)
+	emailVerificationHandler.RegisterAccountRoutes(app)
+	twoFactorHandler.RegisterRoutes(app)
 	taskHandler.RegisterRoutes(app)
 	userHandler.RegisterPublicRoutes(app)
+	userHandler.RegisterRoutes(app)
 	dashboardsHandler.RegisterRoutes(app)
 	spaceHandler.RegisterRoutes(app)
+	workflowHandler.RegisterRoutes(app)
+	approvalHandler.RegisterRoutes(app)
+	reportHandler.RegisterRoutes(app)
+	commentHandler.RegisterRoutes(app)
+	attachmentHandler.RegisterRoutes(app)
+	trashHandler.RegisterRoutes(app)
+	searchHandler.RegisterRoutes(app)
+	roleHandler.RegisterRoutes(app)
+	invitationHandler.RegisterRoutes(app)
+	accessTokenHandler.RegisterRoutes(app)
+	loginGuardHandler.RegisterRoutes(app)
+	scimHandler.RegisterRoutes(app)
+
+	// Фоновая очистка корзины
+	purgerCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go trashService.RunPurger(purgerCtx, cfg.Trash.PurgeInterval)
+	go loginGuard.RunPruner(purgerCtx, cfg.Login.FailureWindow)
 
 	// Graceful shutdown
 	shutdown := make(chan os.Signal, 1)
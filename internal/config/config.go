@@ -2,7 +2,11 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"tasker/internal/mail"
+	"tasker/internal/storage"
+	"time"
 
 	"github.com/KoNekoD/dotenv/pkg/dotenv"
 	"github.com/pkg/errors"
@@ -24,11 +28,153 @@ type DBConfig struct {
 	Password string
 }
 
+type AttachmentsConfig struct {
+	Backend      string // local или s3
+	LocalDir     string
+	S3           storage.S3Config
+	MaxFileSize  int64
+	SpaceQuota   int64
+	AllowedTypes []string
+}
+
+type TrashConfig struct {
+	// Retention — сколько задача лежит в корзине до окончательного удаления.
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+type AuthConfig struct {
+	// AccessTTL — срок жизни access-токена (JWT).
+	AccessTTL time.Duration
+	// RefreshTTL — сколько сессия живёт без обновления; каждый refresh продлевает её.
+	RefreshTTL time.Duration
+	// TwoFactorIssuer — название сервиса в приложении-аутентификаторе.
+	TwoFactorIssuer string
+	// ChallengeTTL — сколько после пароля ждём код 2FA.
+	ChallengeTTL time.Duration
+}
+
+type LoginConfig struct {
+	// AttemptsBackend — где считать неудачные попытки: postgres (общие для всех реплик) или memory.
+	AttemptsBackend string
+	MaxFailures     int
+	MaxIPFailures   int
+	BackoffBase     time.Duration
+	Lockout         time.Duration
+	FailureWindow   time.Duration
+	// PasswordEnabled — false оставляет только вход через SSO.
+	PasswordEnabled bool
+}
+
+type OIDCConfig struct {
+	// Issuer — адрес провайдера OpenID Connect; пустой — SSO выключен.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// LinkByEmail — привязывать вход к пользователю с тем же подтверждённым email.
+	LinkByEmail bool
+	// AutoProvision — создавать пользователя при первом входе.
+	AutoProvision bool
+	StateTTL      time.Duration
+	// PostLoginURL — страница фронтенда, куда браузер возвращается после входа.
+	PostLoginURL string
+}
+
+type LDAPConfig struct {
+	// URL — ldap:// или ldaps:// адрес каталога; пустой — вход через LDAP выключен.
+	URL                string
+	StartTLS           bool
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+	// BindDNTemplate — DN пользователя с %s вместо логина; пустой — поиск по UserFilter.
+	BindDNTemplate string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	IDAttribute    string
+	LoginAttribute string
+	EmailAttribute string
+	// NameAttribute, SurnameAttribute, MiddleAttribute — имя, фамилия и отчество.
+	NameAttribute    string
+	SurnameAttribute string
+	MiddleAttribute  string
+	GroupBaseDN      string
+	GroupFilter      string
+	RequiredGroup    string
+	SyncGroups       bool
+	LinkByLogin      bool
+}
+
+type JWTConfig struct {
+	// Algorithm — HS256 (JWT_SECRET), RS256 или EdDSA (ключи из PEM-файлов).
+	Algorithm      string
+	SigningKeyFile string
+	// VerifyKeyFiles — ключи, подписи которых ещё принимаются (ротация).
+	VerifyKeyFiles []string
+	Issuer         string
+	Audience       string
+}
+
+type MailConfig struct {
+	// Backend — file (письма сохраняются в Dir, для разработки) или smtp.
+	Backend string
+	From    string
+	Dir     string
+	SMTP    mail.SMTPConfig
+}
+
+type PasswordConfig struct {
+	MinLength int
+	// BreachedFile — список скомпрометированных паролей (пароли или SHA-1), пусто — без проверки.
+	BreachedFile string
+	// BcryptCost — стоимость bcrypt для новых хешей; хеши с меньшей стоимостью пересчитываются при входе.
+	BcryptCost int
+	// ResetTTL — срок жизни ссылки для сброса пароля.
+	ResetTTL time.Duration
+	// ResetLinkBase — адрес страницы сброса пароля; к нему добавляется ?token=.
+	ResetLinkBase string
+}
+
+type ProfileConfig struct {
+	AvatarMaxSize int64
+	// Locales — языки интерфейса, доступные в профиле.
+	Locales []string
+	// EmailVerifyTTL — срок жизни ссылки для подтверждения email.
+	EmailVerifyTTL time.Duration
+	// EmailVerifyLinkBase — адрес страницы подтверждения email; к нему добавляется ?token=.
+	EmailVerifyLinkBase string
+}
+
+type InvitationsConfig struct {
+	// TTL — срок жизни приглашения, если при создании не указан свой.
+	TTL time.Duration
+	// LinkBase — адрес страницы вступления; к нему добавляется ?token=.
+	LinkBase string
+}
+
 type Config struct {
-	Port      string
+	Port string
+	// JWTSecret нужен только для JWT.Algorithm = HS256.
 	JWTSecret string
-	DB        DBConfig
-	CORS      CORSConfig
+	JWT       JWTConfig
+	// AdminLogin — пользователь, которому при старте назначается системная роль admin.
+	AdminLogin  string
+	Auth        AuthConfig
+	Login       LoginConfig
+	OIDC        OIDCConfig
+	LDAP        LDAPConfig
+	Password    PasswordConfig
+	Mail        MailConfig
+	DB          DBConfig
+	CORS        CORSConfig
+	Attachments AttachmentsConfig
+	Profile     ProfileConfig
+	Trash       TrashConfig
+	Invitations InvitationsConfig
 }
 
 func MustLoad() *Config {
@@ -37,8 +183,84 @@ func MustLoad() *Config {
 	}
 
 	return &Config{
-		Port:      getEnv("PORT", "3000"),
-		JWTSecret: mustGetEnv("JWT_SECRET"),
+		Port:       getEnv("PORT", "3000"),
+		JWTSecret:  getEnv("JWT_SECRET", ""),
+		AdminLogin: getEnv("ADMIN_LOGIN", ""),
+		Auth: AuthConfig{
+			AccessTTL:       getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTTL:      getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+			TwoFactorIssuer: getEnv("TWO_FACTOR_ISSUER", "Tasker"),
+			ChallengeTTL:    getEnvDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute),
+		},
+		Login: LoginConfig{
+			AttemptsBackend: getEnv("LOGIN_ATTEMPTS_BACKEND", "postgres"),
+			MaxFailures:     int(getEnvInt64("LOGIN_MAX_FAILURES", 5)),
+			MaxIPFailures:   int(getEnvInt64("LOGIN_MAX_IP_FAILURES", 30)),
+			BackoffBase:     getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+			Lockout:         getEnvDuration("LOGIN_LOCKOUT", 15*time.Minute),
+			FailureWindow:   getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			PasswordEnabled: getEnv("PASSWORD_LOGIN_ENABLED", "true") == "true",
+		},
+		OIDC: OIDCConfig{
+			Issuer:        getEnv("OIDC_ISSUER", ""),
+			ClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   getEnv("OIDC_REDIRECT_URL", "http://localhost:3000/api/oidc/callback"),
+			Scopes:        getEnvList("OIDC_SCOPES", "openid,email,profile"),
+			LinkByEmail:   getEnv("OIDC_LINK_BY_EMAIL", "true") == "true",
+			AutoProvision: getEnv("OIDC_AUTO_PROVISION", "false") == "true",
+			StateTTL:      getEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+			PostLoginURL:  getEnv("OIDC_POST_LOGIN_URL", "http://localhost:3000/"),
+		},
+		LDAP: LDAPConfig{
+			URL:                getEnv("LDAP_URL", ""),
+			StartTLS:           getEnv("LDAP_START_TLS", "false") == "true",
+			CAFile:             getEnv("LDAP_CA_FILE", ""),
+			InsecureSkipVerify: getEnv("LDAP_INSECURE_SKIP_VERIFY", "false") == "true",
+			Timeout:            getEnvDuration("LDAP_TIMEOUT", 10*time.Second),
+			BindDNTemplate:     getEnv("LDAP_BIND_DN_TEMPLATE", ""),
+			BindDN:             getEnv("LDAP_BIND_DN", ""),
+			BindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:             getEnv("LDAP_BASE_DN", ""),
+			UserFilter:         getEnv("LDAP_USER_FILTER", "(uid=%s)"),
+			IDAttribute:        getEnv("LDAP_ID_ATTRIBUTE", "entryUUID"),
+			LoginAttribute:     getEnv("LDAP_LOGIN_ATTRIBUTE", "uid"),
+			EmailAttribute:     getEnv("LDAP_EMAIL_ATTRIBUTE", "mail"),
+			NameAttribute:      getEnv("LDAP_NAME_ATTRIBUTE", "givenName"),
+			SurnameAttribute:   getEnv("LDAP_SURNAME_ATTRIBUTE", "sn"),
+			MiddleAttribute:    getEnv("LDAP_MIDDLENAME_ATTRIBUTE", "initials"),
+			GroupBaseDN:        getEnv("LDAP_GROUP_BASE_DN", ""),
+			GroupFilter:        getEnv("LDAP_GROUP_FILTER", "(member=%s)"),
+			RequiredGroup:      getEnv("LDAP_REQUIRED_GROUP", ""),
+			SyncGroups:         getEnv("LDAP_SYNC_GROUPS", "false") == "true",
+			LinkByLogin:        getEnv("LDAP_LINK_BY_LOGIN", "false") == "true",
+		},
+		Password: PasswordConfig{
+			MinLength:     int(getEnvInt64("PASSWORD_MIN_LENGTH", 8)),
+			BreachedFile:  getEnv("PASSWORD_BREACHED_FILE", ""),
+			BcryptCost:    int(getEnvInt64("PASSWORD_BCRYPT_COST", 10)),
+			ResetTTL:      getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+			ResetLinkBase: getEnv("PASSWORD_RESET_LINK_BASE", "http://localhost:3000/reset-password"),
+		},
+		Mail: MailConfig{
+			Backend: getEnv("MAIL_BACKEND", "file"),
+			From:    getEnv("MAIL_FROM", "Tasker <noreply@localhost>"),
+			Dir:     getEnv("MAIL_DIR", "./data/mail"),
+			SMTP: mail.SMTPConfig{
+				Host:     getEnv("SMTP_HOST", ""),
+				Port:     getEnv("SMTP_PORT", "587"),
+				Username: getEnv("SMTP_USERNAME", ""),
+				Password: getEnv("SMTP_PASSWORD", ""),
+				From:     getEnv("MAIL_FROM", "Tasker <noreply@localhost>"),
+			},
+		},
+		JWT: JWTConfig{
+			Algorithm:      getEnv("JWT_ALG", "HS256"),
+			SigningKeyFile: getEnv("JWT_SIGNING_KEY_FILE", ""),
+			VerifyKeyFiles: getEnvList("JWT_VERIFY_KEY_FILES", ""),
+			Issuer:         getEnv("JWT_ISSUER", "tasker"),
+			Audience:       getEnv("JWT_AUDIENCE", "tasker"),
+		},
 		DB: DBConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -53,6 +275,36 @@ func MustLoad() *Config {
 			AllowCredentials: getEnv("ALLOW_CREDENTIALS", "true") == "true",
 			ExposeHeaders:    strings.Split(getEnv("EXPOSE_HEADERS", "Authorization"), ","),
 		},
+		Attachments: AttachmentsConfig{
+			Backend:  getEnv("ATTACHMENTS_BACKEND", "local"),
+			LocalDir: getEnv("ATTACHMENTS_DIR", "./data/attachments"),
+			S3: storage.S3Config{
+				Endpoint:  getEnv("S3_ENDPOINT", ""),
+				Region:    getEnv("S3_REGION", "us-east-1"),
+				Bucket:    getEnv("S3_BUCKET", ""),
+				AccessKey: getEnv("S3_ACCESS_KEY", ""),
+				SecretKey: getEnv("S3_SECRET_KEY", ""),
+				PathStyle: getEnv("S3_PATH_STYLE", "true") == "true",
+				Timeout:   getEnvDuration("S3_TIMEOUT", 2*time.Minute),
+			},
+			MaxFileSize:  getEnvInt64("ATTACHMENTS_MAX_FILE_SIZE", 25<<20),
+			SpaceQuota:   getEnvInt64("ATTACHMENTS_SPACE_QUOTA", 1<<30),
+			AllowedTypes: strings.Split(getEnv("ATTACHMENTS_ALLOWED_TYPES", "image/*,application/pdf,text/plain,application/zip"), ","),
+		},
+		Profile: ProfileConfig{
+			AvatarMaxSize:       getEnvInt64("AVATAR_MAX_SIZE", 2<<20),
+			Locales:             getEnvList("PROFILE_LOCALES", "ru,en"),
+			EmailVerifyTTL:      getEnvDuration("EMAIL_VERIFY_TTL", 48*time.Hour),
+			EmailVerifyLinkBase: getEnv("EMAIL_VERIFY_LINK_BASE", "http://localhost:3000/verify-email"),
+		},
+		Trash: TrashConfig{
+			Retention:     getEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+			PurgeInterval: getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
+		Invitations: InvitationsConfig{
+			TTL:      getEnvDuration("INVITATION_TTL", 7*24*time.Hour),
+			LinkBase: getEnv("INVITATION_LINK_BASE", "http://localhost:3000/join"),
+		},
 	}
 }
 
@@ -63,6 +315,39 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList — список через запятую; пустые элементы отбрасываются.
+func getEnvList(key, defaultValue string) []string {
+	var list []string
+	for _, v := range strings.Split(getEnv(key, defaultValue), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, exists := os.LookupEnv(key); exists {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			panic("environment variable " + key + " must be an integer")
+		}
+		return n
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			panic("environment variable " + key + " must be a positive duration, e.g. 720h")
+		}
+		return d
+	}
+	return defaultValue
+}
+
 func mustGetEnv(key string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
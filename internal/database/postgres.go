@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -57,6 +58,7 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
 	// Создаём структуры таблиц в правильном порядке
 	baseSQL := `
     CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+    CREATE EXTENSION IF NOT EXISTS pg_trgm;
 
     CREATE TABLE IF NOT EXISTS roles (
         id SERIAL PRIMARY KEY,
@@ -64,6 +66,13 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
         maindashboard INTEGER
     );
 
+    -- роли: системные назначаются пользователям (users.roleid), роли пространства — участникам
+    -- (space_memberships.role хранит имя); permissions — имена прав из каталога в service/rbac.go
+    ALTER TABLE roles ADD COLUMN IF NOT EXISTS scope TEXT NOT NULL DEFAULT 'system' CHECK (scope IN ('system', 'space'));
+    ALTER TABLE roles ADD COLUMN IF NOT EXISTS permissions TEXT[] NOT NULL DEFAULT '{}';
+    ALTER TABLE roles ADD COLUMN IF NOT EXISTS builtin BOOLEAN NOT NULL DEFAULT false;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_scope_name ON roles(scope, name);
+
     CREATE TABLE IF NOT EXISTS dashboards (
         id SERIAL PRIMARY KEY,
         name VARCHAR(100) NOT NULL
@@ -77,8 +86,160 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
         login TEXT NOT NULL UNIQUE,
         roleid INTEGER NOT NULL,
         password TEXT NOT NULL,
-        token TEXT,
-        spaces TEXT[]    -- временно храним, если есть старые данные
+        token TEXT
+    );
+
+    -- email необязателен; по нему приглашают ещё не зарегистрированных пользователей
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email TEXT;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(lower(email));
+    -- NULL — владение email не подтверждено; такому email не доверяют привязка SSO и приглашения
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+    -- деактивированный пользователь не может войти; external_id — идентификатор во внешней системе (SCIM)
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id TEXT;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(external_id);
+
+    -- настройки профиля; NULL — не выбраны, фронтенд берёт их из браузера
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT;
+
+    -- аватар: содержимое лежит в хранилище вложений под storage_key
+    CREATE TABLE IF NOT EXISTS user_avatars (
+        user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+        storage_key TEXT NOT NULL,
+        content_type TEXT NOT NULL,
+        size BIGINT NOT NULL,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+    -- сессии входа: refresh-токены одной сессии образуют семейство; повторное использование
+    -- уже обменянного refresh-токена отзывает всю сессию. Хранятся только sha256 токенов.
+    CREATE TABLE IF NOT EXISTS sessions (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        device TEXT NOT NULL DEFAULT '',
+        ip TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        last_used_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        expires_at TIMESTAMPTZ NOT NULL,
+        revoked_at TIMESTAMPTZ,
+        revoke_reason TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS refresh_tokens (
+        token_hash TEXT PRIMARY KEY,
+        session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        used_at TIMESTAMPTZ
+    );
+
+    -- персональные токены доступа; хранится sha256, prefix — начало токена для отображения.
+    -- permissions — подмножество каталога прав, space_id — если токен ограничен одним пространством
+    CREATE TABLE IF NOT EXISTS personal_access_tokens (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        prefix TEXT NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        permissions TEXT[] NOT NULL,
+        space_id TEXT,
+        expires_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        last_used_at TIMESTAMPTZ,
+        last_used_ip TEXT,
+        revoked_at TIMESTAMPTZ
+    );
+
+    -- TOTP (RFC 6238): секрет действует после подтверждения первым кодом; last_step — шаг
+    -- последнего принятого кода, повторно тот же код не принимается
+    CREATE TABLE IF NOT EXISTS user_totp (
+        user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+        secret TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        confirmed_at TIMESTAMPTZ,
+        last_step BIGINT
+    );
+
+    -- одноразовые коды восстановления 2FA; хранится sha256
+    CREATE TABLE IF NOT EXISTS user_recovery_codes (
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        code_hash TEXT NOT NULL,
+        used_at TIMESTAMPTZ,
+        PRIMARY KEY (user_id, code_hash)
+    );
+
+    -- второй шаг входа: после пароля выдаётся challenge-токен, который обменивается на сессию по коду
+    CREATE TABLE IF NOT EXISTS login_challenges (
+        token_hash TEXT PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        device TEXT NOT NULL DEFAULT '',
+        attempts INTEGER NOT NULL DEFAULT 0,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        expires_at TIMESTAMPTZ NOT NULL,
+        used_at TIMESTAMPTZ
+    );
+
+    -- одноразовые токены сброса пароля; хранится только sha256 токена
+    CREATE TABLE IF NOT EXISTS password_resets (
+        token_hash TEXT PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        ip TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        expires_at TIMESTAMPTZ NOT NULL,
+        used_at TIMESTAMPTZ
+    );
+
+    -- одноразовые токены подтверждения email; email — адрес, на который ушло письмо
+    CREATE TABLE IF NOT EXISTS email_verifications (
+        token_hash TEXT PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        email TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        expires_at TIMESTAMPTZ NOT NULL,
+        used_at TIMESTAMPTZ
+    );
+
+    -- незавершённые входы через OIDC: state (хранится sha256), nonce и PKCE-верификатор
+    CREATE TABLE IF NOT EXISTS oidc_login_states (
+        state_hash TEXT PRIMARY KEY,
+        nonce TEXT NOT NULL,
+        code_verifier TEXT NOT NULL,
+        redirect TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        expires_at TIMESTAMPTZ NOT NULL
+    );
+
+    -- привязки учётных записей внешних провайдеров (issuer + sub) к пользователям
+    CREATE TABLE IF NOT EXISTS user_identities (
+        issuer TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        email TEXT,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        last_login_at TIMESTAMPTZ,
+        PRIMARY KEY (issuer, subject)
+    );
+
+    -- счётчики неудачных попыток входа; key — "login:<логин>" или "ip:<адрес>"
+    CREATE TABLE IF NOT EXISTS login_attempts (
+        key TEXT PRIMARY KEY,
+        failures INTEGER NOT NULL,
+        last_failure TIMESTAMPTZ NOT NULL,
+        blocked_until TIMESTAMPTZ
+    );
+
+    -- журнал входов; без FK, чтобы записи переживали удаление пользователя
+    CREATE TABLE IF NOT EXISTS auth_events (
+        id BIGSERIAL PRIMARY KEY,
+        event TEXT NOT NULL,
+        login TEXT NOT NULL DEFAULT '',
+        user_id INTEGER,
+        actor_id INTEGER,
+        ip TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
     );
 
     -- spaces нужно создать ДО space_memberships, т.к. у latter есть FK на spaces
@@ -89,6 +250,19 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
         created_at TIMESTAMPTZ NOT NULL DEFAULT now()
     );
 
+    -- владелец пространства (всегда участник с ролью admin) и архивация
+    ALTER TABLE spaces ADD COLUMN IF NOT EXISTS owner_id INTEGER REFERENCES users(id);
+    ALTER TABLE spaces ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+    -- группа SCIM, которой управляется состав пространства
+    ALTER TABLE spaces ADD COLUMN IF NOT EXISTS external_id TEXT;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_spaces_external_id ON spaces(external_id);
+    -- группа каталога LDAP (DN), участники которой при входе становятся участниками пространства
+    ALTER TABLE spaces ADD COLUMN IF NOT EXISTS ldap_group TEXT;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_spaces_ldap_group ON spaces(lower(ldap_group));
+    -- участникам пространства с require_2fa доступ есть только при включённой 2FA
+    ALTER TABLE spaces ADD COLUMN IF NOT EXISTS require_2fa BOOLEAN NOT NULL DEFAULT false;
+    UPDATE spaces SET owner_id = creator_id WHERE owner_id IS NULL;
+
     CREATE TABLE IF NOT EXISTS space_memberships (
         space_id TEXT NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
         user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -97,6 +271,29 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
         PRIMARY KEY (space_id, user_id)
     );
 
+    -- кто пригласил участника и по какому приглашению он вступил
+    ALTER TABLE space_memberships ADD COLUMN IF NOT EXISTS invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+    ALTER TABLE space_memberships ADD COLUMN IF NOT EXISTS invitation_id UUID;
+
+    -- приглашения: адресные (invitee_id или invitee_email) и ссылки (kind = 'link', max_uses NULL — без ограничения).
+    -- Хранится только sha256 токена, сам токен отдаётся один раз при создании.
+    CREATE TABLE IF NOT EXISTS space_invitations (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        space_id TEXT NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+        kind TEXT NOT NULL CHECK (kind IN ('user', 'link')),
+        role TEXT NOT NULL,
+        inviter_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+        invitee_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+        invitee_email TEXT,
+        token_hash TEXT NOT NULL UNIQUE,
+        max_uses INTEGER CHECK (max_uses > 0),
+        uses INTEGER NOT NULL DEFAULT 0,
+        status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'revoked', 'used')),
+        expires_at TIMESTAMPTZ NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        responded_at TIMESTAMPTZ
+    );
+
     CREATE TABLE IF NOT EXISTS tasks (
         id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
         title TEXT NOT NULL,
@@ -113,21 +310,166 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
         done_at TIMESTAMPTZ,
         deadline TEXT NOT NULL,
         "dashboardID" TEXT NOT NULL,
-        "blockedBy" TEXT[],
         space TEXT
     );
 
+    -- task_id заблокирована задачей blocker_id
+    CREATE TABLE IF NOT EXISTS task_dependencies (
+        task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+        blocker_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        PRIMARY KEY (task_id, blocker_id),
+        CHECK (task_id <> blocker_id)
+    );
+
+    CREATE TABLE IF NOT EXISTS workflow_statuses (
+        space_id TEXT NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        category TEXT NOT NULL CHECK (category IN ('todo', 'in-progress', 'done')),
+        position INTEGER NOT NULL DEFAULT 0,
+        PRIMARY KEY (space_id, name)
+    );
+
+    CREATE TABLE IF NOT EXISTS workflow_transitions (
+        space_id TEXT NOT NULL,
+        from_status TEXT NOT NULL,
+        to_status TEXT NOT NULL,
+        PRIMARY KEY (space_id, from_status, to_status),
+        FOREIGN KEY (space_id, from_status) REFERENCES workflow_statuses(space_id, name) ON DELETE CASCADE,
+        FOREIGN KEY (space_id, to_status) REFERENCES workflow_statuses(space_id, name) ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS approval_policies (
+        space_id TEXT PRIMARY KEY REFERENCES spaces(id) ON DELETE CASCADE,
+        mode TEXT NOT NULL DEFAULT 'any-of' CHECK (mode IN ('any-of', 'all-of', 'quorum')),
+        quorum INTEGER NOT NULL DEFAULT 1 CHECK (quorum > 0),
+        reject_status TEXT
+    );
+
+    CREATE TABLE IF NOT EXISTS task_approvers (
+        task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+        user_id TEXT NOT NULL,
+        PRIMARY KEY (task_id, user_id)
+    );
+
+    -- решения по одобрению; superseded = true у решений прошлых раундов
+    CREATE TABLE IF NOT EXISTS task_approvals (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+        approver_id TEXT NOT NULL,
+        decision TEXT NOT NULL CHECK (decision IN ('approved', 'rejected')),
+        comment TEXT NOT NULL DEFAULT '',
+        decided_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        superseded BOOLEAN NOT NULL DEFAULT false
+    );
+
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_task_approvals_current
+        ON task_approvals(task_id, approver_id) WHERE NOT superseded;
+
+    -- кто запросил текущий раунд одобрения: он, как и репортер, не может одобрить задачу сам
+    ALTER TABLE tasks ADD COLUMN IF NOT EXISTS approval_requested_by TEXT;
+
+    CREATE TABLE IF NOT EXISTS task_comments (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+        parent_id UUID REFERENCES task_comments(id) ON DELETE CASCADE,
+        author_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        body TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        deleted_at TIMESTAMPTZ
+    );
+
+    -- прежние версии комментария
+    CREATE TABLE IF NOT EXISTS task_comment_edits (
+        id BIGSERIAL PRIMARY KEY,
+        comment_id UUID NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+        body TEXT NOT NULL,
+        editor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        edited_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+    CREATE TABLE IF NOT EXISTS comment_mentions (
+        comment_id UUID NOT NULL REFERENCES task_comments(id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        PRIMARY KEY (comment_id, user_id)
+    );
+
+    -- метаданные вложений; содержимое лежит в BlobStore под storage_key
+    CREATE TABLE IF NOT EXISTS attachments (
+        id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+        task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+        space_id TEXT NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+        file_name TEXT NOT NULL,
+        content_type TEXT NOT NULL,
+        size BIGINT NOT NULL,
+        checksum TEXT NOT NULL,
+        storage_key TEXT NOT NULL UNIQUE,
+        uploader_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+    ALTER TABLE spaces ADD COLUMN IF NOT EXISTS attachment_quota BIGINT;
+
+    -- корзина: удалённые задачи хранятся до окончательной очистки
+    ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+    ALTER TABLE tasks ADD COLUMN IF NOT EXISTS deleted_by INTEGER;
+
+    -- полнотекстовый поиск: тексты на русском и английском, поэтому индексируем обеими конфигурациями
+    ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('russian', coalesce(description, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'B')
+    ) STORED;
+    ALTER TABLE task_comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+        to_tsvector('russian', coalesce(body, '')) || to_tsvector('english', coalesce(body, ''))
+    ) STORED;
+
+    -- неизменяемый журнал изменений задач; без FK, чтобы записи переживали удаление задачи
+    CREATE TABLE IF NOT EXISTS task_history (
+        id BIGSERIAL PRIMARY KEY,
+        task_id UUID NOT NULL,
+        action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore', 'done')),
+        actor_id INTEGER,
+        changes JSONB NOT NULL DEFAULT '[]',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
     CREATE INDEX IF NOT EXISTS idx_users_roleid ON users(roleid);
     CREATE INDEX IF NOT EXISTS idx_tasks_dashboardid ON tasks("dashboardID");
     CREATE INDEX IF NOT EXISTS idx_tasks_space ON tasks(space);
     CREATE INDEX IF NOT EXISTS idx_tasks_updated_at ON tasks(updated_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocker ON task_dependencies(blocker_id);
+    CREATE INDEX IF NOT EXISTS idx_task_comments_task ON task_comments(task_id, created_at);
+    CREATE INDEX IF NOT EXISTS idx_comment_mentions_user ON comment_mentions(user_id);
+    CREATE INDEX IF NOT EXISTS idx_attachments_task ON attachments(task_id);
+    CREATE INDEX IF NOT EXISTS idx_attachments_space ON attachments(space_id);
+    CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);
+    CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session ON refresh_tokens(session_id);
+    CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user ON personal_access_tokens(user_id);
+    CREATE INDEX IF NOT EXISTS idx_login_challenges_user ON login_challenges(user_id);
+    CREATE INDEX IF NOT EXISTS idx_password_resets_user ON password_resets(user_id, created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_email_verifications_user ON email_verifications(user_id, created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+    CREATE INDEX IF NOT EXISTS idx_auth_events_created ON auth_events(created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_auth_events_login ON auth_events(lower(login), created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_space_invitations_space ON space_invitations(space_id, status);
+    CREATE INDEX IF NOT EXISTS idx_space_invitations_invitee ON space_invitations(invitee_id) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_space_invitations_email ON space_invitations(lower(invitee_email)) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_task_history_task ON task_history(task_id, created_at);
+    CREATE INDEX IF NOT EXISTS idx_tasks_deleted_at ON tasks(deleted_at) WHERE deleted_at IS NOT NULL;
+    CREATE INDEX IF NOT EXISTS idx_tasks_search ON tasks USING GIN (search_vector);
+    CREATE INDEX IF NOT EXISTS idx_task_comments_search ON task_comments USING GIN (search_vector);
+    CREATE INDEX IF NOT EXISTS idx_tasks_title_trgm ON tasks USING GIN (title gin_trgm_ops);
+    CREATE INDEX IF NOT EXISTS idx_tasks_description_trgm ON tasks USING GIN (description gin_trgm_ops);
     `
 
 	if _, err := pool.Exec(ctx, baseSQL); err != nil {
 		return fmt.Errorf("create base tables: %w", err)
 	}
 
-	// Если есть users.spaces (старые данные), мигрируем их в spaces и space_memberships
+	// Если есть users.spaces (старые данные), мигрируем их в spaces и space_memberships и удаляем колонку
 	var hasSpacesColumn bool
 	err := pool.QueryRow(ctx, `
         SELECT EXISTS (
@@ -140,34 +482,182 @@ func createTables(ctx context.Context, pool *pgxpool.Pool) error {
 	}
 
 	if hasSpacesColumn {
-		// 1) Вставляем отсутствующие записи в spaces (id = s_id, name = s_id, creator = user)
-		//    чтобы FK на space_memberships не падал, если ранее у пользователей были ссылки на пространства, но записей в spaces не было.
-		insertMissingSpaces := `
-        INSERT INTO spaces (id, name, creator_id)
-        SELECT DISTINCT s_id, s_id, u.id
+		if err := migrateUserSpaces(ctx, pool); err != nil {
+			return err
+		}
+	}
+
+	// Если есть tasks."blockedBy" (старые данные), переносим ссылки в task_dependencies
+	// и удаляем колонку (см. migrateBlockedBy).
+	var hasBlockedByColumn bool
+	err = pool.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM information_schema.columns
+            WHERE table_schema = 'public' AND table_name = 'tasks' AND column_name = 'blockedBy'
+        )
+    `).Scan(&hasBlockedByColumn)
+	if err != nil {
+		return fmt.Errorf("check blockedBy column: %w", err)
+	}
+
+	if hasBlockedByColumn {
+		if err := migrateBlockedBy(ctx, pool); err != nil {
+			return err
+		}
+	}
+
+	// Старые задачи создавались со статусом "todo", в рабочем процессе по умолчанию он называется "to-do".
+	// Пространства со своим рабочим процессом не трогаем: там "todo" может быть настоящим статусом.
+	migrateLegacyStatuses := `
+        UPDATE tasks SET status = 'to-do'
+        WHERE status = 'todo'
+          AND NOT EXISTS (SELECT 1 FROM workflow_statuses w WHERE w.space_id = tasks.space)
+        `
+	if _, err := pool.Exec(ctx, migrateLegacyStatuses); err != nil {
+		return fmt.Errorf("migrate legacy task statuses: %w", err)
+	}
+
+	return nil
+}
+
+// migrateUserSpaces переносит старую колонку users.spaces в spaces и space_memberships
+// и удаляет её. Всё в одной транзакции: при ошибке колонка остаётся и миграция повторится.
+func migrateUserSpaces(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate users.spaces: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// 1) Недостающие пространства (id = name = s_id); владелец — первый пользователь, у кого оно было
+	insertMissingSpaces := `
+        INSERT INTO spaces (id, name, creator_id, owner_id)
+        SELECT s_id, s_id, MIN(u.id), MIN(u.id)
         FROM users u, unnest(u.spaces) AS s_id
-        WHERE NOT EXISTS (SELECT 1 FROM spaces sp WHERE sp.id = s_id)
+        WHERE s_id <> '' AND NOT EXISTS (SELECT 1 FROM spaces sp WHERE sp.id = s_id)
+        GROUP BY s_id
         `
-		if _, err := pool.Exec(ctx, insertMissingSpaces); err != nil {
-			return fmt.Errorf("insert missing spaces: %w", err)
-		}
+	if _, err := tx.Exec(ctx, insertMissingSpaces); err != nil {
+		return fmt.Errorf("insert missing spaces: %w", err)
+	}
 
-		// 2) Мигрируем memberships
-		insertMemberships := `
+	// 2) Членства
+	insertMemberships := `
         INSERT INTO space_memberships (space_id, user_id, role)
-        SELECT s_id, u.id, 'member'
+        SELECT DISTINCT s_id, u.id, 'member'
         FROM users u, unnest(u.spaces) AS s_id
+        WHERE s_id <> ''
         ON CONFLICT (space_id, user_id) DO NOTHING
         `
-		if _, err := pool.Exec(ctx, insertMemberships); err != nil {
-			return fmt.Errorf("migrate memberships: %w", err)
+	if _, err := tx.Exec(ctx, insertMemberships); err != nil {
+		return fmt.Errorf("migrate memberships: %w", err)
+	}
+
+	// 3) Владелец каждого пространства — админ
+	ownersAsAdmins := `
+        INSERT INTO space_memberships (space_id, user_id, role)
+        SELECT id, owner_id, 'admin' FROM spaces WHERE owner_id IS NOT NULL
+        ON CONFLICT (space_id, user_id) DO UPDATE SET role = 'admin'
+        `
+	if _, err := tx.Exec(ctx, ownersAsAdmins); err != nil {
+		return fmt.Errorf("migrate space owners: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `ALTER TABLE users DROP COLUMN spaces`); err != nil {
+		return fmt.Errorf("drop users.spaces: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// migrateBlockedBy переносит tasks."blockedBy" в task_dependencies. Берутся только ссылки на
+// существующие задачи того же пространства — те же правила, что при добавлении блокера.
+// Старый массив не проверялся на циклы, поэтому ребро, замыкающее цикл, отбрасывается
+// (см. acyclicEdges).
+func migrateBlockedBy(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate tasks.blockedBy: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `
+        SELECT t.id::text, b.id::text
+        FROM tasks t, unnest(t."blockedBy") WITH ORDINALITY AS ref(b_id, pos)
+        JOIN tasks b ON b.id::text = ref.b_id
+        WHERE b.id <> t.id AND b.space IS NOT DISTINCT FROM t.space
+        ORDER BY t.created_at, t.id, ref.pos
+        `)
+	if err != nil {
+		return fmt.Errorf("load tasks.blockedBy: %w", err)
+	}
+	var edges [][2]string
+	for rows.Next() {
+		var e [2]string
+		if err := rows.Scan(&e[0], &e[1]); err != nil {
+			rows.Close()
+			return fmt.Errorf("load tasks.blockedBy: %w", err)
 		}
+		edges = append(edges, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("load tasks.blockedBy: %w", err)
+	}
 
-		// 3) По желанию — удалить колонку users.spaces (закомментировано; раскомментируй когда будешь уверен)
-		// if _, err := pool.Exec(ctx, `ALTER TABLE users DROP COLUMN IF EXISTS spaces;`); err != nil {
-		//     return fmt.Errorf("drop users.spaces: %w", err)
-		// }
+	for _, e := range acyclicEdges(edges) {
+		if _, err := tx.Exec(ctx, `
+            INSERT INTO task_dependencies (task_id, blocker_id)
+            VALUES ($1::uuid, $2::uuid)
+            ON CONFLICT DO NOTHING
+            `, e[0], e[1]); err != nil {
+			return fmt.Errorf("migrate task dependencies: %w", err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `ALTER TABLE tasks DROP COLUMN "blockedBy"`); err != nil {
+		return fmt.Errorf("drop tasks.blockedBy: %w", err)
 	}
+	return tx.Commit(ctx)
+}
 
-	return nil
+// acyclicEdges оставляет рёбра задача -> блокер в исходном порядке, пропуская повторы и те,
+// что замкнули бы цикл с уже принятыми: блокер (транзитивно) уже зависит от задачи.
+func acyclicEdges(edges [][2]string) [][2]string {
+	blockers := make(map[string][]string)
+	reaches := func(from, to string) bool {
+		seen := map[string]bool{from: true}
+		stack := []string{from}
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if id == to {
+				return true
+			}
+			for _, next := range blockers[id] {
+				if !seen[next] {
+					seen[next] = true
+					stack = append(stack, next)
+				}
+			}
+		}
+		return false
+	}
+
+	var kept [][2]string
+	for _, e := range edges {
+		task, blocker := e[0], e[1]
+		if slices.Contains(blockers[task], blocker) {
+			continue
+		}
+		if reaches(blocker, task) {
+			log.Printf("migrate tasks.blockedBy: dropped %s -> %s, it closes a dependency cycle", task, blocker)
+			continue
+		}
+		blockers[task] = append(blockers[task], blocker)
+		kept = append(kept, e)
+	}
+	return kept
 }
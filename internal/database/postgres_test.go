@@ -0,0 +1,28 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAcyclicEdges(t *testing.T) {
+	cases := []struct {
+		name        string
+		edges, want [][2]string
+	}{
+		{name: "chain", edges: [][2]string{{"a", "b"}, {"b", "c"}}, want: [][2]string{{"a", "b"}, {"b", "c"}}},
+		{name: "duplicate", edges: [][2]string{{"a", "b"}, {"a", "b"}}, want: [][2]string{{"a", "b"}}},
+		{name: "mutual", edges: [][2]string{{"a", "b"}, {"b", "a"}}, want: [][2]string{{"a", "b"}}},
+		{name: "long cycle", edges: [][2]string{{"a", "b"}, {"b", "c"}, {"c", "a"}, {"c", "d"}},
+			want: [][2]string{{"a", "b"}, {"b", "c"}, {"c", "d"}}},
+		{name: "diamond", edges: [][2]string{{"a", "b"}, {"a", "c"}, {"b", "d"}, {"c", "d"}},
+			want: [][2]string{{"a", "b"}, {"a", "c"}, {"b", "d"}, {"c", "d"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := acyclicEdges(tc.edges); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("acyclicEdges(%v) = %v, want %v", tc.edges, got, tc.want)
+			}
+		})
+	}
+}
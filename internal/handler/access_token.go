@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// AccessTokenHandler обрабатывает персональные токены доступа.
+type AccessTokenHandler struct {
+	tokens *service.AccessTokenService
+}
+
+// NewAccessTokenHandler создаёт новый AccessTokenHandler.
+func NewAccessTokenHandler(tokens *service.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{tokens: tokens}
+}
+
+// RegisterRoutes регистрирует роуты токенов текущего пользователя.
+func (h *AccessTokenHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/tokens", h.listTokens)         // GET /tokens
+	app.Post("/tokens", h.createToken)       // POST /tokens
+	app.Delete("/tokens/:id", h.revokeToken) // DELETE /tokens/:id
+}
+
+func (h *AccessTokenHandler) listTokens(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	tokens, err := h.tokens.List(c, uid)
+	if err != nil {
+		return accessTokenError(c, err, "failed to list tokens")
+	}
+	return c.JSON(tokens)
+}
+
+// createToken — POST /tokens
+// Body: { "name": "ci", "permissions": ["task.read"], "spaceId": "<space-id>", "expiresInDays": 90 }
+// Токен возвращается только в этом ответе.
+func (h *AccessTokenHandler) createToken(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in model.AccessTokenInput
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	token, err := h.tokens.Create(c, uid, in)
+	if err != nil {
+		return accessTokenError(c, err, "failed to create token")
+	}
+	return c.Status(fiber.StatusCreated).JSON(token)
+}
+
+func (h *AccessTokenHandler) revokeToken(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.tokens.Revoke(c, uid, c.Params("id")); err != nil {
+		return accessTokenError(c, err, "failed to revoke token")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// accessTokenError переводит ошибки AccessTokenService в HTTP-ответ.
+func accessTokenError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrAccessTokenNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Token not found"})
+	case errors.Is(err, service.ErrSpaceNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Space not found"})
+	case errors.Is(err, service.ErrInvalidAccessTokenInput):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
@@ -0,0 +1,195 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"tasker/internal/handler"
+	"tasker/internal/mail"
+	"tasker/internal/middleware"
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/storage"
+	"tasker/internal/testutil"
+
+	"github.com/gofiber/fiber/v3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenFixture — пользователь в двух пространствах, по задаче в каждом, и приложение
+// с настоящим AuthMiddleware: запросы идут с персональными токенами.
+type tokenFixture struct {
+	app    *fiber.App
+	tokens *service.AccessTokenService
+	user   int
+	spaceA string
+	spaceB string
+	taskA  string
+	taskB  string
+}
+
+func newTokenFixture(t *testing.T) *tokenFixture {
+	t.Helper()
+	ctx := context.Background()
+	db := testutil.DB(t)
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spaces := service.NewSpaceService(db, blobs)
+	tasks := service.NewTaskService(db, spaces, service.NewWorkflowService(db), service.NewEventBus())
+	policy := service.NewPolicyService(db)
+
+	guard := service.NewLoginGuard(db, storage.NewMemoryAttemptStore(), service.LoginPolicy{
+		MaxFailures: 100, MaxIPFailures: 100, Lockout: time.Minute, Window: time.Minute,
+	})
+	keys, err := service.LoadKeySet(service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwordPolicy, err := service.LoadPasswordPolicy(8, bcrypt.MinCost, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoFactor := service.NewTwoFactorService(db, guard, "Tasker", time.Minute)
+	identity := service.NewIdentityService(db, keys, guard, twoFactor, passwordPolicy, time.Minute, time.Hour,
+		service.NewLocalCredentials(db, guard, passwordPolicy))
+	mailer, err := mail.NewFileMailer(t.TempDir(), "tasker@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords := service.NewPasswordService(db, passwordPolicy, guard, mailer, time.Hour, "http://tasker.test/reset")
+
+	f := &tokenFixture{tokens: service.NewAccessTokenService(db), user: testutil.User(t, db, "user")}
+	f.spaceA = testutil.Space(t, db, f.user)
+	f.spaceB = testutil.Space(t, db, f.user)
+	for _, space := range []struct {
+		id   string
+		task *string
+	}{{f.spaceA, &f.taskA}, {f.spaceB, &f.taskB}} {
+		task, err := tasks.CreateTask(ctx, model.Task{
+			Title:      "token",
+			ReporterID: strconv.Itoa(f.user),
+			ApproverID: strconv.Itoa(f.user),
+			Space:      &space.id,
+		}, f.user)
+		if err != nil {
+			t.Fatalf("create task: %v", err)
+		}
+		*space.task = task.ID
+	}
+
+	f.app = fiber.New()
+	f.app.Use(middleware.AuthMiddleware(identity, f.tokens))
+	handler.NewTaskHandler(tasks, policy).RegisterRoutes(f.app)
+	handler.NewAuthHandler(identity, nil).RegisterAccountRoutes(f.app)
+	handler.NewPasswordHandler(passwords).RegisterAccountRoutes(f.app)
+	handler.NewTwoFactorHandler(twoFactor).RegisterRoutes(f.app)
+	handler.NewAccessTokenHandler(f.tokens).RegisterRoutes(f.app)
+	return f
+}
+
+// token выпускает персональный токен пользователя фикстуры.
+func (f *tokenFixture) token(t *testing.T, spaceID string, perms ...service.Permission) string {
+	t.Helper()
+	in := model.AccessTokenInput{Name: "ci", SpaceID: spaceID}
+	for _, p := range perms {
+		in.Permissions = append(in.Permissions, string(p))
+	}
+	tok, err := f.tokens.Create(context.Background(), f.user, in)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	return tok.Token
+}
+
+func (f *tokenFixture) do(t *testing.T, token, method, path, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := f.app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAccessTokenSpaceScope(t *testing.T) {
+	f := newTokenFixture(t)
+	token := f.token(t, f.spaceA, service.PermTaskRead, service.PermTaskUpdate)
+
+	if got := f.do(t, token, http.MethodGet, "/task/by_id/"+f.taskA, ""); got != http.StatusOK {
+		t.Errorf("GET task of the token space: status %d, want 200", got)
+	}
+	// задача другого пространства для токена выглядит несуществующей, хотя пользователь там владелец
+	routes := []struct{ method, path, body string }{
+		{http.MethodGet, "/task/by_id/" + f.taskB, ""},
+		{http.MethodPut, "/update/" + f.taskB, `{"title":"x"}`},
+		{http.MethodGet, "/task/" + f.taskB + "/history", ""},
+	}
+	for _, r := range routes {
+		if got := f.do(t, token, r.method, r.path, r.body); got != http.StatusNotFound {
+			t.Errorf("space-scoped token %s %s: status %d, want 404", r.method, r.path, got)
+		}
+	}
+}
+
+func TestAccessTokenPermissionScope(t *testing.T) {
+	f := newTokenFixture(t)
+	readOnly := f.token(t, "", service.PermTaskRead)
+
+	for _, path := range []string{"/task/by_id/" + f.taskA, "/task/by_id/" + f.taskB, "/list"} {
+		if got := f.do(t, readOnly, http.MethodGet, path, ""); got != http.StatusOK {
+			t.Errorf("read-only token GET %s: status %d, want 200", path, got)
+		}
+	}
+	// права владельца пространства не расширяют права токена
+	routes := []struct{ method, path, body string }{
+		{http.MethodPut, "/update/" + f.taskA, `{"title":"x"}`},
+		{http.MethodPut, "/done/" + f.taskA, ""},
+		{http.MethodDelete, "/delete/" + f.taskA, ""},
+	}
+	for _, r := range routes {
+		if got := f.do(t, readOnly, r.method, r.path, r.body); got != http.StatusForbidden {
+			t.Errorf("read-only token %s %s: status %d, want 403", r.method, r.path, got)
+		}
+	}
+
+	noRead := f.token(t, f.spaceA, service.PermCommentCreate)
+	if got := f.do(t, noRead, http.MethodGet, "/list", ""); got != http.StatusForbidden {
+		t.Errorf("token without task.read GET /list: status %d, want 403", got)
+	}
+}
+
+func TestAccessTokenInteractiveOnly(t *testing.T) {
+	f := newTokenFixture(t)
+	// даже токен с широкими правами не управляет сессиями, паролем, 2FA и токенами
+	token := f.token(t, "", service.PermTaskRead, service.PermTaskCreate, service.PermTaskUpdate,
+		service.PermTaskDelete, service.PermSpaceManage, service.PermSpaceInvite)
+
+	routes := []struct{ method, path, body string }{
+		{http.MethodGet, "/sessions", ""},
+		{http.MethodDelete, "/sessions", ""},
+		{http.MethodPut, "/api/password", `{"currentPassword":"correct-horse-battery","newPassword":"another-horse-battery"}`},
+		{http.MethodGet, "/api/2fa", ""},
+		{http.MethodPost, "/api/2fa/enroll", ""},
+		{http.MethodPost, "/api/2fa/recovery-codes", `{"code":"123456"}`},
+		{http.MethodGet, "/tokens", ""},
+		{http.MethodPost, "/tokens", `{"name":"nested","permissions":["task.read"]}`},
+	}
+	for _, r := range routes {
+		if got := f.do(t, token, r.method, r.path, r.body); got != http.StatusForbidden {
+			t.Errorf("access token %s %s: status %d, want 403", r.method, r.path, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/middleware"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// ApprovalHandler обрабатывает одобрение задач.
+type ApprovalHandler struct {
+	approvals *service.ApprovalService
+	policy    *service.PolicyService
+}
+
+// NewApprovalHandler создаёт новый ApprovalHandler.
+func NewApprovalHandler(approvals *service.ApprovalService, policy *service.PolicyService) *ApprovalHandler {
+	return &ApprovalHandler{approvals: approvals, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты одобрения.
+func (h *ApprovalHandler) RegisterRoutes(app *fiber.App) {
+	read := middleware.TaskAccess(h.policy, service.PermTaskRead)
+	update := middleware.TaskAccess(h.policy, service.PermTaskUpdate)
+	approve := middleware.TaskAccess(h.policy, service.PermTaskApprove)
+
+	app.Get("/task/:id/approvals", read, h.getState)                                                               // GET /task/:id/approvals
+	app.Put("/task/:id/approvers", update, h.setApprovers)                                                         // PUT /task/:id/approvers
+	app.Post("/task/:id/request-approval", update, h.requestApproval)                                              // POST /task/:id/request-approval
+	app.Post("/task/:id/approve", approve, h.approve)                                                              // POST /task/:id/approve
+	app.Post("/task/:id/reject", approve, h.reject)                                                                // POST /task/:id/reject
+	app.Get("/spaces/:id/approval-policy", middleware.SpaceAccess(h.policy, service.PermTaskRead), h.getPolicy)    // GET /spaces/:id/approval-policy
+	app.Put("/spaces/:id/approval-policy", middleware.SpaceAccess(h.policy, service.PermSpaceManage), h.setPolicy) // PUT /spaces/:id/approval-policy
+}
+
+func (h *ApprovalHandler) getState(c fiber.Ctx) error {
+	state, err := h.approvals.GetState(c, c.Params("id"))
+	if err != nil {
+		return approvalError(c, err)
+	}
+	return c.JSON(state)
+}
+
+// setApprovers — PUT /task/:id/approvers
+// Body: { "approverIds": ["2", "3"] } — дополнительные согласующие к approverId задачи.
+func (h *ApprovalHandler) setApprovers(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		ApproverIDs []string `json:"approverIds"`
+	}
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	state, err := h.approvals.SetApprovers(c, c.Params("id"), uid, in.ApproverIDs)
+	if err != nil {
+		return approvalError(c, err)
+	}
+	return c.JSON(state)
+}
+
+func (h *ApprovalHandler) requestApproval(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	state, err := h.approvals.RequestApproval(c, c.Params("id"), uid)
+	if err != nil {
+		return approvalError(c, err)
+	}
+	return c.JSON(state)
+}
+
+// approve — POST /task/:id/approve
+// Body (необязательно): { "comment": "ok" }
+func (h *ApprovalHandler) approve(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		Comment string `json:"comment"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.Bind().JSON(&in); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+	}
+
+	state, err := h.approvals.Approve(c, c.Params("id"), uid, in.Comment)
+	if err != nil {
+		return approvalError(c, err)
+	}
+	return c.JSON(state)
+}
+
+// reject — POST /task/:id/reject
+// Body: { "comment": "причина" } — комментарий обязателен.
+func (h *ApprovalHandler) reject(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		Comment string `json:"comment"`
+	}
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	state, err := h.approvals.Reject(c, c.Params("id"), uid, in.Comment)
+	if err != nil {
+		return approvalError(c, err)
+	}
+	return c.JSON(state)
+}
+
+func (h *ApprovalHandler) getPolicy(c fiber.Ctx) error {
+	policy, err := h.approvals.GetPolicy(c, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load approval policy"})
+	}
+	return c.JSON(policy)
+}
+
+// setPolicy — PUT /spaces/:id/approval-policy
+// Body: { "mode": "quorum", "quorum": 2, "rejectStatus": "in-progress" }
+// Нужно право space.manage.
+func (h *ApprovalHandler) setPolicy(c fiber.Ctx) error {
+	spaceID := c.Params("id")
+	var in model.ApprovalPolicy
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	policy, err := h.approvals.SetPolicy(c, spaceID, in)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidApprovalPolicy) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save approval policy"})
+	}
+	return c.JSON(policy)
+}
+
+// approvalError переводит ошибки ApprovalService в HTTP-ответ.
+func approvalError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	case errors.Is(err, service.ErrNotApprover), errors.Is(err, service.ErrForbidden), errors.Is(err, service.ErrSelfApproval):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrApprovalNotPending), errors.Is(err, service.ErrAlreadyDecided):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrCommentRequired), errors.Is(err, service.ErrInvalidApprovalPolicy):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "approval failed"})
+}
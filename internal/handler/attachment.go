@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"tasker/internal/middleware"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// AttachmentHandler обрабатывает файлы, прикреплённые к задачам.
+type AttachmentHandler struct {
+	attachments *service.AttachmentService
+	policy      *service.PolicyService
+}
+
+// NewAttachmentHandler создаёт новый AttachmentHandler.
+func NewAttachmentHandler(attachments *service.AttachmentService, policy *service.PolicyService) *AttachmentHandler {
+	return &AttachmentHandler{attachments: attachments, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты вложений.
+func (h *AttachmentHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/task/:id/attachments", middleware.TaskAccess(h.policy, service.PermTaskRead), h.listAttachments)              // GET /task/:id/attachments
+	app.Post("/task/:id/attachments", middleware.TaskAccess(h.policy, service.PermAttachmentUpload), h.uploadAttachment)    // POST /task/:id/attachments
+	app.Get("/attachments/:id", middleware.AttachmentAccess(h.policy, service.PermTaskRead), h.downloadAttachment)          // GET /attachments/:id
+	app.Delete("/attachments/:id", middleware.AttachmentAccess(h.policy, service.PermAttachmentUpload), h.deleteAttachment) // DELETE /attachments/:id
+	app.Get("/spaces/:id/attachments/usage", middleware.SpaceAccess(h.policy, service.PermTaskRead), h.usage)               // GET /spaces/:id/attachments/usage
+	app.Put("/spaces/:id/attachments/quota", middleware.SpaceAccess(h.policy, service.PermSpaceManage), h.setQuota)         // PUT /spaces/:id/attachments/quota
+}
+
+func (h *AttachmentHandler) listAttachments(c fiber.Ctx) error {
+	attachments, err := h.attachments.ListAttachments(c, c.Params("id"))
+	if err != nil {
+		return attachmentError(c, err, "failed to list attachments")
+	}
+	return c.JSON(attachments)
+}
+
+// uploadAttachment — POST /task/:id/attachments
+// multipart/form-data с полем "file". Тип файла определяется по содержимому.
+func (h *AttachmentHandler) uploadAttachment(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "failed to read file"})
+	}
+	defer f.Close()
+
+	attachment, err := h.attachments.Upload(c, c.Params("id"), uid, fh.Filename, fh.Size, f)
+	if err != nil {
+		return attachmentError(c, err, "failed to upload attachment")
+	}
+	return c.Status(fiber.StatusCreated).JSON(attachment)
+}
+
+// downloadAttachment — GET /attachments/:id
+// Отдаёт содержимое файла потоком с исходным именем.
+func (h *AttachmentHandler) downloadAttachment(c fiber.Ctx) error {
+	attachment, body, err := h.attachments.Open(c, c.Params("id"))
+	if err != nil {
+		return attachmentError(c, err, "failed to download attachment")
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	c.Set("X-Content-Type-Options", "nosniff")
+	// body закрывается fasthttp после отправки
+	return c.SendStream(body, int(attachment.Size))
+}
+
+func (h *AttachmentHandler) deleteAttachment(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.attachments.DeleteAttachment(c, c.Params("id"), uid); err != nil {
+		return attachmentError(c, err, "failed to delete attachment")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *AttachmentHandler) usage(c fiber.Ctx) error {
+	usage, err := h.attachments.Usage(c, c.Params("id"))
+	if err != nil {
+		return attachmentError(c, err, "failed to load attachment usage")
+	}
+	return c.JSON(usage)
+}
+
+// setQuota — PUT /spaces/:id/attachments/quota
+// Body: { "quotaBytes": 1073741824 } — null возвращает квоту по умолчанию.
+// Нужно право space.manage.
+func (h *AttachmentHandler) setQuota(c fiber.Ctx) error {
+	spaceID := c.Params("id")
+	var in struct {
+		QuotaBytes *int64 `json:"quotaBytes"`
+	}
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	usage, err := h.attachments.SetQuota(c, spaceID, in.QuotaBytes)
+	if err != nil {
+		return attachmentError(c, err, "failed to set attachment quota")
+	}
+	return c.JSON(usage)
+}
+
+// attachmentError переводит ошибки AttachmentService в HTTP-ответ.
+func attachmentError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	case errors.Is(err, service.ErrAttachmentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	case errors.Is(err, service.ErrSpaceNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Space not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	case errors.Is(err, service.ErrAttachmentTooLarge), errors.Is(err, service.ErrQuotaExceeded):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentType):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAttachment):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
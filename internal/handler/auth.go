@@ -1,25 +1,85 @@
 package handler
 
 import (
+	"cmp"
+	"errors"
+	"log/slog"
+	"math"
+	"strconv"
+	"tasker/internal/middleware"
 	"tasker/internal/model"
 	"tasker/internal/service"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 )
 
 type AuthHandler struct {
-	service *service.AuthService
+	service *service.IdentityService
+	emails  *service.EmailVerificationService
 }
 
-func NewAuthHandler(service *service.AuthService) *AuthHandler {
-	return &AuthHandler{service: service}
+// NewAuthHandler: emails отправляет зарегистрировавшемуся письмо для подтверждения email.
+func NewAuthHandler(service *service.IdentityService, emails *service.EmailVerificationService) *AuthHandler {
+	return &AuthHandler{service: service, emails: emails}
 }
 
 func (h *AuthHandler) RegisterRoutes(app *fiber.App) {
 	app.Post("/api/register", h.registerHandler)
 	app.Post("/api/login", h.loginHandler)
+	app.Post("/api/login/2fa", h.twoFactorLoginHandler)
 	app.Get("/api/validate", h.validateTokenHandler)
 	app.Post("/api/logout", h.logoutHandler)
+	app.Post("/api/refresh", h.refreshHandler)
+	app.Get("/.well-known/jwks.json", h.jwks)
+}
+
+// RegisterAccountRoutes регистрирует роуты сессий текущего пользователя; вызывается после AuthMiddleware.
+func (h *AuthHandler) RegisterAccountRoutes(app *fiber.App) {
+	app.Get("/sessions", h.listSessions)         // GET /sessions
+	app.Delete("/sessions", h.revokeAllSessions) // DELETE /sessions — все, кроме текущей
+	app.Delete("/sessions/:id", h.revokeSession) // DELETE /sessions/:id
+}
+
+const refreshCookie = "refresh_token"
+
+// clientInfo собирает сведения о клиенте для сессии.
+func clientInfo(c fiber.Ctx, device string) model.ClientInfo {
+	return model.ClientInfo{Device: device, IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+}
+
+// setAuthCookies кладёт access-токен в api_token, а refresh-токен — в httpOnly-cookie,
+// которая уходит только на /api (refresh и logout).
+func setAuthCookies(c fiber.Ctx, pair *model.TokenPair) {
+	c.Cookie(&fiber.Cookie{
+		Expires:  pair.ExpiresAt,
+		Name:     "api_token",
+		Value:    pair.AccessToken,
+		Path:     "/",
+		Domain:   "localhost",
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Secure:   false,
+		HTTPOnly: false,
+	})
+	c.Cookie(&fiber.Cookie{
+		Expires:  pair.RefreshExpiresAt,
+		Name:     refreshCookie,
+		Value:    pair.RefreshToken,
+		Path:     "/api",
+		Domain:   "localhost",
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Secure:   false,
+		HTTPOnly: true,
+	})
+}
+
+// Deprecated помечает устаревший роут заголовками Deprecation и Link на замену.
+func Deprecated(successor string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		c.Set("Deprecation", "true")
+		c.Set(fiber.HeaderLink, "<"+successor+`>; rel="successor-version"`)
+		return c.Next()
+	}
 }
 
 // Все хендлеры принимают fiber.Ctx (интерфейс), который реализует context.Context
@@ -33,9 +93,27 @@ func (h *AuthHandler) registerHandler(c fiber.Ctx) error {
 	// Передаём сам Ctx как context.Context
 	user, err := h.service.Register(c, req)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmail), errors.Is(err, service.ErrInvalidPassword):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrLoginTaken), errors.Is(err, service.ErrEmailTaken):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrPasswordLoginDisabled):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrInvitationNotFound), errors.Is(err, service.ErrInvitationClosed),
+			errors.Is(err, service.ErrSpaceArchived):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid invitation: " + err.Error()})
+		}
+		slog.Error("Registration failed", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Registration failed"})
 	}
 
+	// пользователь уже создан: без письма он запросит подтверждение позже сам
+	if user.Email != nil {
+		if err := h.emails.RequestVerification(c, user.ID); err != nil {
+			slog.Error("Failed to request email verification", "userID", user.ID, "error", err)
+		}
+	}
 	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
@@ -45,23 +123,116 @@ func (h *AuthHandler) loginHandler(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
+	provider := cmp.Or(req.Provider, service.ProviderLocal)
+	if provider == service.ProviderOIDC {
+		// вход через OIDC начинается редиректом на провайдера
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Use GET /api/oidc/login for single sign-on"})
+	}
+
 	// Передаём Ctx напрямую
-	token, _, exp, err := h.service.Login(c, req.Login, req.Password)
+	cred := service.Credentials{Login: req.Login, Password: req.Password}
+	res, err := h.service.Login(c, provider, cred, clientInfo(c, req.Device))
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return loginError(c, err)
 	}
-	c.Cookie(&fiber.Cookie{
-		Expires:  exp,
-		Name:     "api_token",
-		Value:    token,
-		Path:     "/",
-		Domain:   "localhost",
-		SameSite: fiber.CookieSameSiteLaxMode,
-		Secure:   false,
-		HTTPOnly: false,
+	return h.loginResponse(c, res)
+}
+
+// twoFactorLoginHandler — POST /api/login/2fa
+// Body: { "challengeToken": "...", "code": "123456" } — code может быть кодом восстановления.
+func (h *AuthHandler) twoFactorLoginHandler(c fiber.Ctx) error {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		Device         string `json:"device"`
+	}
+	if err := c.Bind().Body(&req); err != nil || req.ChallengeToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request, challengeToken required"})
+	}
+
+	res, err := h.service.LoginTwoFactor(c, req.ChallengeToken, req.Code, clientInfo(c, req.Device))
+	if err != nil {
+		return loginError(c, err)
+	}
+	return h.loginResponse(c, res)
+}
+
+// loginResponse отдаёт сессию (и ставит cookie) или, если нужен второй шаг, challenge-токен.
+func (h *AuthHandler) loginResponse(c fiber.Ctx, res *model.LoginResult) error {
+	if res.Challenge != nil {
+		return c.JSON(fiber.Map{
+			"twoFactorRequired": true,
+			"challengeToken":    res.Challenge.Token,
+			"expiresAt":         res.Challenge.ExpiresAt,
+		})
+	}
+
+	pair := res.Tokens
+	setAuthCookies(c, pair)
+	return c.JSON(fiber.Map{
+		"token":            pair.AccessToken,
+		"expiresAt":        pair.ExpiresAt,
+		"refreshToken":     pair.RefreshToken,
+		"refreshExpiresAt": pair.RefreshExpiresAt,
+		"sessionId":        pair.SessionID,
+		"user":             res.User,
 	})
+}
 
-	return c.SendStatus(200)
+// refreshHandler — POST /api/refresh
+// Body: { "refreshToken": "..." } — либо refresh-токен из cookie.
+func (h *AuthHandler) refreshHandler(c fiber.Ctx) error {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+		}
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(refreshCookie)
+	}
+
+	pair, err := h.service.Refresh(c, req.RefreshToken, clientInfo(c, ""))
+	if err != nil {
+		return sessionError(c, err, "Failed to refresh token")
+	}
+	setAuthCookies(c, pair)
+	return c.JSON(pair)
+}
+
+// jwks — GET /.well-known/jwks.json: открытые ключи, которыми другие сервисы проверяют наши JWT.
+func (h *AuthHandler) jwks(c fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.service.JWKS())
+}
+
+// loginError переводит ошибки входа в HTTP-ответ; при блокировке клиент получает Retry-After.
+func loginError(c fiber.Ctx, err error) error {
+	var blocked *service.LoginBlockedError
+	switch {
+	case errors.As(err, &blocked):
+		retry := int(math.Ceil(time.Until(blocked.Until).Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(retry, 1)))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many failed login attempts", "retryAfter": blocked.Until})
+	case errors.Is(err, service.ErrInvalidCredentials):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+	case errors.Is(err, service.ErrUnknownProvider):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrPasswordLoginDisabled), errors.Is(err, service.ErrAccountDisabled),
+		errors.Is(err, service.ErrLDAPAccessDenied):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTwoFactorCode), errors.Is(err, service.ErrInvalidLoginChallenge):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrLoginTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrLDAPUnavailable):
+		slog.Error("LDAP login failed", "error", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "directory is unavailable"})
+	}
+	slog.Error("Login failed", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
 }
 
 func (h *AuthHandler) validateTokenHandler(c fiber.Ctx) error {
@@ -70,7 +241,7 @@ func (h *AuthHandler) validateTokenHandler(c fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Token is required"})
 	}
 
-	claims, err := h.service.ValidateToken(token)
+	claims, err := h.service.Authenticate(c, token)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
 	}
@@ -99,23 +270,96 @@ func (h *AuthHandler) GetUserHandler(c fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// logoutHandler отзывает текущую сессию (по refresh-токену или access-токену) и удаляет cookie.
 func (h *AuthHandler) logoutHandler(c fiber.Ctx) error {
-	// 1) Если у тебя будет ревокация refresh-токенов, тут можно вызвать сервис, который пометит token как revoked.
-	// token := c.Cookies("api_token")
-	// _ = h.service.RevokeToken(c.Context(), token) // опционально
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if len(c.Body()) > 0 {
+		_ = c.Bind().Body(&req)
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(refreshCookie)
+	}
+	if err := h.service.Logout(c, middleware.RequestToken(c), req.RefreshToken); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Logout failed"})
+	}
 
-	// 2) Явно удалить cookie: выставляем ту же cookie с MaxAge=-1 и пустым значением
-	c.Cookie(&fiber.Cookie{
-		Name:     "api_token",
-		Value:    "",
-		Path:     "/",
-		Domain:   "localhost", // совпадает с тем, что был установлен
-		MaxAge:   -1,
-		HTTPOnly: true,
-		Secure:   false, // тот же флаг что и в loginHandler
-		SameSite: "Lax",
-	})
+	// Явно удалить cookie: выставляем те же cookie с MaxAge=-1 и пустым значением
+	for _, ck := range []struct{ name, path string }{{"api_token", "/"}, {refreshCookie, "/api"}} {
+		c.Cookie(&fiber.Cookie{
+			Name:     ck.name,
+			Value:    "",
+			Path:     ck.path,
+			Domain:   "localhost", // совпадает с тем, что был установлен
+			MaxAge:   -1,
+			HTTPOnly: true,
+			Secure:   false, // тот же флаг что и в loginHandler
+			SameSite: "Lax",
+		})
+	}
 
 	// В качестве удобства — вернуть JSON о результате
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{"ok": true})
 }
+
+// currentSessionID — id сессии текущего access-токена (кладёт AuthMiddleware).
+func currentSessionID(c fiber.Ctx) string {
+	sid, _ := c.Locals("sessionID").(string)
+	return sid
+}
+
+// listSessions — GET /sessions
+func (h *AuthHandler) listSessions(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	sessions, err := h.service.ListSessions(c, uid, currentSessionID(c))
+	if err != nil {
+		return sessionError(c, err, "failed to list sessions")
+	}
+	return c.JSON(sessions)
+}
+
+// revokeSession — DELETE /sessions/:id
+func (h *AuthHandler) revokeSession(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.service.RevokeSession(c, uid, c.Params("id")); err != nil {
+		return sessionError(c, err, "failed to revoke session")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// revokeAllSessions — DELETE /sessions: выйти на всех устройствах, кроме текущего.
+func (h *AuthHandler) revokeAllSessions(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	n, err := h.service.RevokeAllSessions(c, uid, currentSessionID(c), service.RevokeByUser)
+	if err != nil {
+		return sessionError(c, err, "failed to revoke sessions")
+	}
+	return c.JSON(fiber.Map{"revoked": n})
+}
+
+// sessionError переводит ошибки сессий в HTTP-ответ.
+func sessionError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrRefreshTokenReused),
+		errors.Is(err, service.ErrSessionRevoked):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrSessionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/middleware"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// CommentHandler обрабатывает комментарии к задачам.
+type CommentHandler struct {
+	comments *service.CommentService
+	policy   *service.PolicyService
+}
+
+// NewCommentHandler создаёт новый CommentHandler.
+func NewCommentHandler(comments *service.CommentService, policy *service.PolicyService) *CommentHandler {
+	return &CommentHandler{comments: comments, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты комментариев.
+func (h *CommentHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/task/:id/comments", middleware.TaskAccess(h.policy, service.PermTaskRead), h.listComments)        // GET /task/:id/comments
+	app.Post("/task/:id/comments", middleware.TaskAccess(h.policy, service.PermCommentCreate), h.createComment) // POST /task/:id/comments
+	app.Put("/comments/:id", middleware.CommentAccess(h.policy, service.PermCommentCreate), h.editComment)      // PUT /comments/:id
+	app.Delete("/comments/:id", middleware.CommentAccess(h.policy, service.PermCommentCreate), h.deleteComment) // DELETE /comments/:id
+	app.Get("/comments/:id/history", middleware.CommentAccess(h.policy, service.PermTaskRead), h.editHistory)   // GET /comments/:id/history
+	app.Get("/users/me/mentions", h.myMentions)                                                                 // GET /users/me/mentions
+}
+
+func (h *CommentHandler) listComments(c fiber.Ctx) error {
+	comments, err := h.comments.ListComments(c, c.Params("id"))
+	if err != nil {
+		return commentError(c, err, "failed to list comments")
+	}
+	return c.JSON(comments)
+}
+
+// createComment — POST /task/:id/comments
+// Body: { "body": "@ivanov посмотри", "parentId": "<comment-id>" } — parentId только для ответа.
+func (h *CommentHandler) createComment(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		Body     string  `json:"body"`
+		ParentID *string `json:"parentId"`
+	}
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	comment, err := h.comments.CreateComment(c, c.Params("id"), uid, in.ParentID, in.Body)
+	if err != nil {
+		return commentError(c, err, "failed to create comment")
+	}
+	return c.Status(fiber.StatusCreated).JSON(comment)
+}
+
+// editComment — PUT /comments/:id
+// Body: { "body": "новый текст" }
+func (h *CommentHandler) editComment(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		Body string `json:"body"`
+	}
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	comment, err := h.comments.EditComment(c, c.Params("id"), uid, in.Body)
+	if err != nil {
+		return commentError(c, err, "failed to edit comment")
+	}
+	return c.JSON(comment)
+}
+
+func (h *CommentHandler) deleteComment(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.comments.DeleteComment(c, c.Params("id"), uid); err != nil {
+		return commentError(c, err, "failed to delete comment")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *CommentHandler) editHistory(c fiber.Ctx) error {
+	edits, err := h.comments.EditHistory(c, c.Params("id"))
+	if err != nil {
+		return commentError(c, err, "failed to load comment history")
+	}
+	return c.JSON(edits)
+}
+
+// myMentions — GET /users/me/mentions
+// Комментарии, где упомянут текущий пользователь, с задачами, от новых к старым.
+func (h *CommentHandler) myMentions(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	mentions, err := h.comments.MentionsOf(c, uid)
+	if err != nil {
+		return commentError(c, err, "failed to list mentions")
+	}
+	return c.JSON(mentions)
+}
+
+// commentError переводит ошибки CommentService в HTTP-ответ.
+func commentError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	case errors.Is(err, service.ErrCommentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	case errors.Is(err, service.ErrInvalidComment):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
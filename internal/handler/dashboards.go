@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"tasker/internal/middleware"
 	"tasker/internal/model"
 	"tasker/internal/service"
 
@@ -9,16 +10,17 @@ import (
 
 type DashboardsHandler struct {
 	service *service.DashboardService
+	policy  *service.PolicyService
 }
 
-func NewDashboardsHandler(service *service.DashboardService) *DashboardsHandler {
-	return &DashboardsHandler{service: service}
+func NewDashboardsHandler(service *service.DashboardService, policy *service.PolicyService) *DashboardsHandler {
+	return &DashboardsHandler{service: service, policy: policy}
 }
 
 func (h *DashboardsHandler) RegisterRoutes(app *fiber.App) {
 	app.Get("/ShowDB", h.listDashboards)
 	app.Get("/GetDBbyId/:id", h.GetDashboardById)
-	app.Post("/CreateDB", h.CreateDB)
+	app.Post("/CreateDB", middleware.RequirePermission(h.policy, service.PermDashboardManage), h.CreateDB)
 }
 func (h *DashboardsHandler) listDashboards(c fiber.Ctx) error {
 	dashboards, err := h.service.ListDashboards(c)
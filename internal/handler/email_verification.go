@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// EmailVerificationHandler обрабатывает подтверждение email.
+type EmailVerificationHandler struct {
+	service *service.EmailVerificationService
+}
+
+// NewEmailVerificationHandler создаёт новый EmailVerificationHandler.
+func NewEmailVerificationHandler(service *service.EmailVerificationService) *EmailVerificationHandler {
+	return &EmailVerificationHandler{service: service}
+}
+
+// RegisterRoutes регистрирует публичный роут подтверждения по токену; вызывается до AuthMiddleware.
+func (h *EmailVerificationHandler) RegisterRoutes(app *fiber.App) {
+	app.Post("/api/email/verify", h.verify) // POST /api/email/verify
+}
+
+// RegisterAccountRoutes регистрирует запрос письма текущим пользователем; вызывается после AuthMiddleware.
+func (h *EmailVerificationHandler) RegisterAccountRoutes(app *fiber.App) {
+	app.Post("/users/me/email/verify", h.request) // POST /users/me/email/verify
+}
+
+// request — POST /users/me/email/verify
+// Отправляет на email текущего пользователя ссылку подтверждения; ответ 202.
+func (h *EmailVerificationHandler) request(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	if err := h.service.RequestVerification(c, uid); err != nil {
+		return emailVerificationError(c, err, "failed to request email verification")
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// verify — POST /api/email/verify
+// Body: { "token": "..." } — токен из письма.
+func (h *EmailVerificationHandler) verify(c fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.Bind().Body(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request, token required"})
+	}
+	if err := h.service.VerifyEmail(c, req.Token); err != nil {
+		return emailVerificationError(c, err, "failed to verify email")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// emailVerificationError переводит ошибки подтверждения email в HTTP-ответ.
+func emailVerificationError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidVerificationToken), errors.Is(err, service.ErrNoEmail):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
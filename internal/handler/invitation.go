@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// InvitationHandler обрабатывает приглашения в пространства.
+type InvitationHandler struct {
+	invitations *service.InvitationService
+}
+
+// NewInvitationHandler создаёт новый InvitationHandler.
+func NewInvitationHandler(invitations *service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{invitations: invitations}
+}
+
+// RegisterRoutes регистрирует роуты приглашений. Права проверяет InvitationService.
+func (h *InvitationHandler) RegisterRoutes(app *fiber.App) {
+	app.Post("/spaces/:id/invite", h.invite)           // POST /spaces/:id/invite
+	app.Post("/spaces/:id/invite-links", h.createLink) // POST /spaces/:id/invite-links
+	app.Get("/spaces/:id/invitations", h.listForSpace) // GET /spaces/:id/invitations?status=all
+	app.Get("/invitations", h.listMine)                // GET /invitations
+	app.Post("/invitations/join", h.join)              // POST /invitations/join
+	app.Post("/invitations/:id/accept", h.accept)      // POST /invitations/:id/accept
+	app.Post("/invitations/:id/decline", h.decline)    // POST /invitations/:id/decline
+	app.Delete("/invitations/:id", h.revoke)           // DELETE /invitations/:id
+}
+
+// invite — POST /spaces/:id/invite
+// Body: { "login": "petrov", "role": "member", "expiresInHours": 72 } — вместо login можно userId или email.
+func (h *InvitationHandler) invite(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in model.InvitationInput
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	inv, err := h.invitations.Invite(c, c.Params("id"), uid, in)
+	if err != nil {
+		return invitationError(c, err, "failed to create invitation")
+	}
+	return c.Status(fiber.StatusCreated).JSON(inv)
+}
+
+// createLink — POST /spaces/:id/invite-links
+// Body: { "role": "viewer", "maxUses": 1, "expiresInHours": 24 } — maxUses 0 — без ограничения.
+func (h *InvitationHandler) createLink(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in model.InvitationInput
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	inv, err := h.invitations.CreateLink(c, c.Params("id"), uid, in)
+	if err != nil {
+		return invitationError(c, err, "failed to create invitation link")
+	}
+	return c.Status(fiber.StatusCreated).JSON(inv)
+}
+
+func (h *InvitationHandler) listForSpace(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	list, err := h.invitations.ListSpaceInvitations(c, c.Params("id"), uid, c.Query("status"))
+	if err != nil {
+		return invitationError(c, err, "failed to list invitations")
+	}
+	return c.JSON(list)
+}
+
+func (h *InvitationHandler) listMine(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	list, err := h.invitations.ListMine(c, uid)
+	if err != nil {
+		return invitationError(c, err, "failed to list invitations")
+	}
+	return c.JSON(list)
+}
+
+// join — POST /invitations/join
+// Body: { "token": "..." }
+func (h *InvitationHandler) join(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		Token string `json:"token"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, token required"})
+	}
+
+	inv, err := h.invitations.Join(c, in.Token, uid)
+	if err != nil {
+		return invitationError(c, err, "failed to join space")
+	}
+	return c.JSON(inv)
+}
+
+func (h *InvitationHandler) accept(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	inv, err := h.invitations.Accept(c, c.Params("id"), uid)
+	if err != nil {
+		return invitationError(c, err, "failed to accept invitation")
+	}
+	return c.JSON(inv)
+}
+
+func (h *InvitationHandler) decline(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	inv, err := h.invitations.Decline(c, c.Params("id"), uid)
+	if err != nil {
+		return invitationError(c, err, "failed to decline invitation")
+	}
+	return c.JSON(inv)
+}
+
+func (h *InvitationHandler) revoke(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.invitations.Revoke(c, c.Params("id"), uid); err != nil {
+		return invitationError(c, err, "failed to revoke invitation")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// invitationError переводит ошибки InvitationService в HTTP-ответ.
+func invitationError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrInvitationNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Invitation not found"})
+	case errors.Is(err, service.ErrInvitationClosed), errors.Is(err, service.ErrAlreadyMember):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidInvitation), errors.Is(err, service.ErrInvalidEmail):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return spaceError(c, err, fallback)
+}
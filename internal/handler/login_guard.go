@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"tasker/internal/middleware"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// LoginGuardHandler — журнал входов и разблокировка учётных записей для администраторов.
+type LoginGuardHandler struct {
+	guard  *service.LoginGuard
+	policy *service.PolicyService
+}
+
+// NewLoginGuardHandler создаёт новый LoginGuardHandler.
+func NewLoginGuardHandler(guard *service.LoginGuard, policy *service.PolicyService) *LoginGuardHandler {
+	return &LoginGuardHandler{guard: guard, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты; все требуют права user.manage.
+func (h *LoginGuardHandler) RegisterRoutes(app *fiber.App) {
+	manage := middleware.RequirePermission(h.policy, service.PermUserManage)
+
+	app.Get("/auth/events", manage, h.listEvents)   // GET /auth/events?login=ivanov&event=login_failed&limit=100
+	app.Post("/users/:id/unlock", manage, h.unlock) // POST /users/:id/unlock
+}
+
+func (h *LoginGuardHandler) listEvents(c fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := h.guard.ListEvents(c, c.Query("login"), c.Query("event"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to list auth events"})
+	}
+	return c.JSON(events)
+}
+
+func (h *LoginGuardHandler) unlock(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+
+	if err := h.guard.Unlock(c, uid, id); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to unlock user"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/url"
+	"tasker/internal/service"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// oidcStateCookie привязывает state к браузеру, который начал вход: чужой state из ссылки
+// не подойдёт, и злоумышленник не сможет войти жертвой в свою учётную запись.
+const oidcStateCookie = "oidc_state"
+
+// OIDCHandler обрабатывает вход через OpenID Connect. oidc — nil, если SSO не настроен.
+type OIDCHandler struct {
+	oidc     *service.OIDCService
+	identity *service.IdentityService
+	guard    *service.LoginGuard
+	stateTTL time.Duration
+}
+
+// NewOIDCHandler создаёт новый OIDCHandler.
+func NewOIDCHandler(oidc *service.OIDCService, identity *service.IdentityService, guard *service.LoginGuard, stateTTL time.Duration) *OIDCHandler {
+	return &OIDCHandler{oidc: oidc, identity: identity, guard: guard, stateTTL: stateTTL}
+}
+
+// RegisterRoutes регистрирует публичные роуты входа; вызывается до AuthMiddleware.
+func (h *OIDCHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/auth/methods", h.methods) // GET /api/auth/methods
+	if h.oidc == nil {
+		return
+	}
+	app.Get("/api/oidc/login", h.login)       // GET /api/oidc/login?redirect=/path
+	app.Get("/api/oidc/callback", h.callback) // GET /api/oidc/callback — сюда возвращает провайдер
+}
+
+// methods — GET /api/auth/methods: какие способы входа показывать на странице входа.
+func (h *OIDCHandler) methods(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"password": h.guard.PasswordAllowed() == nil,
+		"oidc":     h.identity.HasProvider(service.ProviderOIDC),
+		"ldap":     h.identity.HasProvider(service.ProviderLDAP),
+	})
+}
+
+// login перенаправляет браузер на страницу входа провайдера.
+func (h *OIDCHandler) login(c fiber.Ctx) error {
+	target, state, err := h.oidc.AuthURL(c, c.Query("redirect"))
+	if err != nil {
+		return oidcError(c, err)
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oidc",
+		Expires:  time.Now().Add(h.stateTTL),
+		SameSite: fiber.CookieSameSiteLaxMode,
+		HTTPOnly: true,
+	})
+	return c.Redirect().Status(fiber.StatusFound).To(target)
+}
+
+// callback завершает вход: ставит cookie сессии и возвращает браузер на фронтенд. Если у
+// пользователя включена 2FA, challenge-токен передаётся во фрагменте адреса (#challengeToken=…),
+// дальше фронтенд вызывает POST /api/login/2fa.
+func (h *OIDCHandler) callback(c fiber.Ctx) error {
+	state := c.Query("state")
+	cookieState := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{Name: oidcStateCookie, Path: "/api/oidc", Expires: time.Unix(0, 0), HTTPOnly: true})
+
+	if e := c.Query("error"); e != "" {
+		slog.Warn("OIDC provider returned error", "error", e, "description", c.Query("error_description"))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Single sign-on failed: " + e})
+	}
+	if state == "" || c.Query("code") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request, code and state required"})
+	}
+	if state != cookieState {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": service.ErrInvalidOIDCState.Error()})
+	}
+
+	cred := service.Credentials{Code: c.Query("code"), State: state}
+	res, err := h.identity.Login(c, service.ProviderOIDC, cred, clientInfo(c, ""))
+	if err != nil {
+		return oidcError(c, err)
+	}
+	redirect := res.Redirect
+	if res.Challenge != nil {
+		fragment := url.Values{
+			"challengeToken": {res.Challenge.Token},
+			"expiresAt":      {res.Challenge.ExpiresAt.Format(time.RFC3339)},
+		}
+		return c.Redirect().Status(fiber.StatusFound).To(redirect + "#" + fragment.Encode())
+	}
+	setAuthCookies(c, res.Tokens)
+	return c.Redirect().Status(fiber.StatusFound).To(redirect)
+}
+
+// oidcError переводит ошибки SSO в HTTP-ответ.
+func oidcError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrSSOUserNotFound), errors.Is(err, service.ErrAccountDisabled):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrOIDCFailed):
+		slog.Warn("OIDC login failed", "error", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": service.ErrOIDCFailed.Error()})
+	}
+	slog.Error("OIDC login failed", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+}
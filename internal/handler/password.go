@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// PasswordHandler обрабатывает смену и сброс пароля.
+type PasswordHandler struct {
+	service *service.PasswordService
+}
+
+// NewPasswordHandler создаёт новый PasswordHandler.
+func NewPasswordHandler(service *service.PasswordService) *PasswordHandler {
+	return &PasswordHandler{service: service}
+}
+
+// RegisterRoutes регистрирует публичные роуты сброса пароля; вызывается до AuthMiddleware.
+func (h *PasswordHandler) RegisterRoutes(app *fiber.App) {
+	app.Post("/api/password/forgot", h.forgotPassword) // POST /api/password/forgot
+	app.Post("/api/password/reset", h.resetPassword)   // POST /api/password/reset
+}
+
+// RegisterAccountRoutes регистрирует смену пароля текущего пользователя; вызывается после AuthMiddleware.
+func (h *PasswordHandler) RegisterAccountRoutes(app *fiber.App) {
+	app.Put("/api/password", h.changePassword) // PUT /api/password
+}
+
+// changePassword — PUT /api/password
+// Body: { "currentPassword": "...", "newPassword": "..." } — остальные сессии отзываются.
+func (h *PasswordHandler) changePassword(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	if err := h.service.ChangePassword(c, uid, req.CurrentPassword, req.NewPassword, currentSessionID(c), clientInfo(c, "")); err != nil {
+		return passwordError(c, err, "failed to change password")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// forgotPassword — POST /api/password/forgot
+// Body: { "login": "..." } — логин или email. Ответ всегда 202, есть такой пользователь или нет.
+func (h *PasswordHandler) forgotPassword(c fiber.Ctx) error {
+	var req struct {
+		Login string `json:"login"`
+	}
+	if err := c.Bind().Body(&req); err != nil || req.Login == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request, login required"})
+	}
+
+	if err := h.service.RequestPasswordReset(c, req.Login, clientInfo(c, "")); err != nil {
+		return passwordError(c, err, "failed to request password reset")
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// resetPassword — POST /api/password/reset
+// Body: { "token": "...", "newPassword": "..." } — все сессии пользователя отзываются.
+func (h *PasswordHandler) resetPassword(c fiber.Ctx) error {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.Bind().Body(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request, token required"})
+	}
+
+	if err := h.service.ResetPassword(c, req.Token, req.NewPassword, clientInfo(c, "")); err != nil {
+		return passwordError(c, err, "failed to reset password")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// passwordError переводит ошибки смены и сброса пароля в HTTP-ответ.
+func passwordError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrWrongPassword), errors.Is(err, service.ErrForbidden),
+		errors.Is(err, service.ErrPasswordLoginDisabled):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidPassword), errors.Is(err, service.ErrInvalidResetToken):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
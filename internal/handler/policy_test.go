@@ -0,0 +1,197 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tasker/internal/handler"
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/storage"
+	"tasker/internal/testutil"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// accessFixture — пространство с владельцем, участником, наблюдателем и посторонним,
+// задача с комментарием и вложением, и приложение с обработчиками задач, комментариев и вложений.
+type accessFixture struct {
+	app     *fiber.App
+	policy  *service.PolicyService
+	tasks   *service.TaskService
+	owner   int
+	member  int
+	viewer  int
+	outside int
+	spaceID string
+	taskID  string
+	comment string
+	attach  string
+}
+
+func newAccessFixture(t *testing.T) *accessFixture {
+	t.Helper()
+	ctx := context.Background()
+	db := testutil.DB(t)
+
+	blobs, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spaces := service.NewSpaceService(db, blobs)
+	tasks := service.NewTaskService(db, spaces, service.NewWorkflowService(db), service.NewEventBus())
+	comments := service.NewCommentService(db, spaces)
+	attachments := service.NewAttachmentService(db, blobs, spaces, service.AttachmentLimits{
+		MaxFileSize:  1 << 20,
+		SpaceQuota:   1 << 20,
+		AllowedTypes: []string{"text/plain"},
+	})
+	policy := service.NewPolicyService(db)
+
+	f := &accessFixture{
+		policy:  policy,
+		tasks:   tasks,
+		owner:   testutil.User(t, db, "user"),
+		member:  testutil.User(t, db, "user"),
+		viewer:  testutil.User(t, db, "user"),
+		outside: testutil.User(t, db, "user"),
+	}
+	f.spaceID = testutil.Space(t, db, f.owner)
+	testutil.Member(t, db, f.spaceID, f.member, "member")
+	testutil.Member(t, db, f.spaceID, f.viewer, "viewer")
+
+	task, err := tasks.CreateTask(ctx, model.Task{
+		Title:      "access",
+		ReporterID: strconv.Itoa(f.owner),
+		ApproverID: strconv.Itoa(f.owner),
+		Space:      &f.spaceID,
+	}, f.owner)
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	f.taskID = task.ID
+
+	c, err := comments.CreateComment(ctx, f.taskID, f.owner, nil, "first")
+	if err != nil {
+		t.Fatalf("create comment: %v", err)
+	}
+	f.comment = c.ID
+
+	body := "plain text attachment"
+	a, err := attachments.Upload(ctx, f.taskID, f.owner, "note.txt", int64(len(body)), strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("upload attachment: %v", err)
+	}
+	f.attach = a.ID
+
+	// вместо JWT — id пользователя из заголовка
+	f.app = fiber.New()
+	f.app.Use(func(c fiber.Ctx) error {
+		if id, err := strconv.Atoi(c.Get("X-User")); err == nil {
+			c.Locals("userID", id)
+		}
+		return c.Next()
+	})
+	handler.NewTaskHandler(tasks, policy).RegisterRoutes(f.app)
+	handler.NewCommentHandler(comments, policy).RegisterRoutes(f.app)
+	handler.NewAttachmentHandler(attachments, policy).RegisterRoutes(f.app)
+	return f
+}
+
+func (f *accessFixture) do(t *testing.T, userID int, method, path, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User", strconv.Itoa(userID))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := f.app.Test(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAccessOutsiderGetsNotFound(t *testing.T) {
+	f := newAccessFixture(t)
+	routes := []struct{ method, path, body string }{
+		{http.MethodGet, "/task/by_id/" + f.taskID, ""},
+		{http.MethodPut, "/update/" + f.taskID, `{"title":"x"}`},
+		{http.MethodDelete, "/delete/" + f.taskID, ""},
+		{http.MethodGet, "/task/" + f.taskID + "/history", ""},
+		{http.MethodGet, "/task/" + f.taskID + "/comments", ""},
+		{http.MethodPost, "/task/" + f.taskID + "/comments", `{"body":"x"}`},
+		{http.MethodPut, "/comments/" + f.comment, `{"body":"x"}`},
+		{http.MethodGet, "/comments/" + f.comment + "/history", ""},
+		{http.MethodGet, "/task/" + f.taskID + "/attachments", ""},
+		{http.MethodGet, "/attachments/" + f.attach, ""},
+		{http.MethodDelete, "/attachments/" + f.attach, ""},
+	}
+	for _, r := range routes {
+		if got := f.do(t, f.outside, r.method, r.path, r.body); got != http.StatusNotFound {
+			t.Errorf("outsider %s %s: status %d, want 404", r.method, r.path, got)
+		}
+	}
+}
+
+func TestAccessViewerCannotWrite(t *testing.T) {
+	f := newAccessFixture(t)
+	routes := []struct{ method, path, body string }{
+		{http.MethodPut, "/update/" + f.taskID, `{"title":"x"}`},
+		{http.MethodPost, "/task/" + f.taskID + "/comments", `{"body":"x"}`},
+		{http.MethodPut, "/comments/" + f.comment, `{"body":"x"}`},
+		{http.MethodDelete, "/attachments/" + f.attach, ""},
+	}
+	for _, r := range routes {
+		if got := f.do(t, f.viewer, r.method, r.path, r.body); got != http.StatusForbidden {
+			t.Errorf("viewer %s %s: status %d, want 403", r.method, r.path, got)
+		}
+	}
+	for _, path := range []string{"/task/by_id/" + f.taskID, "/task/" + f.taskID + "/comments", "/attachments/" + f.attach} {
+		if got := f.do(t, f.viewer, http.MethodGet, path, ""); got != http.StatusOK {
+			t.Errorf("viewer GET %s: status %d, want 200", path, got)
+		}
+	}
+}
+
+func TestAccessMemberCannotDelete(t *testing.T) {
+	f := newAccessFixture(t)
+	if got := f.do(t, f.member, http.MethodDelete, "/delete/"+f.taskID, ""); got != http.StatusForbidden {
+		t.Errorf("member DELETE task: status %d, want 403", got)
+	}
+	if got := f.do(t, f.member, http.MethodGet, "/task/by_id/"+f.taskID, ""); got != http.StatusOK {
+		t.Errorf("task after member delete attempt: status %d, want 200", got)
+	}
+}
+
+func TestAccessTrashedTask(t *testing.T) {
+	f := newAccessFixture(t)
+	ctx := context.Background()
+	if err := f.tasks.DeleteTask(ctx, f.taskID, f.owner); err != nil {
+		t.Fatalf("delete task: %v", err)
+	}
+
+	if _, err := f.policy.TaskSpace(ctx, f.taskID); !errors.Is(err, service.ErrTaskNotFound) {
+		t.Errorf("TaskSpace of trashed task: %v, want ErrTaskNotFound", err)
+	}
+	space, err := f.policy.AnyTaskSpace(ctx, f.taskID)
+	if err != nil || space != f.spaceID {
+		t.Fatalf("AnyTaskSpace of trashed task: %q, %v; want %q", space, err, f.spaceID)
+	}
+
+	if got := f.do(t, f.owner, http.MethodGet, "/task/by_id/"+f.taskID, ""); got != http.StatusNotFound {
+		t.Errorf("GET trashed task: status %d, want 404", got)
+	}
+	if got := f.do(t, f.viewer, http.MethodGet, "/task/"+f.taskID+"/history", ""); got != http.StatusOK {
+		t.Errorf("viewer history of trashed task: status %d, want 200", got)
+	}
+	if got := f.do(t, f.outside, http.MethodGet, "/task/"+f.taskID+"/history", ""); got != http.StatusNotFound {
+		t.Errorf("outsider history of trashed task: status %d, want 404", got)
+	}
+}
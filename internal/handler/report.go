@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// ReportHandler отдаёт аналитические отчёты по задачам.
+type ReportHandler struct {
+	reports *service.ReportService
+}
+
+// NewReportHandler создаёт новый ReportHandler.
+func NewReportHandler(reports *service.ReportService) *ReportHandler {
+	return &ReportHandler{reports: reports}
+}
+
+// RegisterRoutes регистрирует роуты отчётов.
+func (h *ReportHandler) RegisterRoutes(app *fiber.App) {
+	grp := app.Group("/reports")
+	grp.Get("/dashboards/:id/schedule", h.dashboardSchedule) // GET /reports/dashboards/:id/schedule
+	grp.Get("/spaces/:id/schedule", h.spaceSchedule)         // GET /reports/spaces/:id/schedule
+}
+
+// dashboardSchedule — расписание, критический путь и задачи под угрозой срыва для дашборда.
+// В отчёт попадают только задачи из пространств, где состоит текущий пользователь.
+func (h *ReportHandler) dashboardSchedule(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	report, err := h.reports.DashboardSchedule(c, uid, c.Params("id"))
+	return scheduleResponse(c, report, err)
+}
+
+// spaceSchedule — то же для всех задач пространства.
+func (h *ReportHandler) spaceSchedule(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	report, err := h.reports.SpaceSchedule(c, uid, c.Params("id"))
+	return scheduleResponse(c, report, err)
+}
+
+func scheduleResponse(c fiber.Ctx, report *model.ScheduleReport, err error) error {
+	if err != nil {
+		if errors.Is(err, service.ErrDependencyCycle) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to build schedule"})
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"tasker/internal/middleware"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RoleHandler обрабатывает роли и права.
+type RoleHandler struct {
+	roles  *service.RoleService
+	policy *service.PolicyService
+}
+
+// NewRoleHandler создаёт новый RoleHandler.
+func NewRoleHandler(roles *service.RoleService, policy *service.PolicyService) *RoleHandler {
+	return &RoleHandler{roles: roles, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты ролей. Смотреть роли может любой пользователь,
+// менять — только с правом role.manage.
+func (h *RoleHandler) RegisterRoutes(app *fiber.App) {
+	manage := middleware.RequirePermission(h.policy, service.PermRoleManage)
+
+	app.Get("/permissions", h.listPermissions)        // GET /permissions
+	app.Get("/roles", h.listRoles)                    // GET /roles?scope=space
+	app.Get("/roles/:id", h.getRole)                  // GET /roles/:id
+	app.Post("/roles", manage, h.createRole)          // POST /roles
+	app.Put("/roles/:id", manage, h.updateRole)       // PUT /roles/:id
+	app.Delete("/roles/:id", manage, h.deleteRole)    // DELETE /roles/:id
+	app.Put("/users/:id/role", manage, h.setUserRole) // PUT /users/:id/role
+}
+
+func (h *RoleHandler) listPermissions(c fiber.Ctx) error {
+	return c.JSON(h.roles.Permissions())
+}
+
+func (h *RoleHandler) listRoles(c fiber.Ctx) error {
+	roles, err := h.roles.ListRoles(c, c.Query("scope"))
+	if err != nil {
+		return roleError(c, err, "failed to list roles")
+	}
+	return c.JSON(roles)
+}
+
+func (h *RoleHandler) getRole(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid role id"})
+	}
+	role, err := h.roles.GetRole(c, id)
+	if err != nil {
+		return roleError(c, err, "failed to load role")
+	}
+	return c.JSON(role)
+}
+
+// createRole — POST /roles
+// Body: { "name": "reviewer", "scope": "space", "permissions": ["task.read", "task.approve"] }
+func (h *RoleHandler) createRole(c fiber.Ctx) error {
+	var in model.RoleInput
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	role, err := h.roles.CreateRole(c, in)
+	if err != nil {
+		return roleError(c, err, "failed to create role")
+	}
+	return c.Status(fiber.StatusCreated).JSON(role)
+}
+
+// updateRole — PUT /roles/:id
+// Body: { "name": "reviewer", "permissions": ["task.read"] } — область роли не меняется.
+func (h *RoleHandler) updateRole(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid role id"})
+	}
+	var in model.RoleInput
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	role, err := h.roles.UpdateRole(c, id, in)
+	if err != nil {
+		return roleError(c, err, "failed to update role")
+	}
+	return c.JSON(role)
+}
+
+func (h *RoleHandler) deleteRole(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid role id"})
+	}
+	if err := h.roles.DeleteRole(c, id); err != nil {
+		return roleError(c, err, "failed to delete role")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// setUserRole — PUT /users/:id/role
+// Body: { "roleId": 1 } — системная роль пользователя.
+func (h *RoleHandler) setUserRole(c fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	var in struct {
+		RoleID int `json:"roleId"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.RoleID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, roleId required"})
+	}
+	if err := h.roles.SetUserRole(c, userID, in.RoleID); err != nil {
+		return roleError(c, err, "failed to set user role")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// roleError переводит ошибки RoleService в HTTP-ответ.
+func roleError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Role not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse), errors.Is(err, service.ErrBuiltinRole):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"tasker/internal/middleware"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+const scimContentType = "application/scim+json"
+
+// SCIMHandler — SCIM 2.0 для провизионирования пользователей и групп из IdP/HR-системы.
+// Аутентификация — персональный токен (Authorization: Bearer tsk_…) пользователя с правом user.manage.
+type SCIMHandler struct {
+	scim   *service.SCIMService
+	policy *service.PolicyService
+}
+
+// NewSCIMHandler создаёт новый SCIMHandler.
+func NewSCIMHandler(scim *service.SCIMService, policy *service.PolicyService) *SCIMHandler {
+	return &SCIMHandler{scim: scim, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты /scim/v2; все требуют права user.manage.
+func (h *SCIMHandler) RegisterRoutes(app *fiber.App) {
+	grp := app.Group("/scim/v2", middleware.RequirePermission(h.policy, service.PermUserManage))
+
+	grp.Get("/ServiceProviderConfig", h.serviceProviderConfig) // GET /scim/v2/ServiceProviderConfig
+
+	grp.Get("/Users", h.listUsers)         // GET /scim/v2/Users?filter=userName eq "ivanov"&startIndex=1&count=100
+	grp.Post("/Users", h.createUser)       // POST /scim/v2/Users
+	grp.Get("/Users/:id", h.getUser)       // GET /scim/v2/Users/:id
+	grp.Put("/Users/:id", h.replaceUser)   // PUT /scim/v2/Users/:id
+	grp.Patch("/Users/:id", h.patchUser)   // PATCH /scim/v2/Users/:id
+	grp.Delete("/Users/:id", h.deleteUser) // DELETE /scim/v2/Users/:id — деактивация
+
+	grp.Get("/Groups", h.listGroups)         // GET /scim/v2/Groups?filter=displayName eq "Backend"
+	grp.Post("/Groups", h.createGroup)       // POST /scim/v2/Groups
+	grp.Get("/Groups/:id", h.getGroup)       // GET /scim/v2/Groups/:id
+	grp.Put("/Groups/:id", h.replaceGroup)   // PUT /scim/v2/Groups/:id
+	grp.Patch("/Groups/:id", h.patchGroup)   // PATCH /scim/v2/Groups/:id
+	grp.Delete("/Groups/:id", h.deleteGroup) // DELETE /scim/v2/Groups/:id — архивация пространства
+}
+
+func (h *SCIMHandler) serviceProviderConfig(c fiber.Ctx) error {
+	supported := func(ok bool) fiber.Map { return fiber.Map{"supported": ok} }
+	return scimJSON(c, fiber.StatusOK, fiber.Map{
+		"schemas":        []string{model.SCIMSchemaSPConfig},
+		"patch":          supported(true),
+		"bulk":           fiber.Map{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         fiber.Map{"supported": true, "maxResults": 200},
+		"changePassword": supported(true),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []fiber.Map{{
+			"type":        "oauthbearertoken",
+			"name":        "Personal access token",
+			"description": "Authorization: Bearer tsk_… with the user.manage permission",
+		}},
+	})
+}
+
+// --- пользователи ---
+
+func (h *SCIMHandler) listUsers(c fiber.Ctx) error {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	count, _ := strconv.Atoi(c.Query("count"))
+	list, err := h.scim.ListUsers(c, c.Query("filter"), startIndex, count)
+	if err != nil {
+		return scimError(c, err)
+	}
+	users, _ := list.Resources.([]model.SCIMUser)
+	for i := range users {
+		setUserLocation(c, &users[i])
+	}
+	return scimJSON(c, fiber.StatusOK, list)
+}
+
+func (h *SCIMHandler) getUser(c fiber.Ctx) error {
+	u, err := h.scim.GetUser(c, c.Params("id"))
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimUser(c, fiber.StatusOK, u)
+}
+
+// createUser — POST /scim/v2/Users
+// Body: { "schemas": [...User], "userName": "ivanov", "name": { "givenName": "Иван", "familyName": "Иванов" },
+// "emails": [{ "value": "ivanov@example.com", "primary": true }], "externalId": "E-1001", "active": true }
+func (h *SCIMHandler) createUser(c fiber.Ctx) error {
+	var in model.SCIMUser
+	if err := json.Unmarshal(c.Body(), &in); err != nil {
+		return scimInvalidBody(c)
+	}
+	u, err := h.scim.CreateUser(c, in)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimUser(c, fiber.StatusCreated, u)
+}
+
+func (h *SCIMHandler) replaceUser(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var in model.SCIMUser
+	if err := json.Unmarshal(c.Body(), &in); err != nil {
+		return scimInvalidBody(c)
+	}
+	u, err := h.scim.ReplaceUser(c, uid, c.Params("id"), in)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimUser(c, fiber.StatusOK, u)
+}
+
+// patchUser — PATCH /scim/v2/Users/:id
+// Body: { "schemas": [...PatchOp], "Operations": [{ "op": "replace", "path": "active", "value": false }] }
+func (h *SCIMHandler) patchUser(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var patch model.SCIMPatch
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return scimInvalidBody(c)
+	}
+	u, err := h.scim.PatchUser(c, uid, c.Params("id"), patch)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimUser(c, fiber.StatusOK, u)
+}
+
+func (h *SCIMHandler) deleteUser(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	if err := h.scim.DeactivateUser(c, uid, c.Params("id")); err != nil {
+		return scimError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// --- группы ---
+
+func (h *SCIMHandler) listGroups(c fiber.Ctx) error {
+	startIndex, _ := strconv.Atoi(c.Query("startIndex"))
+	count, _ := strconv.Atoi(c.Query("count"))
+	list, err := h.scim.ListGroups(c, c.Query("filter"), startIndex, count, withMembers(c))
+	if err != nil {
+		return scimError(c, err)
+	}
+	groups, _ := list.Resources.([]model.SCIMGroup)
+	for i := range groups {
+		setGroupLocation(c, &groups[i])
+	}
+	return scimJSON(c, fiber.StatusOK, list)
+}
+
+func (h *SCIMHandler) getGroup(c fiber.Ctx) error {
+	g, err := h.scim.GetGroup(c, c.Params("id"), withMembers(c))
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimGroup(c, fiber.StatusOK, g)
+}
+
+// createGroup — POST /scim/v2/Groups
+// Body: { "schemas": [...Group], "displayName": "Backend", "members": [{ "value": "42" }] }
+// Владельцем пространства становится владелец токена.
+func (h *SCIMHandler) createGroup(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var in model.SCIMGroup
+	if err := json.Unmarshal(c.Body(), &in); err != nil {
+		return scimInvalidBody(c)
+	}
+	g, err := h.scim.CreateGroup(c, uid, in)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimGroup(c, fiber.StatusCreated, g)
+}
+
+func (h *SCIMHandler) replaceGroup(c fiber.Ctx) error {
+	var in model.SCIMGroup
+	if err := json.Unmarshal(c.Body(), &in); err != nil {
+		return scimInvalidBody(c)
+	}
+	g, err := h.scim.ReplaceGroup(c, c.Params("id"), in)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimGroup(c, fiber.StatusOK, g)
+}
+
+func (h *SCIMHandler) patchGroup(c fiber.Ctx) error {
+	var patch model.SCIMPatch
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return scimInvalidBody(c)
+	}
+	g, err := h.scim.PatchGroup(c, c.Params("id"), patch)
+	if err != nil {
+		return scimError(c, err)
+	}
+	return scimGroup(c, fiber.StatusOK, g)
+}
+
+func (h *SCIMHandler) deleteGroup(c fiber.Ctx) error {
+	if err := h.scim.ArchiveGroup(c, c.Params("id")); err != nil {
+		return scimError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// --- ответы ---
+
+// withMembers — false, если клиент попросил excludedAttributes=members.
+func withMembers(c fiber.Ctx) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func setUserLocation(c fiber.Ctx, u *model.SCIMUser) {
+	if u.Meta != nil {
+		u.Meta.Location = c.BaseURL() + "/scim/v2/Users/" + u.ID
+	}
+}
+
+func setGroupLocation(c fiber.Ctx, g *model.SCIMGroup) {
+	if g.Meta != nil {
+		g.Meta.Location = c.BaseURL() + "/scim/v2/Groups/" + g.ID
+	}
+}
+
+func scimUser(c fiber.Ctx, status int, u *model.SCIMUser) error {
+	setUserLocation(c, u)
+	if status == fiber.StatusCreated {
+		c.Set(fiber.HeaderLocation, u.Meta.Location)
+	}
+	return scimJSON(c, status, u)
+}
+
+func scimGroup(c fiber.Ctx, status int, g *model.SCIMGroup) error {
+	setGroupLocation(c, g)
+	if status == fiber.StatusCreated {
+		c.Set(fiber.HeaderLocation, g.Meta.Location)
+	}
+	return scimJSON(c, status, g)
+}
+
+func scimJSON(c fiber.Ctx, status int, v any) error {
+	return c.Status(status).JSON(v, scimContentType)
+}
+
+func scimErrorBody(c fiber.Ctx, status int, scimType, detail string) error {
+	body := fiber.Map{
+		"schemas": []string{model.SCIMSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	return scimJSON(c, status, body)
+}
+
+func scimInvalidBody(c fiber.Ctx) error {
+	return scimErrorBody(c, fiber.StatusBadRequest, "invalidSyntax", "invalid request body")
+}
+
+// scimError переводит ошибки SCIMService в ответ по схеме ошибок SCIM (RFC 7644, 3.12).
+func scimError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrSCIMInvalidFilter):
+		return scimErrorBody(c, fiber.StatusBadRequest, "invalidFilter", err.Error())
+	case errors.Is(err, service.ErrSCIMInvalidPath):
+		return scimErrorBody(c, fiber.StatusBadRequest, "invalidPath", err.Error())
+	case errors.Is(err, service.ErrSCIMInvalidValue), errors.Is(err, service.ErrInvalidPassword):
+		return scimErrorBody(c, fiber.StatusBadRequest, "invalidValue", err.Error())
+	case errors.Is(err, service.ErrSCIMConflict):
+		return scimErrorBody(c, fiber.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrSpaceNotFound):
+		return scimErrorBody(c, fiber.StatusNotFound, "", err.Error())
+	case errors.Is(err, service.ErrForbidden):
+		return scimErrorBody(c, fiber.StatusForbidden, "", err.Error())
+	}
+	slog.Error("SCIM request failed", "error", err)
+	return scimErrorBody(c, fiber.StatusInternalServerError, "", "Internal server error")
+}
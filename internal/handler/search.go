@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// SearchHandler обрабатывает поиск задач.
+type SearchHandler struct {
+	search *service.SearchService
+}
+
+// NewSearchHandler создаёт новый SearchHandler.
+func NewSearchHandler(search *service.SearchService) *SearchHandler {
+	return &SearchHandler{search: search}
+}
+
+// RegisterRoutes регистрирует роуты поиска.
+func (h *SearchHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/search", h.searchTasks) // GET /search?q=...&space=...&mode=...&limit=...&offset=...
+}
+
+func (h *SearchHandler) searchTasks(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	limit, offset := 0, 0
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be an integer"})
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "offset must be an integer"})
+		}
+	}
+
+	result, err := h.search.Search(c, uid, c.Query("q"), c.Query("space"), c.Query("mode"), limit, offset)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearch) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to search tasks"})
+	}
+	return c.JSON(result)
+}
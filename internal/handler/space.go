@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"errors"
 	"strconv"
+	"tasker/internal/middleware"
 	"tasker/internal/service"
 
 	"github.com/gofiber/fiber/v3"
@@ -10,20 +12,31 @@ import (
 // SpaceHandler обрабатывает запросы, связанные с Spaces.
 type SpaceHandler struct {
 	spaceSvc *service.SpaceService
+	policy   *service.PolicyService
 }
 
 // NewSpaceHandler создаёт новый SpaceHandler.
-func NewSpaceHandler(spaceSvc *service.SpaceService) *SpaceHandler {
-	return &SpaceHandler{spaceSvc: spaceSvc}
+func NewSpaceHandler(spaceSvc *service.SpaceService, policy *service.PolicyService) *SpaceHandler {
+	return &SpaceHandler{spaceSvc: spaceSvc, policy: policy}
 }
 
-// RegisterRoutes регистрирует роуты, связанные с пространствами.
+// RegisterRoutes регистрирует роуты, связанные с пространствами. Права внутри пространства
+// проверяет SpaceService.
 func (h *SpaceHandler) RegisterRoutes(app *fiber.App) {
 	grp := app.Group("/spaces")
-	grp.Post("/", h.createSpace)             // POST /spaces
-	grp.Post("/:id/invite", h.inviteToSpace) // POST /spaces/:id/invite
-	grp.Get("/:id", h.getSpaceByID)          // GET /spaces/:id
-	grp.Get("/", h.listMySpaces)             // GET /spaces
+	grp.Post("/", middleware.RequirePermission(h.policy, service.PermSpaceCreate), h.createSpace) // POST /spaces
+	grp.Get("/", h.listMySpaces)                                                                  // GET /spaces
+	grp.Get("/:id", h.getSpaceByID)                                                               // GET /spaces/:id
+	grp.Put("/:id", h.renameSpace)                                                                // PUT /spaces/:id
+	grp.Delete("/:id", h.deleteSpace)                                                             // DELETE /spaces/:id
+	grp.Post("/:id/archive", h.archiveSpace)                                                      // POST /spaces/:id/archive
+	grp.Post("/:id/unarchive", h.unarchiveSpace)                                                  // POST /spaces/:id/unarchive
+	grp.Put("/:id/require-2fa", h.setRequireTwoFactor)                                            // PUT /spaces/:id/require-2fa
+	grp.Put("/:id/ldap-group", h.setLDAPGroup)                                                    // PUT /spaces/:id/ldap-group
+	grp.Put("/:id/members/:userId", h.setMemberRole)                                              // PUT /spaces/:id/members/:userId
+	grp.Delete("/:id/members/:userId", h.removeMember)                                            // DELETE /spaces/:id/members/:userId
+	grp.Post("/:id/leave", h.leaveSpace)                                                          // POST /spaces/:id/leave
+	grp.Post("/:id/transfer", h.transferOwnership)                                                // POST /spaces/:id/transfer
 }
 
 // createSpace — POST /spaces
@@ -37,74 +50,239 @@ func (h *SpaceHandler) createSpace(c fiber.Ctx) error {
 	var in struct {
 		Name string `json:"name"`
 	}
-	if err := c.Bind().JSON(&in); err != nil || in.Name == "" {
+	if err := c.Bind().JSON(&in); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, name is required"})
 	}
 
 	sp, err := h.spaceSvc.CreateSpace(c, in.Name, uid)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to create space", "detail": err.Error()})
+		return spaceError(c, err, "failed to create space")
 	}
 	return c.Status(fiber.StatusCreated).JSON(sp)
 }
 
-// inviteToSpace — POST /spaces/:id/invite
-// Body: { "userId": 42, "role": "member" }
-func (h *SpaceHandler) inviteToSpace(c fiber.Ctx) error {
+// setMemberRole — PUT /spaces/:id/members/:userId
+// Body: { "role": "viewer" } — роль пространства (admin, member, viewer или своя из /roles).
+// Нужно право space.invite. Новых участников приглашают через /spaces/:id/invite.
+func (h *SpaceHandler) setMemberRole(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	memberID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+
+	var in struct {
+		Role string `json:"role"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.Role == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, role required"})
+	}
+
+	if err := h.spaceSvc.SetMemberRole(c, c.Params("id"), uid, memberID, in.Role); err != nil {
+		return spaceError(c, err, "failed to set member role")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// getSpaceByID — GET /spaces/:id
+// Возвращает пространство, роль текущего пользователя и участников.
+func (h *SpaceHandler) getSpaceByID(c fiber.Ctx) error {
 	uid, err := getUserIDFromCtx(c)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 	}
 
-	spaceID := c.Params("id")
-	if spaceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "space id required"})
+	sp, err := h.spaceSvc.GetSpace(c, c.Params("id"), uid)
+	if err != nil {
+		return spaceError(c, err, "failed to load space")
 	}
+	return c.JSON(sp)
+}
 
-	// Проверяем, что вызывающий пользователь — админ в этом пространстве
-	isMember, role, err := h.spaceSvc.IsMember(c, spaceID, uid)
+// listMySpaces — GET /spaces
+// Возвращает список пространств, где текущий пользователь состоит.
+func (h *SpaceHandler) listMySpaces(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal error", "detail": err.Error()})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 	}
-	if !isMember || role != "admin" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only admin can invite users to space"})
+
+	spaces, err := h.spaceSvc.ListSpaces(c, uid)
+	if err != nil {
+		return spaceError(c, err, "failed to list spaces")
+	}
+	return c.JSON(spaces)
+}
+
+// renameSpace — PUT /spaces/:id
+// Body: { "name": "Backend Team" }
+func (h *SpaceHandler) renameSpace(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 	}
 
 	var in struct {
-		UserID int    `json:"userId"`
-		Role   string `json:"role"`
+		Name string `json:"name"`
 	}
-	if err := c.Bind().JSON(&in); err != nil || in.UserID == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, userId required"})
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, name is required"})
 	}
-	if in.Role == "" {
-		in.Role = "member"
+
+	if err := h.spaceSvc.RenameSpace(c, c.Params("id"), uid, in.Name); err != nil {
+		return spaceError(c, err, "failed to rename space")
 	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *SpaceHandler) archiveSpace(c fiber.Ctx) error {
+	return h.setArchived(c, true)
+}
 
-	if err := h.spaceSvc.AddMember(c, spaceID, in.UserID, in.Role); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to add member", "detail": err.Error()})
+func (h *SpaceHandler) unarchiveSpace(c fiber.Ctx) error {
+	return h.setArchived(c, false)
+}
+
+func (h *SpaceHandler) setArchived(c fiber.Ctx, archived bool) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 	}
 
+	if err := h.spaceSvc.SetArchived(c, c.Params("id"), uid, archived); err != nil {
+		return spaceError(c, err, "failed to update space")
+	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// getSpaceByID — GET /spaces/:id
-func (h *SpaceHandler) getSpaceByID(c fiber.Ctx) error {
-	spaceID := c.Params("id")
-	if spaceID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "space id required"})
+// setRequireTwoFactor — PUT /spaces/:id/require-2fa
+// Body: { "required": true }
+func (h *SpaceHandler) setRequireTwoFactor(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 	}
 
-	// Если позже добавим SpaceService.GetSpaceByID, здесь можно вернуть полную запись.
-	// Сейчас возвращаем минимальную информацию.
-	return c.JSON(fiber.Map{"id": spaceID})
+	var in struct {
+		Required *bool `json:"required"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.Required == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, required is required"})
+	}
+	if err := h.spaceSvc.SetRequireTwoFactor(c, c.Params("id"), uid, *in.Required); err != nil {
+		return spaceError(c, err, "failed to update space")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// listMySpaces — GET /spaces
-// Возвращает список пространств, где текущий пользователь состоит.
-// Пока не реализовано в SpaceService, возвращаем 501.
-func (h *SpaceHandler) listMySpaces(c fiber.Ctx) error {
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not implemented, add ListSpaces in SpaceService"})
+// setLDAPGroup — PUT /spaces/:id/ldap-group
+// Body: { "group": "cn=backend,ou=groups,dc=example,dc=org" } — пустая строка отвязывает группу
+func (h *SpaceHandler) setLDAPGroup(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		Group *string `json:"group"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.Group == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, group is required"})
+	}
+	if err := h.spaceSvc.SetLDAPGroup(c, c.Params("id"), uid, *in.Group); err != nil {
+		return spaceError(c, err, "failed to update space")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// deleteSpace — DELETE /spaces/:id
+// Только владелец и только архивное пространство; задачи удаляются вместе с ним.
+func (h *SpaceHandler) deleteSpace(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.spaceSvc.DeleteSpace(c, c.Params("id"), uid); err != nil {
+		return spaceError(c, err, "failed to delete space")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// removeMember — DELETE /spaces/:id/members/:userId
+func (h *SpaceHandler) removeMember(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	memberID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+
+	if err := h.spaceSvc.RemoveMember(c, c.Params("id"), uid, memberID); err != nil {
+		return spaceError(c, err, "failed to remove member")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// leaveSpace — POST /spaces/:id/leave
+func (h *SpaceHandler) leaveSpace(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	if err := h.spaceSvc.LeaveSpace(c, c.Params("id"), uid); err != nil {
+		return spaceError(c, err, "failed to leave space")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// transferOwnership — POST /spaces/:id/transfer
+// Body: { "userId": 42 } — новый владелец, должен быть участником.
+func (h *SpaceHandler) transferOwnership(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var in struct {
+		UserID int `json:"userId"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.UserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body, userId required"})
+	}
+
+	if err := h.spaceSvc.TransferOwnership(c, c.Params("id"), uid, in.UserID); err != nil {
+		return spaceError(c, err, "failed to transfer ownership")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// spaceError переводит ошибки SpaceService в HTTP-ответ. Не участнику пространство отдаётся как 404.
+func spaceError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrSpaceNotFound), errors.Is(err, service.ErrNotMember):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Space not found"})
+	case errors.Is(err, service.ErrMemberNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Member not found"})
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "twoFactorRequired": true})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	case errors.Is(err, service.ErrSpaceArchived), errors.Is(err, service.ErrSpaceNotArchived), errors.Is(err, service.ErrOwnerMembership),
+		errors.Is(err, service.ErrTwoFactorNotEnabled), errors.Is(err, service.ErrLDAPGroupTaken):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrInvalidSpace):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
 }
 
 // getUserIDFromCtx получает user id (int) из контекста Fiber.
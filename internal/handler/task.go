@@ -1,6 +1,11 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tasker/internal/middleware"
 	"tasker/internal/model"
 	"tasker/internal/service"
 	"time"
@@ -10,47 +15,172 @@ import (
 
 type TaskHandler struct {
 	service *service.TaskService
+	policy  *service.PolicyService
 }
 
-func NewTaskHandler(service *service.TaskService) *TaskHandler {
-	return &TaskHandler{service: service}
+func NewTaskHandler(service *service.TaskService, policy *service.PolicyService) *TaskHandler {
+	return &TaskHandler{service: service, policy: policy}
 }
 
+// RegisterRoutes регистрирует роуты задач. Доступ к задаче :id проверяет middleware.TaskAccess
+// по правам роли пользователя в пространстве задачи.
 func (h *TaskHandler) RegisterRoutes(app *fiber.App) {
+	read := middleware.TaskAccess(h.policy, service.PermTaskRead)
+	update := middleware.TaskAccess(h.policy, service.PermTaskUpdate)
+
 	app.Get("/list", h.listTasks)
 	app.Post("/create", h.createTask)
-	app.Get("/task/by_id/:id", h.getTaskByID)
-	app.Put("/update/:id", h.updateTask)
-	app.Delete("/delete/:id", h.deleteTask)
-	app.Put("/done/:id", h.doneTask)
+	app.Get("/task/by_id/:id", read, h.getTaskByID)
+	app.Put("/update/:id", update, h.updateTask)
+	app.Delete("/delete/:id", middleware.TaskAccess(h.policy, service.PermTaskDelete), h.deleteTask)
+	app.Put("/done/:id", update, h.doneTask)
 	app.Get("/tasklist", h.mockTasks)
 	app.Get("/taskByDB/:id", h.GetTasksByDashboardID)
+	app.Get("/task/:id/blockers", read, h.listBlockers)
+	app.Post("/task/:id/blockers", update, h.addBlocker)
+	app.Delete("/task/:id/blockers/:blockerId", update, h.removeBlocker)
+	app.Get("/task/:id/blocking", read, h.listBlocking)
+	app.Get("/task/:id/history", middleware.AnyTaskAccess(h.policy, service.PermTaskRead), h.taskHistory)
 }
 
 func (h *TaskHandler) createTask(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
 	var task model.Task
 	if err := c.Bind().JSON(&task); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
+	if task.Space != nil && *task.Space != "" {
+		if _, err := h.policy.Can(c, uid, service.PermTaskCreate, *task.Space); err != nil {
+			return middleware.AccessError(c, err)
+		}
+	}
 
-	createdTask, err := h.service.CreateTask(c, task)
+	createdTask, err := h.service.CreateTask(c, task, uid)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create task"})
+		return taskError(c, err, "Failed to create task")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(createdTask)
 }
 
+// listTasks — GET /list
+// Фильтры: space, dashboard, status (через запятую), assignee, reporter, approver, approveStatus,
+// deadlineFrom/deadlineTo (YYYY-MM-DD), createdFrom/createdTo, updatedFrom/updatedTo (RFC3339 или YYYY-MM-DD),
+// blocked (true/false), assigneeDeactivated=true (исполнитель деактивирован).
+// Сортировка: sort=-updatedAt,title. Пагинация: limit, cursor; total=true — с общим числом.
 func (h *TaskHandler) listTasks(c fiber.Ctx) error {
-	tasks, err := h.service.ListTasks(c)
+	uid, err := getUserIDFromCtx(c)
 	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	filter, err := parseTaskFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := h.service.ListTasks(c, uid, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTaskQuery) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, service.ErrForbidden) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list tasks"})
 	}
-	return c.JSON(tasks)
+	return c.JSON(page)
+}
+
+// parseTaskFilter собирает model.TaskFilter из query-параметров /list.
+func parseTaskFilter(c fiber.Ctx) (model.TaskFilter, error) {
+	f := model.TaskFilter{
+		SpaceID:       c.Query("space"),
+		DashboardID:   c.Query("dashboard"),
+		AssignerID:    c.Query("assignee"),
+		ReporterID:    c.Query("reporter"),
+		ApproverID:    c.Query("approver"),
+		ApproveStatus: c.Query("approveStatus"),
+		DeadlineFrom:  c.Query("deadlineFrom"),
+		DeadlineTo:    c.Query("deadlineTo"),
+		Cursor:        c.Query("cursor"),
+		WithTotal:     c.Query("total") == "true",
+	}
+	if v := c.Query("status"); v != "" {
+		f.Statuses = strings.Split(v, ",")
+	}
+
+	var err error
+	for _, p := range []struct {
+		name  string
+		dst   **time.Time
+		upper bool
+	}{
+		{"createdFrom", &f.CreatedFrom, false},
+		{"createdTo", &f.CreatedTo, true},
+		{"updatedFrom", &f.UpdatedFrom, false},
+		{"updatedTo", &f.UpdatedTo, true},
+	} {
+		if *p.dst, err = parseTimeParam(c.Query(p.name), p.upper); err != nil {
+			return f, fmt.Errorf("%s: %w", p.name, err)
+		}
+	}
+
+	if v := c.Query("blocked"); v != "" {
+		blocked, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("blocked must be true or false")
+		}
+		f.Blocked = &blocked
+	}
+	f.AssigneeDeactivated = c.Query("assigneeDeactivated") == "true"
+	if v := c.Query("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			return f, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	if f.Sort, err = service.ParseTaskSort(c.Query("sort")); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// parseTimeParam понимает RFC3339 и YYYY-MM-DD. Дата в верхней границе включает весь день
+// (граница — начало следующего дня, сравнение строгое).
+func parseTimeParam(v string, upper bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, fmt.Errorf("expected RFC3339 or YYYY-MM-DD, got %q", v)
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
 }
+
+// GetTasksByDashboardID — GET /taskByDB/:id
+// Возвращает только задачи дашборда из пространств, где состоит пользователь.
 func (h *TaskHandler) GetTasksByDashboardID(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
 	id := c.Params("id")
-	tasks, err := h.service.GetTasksByDashboardID(c, id)
+	tasks, err := h.service.GetTasksByDashboardID(c, id, uid)
+	if errors.Is(err, service.ErrForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Tasks not found for this dashboard"})
 	}
@@ -61,43 +191,146 @@ func (h *TaskHandler) getTaskByID(c fiber.Ctx) error {
 	id := c.Params("id")
 	task, err := h.service.GetTaskByID(c, id)
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+		if errors.Is(err, service.ErrTaskNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to get task"})
 	}
 	return c.JSON(task)
 }
 
 func (h *TaskHandler) updateTask(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
 	id := c.Params("id")
 	var task model.TaskPatch
 	if err := c.Bind().JSON(&task); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
-	updatedTask, err := h.service.UpdateTask(c, id, task)
+	updatedTask, err := h.service.UpdateTask(c, id, task, uid)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update task"})
+		return taskError(c, err, "Failed to update task")
 	}
 
 	return c.JSON(updatedTask)
 }
 
 func (h *TaskHandler) deleteTask(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
 	id := c.Params("id")
-	if err := h.service.DeleteTask(c, id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete task"})
+	if err := h.service.DeleteTask(c, id, uid); err != nil {
+		return taskError(c, err, "Failed to delete task")
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
 func (h *TaskHandler) doneTask(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
 	id := c.Params("id")
-	task, err := h.service.MarkTaskDone(c, id)
+	task, err := h.service.MarkTaskDone(c, id, uid)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark task as done"})
+		return taskError(c, err, "Failed to mark task as done")
 	}
 	return c.JSON(task)
 }
 
+func (h *TaskHandler) listBlockers(c fiber.Ctx) error {
+	blockers, err := h.service.GetBlockers(c, c.Params("id"))
+	if err != nil {
+		return taskError(c, err, "Failed to list blockers")
+	}
+	return c.JSON(blockers)
+}
+
+// addBlocker — POST /task/:id/blockers
+// Body: { "blockerId": "<task-id>" }
+func (h *TaskHandler) addBlocker(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var in struct {
+		BlockerID string `json:"blockerId"`
+	}
+	if err := c.Bind().JSON(&in); err != nil || in.BlockerID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request, blockerId is required"})
+	}
+
+	blockers, err := h.service.AddBlocker(c, c.Params("id"), in.BlockerID, uid)
+	if err != nil {
+		return taskError(c, err, "Failed to add blocker")
+	}
+	return c.Status(fiber.StatusCreated).JSON(blockers)
+}
+
+func (h *TaskHandler) removeBlocker(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	blockers, err := h.service.RemoveBlocker(c, c.Params("id"), c.Params("blockerId"), uid)
+	if err != nil {
+		return taskError(c, err, "Failed to remove blocker")
+	}
+	return c.JSON(blockers)
+}
+
+func (h *TaskHandler) listBlocking(c fiber.Ctx) error {
+	blocking, err := h.service.GetBlocking(c, c.Params("id"))
+	if err != nil {
+		return taskError(c, err, "Failed to list blocked tasks")
+	}
+	return c.JSON(blocking)
+}
+
+// taskHistory — GET /task/:id/history
+// Журнал изменений задачи от старых записей к новым; доступен и для задачи в корзине.
+func (h *TaskHandler) taskHistory(c fiber.Ctx) error {
+	history, err := h.service.GetHistory(c, c.Params("id"))
+	if err != nil {
+		return taskError(c, err, "Failed to load task history")
+	}
+	return c.JSON(history)
+}
+
+// taskError переводит ошибки TaskService в HTTP-ответ.
+// Недопустимый переход статуса — 409, неизвестный статус — 422; в обоих случаях
+// в ответе есть список допустимых статусов.
+func taskError(c fiber.Ctx, err error, fallback string) error {
+	var trErr *service.TransitionError
+	switch {
+	case errors.As(err, &trErr):
+		status := fiber.StatusConflict
+		if trErr.Unknown {
+			status = fiber.StatusUnprocessableEntity
+		}
+		return c.Status(status).JSON(fiber.Map{"error": trErr.Error(), "from": trErr.From, "allowed": trErr.Allowed})
+	case errors.Is(err, service.ErrTaskNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	case errors.Is(err, service.ErrTaskBlocked), errors.Is(err, service.ErrApprovalRequired):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrDependencyCycle):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidApproveStatus), errors.Is(err, service.ErrInvalidDependency):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
+
 // ВРЕМЕННО
 func (h *TaskHandler) mockTasks(c fiber.Ctx) error {
 	assigner2 := "user-2"
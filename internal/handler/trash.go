@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/middleware"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// TrashHandler обрабатывает корзину задач.
+type TrashHandler struct {
+	trash  *service.TrashService
+	policy *service.PolicyService
+}
+
+// NewTrashHandler создаёт новый TrashHandler.
+func NewTrashHandler(trash *service.TrashService, policy *service.PolicyService) *TrashHandler {
+	return &TrashHandler{trash: trash, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты корзины.
+func (h *TrashHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/spaces/:id/trash", middleware.SpaceAccess(h.policy, service.PermTaskRead), h.listTrash)        // GET /spaces/:id/trash
+	app.Post("/task/:id/restore", middleware.AnyTaskAccess(h.policy, service.PermTaskDelete), h.restoreTask) // POST /task/:id/restore
+}
+
+func (h *TrashHandler) listTrash(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	tasks, err := h.trash.ListTrash(c, c.Params("id"), uid)
+	if err != nil {
+		return trashError(c, err, "Failed to list trash")
+	}
+	return c.JSON(tasks)
+}
+
+func (h *TrashHandler) restoreTask(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	task, err := h.trash.RestoreTask(c, c.Params("id"), uid)
+	if err != nil {
+		return trashError(c, err, "Failed to restore task")
+	}
+	return c.JSON(task)
+}
+
+// trashError переводит ошибки TrashService в HTTP-ответ.
+func trashError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found in trash"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
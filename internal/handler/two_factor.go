@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// TwoFactorHandler обрабатывает настройку TOTP-2FA текущего пользователя.
+type TwoFactorHandler struct {
+	twoFactor *service.TwoFactorService
+}
+
+// NewTwoFactorHandler создаёт новый TwoFactorHandler.
+func NewTwoFactorHandler(twoFactor *service.TwoFactorService) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactor: twoFactor}
+}
+
+// RegisterRoutes регистрирует роуты 2FA; вызывается после AuthMiddleware.
+func (h *TwoFactorHandler) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/2fa", h.status)                                  // GET /api/2fa
+	app.Post("/api/2fa/enroll", h.enroll)                          // POST /api/2fa/enroll
+	app.Post("/api/2fa/confirm", h.confirm)                        // POST /api/2fa/confirm
+	app.Post("/api/2fa/recovery-codes", h.regenerateRecoveryCodes) // POST /api/2fa/recovery-codes
+	app.Delete("/api/2fa", h.disable)                              // DELETE /api/2fa
+}
+
+// codeRequest — тело запросов, подтверждаемых кодом 2FA.
+type codeRequest struct {
+	Code string `json:"code"`
+}
+
+func (h *TwoFactorHandler) status(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	st, err := h.twoFactor.Status(c, uid)
+	if err != nil {
+		return twoFactorError(c, err, "failed to load two-factor status")
+	}
+	return c.JSON(st)
+}
+
+// enroll — POST /api/2fa/enroll: новый секрет; 2FA включается после confirm.
+func (h *TwoFactorHandler) enroll(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	enrollment, err := h.twoFactor.Enroll(c, uid)
+	if err != nil {
+		return twoFactorError(c, err, "failed to start two-factor enrollment")
+	}
+	return c.JSON(enrollment)
+}
+
+// confirm — POST /api/2fa/confirm
+// Body: { "code": "123456" } — в ответе коды восстановления, они показываются один раз.
+func (h *TwoFactorHandler) confirm(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req codeRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	codes, err := h.twoFactor.Confirm(c, uid, req.Code)
+	if err != nil {
+		return twoFactorError(c, err, "failed to confirm two-factor authentication")
+	}
+	return c.JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+// regenerateRecoveryCodes — POST /api/2fa/recovery-codes
+// Body: { "code": "123456" }
+func (h *TwoFactorHandler) regenerateRecoveryCodes(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req codeRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(c, uid, req.Code)
+	if err != nil {
+		return twoFactorError(c, err, "failed to regenerate recovery codes")
+	}
+	return c.JSON(fiber.Map{"recoveryCodes": codes})
+}
+
+// disable — DELETE /api/2fa
+// Body: { "code": "123456" } — подойдёт и код восстановления.
+func (h *TwoFactorHandler) disable(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	var req codeRequest
+	if err := c.Bind().JSON(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if err := h.twoFactor.Disable(c, uid, req.Code); err != nil {
+		return twoFactorError(c, err, "failed to disable two-factor authentication")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// twoFactorError переводит ошибки TwoFactorService в HTTP-ответ.
+func twoFactorError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTwoFactorCode):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
+}
@@ -1,6 +1,11 @@
 package handler
 
 import (
+	"errors"
+	"log/slog"
+	"strconv"
+	"tasker/internal/middleware"
+	"tasker/internal/model"
 	"tasker/internal/service"
 
 	"github.com/gofiber/fiber/v3"
@@ -8,39 +13,211 @@ import (
 
 type UserHandler struct {
 	service *service.UserService
+	policy  *service.PolicyService
 }
 
-func NewUserHandler(service *service.UserService) *UserHandler {
-	return &UserHandler{service: service}
+func NewUserHandler(service *service.UserService, policy *service.PolicyService) *UserHandler {
+	return &UserHandler{service: service, policy: policy}
 }
 
 func (h *UserHandler) RegisterPublicRoutes(app *fiber.App) {
-	app.Post("/user/login", h.loginHandler)
+	app.Post("/user/login", Deprecated("/api/login"), h.loginRemoved)
 	app.Get("/Users", h.listUsers)
 }
 
-func (h *UserHandler) loginHandler(c fiber.Ctx) error {
-	var req struct {
-		Login    string `json:"login"`
-		Password string `json:"password"`
+// RegisterRoutes регистрирует роуты профиля и администрирования учётных записей.
+func (h *UserHandler) RegisterRoutes(app *fiber.App) {
+	manage := middleware.RequirePermission(h.policy, service.PermUserManage)
+
+	app.Get("/users/me", h.getProfile)             // GET /users/me
+	app.Put("/users/me", h.updateProfile)          // PUT /users/me
+	app.Put("/users/me/avatar", h.uploadAvatar)    // PUT /users/me/avatar
+	app.Delete("/users/me/avatar", h.deleteAvatar) // DELETE /users/me/avatar
+	app.Get("/users/:id/avatar", h.getAvatar)      // GET /users/:id/avatar
+
+	app.Post("/users/:id/deactivate", manage, h.deactivate) // POST /users/:id/deactivate
+	app.Post("/users/:id/reactivate", manage, h.reactivate) // POST /users/:id/reactivate
+}
+
+// loginRemoved — POST /user/login проверял пароль, не открывая сессии, и дублировал /api/login.
+// Теперь вход один; старый роут отвечает 410 со ссылкой на замену.
+func (h *UserHandler) loginRemoved(c fiber.Ctx) error {
+	return c.Status(fiber.StatusGone).JSON(fiber.Map{
+		"error":     "POST /user/login has been removed, use POST /api/login",
+		"successor": "/api/login",
+	})
+}
+
+// listUsers — GET /Users?search=иван&limit=100&offset=0
+// Деактивированные скрыты; includeDeactivated=true — показать и их (с "deactivated": true).
+func (h *UserHandler) listUsers(c fiber.Ctx) error {
+	q := model.UserListQuery{
+		Search:             c.Query("search"),
+		IncludeDeactivated: c.Query("includeDeactivated") == "true",
+	}
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be a positive integer"})
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "offset must be a non-negative integer"})
+		}
 	}
 
-	if err := c.Bind().Body(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	users, err := h.service.GetAllUsers(c, q)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list users"})
 	}
+	return c.JSON(users)
+}
 
-	user, err := h.service.Login(c, req.Login, req.Password)
+func (h *UserHandler) getProfile(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	profile, err := h.service.GetProfile(c, uid)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return userError(c, err, "failed to load profile")
 	}
+	return c.JSON(profile)
+}
 
-	return c.JSON(user)
+// updateProfile — PUT /users/me
+// Body: { "name": "Иван", "surname": "Иванов", "middlename": "", "timezone": "Europe/Moscow", "locale": "ru" }
+// Отсутствующие поля не меняются, пустые middlename/timezone/locale очищаются.
+func (h *UserHandler) updateProfile(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	var in model.ProfileUpdate
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	profile, err := h.service.UpdateProfile(c, uid, in)
+	if err != nil {
+		return userError(c, err, "failed to update profile")
+	}
+	return c.JSON(profile)
 }
 
-func (h *UserHandler) listUsers(c fiber.Ctx) error {
-	users, err := h.service.GetAllUsers(c)
+// uploadAvatar — PUT /users/me/avatar
+// multipart/form-data с полем "file": PNG, JPEG, GIF или WebP (тип определяется по содержимому).
+func (h *UserHandler) uploadAvatar(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to list users"})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 	}
-	return c.JSON(users)
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file is required"})
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "failed to read file"})
+	}
+	defer f.Close()
+
+	profile, err := h.service.SetAvatar(c, uid, fh.Size, f)
+	if err != nil {
+		return userError(c, err, "failed to upload avatar")
+	}
+	return c.JSON(profile)
+}
+
+func (h *UserHandler) deleteAvatar(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	if err := h.service.DeleteAvatar(c, uid); err != nil {
+		return userError(c, err, "failed to delete avatar")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// getAvatar — GET /users/:id/avatar
+// Адрес из avatarUrl содержит версию, поэтому ответ кешируется надолго.
+func (h *UserHandler) getAvatar(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	contentType, size, body, err := h.service.OpenAvatar(c, id)
+	if err != nil {
+		return userError(c, err, "failed to load avatar")
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set("X-Content-Type-Options", "nosniff")
+	if c.Query("v") != "" {
+		c.Set(fiber.HeaderCacheControl, "private, max-age=31536000, immutable")
+	}
+	// body закрывается fasthttp после отправки
+	return c.SendStream(body, int(size))
+}
+
+// deactivate — POST /users/:id/deactivate
+// Body (необязательно): { "reassignTo": 42 } — кому передать открытые задачи.
+// Нужно право user.manage.
+func (h *UserHandler) deactivate(c fiber.Ctx) error {
+	uid, err := getUserIDFromCtx(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	var in struct {
+		ReassignTo *int `json:"reassignTo"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.Bind().JSON(&in); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+		}
+	}
+
+	res, err := h.service.DeactivateUser(c, uid, id, in.ReassignTo)
+	if err != nil {
+		return userError(c, err, "failed to deactivate user")
+	}
+	return c.JSON(res)
+}
+
+func (h *UserHandler) reactivate(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user id"})
+	}
+	if err := h.service.ReactivateUser(c, id); err != nil {
+		return userError(c, err, "failed to reactivate user")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// userError переводит ошибки профиля и администрирования пользователей в HTTP-ответ.
+func userError(c fiber.Ctx, err error, fallback string) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, service.ErrAvatarNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Avatar not found"})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	case errors.Is(err, service.ErrInvalidProfile), errors.Is(err, service.ErrInvalidReassignee):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrSelfDeactivation):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAvatarTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrAvatarType):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": err.Error()})
+	}
+	slog.Error(fallback, "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fallback})
 }
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"tasker/internal/middleware"
+	"tasker/internal/model"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// WorkflowHandler обрабатывает настройку статусов и переходов пространства.
+type WorkflowHandler struct {
+	workflows *service.WorkflowService
+	policy    *service.PolicyService
+}
+
+// NewWorkflowHandler создаёт новый WorkflowHandler.
+func NewWorkflowHandler(workflows *service.WorkflowService, policy *service.PolicyService) *WorkflowHandler {
+	return &WorkflowHandler{workflows: workflows, policy: policy}
+}
+
+// RegisterRoutes регистрирует роуты рабочего процесса.
+func (h *WorkflowHandler) RegisterRoutes(app *fiber.App) {
+	grp := app.Group("/spaces")
+	grp.Get("/:id/workflow", middleware.SpaceAccess(h.policy, service.PermTaskRead), h.getWorkflow)    // GET /spaces/:id/workflow
+	grp.Put("/:id/workflow", middleware.SpaceAccess(h.policy, service.PermSpaceManage), h.setWorkflow) // PUT /spaces/:id/workflow
+}
+
+// getWorkflow — GET /spaces/:id/workflow
+// Нужно право task.read.
+func (h *WorkflowHandler) getWorkflow(c fiber.Ctx) error {
+	spaceID := c.Params("id")
+
+	wf, err := h.workflows.GetWorkflow(c, spaceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to load workflow", "detail": err.Error()})
+	}
+	return c.JSON(wf)
+}
+
+// setWorkflow — PUT /spaces/:id/workflow
+// Body: { "statuses": [{"name": "to-do", "category": "todo", "position": 0}], "transitions": [{"from": "to-do", "to": "in-progress"}] }
+// Нужно право space.manage.
+func (h *WorkflowHandler) setWorkflow(c fiber.Ctx) error {
+	spaceID := c.Params("id")
+
+	var in model.Workflow
+	if err := c.Bind().JSON(&in); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	wf, err := h.workflows.SetWorkflow(c, spaceID, in)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWorkflow) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save workflow", "detail": err.Error()})
+	}
+	return c.JSON(wf)
+}
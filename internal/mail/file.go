@@ -0,0 +1,50 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer для локальной разработки и тестов: письма не уходят наружу, а сохраняются
+// файлами .eml в каталоге dir и пишутся в лог.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer создаёт каталог dir, если его нет.
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create mail dir: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	if err := checkHeader(msg); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, render(m.from, msg), 0o640); err != nil {
+		return err
+	}
+	slog.Info("Mail saved", "to", msg.To, "subject", msg.Subject, "file", path)
+	return nil
+}
+
+// sanitize оставляет в адресе только символы, безопасные для имени файла.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
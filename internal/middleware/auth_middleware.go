@@ -2,24 +2,64 @@ package middleware
 
 import (
 	"log/slog"
+	"strings"
 	"tasker/internal/service"
 
 	"github.com/gofiber/fiber/v3"
 )
 
-func AuthMiddleware(authService *service.AuthService) fiber.Handler {
+// RequestToken берёт токен из заголовка Authorization: Bearer, а если его нет — из cookie api_token.
+func RequestToken(c fiber.Ctx) string {
+	if h := c.Get(fiber.HeaderAuthorization); h != "" {
+		if scheme, token, ok := strings.Cut(h, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return c.Cookies("api_token")
+}
+
+// publicPaths — роуты, доступные без токена (вход, регистрация, сброс пароля, SSO).
+var publicPaths = map[string]bool{
+	"/api/login":           true,
+	"/api/login/2fa":       true,
+	"/api/register":        true,
+	"/api/refresh":         true,
+	"/api/password/forgot": true,
+	"/api/password/reset":  true,
+	"/api/auth/methods":    true,
+	"/api/oidc/login":      true,
+	"/api/oidc/callback":   true,
+	// устаревший вход: отвечает 410 и ссылкой на /api/login
+	"/user/login": true,
+}
+
+// AuthMiddleware принимает JWT сессии и персональные токены доступа (префикс tsk_).
+// Для персонального токена в Locals кладутся его ограничения (service.TokenScopeKey).
+func AuthMiddleware(identity *service.IdentityService, tokens *service.AccessTokenService) fiber.Handler {
 	return func(c fiber.Ctx) error {
-		if c.Path() == "/api/login" || c.Path() == "/api/register" {
+		if publicPaths[c.Path()] {
 			return c.Next()
 		}
 
-		token := c.Cookies("api_token")
+		token := RequestToken(c)
 		if token == "" {
-			slog.Warn("Token not found in cookies")
+			slog.Warn("Token not found in Authorization header or cookies")
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token not found"})
 		}
 
-		claims, err := authService.ValidateToken(token)
+		if service.IsAccessToken(token) {
+			userID, scope, err := tokens.Authenticate(c, token, c.IP())
+			if err != nil {
+				slog.Warn("Invalid access token", "error", err)
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+			}
+			c.Locals("userID", userID)
+			c.Locals(service.TokenScopeKey{}, scope)
+			return c.Next()
+		}
+
+		// Authenticate отклоняет и токены отозванных сессий
+		claims, err := identity.Authenticate(c, token)
 		if err != nil {
 			slog.Warn("Invalid token", "error", err)
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
@@ -33,6 +73,7 @@ func AuthMiddleware(authService *service.AuthService) fiber.Handler {
 
 		c.Locals("userID", int(userID))
 		c.Locals("userRole", claims["role"])
+		c.Locals("sessionID", claims["sid"])
 
 		return c.Next()
 	}
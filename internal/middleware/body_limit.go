@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+// BodyRoute — маршрут со своим лимитом тела запроса (Path — шаблон fiber, например "/task/:id/attachments").
+type BodyRoute struct {
+	Method string
+	Path   string
+	Limit  int
+}
+
+// MaxBodyLimit — лимит для fiber.Config.BodyLimit: сервер должен принять тело самого большого
+// из маршрутов, иначе запрос отклоняется ещё до роутинга.
+func MaxBodyLimit(limit int, routes ...BodyRoute) int {
+	for _, r := range routes {
+		limit = max(limit, r.Limit)
+	}
+	return limit
+}
+
+// BodyLimit отвечает 413 на запрос, тело которого больше limit. Для маршрутов из routes
+// действует их собственный лимит; сервер при этом настраивается на MaxBodyLimit.
+func BodyLimit(limit int, routes ...BodyRoute) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		allowed := limit
+		for _, r := range routes {
+			if c.Method() == r.Method && fiber.RoutePatternMatch(c.Path(), r.Path) {
+				allowed = r.Limit
+				break
+			}
+		}
+		if len(c.Body()) > allowed {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "request body too large"})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tasker/internal/middleware"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestBodyLimit(t *testing.T) {
+	routes := []middleware.BodyRoute{{Method: fiber.MethodPost, Path: "/task/:id/attachments", Limit: 64}}
+	if got := middleware.MaxBodyLimit(16, routes...); got != 64 {
+		t.Errorf("MaxBodyLimit = %d, want 64", got)
+	}
+	// сервер принимает больше, чтобы ответ давал сам middleware
+	app := fiber.New(fiber.Config{BodyLimit: 1024})
+	app.Use(middleware.BodyLimit(16, routes...))
+	ok := func(c fiber.Ctx) error { return c.SendStatus(fiber.StatusNoContent) }
+	app.Post("/task/:id/attachments", ok)
+	app.Post("/create", ok)
+	app.Put("/task/:id/attachments", ok)
+
+	cases := []struct {
+		method, path string
+		size         int
+		want         int
+	}{
+		{http.MethodPost, "/create", 16, http.StatusNoContent},
+		{http.MethodPost, "/create", 17, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/task/42/attachments", 64, http.StatusNoContent},
+		{http.MethodPost, "/task/42/attachments", 65, http.StatusRequestEntityTooLarge},
+		// лимит привязан к методу маршрута
+		{http.MethodPut, "/task/42/attachments", 17, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(strings.Repeat("x", tc.size)))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s %s with %d bytes: status %d, want %d", tc.method, tc.path, tc.size, resp.StatusCode, tc.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"tasker/internal/service"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// SpaceResolver находит пространство ресурса по его id из параметра маршрута.
+type SpaceResolver func(ctx context.Context, id string) (string, error)
+
+// RequireAccess пропускает запрос, только если у пользователя есть право perm
+// в пространстве ресурса из параметра :id. Несуществующий ресурс и ресурс чужого
+// пространства дают одинаковый 404, нехватка роли — 403.
+// notFound — ошибка «ресурс не найден», которой отвечаем не участнику.
+// Пространство и роль кладутся в c.Locals("spaceID") и c.Locals("spaceRole").
+func RequireAccess(policy *service.PolicyService, perm service.Permission, resolve SpaceResolver, notFound error) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		spaceID, err := resolve(c, c.Params("id"))
+		if err != nil {
+			return AccessError(c, err)
+		}
+		role, err := policy.Can(c, userID, perm, spaceID)
+		if errors.Is(err, service.ErrNotMember) {
+			return AccessError(c, notFound)
+		}
+		if err != nil {
+			return AccessError(c, err)
+		}
+
+		c.Locals("spaceID", spaceID)
+		c.Locals("spaceRole", role)
+		return c.Next()
+	}
+}
+
+// TaskAccess — доступ к задаче :id (задачи из корзины не находятся).
+func TaskAccess(policy *service.PolicyService, perm service.Permission) fiber.Handler {
+	return RequireAccess(policy, perm, policy.TaskSpace, service.ErrTaskNotFound)
+}
+
+// AnyTaskAccess — доступ к задаче :id, в том числе лежащей в корзине.
+func AnyTaskAccess(policy *service.PolicyService, perm service.Permission) fiber.Handler {
+	return RequireAccess(policy, perm, policy.AnyTaskSpace, service.ErrTaskNotFound)
+}
+
+// CommentAccess — доступ к комментарию :id.
+func CommentAccess(policy *service.PolicyService, perm service.Permission) fiber.Handler {
+	return RequireAccess(policy, perm, policy.CommentSpace, service.ErrCommentNotFound)
+}
+
+// AttachmentAccess — доступ к вложению :id.
+func AttachmentAccess(policy *service.PolicyService, perm service.Permission) fiber.Handler {
+	return RequireAccess(policy, perm, policy.AttachmentSpace, service.ErrAttachmentNotFound)
+}
+
+// SpaceAccess — доступ к пространству :id.
+func SpaceAccess(policy *service.PolicyService, perm service.Permission) fiber.Handler {
+	return RequireAccess(policy, perm, policy.SpaceByID, service.ErrSpaceNotFound)
+}
+
+// RequirePermission пропускает запрос, только если у пользователя есть системное право perm.
+func RequirePermission(policy *service.PolicyService, perm service.Permission) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		if _, err := policy.Can(c, userID, perm, ""); err != nil {
+			return AccessError(c, err)
+		}
+		return c.Next()
+	}
+}
+
+// AccessError переводит ошибки проверки доступа в HTTP-ответ.
+func AccessError(c fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Task not found"})
+	case errors.Is(err, service.ErrCommentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Comment not found"})
+	case errors.Is(err, service.ErrAttachmentNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	case errors.Is(err, service.ErrSpaceNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Space not found"})
+	case errors.Is(err, service.ErrNotMember):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Space not found"})
+	case errors.Is(err, service.ErrTwoFactorRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error(), "twoFactorRequired": true})
+	case errors.Is(err, service.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed"})
+	case errors.Is(err, service.ErrSpaceArchived):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	}
+	slog.Error("Access check failed", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+}
@@ -0,0 +1,431 @@
+// Package mockldap — минимальный LDAP-сервер для локальной проверки входа через каталог и для тестов.
+// Записи берутся из LDIF-файла, пароль — атрибут userPassword открытым текстом. Поддерживает
+// simple bind, поиск (and, or, not, равенство без учёта регистра, present, подстроки) и,
+// если задан TLS, StartTLS и ldaps. По протоколу изменять каталог нельзя; тесты меняют его через Set.
+package mockldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+type entry struct {
+	dn    string
+	norm  string // нормализованный DN в нижнем регистре
+	attrs map[string][]string
+	names []string // имена атрибутов в порядке файла
+}
+
+func (e *entry) get(attr string) []string {
+	for _, name := range e.names {
+		if strings.EqualFold(name, attr) {
+			return e.attrs[name]
+		}
+	}
+	return nil
+}
+
+// Directory — каталог в памяти; один Directory может обслуживать несколько слушателей.
+type Directory struct {
+	// TLS включает StartTLS; для ldaps слушатель создаётся через tls.Listen с ним же.
+	TLS *tls.Config
+
+	mu      sync.RWMutex
+	entries []*entry
+}
+
+// Load читает каталог из LDIF-файла.
+func Load(path string) (*Directory, error) {
+	entries, err := loadLDIF(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Directory{entries: entries}, nil
+}
+
+// Len — число записей каталога.
+func (d *Directory) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.entries)
+}
+
+// Set заменяет значения атрибута записи dn (без значений — удаляет атрибут).
+func (d *Directory) Set(dn, attr string, values ...string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e := d.find(dn)
+	if e == nil {
+		return errors.New("no such entry: " + dn)
+	}
+	name := attr
+	for _, n := range e.names {
+		if strings.EqualFold(n, attr) {
+			name = n
+		}
+	}
+	if len(values) == 0 {
+		delete(e.attrs, name)
+		e.names = slices.DeleteFunc(e.names, func(n string) bool { return n == name })
+		return nil
+	}
+	if _, ok := e.attrs[name]; !ok {
+		e.names = append(e.names, name)
+	}
+	e.attrs[name] = slices.Clone(values)
+	return nil
+}
+
+// Serve принимает соединения, пока слушатель не закроют, и возвращает ошибку Accept.
+func (d *Directory) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle обслуживает соединение до unbind или ошибки.
+func (d *Directory) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		msg, err := ber.ReadPacket(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("read: %v", err)
+			}
+			return
+		}
+		if len(msg.Children) < 2 {
+			return
+		}
+		id := intValue(msg.Children[0])
+		op := msg.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code, text := d.bind(op)
+			write(conn, result(id, ldap.ApplicationBindResponse, code, text))
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			for _, p := range d.search(id, op) {
+				write(conn, p)
+			}
+		case ldap.ApplicationExtendedRequest:
+			if len(op.Children) == 0 || op.Children[0].Data.String() != startTLSOID || d.TLS == nil {
+				write(conn, result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "unsupported extended operation"))
+				continue
+			}
+			write(conn, result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, ""))
+			tc := tls.Server(conn, d.TLS)
+			if err := tc.Handshake(); err != nil {
+				log.Printf("StartTLS: %v", err)
+				return
+			}
+			conn = tc
+		case ldap.ApplicationAbandonRequest:
+		default:
+			write(conn, result(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "operation is not supported"))
+		}
+	}
+}
+
+// bind — simple bind: пустой пароль — анонимный вход, иначе сравнение с userPassword.
+func (d *Directory) bind(op *ber.Packet) (uint16, string) {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported, "only simple bind is supported"
+	}
+	dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+	if password == "" {
+		return ldap.LDAPResultSuccess, ""
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	e := d.find(dn)
+	if e == nil || !slices.Contains(e.get("userPassword"), password) {
+		log.Printf("bind %q: invalid credentials", dn)
+		return ldap.LDAPResultInvalidCredentials, ""
+	}
+	log.Printf("bind %q", dn)
+	return ldap.LDAPResultSuccess, ""
+}
+
+// find ищет запись по DN; вызывать под d.mu.
+func (d *Directory) find(dn string) *entry {
+	norm := normalize(dn)
+	for _, e := range d.entries {
+		if e.norm == norm {
+			return e
+		}
+	}
+	return nil
+}
+
+// search отвечает записями, подходящими под base, scope и фильтр, и SearchResultDone.
+func (d *Directory) search(id int64, op *ber.Packet) []*ber.Packet {
+	if len(op.Children) < 8 {
+		return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "malformed search")}
+	}
+	base := normalize(op.Children[0].Data.String())
+	scope := intValue(op.Children[1])
+	sizeLimit := intValue(op.Children[3])
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, a.Data.String())
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if base != "" && d.find(base) == nil {
+		return []*ber.Packet{result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultNoSuchObject, "")}
+	}
+	var out []*ber.Packet
+	for _, e := range d.entries {
+		if !inScope(e.norm, base, scope) || !matches(e, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(out)) >= sizeLimit {
+			return append(out, result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded, ""))
+		}
+		out = append(out, searchEntry(id, e, attrs))
+	}
+	log.Printf("search %q scope %d %s: %d entries", base, scope, describeFilter(filter), len(out))
+	return append(out, result(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+}
+
+func inScope(dn, base string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == base
+	case ldap.ScopeSingleLevel:
+		_, parent, _ := strings.Cut(dn, ",")
+		return parent == base
+	default:
+		return base == "" || dn == base || strings.HasSuffix(dn, ","+base)
+	}
+}
+
+// matches вычисляет фильтр поиска; незнакомые виды фильтров не совпадают ни с чем.
+func matches(e *entry, f *ber.Packet) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !matches(e, c) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if matches(e, c) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !matches(e, f.Children[0])
+	case ldap.FilterPresent:
+		attr := f.Data.String()
+		return strings.EqualFold(attr, "objectClass") || len(e.get(attr)) > 0
+	case ldap.FilterEqualityMatch:
+		if len(f.Children) != 2 {
+			return false
+		}
+		attr, want := f.Children[0].Data.String(), f.Children[1].Data.String()
+		for _, v := range e.get(attr) {
+			if strings.EqualFold(v, want) || (isDNAttr(attr) && normalize(v) == normalize(want)) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		if len(f.Children) != 2 {
+			return false
+		}
+		for _, v := range e.get(f.Children[0].Data.String()) {
+			if substringsMatch(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isDNAttr(attr string) bool {
+	return strings.EqualFold(attr, "member") || strings.EqualFold(attr, "uniqueMember")
+}
+
+func substringsMatch(v string, parts []*ber.Packet) bool {
+	for i, p := range parts {
+		s := strings.ToLower(p.Data.String())
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case ldap.FilterSubstringsAny:
+			idx := strings.Index(v, s)
+			if idx < 0 {
+				return false
+			}
+			v = v[idx+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if i != len(parts)-1 || !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func describeFilter(f *ber.Packet) string {
+	s, err := ldap.DecompileFilter(f)
+	if err != nil {
+		return "(?)"
+	}
+	return s
+}
+
+// searchEntry — SearchResultEntry с запрошенными атрибутами (пусто или * — все, 1.1 — никаких).
+// userPassword не отдаётся никогда.
+func searchEntry(id int64, e *entry, attrs []string) *ber.Packet {
+	all := len(attrs) == 0 || slices.Contains(attrs, "*")
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	list := ber.NewSequence("attributes")
+	for _, name := range e.names {
+		if strings.EqualFold(name, "userPassword") || slices.Contains(attrs, "1.1") {
+			continue
+		}
+		if !all && !slices.ContainsFunc(attrs, func(a string) bool { return strings.EqualFold(a, name) }) {
+			continue
+		}
+		a := ber.NewSequence("attribute")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range e.attrs[name] {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		a.AppendChild(vals)
+		list.AppendChild(a)
+	}
+	res.AppendChild(list)
+	return envelope(id, res)
+}
+
+func result(id int64, op ber.Tag, code uint16, text string) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "Result")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, text, "diagnosticMessage"))
+	return envelope(id, res)
+}
+
+func envelope(id int64, op *ber.Packet) *ber.Packet {
+	msg := ber.NewSequence("LDAP Response")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	msg.AppendChild(op)
+	return msg
+}
+
+func write(conn net.Conn, p *ber.Packet) {
+	if _, err := conn.Write(p.Bytes()); err != nil {
+		log.Printf("write: %v", err)
+	}
+}
+
+func intValue(p *ber.Packet) int64 {
+	v, _ := ber.ParseInt64(p.Data.Bytes())
+	return v
+}
+
+func normalize(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(dn))
+	}
+	return strings.ToLower(parsed.String())
+}
+
+// loadLDIF читает записи LDIF: "атрибут: значение", "атрибут:: base64", продолжение строки
+// с пробела, записи разделены пустой строкой.
+func loadLDIF(path string) ([]*entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.HasPrefix(line, " ") && len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries []*entry
+	var cur *entry
+	for _, line := range append(lines, "") {
+		if strings.TrimSpace(line) == "" {
+			if cur != nil {
+				entries = append(entries, cur)
+				cur = nil
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, errors.New("invalid LDIF line: " + line)
+		}
+		if strings.HasPrefix(value, ":") {
+			raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return nil, err
+			}
+			value = string(raw)
+		} else {
+			value = strings.TrimSpace(value)
+		}
+		if strings.EqualFold(name, "dn") {
+			cur = &entry{dn: value, norm: normalize(value), attrs: map[string][]string{}}
+			continue
+		}
+		if cur == nil {
+			return nil, errors.New("LDIF attribute before dn: " + line)
+		}
+		if _, seen := cur.attrs[name]; !seen {
+			cur.names = append(cur.names, name)
+		}
+		cur.attrs[name] = append(cur.attrs[name], value)
+	}
+	return entries, nil
+}
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Task struct {
 	ID            string     `db:"id" json:"id"`
@@ -19,38 +22,95 @@ type Task struct {
 	DeadLine      string     `db:"deadline" json:"deadline"`
 	DashboardID   string     `db:"dashboardID" json:"dashboardId"`
 	BlockedBy     []string   `db:"blockedBy" json:"blockedBy"`
+	Blockers      []TaskRef  `json:"blockers,omitempty"`
 	Space         *string    `db:"space" json:"space,omitempty"`
 	AssignerName  *string    `json:"assignerName,omitempty"`
 	ApproverName  *string    `json:"approverName,omitempty"`
 	ReporterName  *string    `json:"reporterName,omitempty"`
 	DashboardName *string    `json:"dashboardName,omitempty"`
+	DeletedAt     *time.Time `db:"deleted_at" json:"deletedAt,omitempty"`
+	DeletedBy     *int       `db:"deleted_by" json:"deletedBy,omitempty"`
+	PurgeAt       *time.Time `json:"purgeAt,omitempty"`
+}
+
+// TaskRef — краткая ссылка на связанную задачу (блокер или зависимая задача).
+type TaskRef struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	Done   bool   `json:"done"`
 }
 
 type TaskPatch struct {
-	Title         *string    `json:"title,omitempty"`
-	Description   *string    `json:"description,omitempty"`
-	Status        *string    `json:"status,omitempty"`
-	ReporterID    *string    `json:"reporterId,omitempty"`
-	AssignerID    *string    `json:"assignerId,omitempty"`
-	ReviewerID    *string    `json:"reviewerId,omitempty"`
-	ApproverID    *string    `json:"approverId,omitempty"`
-	ApproveStatus *string    `json:"approveStatus,omitempty"`
-	StartedAt     *time.Time `json:"startedAt,omitempty"`
-	CompletedAt   *time.Time `json:"completedAt,omitempty"`
-	DeadLine      *string    `json:"deadline,omitempty"`
-	DashboardID   *string    `json:"dashboardId,omitempty"`
-	BlockedBy     *[]string  `json:"blockedBy,omitempty"`
+	Title         *string   `json:"title,omitempty"`
+	Description   *string   `json:"description,omitempty"`
+	Status        *string   `json:"status,omitempty"`
+	ReporterID    *string   `json:"reporterId,omitempty"`
+	AssignerID    *string   `json:"assignerId,omitempty"`
+	ReviewerID    *string   `json:"reviewerId,omitempty"`
+	ApproverID    *string   `json:"approverId,omitempty"`
+	ApproveStatus *string   `json:"approveStatus,omitempty"`
+	DeadLine      *string   `json:"deadline,omitempty"`
+	DashboardID   *string   `json:"dashboardId,omitempty"`
+	BlockedBy     *[]string `json:"blockedBy,omitempty"`
 }
 
 type User struct {
-	ID         int       `db:"id" json:"id"`
-	Name       string    `db:"name" json:"name"`
-	Surname    string    `db:"surname" json:"surname"`
-	Middlename *string   `db:"middlename" json:"middlename,omitempty"`
-	Login      string    `db:"login" json:"login"`
-	RoleID     int       `db:"roleID" json:"roleID"`
-	Password   string    `db:"password" json:"-"`
-	Spaces     *[]string `db:"spaces" json:"spaces,omitempty"`
+	ID         int     `db:"id" json:"id"`
+	Name       string  `db:"name" json:"name"`
+	Surname    string  `db:"surname" json:"surname"`
+	Middlename *string `db:"middlename" json:"middlename,omitempty"`
+	Login      string  `db:"login" json:"login"`
+	Email      *string `db:"email" json:"email,omitempty"`
+	RoleID     int     `db:"roleID" json:"roleID"`
+	Password   string  `db:"password" json:"-"`
+	// Deactivated — учётная запись отключена (в списках для выбора исполнителя помечается).
+	Deactivated bool `db:"deactivated" json:"deactivated,omitempty"`
+	// AvatarURL — адрес аватара с версией для кеша; пустой, если аватар не загружен.
+	AvatarURL *string `db:"-" json:"avatarUrl,omitempty"`
+}
+
+// UserProfile — профиль текущего пользователя.
+type UserProfile struct {
+	ID         int     `json:"id"`
+	Login      string  `json:"login"`
+	Name       string  `json:"name"`
+	Surname    string  `json:"surname"`
+	Middlename *string `json:"middlename,omitempty"`
+	Email      *string `json:"email,omitempty"`
+	// EmailVerified — владение email подтверждено (письмом или внешним источником учётных записей).
+	EmailVerified bool `json:"emailVerified"`
+	// Timezone — зона IANA (Europe/Moscow); пустая — не выбрана.
+	Timezone  *string `json:"timezone,omitempty"`
+	Locale    *string `json:"locale,omitempty"`
+	AvatarURL *string `json:"avatarUrl,omitempty"`
+}
+
+// ProfileUpdate — изменение профиля; nil — поле не меняется, "" у необязательных полей — очистить.
+type ProfileUpdate struct {
+	Name       *string `json:"name"`
+	Surname    *string `json:"surname"`
+	Middlename *string `json:"middlename"`
+	Timezone   *string `json:"timezone"`
+	Locale     *string `json:"locale"`
+}
+
+// UserListQuery — поиск по списку пользователей.
+type UserListQuery struct {
+	// Search — слова, каждое ищется в имени, фамилии, отчестве или логине.
+	Search             string
+	IncludeDeactivated bool
+	Limit              int
+	Offset             int
+}
+
+// UserDeactivation — итог деактивации: какие открытые задачи переданы другому пользователю,
+// а какие остались за деактивированным (исполнитель или согласующий) и требуют внимания.
+type UserDeactivation struct {
+	UserID          int      `json:"userId"`
+	ReassignedTo    *int     `json:"reassignedTo,omitempty"`
+	ReassignedTasks []string `json:"reassignedTasks"`
+	FlaggedTasks    []string `json:"flaggedTasks"`
 }
 
 type RegisterRequest struct {
@@ -58,13 +118,159 @@ type RegisterRequest struct {
 	Surname    string `json:"surname"`
 	Middlename string `json:"middlename"`
 	Login      string `json:"login"`
-	RoleID     int    `json:"roleID"`
 	Password   string `json:"password"`
+	Email      string `json:"email"`
+	// InviteToken — токен приглашения в пространство: после регистрации пользователь сразу в него вступает.
+	InviteToken string `json:"inviteToken"`
 }
 
 type LoginRequest struct {
 	Login    string `json:"login"`
 	Password string `json:"password"`
+	// Provider — источник учётных данных (local по умолчанию, см. GET /api/auth/methods).
+	Provider string `json:"provider"`
+	// Device — название устройства для списка сессий; по умолчанию — User-Agent.
+	Device string `json:"device"`
+}
+
+// ClientInfo — откуда пришёл запрос на вход или обновление токена.
+type ClientInfo struct {
+	Device    string
+	IP        string
+	UserAgent string
+}
+
+// LoginResult — итог первого шага входа: либо сессия (Tokens и User), либо, если у пользователя
+// включена 2FA, Challenge для второго шага.
+type LoginResult struct {
+	Tokens    *TokenPair
+	User      *User
+	Challenge *LoginChallenge
+	// Redirect — куда вернуть браузер после входа через OIDC.
+	Redirect string
+}
+
+// LoginChallenge — одноразовый токен второго шага входа; обменивается на сессию вместе с кодом.
+type LoginChallenge struct {
+	Token     string    `json:"challengeToken"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TwoFactorStatus — состояние 2FA пользователя.
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	ConfirmedAt       *time.Time `json:"confirmedAt,omitempty"`
+	RecoveryCodesLeft int        `json:"recoveryCodesLeft"`
+}
+
+// TwoFactorEnrollment — секрет TOTP для приложения-аутентификатора: URI для QR-кода
+// и тот же секрет в base32 для ручного ввода.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+	Issuer     string `json:"issuer"`
+	Account    string `json:"account"`
+	Digits     int    `json:"digits"`
+	Period     int    `json:"period"`
+}
+
+// TokenPair — access-токен (JWT) и refresh-токен сессии.
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+	SessionID        string    `json:"sessionId"`
+}
+
+// JWK — открытый ключ проверки подписи JWT (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet — ответ /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// AccessToken — персональный токен доступа. Token заполняется только в ответе на создание.
+type AccessToken struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Permissions []string   `json:"permissions"`
+	SpaceID     *string    `json:"spaceId,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP  *string    `json:"lastUsedIp,omitempty"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty"`
+	Token       string     `json:"token,omitempty"`
+}
+
+// AccessTokenInput — запрос на выпуск токена. SpaceID ограничивает токен одним пространством,
+// ExpiresInDays = 0 — бессрочный.
+type AccessTokenInput struct {
+	Name          string   `json:"name"`
+	Permissions   []string `json:"permissions"`
+	SpaceID       string   `json:"spaceId"`
+	ExpiresInDays int      `json:"expiresInDays"`
+}
+
+// Session — сессия входа пользователя.
+type Session struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+// Типы событий журнала входов.
+const (
+	AuthEventLoginSucceeded = "login_succeeded"
+	AuthEventLoginFailed    = "login_failed"
+	AuthEventLoginBlocked   = "login_blocked"
+	// AuthEventTwoFactorChallenge — пароль верен, ожидается код 2FA.
+	AuthEventTwoFactorChallenge = "login_2fa_challenge"
+	AuthEventAccountLocked      = "account_locked"
+	AuthEventAccountUnlock      = "account_unlocked"
+	AuthEventPasswordChanged    = "password_changed"
+	// AuthEventPasswordResetRequest — запрошено письмо для сброса пароля.
+	AuthEventPasswordResetRequest = "password_reset_requested"
+	AuthEventPasswordReset        = "password_reset"
+	// AuthEventSSOLinked — учётная запись SSO привязана к пользователю по email.
+	AuthEventSSOLinked = "sso_linked"
+	// AuthEventSSOProvisioned — пользователь создан при первом входе через SSO.
+	AuthEventSSOProvisioned = "sso_provisioned"
+	// AuthEventLDAPLinked — учётная запись каталога привязана к пользователю с тем же логином.
+	AuthEventLDAPLinked = "ldap_linked"
+	// AuthEventLDAPProvisioned — пользователь создан при первом входе через LDAP.
+	AuthEventLDAPProvisioned = "ldap_provisioned"
+)
+
+// AuthEvent — запись журнала входов. UserID пуст, если логин не найден; ActorID — кто
+// выполнил действие администратора (разблокировку).
+type AuthEvent struct {
+	ID        int64     `json:"id"`
+	Event     string    `json:"event"`
+	Login     string    `json:"login"`
+	UserID    *int      `json:"userId,omitempty"`
+	ActorID   *int      `json:"actorId,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 type DashBoards struct {
 	ID   string `json:"id"`
@@ -72,10 +278,89 @@ type DashBoards struct {
 }
 
 type Space struct {
-	ID        string    `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	CreatorID int       `db:"creator_id" json:"creatorId"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	ID         string     `db:"id" json:"id"`
+	Name       string     `db:"name" json:"name"`
+	CreatorID  int        `db:"creator_id" json:"creatorId"`
+	OwnerID    int        `db:"owner_id" json:"ownerId"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	ArchivedAt *time.Time `db:"archived_at" json:"archivedAt,omitempty"`
+	Require2FA bool       `db:"require_2fa" json:"require2fa"`
+	// LDAPGroup — DN группы каталога, с которой синхронизируется состав пространства.
+	LDAPGroup *string `db:"ldap_group" json:"ldapGroup,omitempty"`
+}
+
+// SpaceSummary — пространство в списке пользователя: его роль и число участников и задач.
+type SpaceSummary struct {
+	Space
+	Role        string `json:"role"`
+	MemberCount int    `json:"memberCount"`
+	TaskCount   int    `json:"taskCount"`
+}
+
+// SpaceMember — участник пространства.
+type SpaceMember struct {
+	UserID    int       `json:"userId"`
+	Login     string    `json:"login"`
+	Name      string    `json:"name"`
+	Surname   string    `json:"surname"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	InvitedBy *int      `json:"invitedBy,omitempty"`
+	// TwoFactor — включена ли у участника 2FA (важно для пространств с require2fa).
+	TwoFactor bool `json:"twoFactor"`
+	// Deactivated — учётная запись участника отключена.
+	Deactivated bool `json:"deactivated,omitempty"`
+}
+
+// Виды и статусы приглашений в пространство.
+const (
+	InvitationKindUser = "user"
+	InvitationKindLink = "link"
+
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+	InvitationUsed     = "used"
+)
+
+// Invitation — приглашение в пространство: адресное (пользователю или на email) или ссылка.
+// Token и Link заполняются только в ответе на создание.
+type Invitation struct {
+	ID           string     `json:"id"`
+	SpaceID      string     `json:"spaceId"`
+	SpaceName    string     `json:"spaceName"`
+	Kind         string     `json:"kind"`
+	Role         string     `json:"role"`
+	InviterID    *int       `json:"inviterId,omitempty"`
+	InviteeID    *int       `json:"inviteeId,omitempty"`
+	InviteeEmail *string    `json:"inviteeEmail,omitempty"`
+	MaxUses      *int       `json:"maxUses,omitempty"`
+	Uses         int        `json:"uses"`
+	Status       string     `json:"status"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	RespondedAt  *time.Time `json:"respondedAt,omitempty"`
+	Token        string     `json:"token,omitempty"`
+	Link         string     `json:"link,omitempty"`
+}
+
+// InvitationInput — запрос на приглашение. Адресное — по userId, login или email;
+// для ссылки адресата нет, MaxUses = 0 — без ограничения числа вступлений.
+type InvitationInput struct {
+	UserID         int    `json:"userId"`
+	Login          string `json:"login"`
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	MaxUses        int    `json:"maxUses"`
+	ExpiresInHours int    `json:"expiresInHours"`
+}
+
+// SpaceDetails — пространство с участниками.
+type SpaceDetails struct {
+	Space
+	Role    string        `json:"role"`
+	Members []SpaceMember `json:"members"`
 }
 
 type SpaceMembership struct {
@@ -84,3 +369,350 @@ type SpaceMembership struct {
 	Role     string    `db:"role" json:"role"`
 	JoinedAt time.Time `db:"joined_at" json:"joinedAt"`
 }
+
+// Области действия ролей.
+const (
+	RoleScopeSystem = "system"
+	RoleScopeSpace  = "space"
+)
+
+// Role — именованный набор прав. Системная роль назначается пользователю (users.roleid),
+// роль пространства — участнику (space_memberships.role хранит её имя).
+type Role struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Scope       string   `json:"scope"`
+	Permissions []string `json:"permissions"`
+	Builtin     bool     `json:"builtin"`
+}
+
+// RoleInput — тело создания и изменения роли.
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Scope       string   `json:"scope"`
+	Permissions []string `json:"permissions"`
+}
+
+// PermissionInfo — право из каталога.
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+}
+
+// Категории статусов рабочего процесса.
+const (
+	StatusCategoryTodo       = "todo"
+	StatusCategoryInProgress = "in-progress"
+	StatusCategoryDone       = "done"
+)
+
+type WorkflowStatus struct {
+	Name     string `db:"name" json:"name"`
+	Category string `db:"category" json:"category"`
+	Position int    `db:"position" json:"position"`
+}
+
+type WorkflowTransition struct {
+	From string `db:"from_status" json:"from"`
+	To   string `db:"to_status" json:"to"`
+}
+
+type Workflow struct {
+	SpaceID     string               `json:"spaceId"`
+	Statuses    []WorkflowStatus     `json:"statuses"`
+	Transitions []WorkflowTransition `json:"transitions"`
+}
+
+// Значения tasks."approveStatus".
+const (
+	ApproveStatusNeedApproval = "need-approval"
+	ApproveStatusApproved     = "approved"
+	ApproveStatusRejected     = "rejected"
+)
+
+// Режимы политики одобрения пространства.
+const (
+	ApprovalModeAnyOf  = "any-of"
+	ApprovalModeAllOf  = "all-of"
+	ApprovalModeQuorum = "quorum"
+)
+
+type ApprovalPolicy struct {
+	SpaceID      string  `db:"space_id" json:"spaceId"`
+	Mode         string  `db:"mode" json:"mode"`
+	Quorum       int     `db:"quorum" json:"quorum"`
+	RejectStatus *string `db:"reject_status" json:"rejectStatus,omitempty"`
+}
+
+type ApprovalDecision struct {
+	ID         string    `db:"id" json:"id"`
+	TaskID     string    `db:"task_id" json:"taskId"`
+	ApproverID string    `db:"approver_id" json:"approverId"`
+	Decision   string    `db:"decision" json:"decision"`
+	Comment    string    `db:"comment" json:"comment"`
+	DecidedAt  time.Time `db:"decided_at" json:"decidedAt"`
+}
+
+type TaskApprovalState struct {
+	TaskID        string             `json:"taskId"`
+	Status        string             `json:"status"`
+	ApproveStatus string             `json:"approveStatus"`
+	Policy        ApprovalPolicy     `json:"policy"`
+	Approvers     []string           `json:"approvers"`
+	Decisions     []ApprovalDecision `json:"decisions"`
+	Required      int                `json:"required"`
+}
+
+// ScheduleTask — задача в отчёте по расписанию (строка диаграммы Ганта).
+type ScheduleTask struct {
+	ID                string     `json:"id"`
+	Title             string     `json:"title"`
+	Status            string     `json:"status"`
+	Done              bool       `json:"done"`
+	External          bool       `json:"external,omitempty"`
+	AssignerID        *string    `json:"assignerId,omitempty"`
+	BlockedBy         []string   `json:"blockedBy"`
+	Start             time.Time  `json:"start"`
+	Finish            time.Time  `json:"finish"`
+	DurationHours     float64    `json:"durationHours"`
+	Deadline          *time.Time `json:"deadline,omitempty"`
+	SlackHours        float64    `json:"slackHours"`
+	Critical          bool       `json:"critical"`
+	MissesDeadline    bool       `json:"missesDeadline"`
+	DelayedByBlockers bool       `json:"delayedByBlockers"`
+}
+
+type ScheduleReport struct {
+	DashboardID     string         `json:"dashboardId,omitempty"`
+	SpaceID         string         `json:"spaceId,omitempty"`
+	GeneratedAt     time.Time      `json:"generatedAt"`
+	ProjectedFinish *time.Time     `json:"projectedFinish,omitempty"`
+	CriticalPath    []string       `json:"criticalPath"`
+	AtRisk          []string       `json:"atRisk"`
+	Tasks           []ScheduleTask `json:"tasks"`
+}
+
+type Comment struct {
+	ID         string     `db:"id" json:"id"`
+	TaskID     string     `db:"task_id" json:"taskId"`
+	ParentID   *string    `db:"parent_id" json:"parentId,omitempty"`
+	AuthorID   int        `db:"author_id" json:"authorId"`
+	AuthorName *string    `json:"authorName,omitempty"`
+	Body       string     `db:"body" json:"body"`
+	CreatedAt  time.Time  `db:"created_at" json:"createdAt"`
+	UpdatedAt  time.Time  `db:"updated_at" json:"updatedAt"`
+	Edited     bool       `json:"edited"`
+	DeletedAt  *time.Time `db:"deleted_at" json:"deletedAt,omitempty"`
+	Mentions   []string   `json:"mentions"`
+	Replies    []*Comment `json:"replies,omitempty"`
+}
+
+type CommentEdit struct {
+	Body     string    `db:"body" json:"body"`
+	EditorID int       `db:"editor_id" json:"editorId"`
+	EditedAt time.Time `db:"edited_at" json:"editedAt"`
+}
+
+// Mention — упоминание пользователя в комментарии к задаче.
+type Mention struct {
+	CommentID   string    `json:"commentId"`
+	TaskID      string    `json:"taskId"`
+	TaskTitle   string    `json:"taskTitle"`
+	AuthorID    int       `json:"authorId"`
+	Body        string    `json:"body"`
+	MentionedAt time.Time `json:"mentionedAt"`
+}
+
+type Attachment struct {
+	ID          string    `db:"id" json:"id"`
+	TaskID      string    `db:"task_id" json:"taskId"`
+	SpaceID     string    `db:"space_id" json:"spaceId"`
+	FileName    string    `db:"file_name" json:"fileName"`
+	ContentType string    `db:"content_type" json:"contentType"`
+	Size        int64     `db:"size" json:"size"`
+	Checksum    string    `db:"checksum" json:"checksum"`
+	UploaderID  int       `db:"uploader_id" json:"uploaderId"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+}
+
+type AttachmentUsage struct {
+	SpaceID    string `json:"spaceId"`
+	UsedBytes  int64  `json:"usedBytes"`
+	QuotaBytes int64  `json:"quotaBytes"`
+}
+
+// Действия в истории задачи.
+const (
+	TaskActionCreate  = "create"
+	TaskActionUpdate  = "update"
+	TaskActionDelete  = "delete"
+	TaskActionRestore = "restore"
+	TaskActionDone    = "done"
+)
+
+// FieldChange — изменение одного поля задачи; имена полей совпадают с JSON-полями Task.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// TaskHistoryEntry — неизменяемая запись журнала изменений задачи.
+// ActorID пустой, если изменение сделала система (например, автоматическая разблокировка).
+type TaskHistoryEntry struct {
+	ID        int64         `json:"id"`
+	TaskID    string        `json:"taskId"`
+	Action    string        `json:"action"`
+	ActorID   *int          `json:"actorId,omitempty"`
+	ActorName *string       `json:"actorName,omitempty"`
+	Changes   []FieldChange `json:"changes"`
+	At        time.Time     `json:"at"`
+}
+
+// TaskSort — поле сортировки списка задач; Desc — по убыванию.
+type TaskSort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// TaskFilter — параметры выборки задач для /list. Пустые поля не фильтруют.
+// Выборка всегда ограничена пространствами, где пользователь — участник.
+type TaskFilter struct {
+	SpaceID       string
+	DashboardID   string
+	Statuses      []string
+	AssignerID    string
+	ReporterID    string
+	ApproverID    string
+	ApproveStatus string
+	// DeadlineFrom/DeadlineTo — даты "2006-01-02", включительно.
+	DeadlineFrom string
+	DeadlineTo   string
+	CreatedFrom  *time.Time
+	CreatedTo    *time.Time
+	UpdatedFrom  *time.Time
+	UpdatedTo    *time.Time
+	// Blocked: true — только с незакрытыми блокерами, false — только без них.
+	Blocked *bool
+	// AssigneeDeactivated — только задачи, исполнитель которых деактивирован.
+	AssigneeDeactivated bool
+	Sort                []TaskSort
+	Limit               int
+	Cursor              string
+	WithTotal           bool
+}
+
+// TaskPage — страница списка задач. NextCursor пустой на последней странице.
+type TaskPage struct {
+	Items      []Task  `json:"items"`
+	NextCursor *string `json:"nextCursor"`
+	Total      *int    `json:"total,omitempty"`
+}
+
+// Режимы поиска задач.
+const (
+	SearchModeFullText = "fulltext"
+	SearchModeFuzzy    = "fuzzy"
+)
+
+// TaskSearchHit — найденная задача. Сниппеты — экранированный HTML, совпадения в <mark>.
+type TaskSearchHit struct {
+	ID             string  `json:"id"`
+	Title          string  `json:"title"`
+	Status         string  `json:"status"`
+	Space          string  `json:"space"`
+	DashboardID    string  `json:"dashboardId"`
+	Rank           float64 `json:"rank"`
+	TitleSnippet   string  `json:"titleSnippet"`
+	Snippet        string  `json:"snippet"`
+	CommentID      *string `json:"commentId,omitempty"`
+	CommentSnippet *string `json:"commentSnippet,omitempty"`
+}
+
+// TaskSearchResult — ответ поиска. Mode = fuzzy, если полнотекстовый поиск ничего не нашёл
+// и сработал поиск по триграммам (или этот режим запрошен явно).
+type TaskSearchResult struct {
+	Query string          `json:"query"`
+	Mode  string          `json:"mode"`
+	Items []TaskSearchHit `json:"items"`
+}
+
+// Схемы SCIM 2.0 (RFC 7643, RFC 7644).
+const (
+	SCIMSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMSchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+type SCIMMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	MiddleName string `json:"middleName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMUser — пользователь в представлении SCIM: id — users.id, userName — login.
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        SCIMName    `json:"name"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMEmail `json:"emails,omitempty"`
+	// Active не указан — пользователь активен.
+	Active *bool `json:"active,omitempty"`
+	// Password только принимается, в ответах его нет.
+	Password string    `json:"password,omitempty"`
+	Meta     *SCIMMeta `json:"meta,omitempty"`
+}
+
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// SCIMGroup — группа SCIM, она же пространство: id — spaces.id, members — участники.
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+type SCIMListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+// SCIMPatch — тело PATCH-запроса (PatchOp).
+type SCIMPatch struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrAccessTokenNotFound — токена нет или он чужой.
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	// ErrInvalidAccessToken — токен не найден, отозван или истёк.
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// ErrInvalidAccessTokenInput — неверные параметры нового токена.
+	ErrInvalidAccessTokenInput = errors.New("invalid access token request")
+)
+
+// AccessTokenPrefix отличает персональные токены от JWT в заголовке Authorization.
+const AccessTokenPrefix = "tsk_"
+
+const (
+	maxAccessTokenName = 100
+	// accessTokenTouchInterval — чаще этого last_used_at не обновляется, чтобы не писать в базу на каждый запрос.
+	accessTokenTouchInterval = time.Minute
+)
+
+// IsAccessToken — похоже ли значение на персональный токен.
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// TokenScopeKey — ключ в контексте запроса (fiber Locals), под которым AuthMiddleware
+// кладёт *TokenScope для запросов с персональным токеном.
+type TokenScopeKey struct{}
+
+// TokenScope — ограничения персонального токена: действуют только перечисленные права
+// и, если задано, только в одном пространстве. Права самого пользователя при этом тоже проверяются.
+type TokenScope struct {
+	TokenID     string
+	Permissions []Permission
+	SpaceID     string
+}
+
+func tokenScopeFrom(ctx context.Context) *TokenScope {
+	sc, _ := ctx.Value(TokenScopeKey{}).(*TokenScope)
+	return sc
+}
+
+// check проверяет право perm в spaceID (пустой — системное право). Чужое пространство
+// для токена одного пространства выглядит так же, как пространство, где пользователь не состоит.
+func (sc *TokenScope) check(perm Permission, spaceID string) error {
+	if sc.SpaceID != "" && spaceID != sc.SpaceID {
+		if spaceID == "" {
+			return fmt.Errorf("%s is not available for a space-scoped token: %w", perm, ErrForbidden)
+		}
+		return fmt.Errorf("space %s: %w", spaceID, ErrNotMember)
+	}
+	if !slices.Contains(sc.Permissions, perm) {
+		return fmt.Errorf("token has no %s: %w", perm, ErrForbidden)
+	}
+	return nil
+}
+
+// checkTokenScope — ограничения токена запроса, если запрос пришёл с персональным токеном.
+func checkTokenScope(ctx context.Context, perm Permission, spaceID string) error {
+	if sc := tokenScopeFrom(ctx); sc != nil {
+		return sc.check(perm, spaceID)
+	}
+	return nil
+}
+
+// scopedSpace сужает фильтр списков (задачи, поиск, отчёты) до пространства токена.
+// Токену нужно право task.read. ok = false — запрошено другое пространство, результат пуст.
+func scopedSpace(ctx context.Context, spaceID string) (string, bool, error) {
+	sc := tokenScopeFrom(ctx)
+	if sc == nil {
+		return spaceID, true, nil
+	}
+	if !slices.Contains(sc.Permissions, PermTaskRead) {
+		return "", false, fmt.Errorf("token has no %s: %w", PermTaskRead, ErrForbidden)
+	}
+	if sc.SpaceID == "" {
+		return spaceID, true, nil
+	}
+	return sc.SpaceID, spaceID == "" || spaceID == sc.SpaceID, nil
+}
+
+// interactiveOnly запрещает действие по персональному токену: управление токенами, сессиями,
+// паролем, вступление в пространства и выход из них доступны только после входа по паролю.
+func interactiveOnly(ctx context.Context) error {
+	if tokenScopeFrom(ctx) != nil {
+		return fmt.Errorf("not available with a personal access token: %w", ErrForbidden)
+	}
+	return nil
+}
+
+// AccessTokenService управляет персональными токенами доступа (для скриптов и CI).
+type AccessTokenService struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewAccessTokenService(dbPool *pgxpool.Pool) *AccessTokenService {
+	return &AccessTokenService{dbPool: dbPool}
+}
+
+const accessTokenColumns = `id::text, name, prefix, permissions, space_id, expires_at, created_at, last_used_at, last_used_ip, revoked_at`
+
+func scanAccessToken(row pgx.Row) (*model.AccessToken, error) {
+	var t model.AccessToken
+	err := row.Scan(&t.ID, &t.Name, &t.Prefix, &t.Permissions, &t.SpaceID, &t.ExpiresAt, &t.CreatedAt,
+		&t.LastUsedAt, &t.LastUsedIP, &t.RevokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAccessTokenNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+// validateAccessToken проверяет имя и права токена. Токен одного пространства может нести
+// только права пространства, а пользователь должен в нём состоять.
+func (s *AccessTokenService) validateAccessToken(ctx context.Context, userID int, in *model.AccessTokenInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || len([]rune(in.Name)) > maxAccessTokenName {
+		return fmt.Errorf("%w: name is required and must be at most %d characters", ErrInvalidAccessTokenInput, maxAccessTokenName)
+	}
+	if len(in.Permissions) == 0 {
+		return fmt.Errorf("%w: at least one permission is required", ErrInvalidAccessTokenInput)
+	}
+	if in.ExpiresInDays < 0 {
+		return fmt.Errorf("%w: expiresInDays must not be negative", ErrInvalidAccessTokenInput)
+	}
+
+	allowed := permissionsOf("")
+	if in.SpaceID != "" {
+		allowed = permissionsOf(model.RoleScopeSpace)
+	}
+	for _, p := range in.Permissions {
+		if !slices.Contains(allowed, p) {
+			return fmt.Errorf("%w: permission %q is unknown or not allowed for this token", ErrInvalidAccessTokenInput, p)
+		}
+	}
+	slices.Sort(in.Permissions)
+	in.Permissions = slices.Compact(in.Permissions)
+
+	if in.SpaceID != "" {
+		var member bool
+		if err := s.dbPool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM space_memberships WHERE space_id = $1 AND user_id = $2)`,
+			in.SpaceID, userID).Scan(&member); err != nil {
+			return err
+		}
+		if !member {
+			return fmt.Errorf("space %s: %w", in.SpaceID, ErrSpaceNotFound)
+		}
+	}
+	return nil
+}
+
+// Create выпускает токен. Сам токен возвращается только здесь, в базе хранится его sha256.
+// ExpiresInDays = 0 — бессрочный.
+func (s *AccessTokenService) Create(ctx context.Context, userID int, in model.AccessTokenInput) (*model.AccessToken, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.validateAccessToken(ctx, userID, &in); err != nil {
+		return nil, err
+	}
+
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	token := AccessTokenPrefix + secret
+	var expires *time.Time
+	if in.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, in.ExpiresInDays)
+		expires = &t
+	}
+	var spaceID *string
+	if in.SpaceID != "" {
+		spaceID = &in.SpaceID
+	}
+
+	t, err := scanAccessToken(s.dbPool.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, prefix, token_hash, permissions, space_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+accessTokenColumns,
+		userID, in.Name, token[:len(AccessTokenPrefix)+6], hashToken(token), in.Permissions, spaceID, expires))
+	if err != nil {
+		return nil, err
+	}
+	t.Token = token
+	return t, nil
+}
+
+// List возвращает токены пользователя, включая отозванные и истёкшие.
+func (s *AccessTokenService) List(ctx context.Context, userID int) ([]model.AccessToken, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT `+accessTokenColumns+` FROM personal_access_tokens WHERE user_id = $1 ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []model.AccessToken{}
+	for rows.Next() {
+		t, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke отзывает токен пользователя.
+func (s *AccessTokenService) Revoke(ctx context.Context, userID int, tokenID string) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
+	}
+	tag, err := s.dbPool.Exec(ctx, `
+		UPDATE personal_access_tokens SET revoked_at = COALESCE(revoked_at, now())
+		WHERE id::text = $1 AND user_id = $2
+	`, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("token %s: %w", tokenID, ErrAccessTokenNotFound)
+	}
+	return nil
+}
+
+// Authenticate находит действующий токен, отмечает его использование (время и IP)
+// и возвращает владельца и ограничения токена.
+func (s *AccessTokenService) Authenticate(ctx context.Context, token, ip string) (int, *TokenScope, error) {
+	var (
+		userID  int
+		scope   TokenScope
+		perms   []string
+		spaceID *string
+	)
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT id::text, user_id, permissions, space_id
+		FROM personal_access_tokens
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+			AND user_id IN (SELECT id FROM users WHERE deactivated_at IS NULL)
+	`, hashToken(token)).Scan(&scope.TokenID, &userID, &perms, &spaceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil, ErrInvalidAccessToken
+		}
+		return 0, nil, err
+	}
+	for _, p := range perms {
+		scope.Permissions = append(scope.Permissions, Permission(p))
+	}
+	if spaceID != nil {
+		scope.SpaceID = *spaceID
+	}
+
+	if _, err := s.dbPool.Exec(ctx, `
+		UPDATE personal_access_tokens SET last_used_at = now(), last_used_ip = $2
+		WHERE id::text = $1 AND (last_used_at IS NULL OR last_used_at < now() - make_interval(secs => $3) OR last_used_ip IS DISTINCT FROM $2)
+	`, scope.TokenID, ip, accessTokenTouchInterval.Seconds()); err != nil {
+		return 0, nil, err
+	}
+	return userID, &scope, nil
+}
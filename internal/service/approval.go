@@ -0,0 +1,485 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrNotApprover — пользователь не входит в список согласующих задачи.
+	ErrNotApprover = errors.New("user is not an approver of this task")
+	// ErrApprovalNotPending — задача сейчас не ожидает одобрения.
+	ErrApprovalNotPending = errors.New("task is not waiting for approval")
+	// ErrAlreadyDecided — согласующий уже принял решение в текущем раунде.
+	ErrAlreadyDecided = errors.New("approver has already decided")
+	// ErrSelfApproval — репортер задачи или запросивший одобрение решает по ней сам.
+	ErrSelfApproval = errors.New("reporter or requester cannot approve their own task")
+	// ErrCommentRequired — отклонение без комментария.
+	ErrCommentRequired = errors.New("comment is required")
+	// ErrInvalidApprovalPolicy — некорректная политика одобрения.
+	ErrInvalidApprovalPolicy = errors.New("invalid approval policy")
+	// ErrForbidden — у пользователя нет прав на действие.
+	ErrForbidden = errors.New("forbidden")
+)
+
+type ApprovalService struct {
+	dbPool    *pgxpool.Pool
+	spaces    *SpaceService
+	workflows *WorkflowService
+}
+
+func NewApprovalService(dbPool *pgxpool.Pool, spaces *SpaceService, workflows *WorkflowService) *ApprovalService {
+	return &ApprovalService{dbPool: dbPool, spaces: spaces, workflows: workflows}
+}
+
+// requiredApprovals — сколько одобрений нужно по политике при n согласующих.
+func requiredApprovals(policy model.ApprovalPolicy, n int) int {
+	switch policy.Mode {
+	case model.ApprovalModeAllOf:
+		return n
+	case model.ApprovalModeQuorum:
+		if policy.Quorum > n {
+			return n
+		}
+		return policy.Quorum
+	default:
+		return 1
+	}
+}
+
+// rejectTarget выбирает статус, в который задача возвращается после отклонения:
+// rejectStatus из политики, иначе ближайший более ранний статус, в который разрешён переход,
+// иначе начальный статус рабочего процесса.
+func rejectTarget(wf *model.Workflow, policy model.ApprovalPolicy, current string) model.WorkflowStatus {
+	if policy.RejectStatus != nil {
+		if st, ok := workflowStatus(wf, *policy.RejectStatus); ok {
+			return st
+		}
+	}
+
+	cur, ok := workflowStatus(wf, current)
+	if ok {
+		var best *model.WorkflowStatus
+		for _, name := range allowedTransitions(wf, current) {
+			st, _ := workflowStatus(wf, name)
+			if st.Position < cur.Position && st.Category != model.StatusCategoryDone {
+				if best == nil || st.Position > best.Position {
+					best = &st
+				}
+			}
+		}
+		if best != nil {
+			return *best
+		}
+	}
+	return initialStatus(wf)
+}
+
+// GetPolicy возвращает политику одобрения пространства (по умолчанию any-of).
+func (s *ApprovalService) GetPolicy(ctx context.Context, spaceID string) (model.ApprovalPolicy, error) {
+	policy := model.ApprovalPolicy{SpaceID: spaceID, Mode: model.ApprovalModeAnyOf, Quorum: 1}
+	if spaceID == "" {
+		return policy, nil
+	}
+
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT mode, quorum, reject_status FROM approval_policies WHERE space_id = $1
+	`, spaceID).Scan(&policy.Mode, &policy.Quorum, &policy.RejectStatus)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// SetPolicy сохраняет политику одобрения пространства.
+func (s *ApprovalService) SetPolicy(ctx context.Context, spaceID string, policy model.ApprovalPolicy) (model.ApprovalPolicy, error) {
+	policy.SpaceID = spaceID
+	switch policy.Mode {
+	case model.ApprovalModeAnyOf, model.ApprovalModeAllOf:
+		policy.Quorum = 1
+	case model.ApprovalModeQuorum:
+		if policy.Quorum < 1 {
+			return policy, fmt.Errorf("%w: quorum must be positive", ErrInvalidApprovalPolicy)
+		}
+	default:
+		return policy, fmt.Errorf("%w: unknown mode %q", ErrInvalidApprovalPolicy, policy.Mode)
+	}
+	if policy.RejectStatus != nil {
+		wf, err := s.workflows.GetWorkflow(ctx, spaceID)
+		if err != nil {
+			return policy, err
+		}
+		if _, ok := workflowStatus(wf, *policy.RejectStatus); !ok {
+			return policy, fmt.Errorf("%w: unknown reject status %q", ErrInvalidApprovalPolicy, *policy.RejectStatus)
+		}
+	}
+
+	_, err := s.dbPool.Exec(ctx, `
+		INSERT INTO approval_policies (space_id, mode, quorum, reject_status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (space_id) DO UPDATE
+		SET mode = EXCLUDED.mode, quorum = EXCLUDED.quorum, reject_status = EXCLUDED.reject_status
+	`, spaceID, policy.Mode, policy.Quorum, policy.RejectStatus)
+	return policy, err
+}
+
+// queryer — общий интерфейс пула и транзакции для чтения.
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// taskApprovers — основной согласующий задачи плюс дополнительные из task_approvers,
+// кроме excluded (репортер и запросивший одобрение: решать по своей задаче они не могут).
+func taskApprovers(ctx context.Context, q queryer, taskID, approverID string, excluded ...string) ([]string, error) {
+	approvers := []string{}
+	if approverID != "" && !slices.Contains(excluded, approverID) {
+		approvers = append(approvers, approverID)
+	}
+
+	rows, err := q.Query(ctx, `SELECT user_id FROM task_approvers WHERE task_id = $1 ORDER BY user_id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if id != approverID && !slices.Contains(excluded, id) {
+			approvers = append(approvers, id)
+		}
+	}
+	return approvers, rows.Err()
+}
+
+// currentDecisions — решения текущего раунда одобрения.
+func currentDecisions(ctx context.Context, q queryer, taskID string) ([]model.ApprovalDecision, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, task_id, approver_id, decision, comment, decided_at
+		FROM task_approvals
+		WHERE task_id = $1 AND NOT superseded
+		ORDER BY decided_at
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []model.ApprovalDecision{}
+	for rows.Next() {
+		var d model.ApprovalDecision
+		if err := rows.Scan(&d.ID, &d.TaskID, &d.ApproverID, &d.Decision, &d.Comment, &d.DecidedAt); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
+
+// GetState возвращает текущее состояние одобрения задачи.
+func (s *ApprovalService) GetState(ctx context.Context, taskID string) (*model.TaskApprovalState, error) {
+	var state model.TaskApprovalState
+	var space sql.NullString
+	var approverID, reporterID, requesterID string
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT id, status, "approveStatus", "approverID", "reporterD", COALESCE(approval_requested_by, ''), space
+		FROM tasks WHERE id = $1 AND deleted_at IS NULL
+	`, taskID).Scan(&state.TaskID, &state.Status, &state.ApproveStatus, &approverID, &reporterID, &requesterID, &space)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+		}
+		return nil, err
+	}
+
+	if state.Policy, err = s.GetPolicy(ctx, space.String); err != nil {
+		return nil, err
+	}
+	if state.Approvers, err = taskApprovers(ctx, s.dbPool, taskID, approverID, reporterID, requesterID); err != nil {
+		return nil, err
+	}
+	if state.Decisions, err = currentDecisions(ctx, s.dbPool, taskID); err != nil {
+		return nil, err
+	}
+	state.Required = requiredApprovals(state.Policy, len(state.Approvers))
+	return &state, nil
+}
+
+// SetApprovers задаёт дополнительных согласующих задачи.
+// Менять список может репортер задачи или пользователь с правом space.manage; все согласующие должны быть участниками пространства.
+// Репортер и запросивший текущий раунд одобрения согласующими быть не могут.
+// Изменение списка попадает в историю задачи полем approvers.
+func (s *ApprovalService) SetApprovers(ctx context.Context, taskID string, actorID int, approverIDs []string) (*model.TaskApprovalState, error) {
+	var reporterID, requesterID string
+	var space sql.NullString
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT "reporterD", COALESCE(approval_requested_by, ''), space FROM tasks WHERE id = $1 AND deleted_at IS NULL
+	`, taskID).Scan(&reporterID, &requesterID, &space)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+		}
+		return nil, err
+	}
+
+	if reporterID != strconv.Itoa(actorID) {
+		ok, err := can(ctx, s.dbPool, actorID, PermSpaceManage, space.String)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrForbidden
+		}
+	}
+
+	for _, id := range approverIDs {
+		uid, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid approver id %q", ErrInvalidApprovalPolicy, id)
+		}
+		if id == reporterID || id == requesterID {
+			return nil, fmt.Errorf("%w: user %s is the reporter or requested approval", ErrInvalidApprovalPolicy, id)
+		}
+		isMember, _, err := s.spaces.IsMember(ctx, space.String, uid)
+		if err != nil {
+			return nil, err
+		}
+		if !isMember {
+			return nil, fmt.Errorf("%w: user %s is not a member of the space", ErrInvalidApprovalPolicy, id)
+		}
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	before, err := extraApprovers(ctx, tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM task_approvers WHERE task_id = $1`, taskID); err != nil {
+		return nil, err
+	}
+	for _, id := range approverIDs {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO task_approvers (task_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, taskID, id); err != nil {
+			return nil, err
+		}
+	}
+	after, err := extraApprovers(ctx, tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(before, after) {
+		if err := recordHistory(ctx, tx, taskID, model.TaskActionUpdate, &actorID, []model.FieldChange{
+			{Field: "approvers", Old: before, New: after},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetState(ctx, taskID)
+}
+
+// extraApprovers — дополнительные согласующие задачи (task_approvers), отсортированы.
+func extraApprovers(ctx context.Context, q queryer, taskID string) ([]string, error) {
+	rows, err := q.Query(ctx, `SELECT user_id FROM task_approvers WHERE task_id = $1`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	slices.Sort(ids)
+	return ids, err
+}
+
+// RequestApproval начинает новый раунд одобрения: прошлые решения помечаются superseded.
+// Запросивший запоминается: в этом раунде он решение не принимает.
+func (s *ApprovalService) RequestApproval(ctx context.Context, taskID string, actorID int) (*model.TaskApprovalState, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var previous string
+	err = tx.QueryRow(ctx, `SELECT "approveStatus" FROM tasks WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, taskID).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+		}
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE tasks SET "approveStatus" = $2, approval_requested_by = $3, updated_at = NOW() WHERE id = $1
+	`, taskID, model.ApproveStatusNeedApproval, strconv.Itoa(actorID)); err != nil {
+		return nil, err
+	}
+	if previous != model.ApproveStatusNeedApproval {
+		if err := recordHistory(ctx, tx, taskID, model.TaskActionUpdate, &actorID, []model.FieldChange{
+			{Field: "approveStatus", Old: previous, New: model.ApproveStatusNeedApproval},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE task_approvals SET superseded = true WHERE task_id = $1`, taskID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetState(ctx, taskID)
+}
+
+// Approve записывает одобрение согласующего и, если политика выполнена, переводит задачу в approved.
+func (s *ApprovalService) Approve(ctx context.Context, taskID string, actorID int, comment string) (*model.TaskApprovalState, error) {
+	return s.decide(ctx, taskID, actorID, model.ApproveStatusApproved, comment)
+}
+
+// Reject записывает отклонение (комментарий обязателен) и возвращает задачу в более ранний статус.
+func (s *ApprovalService) Reject(ctx context.Context, taskID string, actorID int, comment string) (*model.TaskApprovalState, error) {
+	if strings.TrimSpace(comment) == "" {
+		return nil, ErrCommentRequired
+	}
+	return s.decide(ctx, taskID, actorID, model.ApproveStatusRejected, comment)
+}
+
+func (s *ApprovalService) decide(ctx context.Context, taskID string, actorID int, decision, comment string) (*model.TaskApprovalState, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var status, approveStatus, approverID, reporterID, requesterID string
+	var space sql.NullString
+	var startedAt, doneAt *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT status, "approveStatus", "approverID", "reporterD", COALESCE(approval_requested_by, ''), space, "started_At", done_at
+		FROM tasks WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, taskID).Scan(&status, &approveStatus, &approverID, &reporterID, &requesterID, &space, &startedAt, &doneAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+		}
+		return nil, err
+	}
+	if approveStatus != model.ApproveStatusNeedApproval {
+		return nil, ErrApprovalNotPending
+	}
+
+	actor := strconv.Itoa(actorID)
+	if actor == reporterID || actor == requesterID {
+		return nil, ErrSelfApproval
+	}
+	approvers, err := taskApprovers(ctx, tx, taskID, approverID, reporterID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	isApprover := false
+	for _, id := range approvers {
+		if id == actor {
+			isApprover = true
+			break
+		}
+	}
+	if !isApprover {
+		return nil, ErrNotApprover
+	}
+
+	decisions, err := currentDecisions(ctx, tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	approvals := 0
+	for _, d := range decisions {
+		if d.ApproverID == actor {
+			return nil, ErrAlreadyDecided
+		}
+		if d.Decision == model.ApproveStatusApproved {
+			approvals++
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO task_approvals (task_id, approver_id, decision, comment)
+		VALUES ($1, $2, $3, $4)
+	`, taskID, actor, decision, comment); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.GetPolicy(ctx, space.String)
+	if err != nil {
+		return nil, err
+	}
+
+	switch decision {
+	case model.ApproveStatusRejected:
+		wf, err := s.workflows.GetWorkflow(ctx, space.String)
+		if err != nil {
+			return nil, err
+		}
+		target := rejectTarget(wf, policy, status)
+		newStarted, newDone := startedAt, doneAt
+		if target.Name != status {
+			newStarted, newDone = applyStatusStamps(target, startedAt, doneAt, time.Now())
+		}
+		if _, err := tx.Exec(ctx, `
+			UPDATE tasks
+			SET "approveStatus" = $2, status = $3, "started_At" = $4, done_at = $5, updated_at = NOW()
+			WHERE id = $1
+		`, taskID, model.ApproveStatusRejected, target.Name, newStarted, newDone); err != nil {
+			return nil, err
+		}
+		before := model.Task{Status: status, ApproveStatus: approveStatus, StartedAt: startedAt, CompletedAt: doneAt}
+		after := model.Task{Status: target.Name, ApproveStatus: model.ApproveStatusRejected, StartedAt: newStarted, CompletedAt: newDone}
+		if err := recordHistory(ctx, tx, taskID, model.TaskActionUpdate, &actorID, diffTask(&before, &after, nil)); err != nil {
+			return nil, err
+		}
+	case model.ApproveStatusApproved:
+		if approvals+1 >= requiredApprovals(policy, len(approvers)) {
+			if _, err := tx.Exec(ctx, `
+				UPDATE tasks SET "approveStatus" = $2, updated_at = NOW() WHERE id = $1
+			`, taskID, model.ApproveStatusApproved); err != nil {
+				return nil, err
+			}
+			if err := recordHistory(ctx, tx, taskID, model.TaskActionUpdate, &actorID, []model.FieldChange{
+				{Field: "approveStatus", Old: approveStatus, New: model.ApproveStatusApproved},
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetState(ctx, taskID)
+}
@@ -0,0 +1,225 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+)
+
+// approvalFixture — пространство с владельцем и участниками и задача владельца.
+type approvalFixture struct {
+	tasks     *service.TaskService
+	approvals *service.ApprovalService
+	owner     int
+	members   []int
+	spaceID   string
+}
+
+func newApprovalFixture(t *testing.T, members int) *approvalFixture {
+	t.Helper()
+	db := testutil.DB(t)
+	spaces := service.NewSpaceService(db, nil)
+	workflows := service.NewWorkflowService(db)
+	f := &approvalFixture{
+		tasks:     service.NewTaskService(db, spaces, workflows, service.NewEventBus()),
+		approvals: service.NewApprovalService(db, spaces, workflows),
+		owner:     testutil.User(t, db, service.SystemRoleUser),
+	}
+	f.spaceID = testutil.Space(t, db, f.owner)
+	for range members {
+		id := testutil.User(t, db, service.SystemRoleUser)
+		testutil.Member(t, db, f.spaceID, id, service.RoleMember)
+		f.members = append(f.members, id)
+	}
+	return f
+}
+
+// newTask создаёт задачу владельца со статусом review и согласующим approverID.
+func (f *approvalFixture) newTask(t *testing.T, approverID int) string {
+	t.Helper()
+	ctx := context.Background()
+	task, err := f.tasks.CreateTask(ctx, model.Task{
+		Title:      "approval",
+		ReporterID: strconv.Itoa(f.owner),
+		ApproverID: strconv.Itoa(approverID),
+		Space:      &f.spaceID,
+	}, f.owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{"in-progress", "review"} {
+		if _, err := f.tasks.UpdateTask(ctx, task.ID, model.TaskPatch{Status: &status}, f.owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return task.ID
+}
+
+func TestApprovalCannotBeSelfRequestedViaUpdate(t *testing.T) {
+	f := newApprovalFixture(t, 1)
+	ctx := context.Background()
+	member := f.members[0]
+	taskID := f.newTask(t, f.owner)
+
+	// участник назначает согласующим себя и пытается запросить одобрение через /update
+	self := strconv.Itoa(member)
+	if _, err := f.tasks.UpdateTask(ctx, taskID, model.TaskPatch{ApproverID: &self}, member); err != nil {
+		t.Fatal(err)
+	}
+	need := model.ApproveStatusNeedApproval
+	if _, err := f.tasks.UpdateTask(ctx, taskID, model.TaskPatch{ApproveStatus: &need}, member); !errors.Is(err, service.ErrInvalidApproveStatus) {
+		t.Fatalf("approveStatus via update: err = %v, want ErrInvalidApproveStatus", err)
+	}
+
+	// через RequestApproval он становится запросившим и одобрить сам не может
+	state, err := f.approvals.RequestApproval(ctx, taskID, member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Approvers) != 0 {
+		t.Errorf("approvers %v, want none: the requester is excluded", state.Approvers)
+	}
+	if _, err := f.approvals.Approve(ctx, taskID, member, ""); !errors.Is(err, service.ErrSelfApproval) {
+		t.Errorf("requester approves: err = %v, want ErrSelfApproval", err)
+	}
+}
+
+func TestApproverChangeStartsNewRound(t *testing.T) {
+	f := newApprovalFixture(t, 2)
+	ctx := context.Background()
+	first, second := f.members[0], f.members[1]
+	taskID := f.newTask(t, first)
+
+	if _, err := f.approvals.RequestApproval(ctx, taskID, f.owner); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.approvals.Approve(ctx, taskID, first, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// второй участник назначает согласующим себя: одобрение первого больше не считается,
+	// а сам он теперь запросивший и решение принять не может
+	self := strconv.Itoa(second)
+	task, err := f.tasks.UpdateTask(ctx, taskID, model.TaskPatch{ApproverID: &self}, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.ApproveStatus != model.ApproveStatusNeedApproval {
+		t.Errorf("approveStatus after approver change = %q, want need-approval", task.ApproveStatus)
+	}
+	state, err := f.approvals.GetState(ctx, taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Decisions) != 0 {
+		t.Errorf("decisions %+v, want the previous round superseded", state.Decisions)
+	}
+	if _, err := f.approvals.Approve(ctx, taskID, second, ""); !errors.Is(err, service.ErrSelfApproval) {
+		t.Errorf("new approver approves own change: err = %v, want ErrSelfApproval", err)
+	}
+	if _, err := f.tasks.MarkTaskDone(ctx, taskID, f.owner); !errors.Is(err, service.ErrApprovalRequired) {
+		t.Errorf("done during the new round: err = %v, want ErrApprovalRequired", err)
+	}
+}
+
+func TestApprovalQuorum(t *testing.T) {
+	f := newApprovalFixture(t, 3)
+	ctx := context.Background()
+	m := f.members
+	taskID := f.newTask(t, m[0])
+	if _, err := f.approvals.SetApprovers(ctx, taskID, f.owner, []string{strconv.Itoa(m[1]), strconv.Itoa(m[2])}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.approvals.SetPolicy(ctx, f.spaceID, model.ApprovalPolicy{Mode: model.ApprovalModeQuorum, Quorum: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.approvals.RequestApproval(ctx, taskID, f.owner); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := f.approvals.Approve(ctx, taskID, m[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Required != 2 || state.ApproveStatus != model.ApproveStatusNeedApproval {
+		t.Errorf("after one approval: required %d, approveStatus %q; want 2, need-approval", state.Required, state.ApproveStatus)
+	}
+	if _, err := f.approvals.Approve(ctx, taskID, m[0], ""); !errors.Is(err, service.ErrAlreadyDecided) {
+		t.Errorf("second decision of the same approver: err = %v, want ErrAlreadyDecided", err)
+	}
+	if state, err = f.approvals.Approve(ctx, taskID, m[2], ""); err != nil {
+		t.Fatal(err)
+	}
+	if state.ApproveStatus != model.ApproveStatusApproved {
+		t.Errorf("after quorum: approveStatus %q, want approved", state.ApproveStatus)
+	}
+	if _, err := f.approvals.Approve(ctx, taskID, m[1], ""); !errors.Is(err, service.ErrApprovalNotPending) {
+		t.Errorf("approval after the round is over: err = %v, want ErrApprovalNotPending", err)
+	}
+}
+
+func TestApprovalExcludesReporterAndRequester(t *testing.T) {
+	f := newApprovalFixture(t, 3)
+	ctx := context.Background()
+	m := f.members
+	// основной согласующий — сам репортер
+	taskID := f.newTask(t, f.owner)
+
+	if _, err := f.approvals.SetApprovers(ctx, taskID, f.owner, []string{strconv.Itoa(f.owner)}); !errors.Is(err, service.ErrInvalidApprovalPolicy) {
+		t.Errorf("reporter as approver: err = %v, want ErrInvalidApprovalPolicy", err)
+	}
+	if _, err := f.approvals.SetApprovers(ctx, taskID, f.owner, []string{strconv.Itoa(m[0]), strconv.Itoa(m[1])}); err != nil {
+		t.Fatal(err)
+	}
+
+	// запросивший одобрение в этом раунде тоже не согласующий
+	state, err := f.approvals.RequestApproval(ctx, taskID, m[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{strconv.Itoa(m[1])}; !slices.Equal(state.Approvers, want) {
+		t.Errorf("approvers %v, want %v", state.Approvers, want)
+	}
+	for _, id := range []int{f.owner, m[0]} {
+		if _, err := f.approvals.Approve(ctx, taskID, id, ""); !errors.Is(err, service.ErrSelfApproval) {
+			t.Errorf("user %d approves: err = %v, want ErrSelfApproval", id, err)
+		}
+	}
+	if _, err := f.approvals.Approve(ctx, taskID, m[2], ""); !errors.Is(err, service.ErrNotApprover) {
+		t.Errorf("non-approver approves: err = %v, want ErrNotApprover", err)
+	}
+	if state, err = f.approvals.Approve(ctx, taskID, m[1], ""); err != nil || state.ApproveStatus != model.ApproveStatusApproved {
+		t.Errorf("approver approves: %+v, %v; want approved", state, err)
+	}
+}
+
+func TestApprovalReject(t *testing.T) {
+	f := newApprovalFixture(t, 1)
+	ctx := context.Background()
+	approver := f.members[0]
+	taskID := f.newTask(t, approver)
+	if _, err := f.approvals.RequestApproval(ctx, taskID, f.owner); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.approvals.Reject(ctx, taskID, approver, "  "); !errors.Is(err, service.ErrCommentRequired) {
+		t.Errorf("reject without comment: err = %v, want ErrCommentRequired", err)
+	}
+	state, err := f.approvals.Reject(ctx, taskID, approver, "нет тестов")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// из review задача возвращается в ближайший более ранний статус
+	if state.ApproveStatus != model.ApproveStatusRejected || state.Status != "in-progress" {
+		t.Errorf("after reject: status %q, approveStatus %q; want in-progress, rejected", state.Status, state.ApproveStatus)
+	}
+	if _, err := f.tasks.MarkTaskDone(ctx, taskID, f.owner); !errors.Is(err, service.ErrApprovalRequired) {
+		t.Errorf("done after reject: err = %v, want ErrApprovalRequired", err)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"testing"
+
+	"tasker/internal/model"
+)
+
+func TestRequiredApprovals(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy model.ApprovalPolicy
+		n      int
+		want   int
+	}{
+		{name: "any-of", policy: model.ApprovalPolicy{Mode: model.ApprovalModeAnyOf, Quorum: 1}, n: 3, want: 1},
+		{name: "all-of", policy: model.ApprovalPolicy{Mode: model.ApprovalModeAllOf, Quorum: 1}, n: 3, want: 3},
+		{name: "quorum", policy: model.ApprovalPolicy{Mode: model.ApprovalModeQuorum, Quorum: 2}, n: 3, want: 2},
+		// согласующих меньше кворума: нужны все
+		{name: "quorum above approvers", policy: model.ApprovalPolicy{Mode: model.ApprovalModeQuorum, Quorum: 5}, n: 3, want: 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := requiredApprovals(tc.policy, tc.n); got != tc.want {
+				t.Errorf("requiredApprovals = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRejectTarget(t *testing.T) {
+	wf := DefaultWorkflow("")
+	status := func(name string) *string { return &name }
+	cases := []struct {
+		name    string
+		current string
+		reject  *string // rejectStatus политики
+		want    string
+	}{
+		{name: "policy status", current: "review", reject: status("to-do"), want: "to-do"},
+		{name: "unknown policy status", current: "review", reject: status("gone"), want: "in-progress"},
+		{name: "review goes back to work", current: "review", want: "in-progress"},
+		{name: "in-progress goes back to queue", current: "in-progress", want: "to-do"},
+		// done раньше не бывает, даже если в него разрешён переход
+		{name: "done reopens", current: "done", want: "in-progress"},
+		{name: "blocked skips canceled", current: "blocked", want: "in-progress"},
+		{name: "nothing earlier", current: "to-do", want: "to-do"},
+		{name: "legacy status", current: "todo", want: "to-do"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := model.ApprovalPolicy{Mode: model.ApprovalModeAnyOf, Quorum: 1, RejectStatus: tc.reject}
+			if got := rejectTarget(wf, policy, tc.current); got.Name != tc.want {
+				t.Errorf("rejectTarget = %q, want %q", got.Name, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"tasker/internal/model"
+	"tasker/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrAttachmentNotFound возвращается, если вложения нет.
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrAttachmentTooLarge — файл больше допустимого размера.
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	// ErrAttachmentType — тип файла (определённый по содержимому) не разрешён.
+	ErrAttachmentType = errors.New("attachment type is not allowed")
+	// ErrQuotaExceeded — вложения пространства превысили бы квоту.
+	ErrQuotaExceeded = errors.New("space attachment quota exceeded")
+	// ErrInvalidAttachment — пустой файл или задача без пространства.
+	ErrInvalidAttachment = errors.New("invalid attachment")
+)
+
+// AttachmentLimits — ограничения на вложения.
+type AttachmentLimits struct {
+	MaxFileSize int64
+	// SpaceQuota — квота пространства по умолчанию (spaces.attachment_quota её переопределяет).
+	SpaceQuota int64
+	// AllowedTypes — MIME-типы, допускается маска вида image/*.
+	AllowedTypes []string
+}
+
+type AttachmentService struct {
+	dbPool *pgxpool.Pool
+	store  storage.BlobStore
+	spaces *SpaceService
+	limits AttachmentLimits
+}
+
+func NewAttachmentService(dbPool *pgxpool.Pool, store storage.BlobStore, spaces *SpaceService, limits AttachmentLimits) *AttachmentService {
+	return &AttachmentService{dbPool: dbPool, store: store, spaces: spaces, limits: limits}
+}
+
+// typeAllowed сравнивает MIME-тип с разрешёнными (поддерживаются маски type/*).
+func typeAllowed(contentType string, allowed []string) bool {
+	for _, a := range allowed {
+		a = strings.TrimSpace(a)
+		if a == contentType || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// sniffContentType определяет тип по первым байтам (клиентскому Content-Type не доверяем).
+func sniffContentType(head []byte) string {
+	ct := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(ct); err == nil {
+		return mediaType
+	}
+	return ct
+}
+
+const attachmentColumns = `id, task_id, space_id, file_name, content_type, size, checksum, uploader_id, created_at`
+
+func scanAttachment(row pgx.Row) (*model.Attachment, string, error) {
+	var a model.Attachment
+	var key string
+	err := row.Scan(&a.ID, &a.TaskID, &a.SpaceID, &a.FileName, &a.ContentType, &a.Size, &a.Checksum, &a.UploaderID, &a.CreatedAt, &key)
+	return &a, key, err
+}
+
+// spaceQuota — квота пространства: собственная или по умолчанию.
+func (s *AttachmentService) spaceQuota(ctx context.Context, q queryer, spaceID string) (used, quota int64, err error) {
+	var override sql.NullInt64
+	err = q.QueryRow(ctx, `
+		SELECT sp.attachment_quota, COALESCE((SELECT SUM(size) FROM attachments WHERE space_id = sp.id), 0)
+		FROM spaces sp WHERE sp.id = $1
+	`, spaceID).Scan(&override, &used)
+	if err != nil {
+		return 0, 0, err
+	}
+	quota = s.limits.SpaceQuota
+	if override.Valid {
+		quota = override.Int64
+	}
+	return used, quota, nil
+}
+
+// Upload сохраняет файл задачи: проверяет размер, тип по содержимому и квоту пространства,
+// кладёт содержимое в BlobStore и записывает метаданные (sha256, размер, загрузивший).
+func (s *AttachmentService) Upload(ctx context.Context, taskID string, uploaderID int, fileName string, size int64, r io.Reader) (*model.Attachment, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalidAttachment)
+	}
+	if s.limits.MaxFileSize > 0 && size > s.limits.MaxFileSize {
+		return nil, fmt.Errorf("%w: %d bytes, max %d", ErrAttachmentTooLarge, size, s.limits.MaxFileSize)
+	}
+
+	var space sql.NullString
+	err := s.dbPool.QueryRow(ctx, `SELECT space FROM tasks WHERE id::text = $1 AND deleted_at IS NULL`, taskID).Scan(&space)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+		}
+		return nil, err
+	}
+	if !space.Valid || space.String == "" {
+		return nil, fmt.Errorf("%w: task has no space", ErrInvalidAttachment)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := sniffContentType(head)
+	if !typeAllowed(contentType, s.limits.AllowedTypes) {
+		return nil, fmt.Errorf("%w: %s", ErrAttachmentType, contentType)
+	}
+
+	used, quota, err := s.spaceQuota(ctx, s.dbPool, space.String)
+	if err != nil {
+		return nil, err
+	}
+	if used+size > quota {
+		return nil, fmt.Errorf("%w: used %d of %d bytes", ErrQuotaExceeded, used, quota)
+	}
+
+	key := taskID + "/" + uuid.New().String()
+	hasher := sha256.New()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), r), hasher)
+	if err := s.store.Put(ctx, key, body, size, contentType); err != nil {
+		return nil, fmt.Errorf("store attachment: %w", err)
+	}
+
+	a, err := s.insertAttachment(ctx, space.String, model.Attachment{
+		TaskID:      taskID,
+		SpaceID:     space.String,
+		FileName:    filepath.Base(fileName),
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hasher.Sum(nil)),
+		UploaderID:  uploaderID,
+	}, key)
+	if err != nil {
+		if delErr := s.store.Delete(ctx, key); delErr != nil {
+			slog.Error("Failed to delete orphaned blob", "key", key, "error", delErr)
+		}
+		return nil, err
+	}
+	return a, nil
+}
+
+// insertAttachment записывает метаданные, повторно проверяя квоту под блокировкой строки пространства.
+func (s *AttachmentService) insertAttachment(ctx context.Context, spaceID string, a model.Attachment, key string) (*model.Attachment, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM spaces WHERE id = $1 FOR UPDATE`, spaceID); err != nil {
+		return nil, err
+	}
+	used, quota, err := s.spaceQuota(ctx, tx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if used+a.Size > quota {
+		return nil, fmt.Errorf("%w: used %d of %d bytes", ErrQuotaExceeded, used, quota)
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO attachments (task_id, space_id, file_name, content_type, size, checksum, storage_key, uploader_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, a.TaskID, a.SpaceID, a.FileName, a.ContentType, a.Size, a.Checksum, key, a.UploaderID).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ListAttachments возвращает вложения задачи, новые первыми.
+func (s *AttachmentService) ListAttachments(ctx context.Context, taskID string) ([]model.Attachment, error) {
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT `+attachmentColumns+`, storage_key
+		FROM attachments WHERE task_id::text = $1
+		ORDER BY created_at DESC
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []model.Attachment{}
+	for rows.Next() {
+		a, _, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *a)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *AttachmentService) getAttachment(ctx context.Context, id string) (*model.Attachment, string, error) {
+	a, key, err := scanAttachment(s.dbPool.QueryRow(ctx, `
+		SELECT `+attachmentColumns+`, storage_key FROM attachments WHERE id::text = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", fmt.Errorf("attachment %s: %w", id, ErrAttachmentNotFound)
+		}
+		return nil, "", err
+	}
+	return a, key, nil
+}
+
+// Open возвращает метаданные и содержимое вложения; reader нужно закрыть.
+func (s *AttachmentService) Open(ctx context.Context, id string) (*model.Attachment, io.ReadCloser, error) {
+	a, key, err := s.getAttachment(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, fmt.Errorf("attachment %s content: %w", id, ErrAttachmentNotFound)
+		}
+		return nil, nil, err
+	}
+	return a, rc, nil
+}
+
+// DeleteAttachment удаляет вложение. Разрешено загрузившему и пользователю с правом attachment.manage.
+func (s *AttachmentService) DeleteAttachment(ctx context.Context, id string, actorID int) error {
+	a, key, err := s.getAttachment(ctx, id)
+	if err != nil {
+		return err
+	}
+	if a.UploaderID != actorID {
+		ok, err := can(ctx, s.dbPool, actorID, PermAttachmentManage, a.SpaceID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrForbidden
+		}
+	}
+
+	if _, err := s.dbPool.Exec(ctx, `DELETE FROM attachments WHERE id = $1`, a.ID); err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, key); err != nil {
+		slog.Error("Failed to delete attachment blob", "key", key, "error", err)
+	}
+	return nil
+}
+
+// Usage возвращает занятое место и квоту пространства.
+func (s *AttachmentService) Usage(ctx context.Context, spaceID string) (*model.AttachmentUsage, error) {
+	used, quota, err := s.spaceQuota(ctx, s.dbPool, spaceID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSpaceNotFound
+		}
+		return nil, err
+	}
+	return &model.AttachmentUsage{SpaceID: spaceID, UsedBytes: used, QuotaBytes: quota}, nil
+}
+
+// SetQuota задаёт квоту пространства; nil возвращает квоту по умолчанию.
+func (s *AttachmentService) SetQuota(ctx context.Context, spaceID string, quota *int64) (*model.AttachmentUsage, error) {
+	if quota != nil && *quota < 0 {
+		return nil, fmt.Errorf("%w: quota must not be negative", ErrInvalidAttachment)
+	}
+	tag, err := s.dbPool.Exec(ctx, `UPDATE spaces SET attachment_quota = $2 WHERE id = $1`, spaceID, quota)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrSpaceNotFound
+	}
+	return s.Usage(ctx, spaceID)
+}
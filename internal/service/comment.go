@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrCommentNotFound возвращается, если комментария нет или он удалён.
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrInvalidComment — пустой текст или ответ на комментарий другой задачи.
+	ErrInvalidComment = errors.New("invalid comment")
+)
+
+// mentionPattern — @login в тексте комментария; перед @ не должно быть буквы/цифры (чтобы не ловить e-mail).
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.])@([\p{L}\p{N}_.\-]+)`)
+
+// parseMentions возвращает уникальные логины, упомянутые в тексте, в порядке появления.
+func parseMentions(body string) []string {
+	seen := map[string]bool{}
+	logins := []string{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		login := strings.TrimRight(m[1], ".-")
+		if login != "" && !seen[login] {
+			seen[login] = true
+			logins = append(logins, login)
+		}
+	}
+	return logins
+}
+
+type CommentService struct {
+	dbPool *pgxpool.Pool
+	spaces *SpaceService
+}
+
+func NewCommentService(dbPool *pgxpool.Pool, spaces *SpaceService) *CommentService {
+	return &CommentService{dbPool: dbPool, spaces: spaces}
+}
+
+// saveMentions заменяет упоминания комментария пользователями с найденными логинами.
+// Упомянуть можно только участника пространства задачи; неизвестные логины и посторонние
+// молча игнорируются — иначе упоминание раскрыло бы задачу чужому.
+func saveMentions(ctx context.Context, tx pgx.Tx, commentID, body string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM comment_mentions WHERE comment_id = $1`, commentID); err != nil {
+		return err
+	}
+
+	logins := parseMentions(body)
+	if len(logins) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO comment_mentions (comment_id, user_id)
+		SELECT c.id, u.id FROM task_comments c
+		JOIN tasks t ON t.id = c.task_id
+		JOIN space_memberships m ON m.space_id = t.space
+		JOIN users u ON u.id = m.user_id
+		WHERE c.id = $1 AND u.login = ANY($2)
+		ON CONFLICT DO NOTHING
+	`, commentID, logins)
+	return err
+}
+
+const commentColumns = `
+	c.id, c.task_id, c.parent_id, c.author_id, (u.name || ' ' || u.surname),
+	c.body, c.created_at, c.updated_at, c.deleted_at,
+	EXISTS (SELECT 1 FROM task_comment_edits e WHERE e.comment_id = c.id),
+	ARRAY(SELECT mu.login FROM comment_mentions cm JOIN users mu ON mu.id = cm.user_id WHERE cm.comment_id = c.id ORDER BY mu.login)
+`
+
+func scanComment(row pgx.Row) (*model.Comment, error) {
+	var cm model.Comment
+	var authorName sql.NullString
+	if err := row.Scan(&cm.ID, &cm.TaskID, &cm.ParentID, &cm.AuthorID, &authorName,
+		&cm.Body, &cm.CreatedAt, &cm.UpdatedAt, &cm.DeletedAt, &cm.Edited, &cm.Mentions); err != nil {
+		return nil, err
+	}
+	if authorName.Valid {
+		cm.AuthorName = &authorName.String
+	}
+	// у удалённых комментариев текст не отдаём, но оставляем их в дереве ради ответов
+	if cm.DeletedAt != nil {
+		cm.Body = ""
+		cm.Mentions = []string{}
+	}
+	return &cm, nil
+}
+
+// GetComment возвращает комментарий по id (включая удалённые).
+func (s *CommentService) GetComment(ctx context.Context, id string) (*model.Comment, error) {
+	cm, err := scanComment(s.dbPool.QueryRow(ctx, `
+		SELECT `+commentColumns+`
+		FROM task_comments c
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.id::text = $1
+	`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("comment %s: %w", id, ErrCommentNotFound)
+		}
+		return nil, err
+	}
+	return cm, nil
+}
+
+// ListComments возвращает комментарии задачи деревом: корневые по времени, ответы вложены.
+func (s *CommentService) ListComments(ctx context.Context, taskID string) ([]*model.Comment, error) {
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT `+commentColumns+`
+		FROM task_comments c
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.task_id::text = $1
+		ORDER BY c.created_at, c.id
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*model.Comment
+	byID := map[string]*model.Comment{}
+	for rows.Next() {
+		cm, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, cm)
+		byID[cm.ID] = cm
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	roots := []*model.Comment{}
+	for _, cm := range all {
+		if cm.ParentID != nil {
+			if parent, ok := byID[*cm.ParentID]; ok {
+				parent.Replies = append(parent.Replies, cm)
+				continue
+			}
+		}
+		roots = append(roots, cm)
+	}
+	return roots, nil
+}
+
+// CreateComment добавляет комментарий (или ответ, если parentID задан) от имени authorID.
+func (s *CommentService) CreateComment(ctx context.Context, taskID string, authorID int, parentID *string, body string) (*model.Comment, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalidComment)
+	}
+
+	var exists bool
+	if err := s.dbPool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tasks WHERE id::text = $1 AND deleted_at IS NULL)`, taskID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+	}
+
+	if parentID != nil {
+		parent, err := s.GetComment(ctx, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.TaskID != taskID {
+			return nil, fmt.Errorf("%w: parent comment belongs to another task", ErrInvalidComment)
+		}
+		if parent.DeletedAt != nil {
+			return nil, fmt.Errorf("%w: cannot reply to a deleted comment", ErrInvalidComment)
+		}
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var id string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO task_comments (task_id, parent_id, author_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, taskID, parentID, authorID, body).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveMentions(ctx, tx, id, body); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetComment(ctx, id)
+}
+
+// EditComment меняет текст комментария; прежний текст сохраняется в истории правок.
+// Редактировать может только автор.
+func (s *CommentService) EditComment(ctx context.Context, id string, actorID int, body string) (*model.Comment, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalidComment)
+	}
+
+	cm, err := s.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cm.DeletedAt != nil {
+		return nil, fmt.Errorf("comment %s: %w", id, ErrCommentNotFound)
+	}
+	if cm.AuthorID != actorID {
+		return nil, ErrForbidden
+	}
+	if cm.Body == body {
+		return cm, nil
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO task_comment_edits (comment_id, body, editor_id) VALUES ($1, $2, $3)
+	`, cm.ID, cm.Body, actorID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE task_comments SET body = $2, updated_at = NOW() WHERE id = $1
+	`, cm.ID, body); err != nil {
+		return nil, err
+	}
+	if err := saveMentions(ctx, tx, cm.ID, body); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetComment(ctx, id)
+}
+
+// DeleteComment мягко удаляет комментарий. Удалять может автор или пользователь с правом comment.moderate.
+func (s *CommentService) DeleteComment(ctx context.Context, id string, actorID int) error {
+	cm, err := s.GetComment(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cm.DeletedAt != nil {
+		return fmt.Errorf("comment %s: %w", id, ErrCommentNotFound)
+	}
+	if cm.AuthorID != actorID {
+		var space sql.NullString
+		if err := s.dbPool.QueryRow(ctx, `SELECT space FROM tasks WHERE id::text = $1`, cm.TaskID).Scan(&space); err != nil {
+			return err
+		}
+		ok, err := can(ctx, s.dbPool, actorID, PermCommentModerate, space.String)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrForbidden
+		}
+	}
+
+	_, err = s.dbPool.Exec(ctx, `UPDATE task_comments SET deleted_at = NOW() WHERE id = $1`, cm.ID)
+	return err
+}
+
+// EditHistory возвращает прежние версии комментария, от новых к старым.
+func (s *CommentService) EditHistory(ctx context.Context, id string) ([]model.CommentEdit, error) {
+	cm, err := s.GetComment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cm.DeletedAt != nil {
+		return nil, fmt.Errorf("comment %s: %w", id, ErrCommentNotFound)
+	}
+
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT body, editor_id, edited_at
+		FROM task_comment_edits
+		WHERE comment_id = $1
+		ORDER BY edited_at DESC, id DESC
+	`, cm.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []model.CommentEdit{}
+	for rows.Next() {
+		var e model.CommentEdit
+		if err := rows.Scan(&e.Body, &e.EditorID, &e.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
+	}
+	return edits, rows.Err()
+}
+
+// MentionsOf возвращает упоминания пользователя в неудалённых комментариях, от новых к старым.
+// Упоминания из пространств, где он больше не состоит (или которые требуют 2FA), не показываются,
+// с персональным токеном пространства — только из этого пространства.
+func (s *CommentService) MentionsOf(ctx context.Context, userID int) ([]model.Mention, error) {
+	spaceID, _, err := scopedSpace(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT c.id::text, t.id::text, t.title, c.author_id, c.body, c.created_at
+		FROM comment_mentions cm
+		JOIN task_comments c ON c.id = cm.comment_id AND c.deleted_at IS NULL
+		JOIN tasks t ON t.id = c.task_id AND t.deleted_at IS NULL
+		WHERE cm.user_id = $1 AND t.space IN (`+memberSpacesSQL("$1")+`) AND ($2 = '' OR t.space = $2)
+		ORDER BY c.created_at DESC
+	`, userID, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []model.Mention{}
+	for rows.Next() {
+		var m model.Mention
+		if err := rows.Scan(&m.CommentID, &m.TaskID, &m.TaskTitle, &m.AuthorID, &m.Body, &m.MentionedAt); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"tasker/internal/mail"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInvalidVerificationToken — токен подтверждения не найден, уже использован, истёк
+	// или email пользователя с тех пор сменился.
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	// ErrNoEmail — у пользователя не указан email.
+	ErrNoEmail = errors.New("user has no email")
+)
+
+// verifyRequestInterval — не чаще одного письма с подтверждением на пользователя за этот интервал.
+const verifyRequestInterval = time.Minute
+
+// EmailVerificationService подтверждает, что email пользователя принадлежит ему. Подтверждённым
+// email-ам доверяют привязка входа через SSO и приглашения, отправленные на email.
+// Email из каталога LDAP, SCIM и подтверждённый провайдером OIDC считается подтверждённым сразу.
+type EmailVerificationService struct {
+	dbPool   *pgxpool.Pool
+	mailer   mail.Mailer
+	ttl      time.Duration
+	linkBase string
+}
+
+// NewEmailVerificationService: ttl — срок жизни ссылки, linkBase — адрес страницы подтверждения
+// во фронтенде; к нему добавляется ?token=.
+func NewEmailVerificationService(dbPool *pgxpool.Pool, mailer mail.Mailer, ttl time.Duration, linkBase string) *EmailVerificationService {
+	return &EmailVerificationService{dbPool: dbPool, mailer: mailer, ttl: ttl, linkBase: linkBase}
+}
+
+// RequestVerification отправляет на текущий email пользователя ссылку подтверждения. Прежние
+// ссылки перестают действовать; уже подтверждённый email и повторный запрос чаще
+// verifyRequestInterval ничего не отправляют. Без email — ErrNoEmail.
+func (s *EmailVerificationService) RequestVerification(ctx context.Context, userID int) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
+	}
+	var (
+		login, email string
+		verified     bool
+	)
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT login, COALESCE(email, ''), email_verified_at IS NOT NULL FROM users WHERE id = $1
+	`, userID).Scan(&login, &email, &verified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user %d: %w", userID, ErrUserNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if email == "" {
+		return fmt.Errorf("user %d: %w", userID, ErrNoEmail)
+	}
+	if verified {
+		return nil
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var recent bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM email_verifications WHERE user_id = $1 AND created_at > $2)
+	`, userID, time.Now().Add(-verifyRequestInterval)).Scan(&recent)
+	if err != nil {
+		return err
+	}
+	if recent {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM email_verifications WHERE user_id = $1 AND (used_at IS NOT NULL OR expires_at < now())
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE email_verifications SET used_at = now() WHERE user_id = $1 AND used_at IS NULL
+	`, userID); err != nil {
+		return err
+	}
+	expires := time.Now().Add(s.ttl)
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO email_verifications (token_hash, user_id, email, expires_at) VALUES ($1, $2, $3, $4)
+	`, hash, userID, email, expires); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы подтвердить адрес %s, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует до %s и сработает один раз.\nЕсли вы не указывали этот адрес, просто проигнорируйте это письмо.\n",
+			login, email, s.link(token), expires.UTC().Format("02.01.2006 15:04 MST")),
+	}
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, msg); err != nil {
+			slog.Error("Failed to send email verification mail", "userID", userID, "error", err)
+		}
+	}()
+	return nil
+}
+
+func (s *EmailVerificationService) link(token string) string {
+	return s.linkBase + "?token=" + url.QueryEscape(token)
+}
+
+// VerifyEmail подтверждает email по токену из письма. Токен одноразовый и действует, только
+// пока у пользователя тот же email, на который ушло письмо.
+func (s *EmailVerificationService) VerifyEmail(ctx context.Context, token string) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var userID int
+	err = tx.QueryRow(ctx, `
+		SELECT v.user_id
+		FROM email_verifications v JOIN users u ON u.id = v.user_id
+		WHERE v.token_hash = $1 AND v.used_at IS NULL AND v.expires_at > now()
+		  AND lower(u.email) = lower(v.email) AND u.deactivated_at IS NULL
+		FOR UPDATE OF v, u
+	`, hashToken(token)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE email_verifications SET used_at = now() WHERE token_hash = $1`, hashToken(token)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1
+	`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
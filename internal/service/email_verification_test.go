@@ -0,0 +1,114 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"tasker/internal/mail"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recordingMailer отдаёт отправленные письма в канал.
+type recordingMailer chan mail.Message
+
+func (m recordingMailer) Send(_ context.Context, msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+var verifyLink = regexp.MustCompile(`http://tasker\.test/verify-email\S+`)
+
+// verificationToken ждёт письмо с подтверждением и достаёт из ссылки токен.
+func verificationToken(t *testing.T, mailer recordingMailer, to string) string {
+	t.Helper()
+	select {
+	case msg := <-mailer:
+		if msg.To != to {
+			t.Fatalf("mail sent to %q, want %q", msg.To, to)
+		}
+		u, err := url.Parse(verifyLink.FindString(msg.Body))
+		if err != nil || u.Query().Get("token") == "" {
+			t.Fatalf("no verification link in %q", msg.Body)
+		}
+		return u.Query().Get("token")
+	case <-time.After(5 * time.Second):
+		t.Fatal("verification mail was not sent")
+	}
+	return ""
+}
+
+func userWithEmail(t *testing.T, db *pgxpool.Pool) (int, string) {
+	t.Helper()
+	id := testutil.User(t, db, service.SystemRoleUser)
+	email := strings.ToLower(testutil.Name("mail")) + "@example.org"
+	if _, err := db.Exec(context.Background(), `UPDATE users SET email = $2 WHERE id = $1`, id, email); err != nil {
+		t.Fatal(err)
+	}
+	return id, email
+}
+
+func emailVerified(t *testing.T, db *pgxpool.Pool, userID int) bool {
+	t.Helper()
+	var verified bool
+	err := db.QueryRow(context.Background(), `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verified
+}
+
+func TestEmailVerification(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	mailer := make(recordingMailer, 1)
+	s := service.NewEmailVerificationService(db, mailer, time.Hour, "http://tasker.test/verify-email")
+	userID, email := userWithEmail(t, db)
+
+	if err := s.RequestVerification(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	token := verificationToken(t, mailer, email)
+	if emailVerified(t, db, userID) {
+		t.Fatal("email is verified before the link was followed")
+	}
+	if err := s.VerifyEmail(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if !emailVerified(t, db, userID) {
+		t.Error("email is not verified after the link was followed")
+	}
+	if err := s.VerifyEmail(ctx, token); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("reused token: err = %v, want ErrInvalidVerificationToken", err)
+	}
+}
+
+func TestEmailVerificationTokenIsBoundToEmail(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	mailer := make(recordingMailer, 1)
+	s := service.NewEmailVerificationService(db, mailer, time.Hour, "http://tasker.test/verify-email")
+	userID, email := userWithEmail(t, db)
+
+	if err := s.RequestVerification(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	token := verificationToken(t, mailer, email)
+	// письмо ушло на прежний адрес: новый им не подтверждается
+	if _, err := db.Exec(ctx, `UPDATE users SET email = $2 WHERE id = $1`, userID, "changed-"+email); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.VerifyEmail(ctx, token); !errors.Is(err, service.ErrInvalidVerificationToken) {
+		t.Errorf("token for a previous email: err = %v, want ErrInvalidVerificationToken", err)
+	}
+	if emailVerified(t, db, userID) {
+		t.Error("changed email is verified by a token sent to the previous one")
+	}
+}
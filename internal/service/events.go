@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Типы событий задач.
+const (
+	EventTaskUnblocked = "task.unblocked"
+	EventTaskBlocked   = "task.blocked"
+)
+
+// Event — доменное событие, которое публикуют сервисы.
+type Event struct {
+	Type    string         `json:"type"`
+	TaskID  string         `json:"taskId,omitempty"`
+	SpaceID string         `json:"spaceId,omitempty"`
+	At      time.Time      `json:"at"`
+	Payload map[string]any `json:"payload,omitempty"`
+}
+
+// EventBus — простая in-process шина событий: подписчики вызываются синхронно в порядке подписки.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []func(ctx context.Context, e Event)
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe добавляет обработчик всех событий.
+func (b *EventBus) Subscribe(fn func(ctx context.Context, e Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// Publish рассылает событие всем подписчикам.
+func (b *EventBus) Publish(ctx context.Context, e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	b.mu.RLock()
+	handlers := append([]func(context.Context, Event){}, b.handlers...)
+	b.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(ctx, e)
+	}
+}
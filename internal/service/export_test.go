@@ -0,0 +1,17 @@
+package service
+
+import "time"
+
+// TOTPAt — код из приложения-аутентификатора для секрета secret в момент at (для тестов service_test).
+func TOTPAt(secret string, at time.Time) string {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		panic(err)
+	}
+	return totpCode(key, at.Unix()/int64(totpPeriod/time.Second))
+}
+
+// SetLoginGuardClock подменяет часы, по которым LoginGuard проверяет блокировку.
+func SetLoginGuardClock(g *LoginGuard, now func() time.Time) {
+	g.now = now
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tasker/internal/model"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInvalidCredentials — неверный логин или пароль.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnknownProvider — такой источник учётных данных не настроен.
+	ErrUnknownProvider = errors.New("unknown credential provider")
+	// ErrLoginTaken — пользователь с таким логином уже есть.
+	ErrLoginTaken = errors.New("login is already taken")
+	// ErrEmailTaken — email уже указан у другого пользователя.
+	ErrEmailTaken = errors.New("email is already taken")
+)
+
+// Источники учётных данных.
+const (
+	ProviderLocal = "local"
+	ProviderOIDC  = "oidc"
+)
+
+// Credentials — то, что предъявил пользователь. Парольные источники используют Login и Password,
+// OIDC — Code и State из обратного вызова провайдера.
+type Credentials struct {
+	Login    string
+	Password string
+	Code     string
+	State    string
+}
+
+// Identity — пользователь, личность которого подтвердил источник учётных данных.
+type Identity struct {
+	User *model.User
+	// Redirect — адрес фронтенда, запомненный при начале входа (только OIDC).
+	Redirect string
+}
+
+// CredentialProvider — источник учётных данных: локальные пароли, каталог LDAP, OIDC.
+// Провайдер только подтверждает личность (при необходимости находит или заводит локального
+// пользователя) и проверяет, что учётная запись активна; 2FA, сессии и журнал входов общие —
+// их делает IdentityService.
+type CredentialProvider interface {
+	// Name — идентификатор источника в LoginRequest.Provider и GET /api/auth/methods.
+	Name() string
+	// Verify возвращает ErrInvalidCredentials, если учётные данные не подошли.
+	Verify(ctx context.Context, cred Credentials, client model.ClientInfo) (*Identity, error)
+}
+
+// IdentityService — единая точка входа: регистрация, вход через любой CredentialProvider,
+// второй фактор и сессии (см. session.go).
+type IdentityService struct {
+	dbPool     *pgxpool.Pool
+	keys       *KeySet
+	guard      *LoginGuard
+	twoFactor  *TwoFactorService
+	passwords  *PasswordPolicy
+	providers  map[string]CredentialProvider
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewIdentityService: keys подписывают и проверяют JWT, guard ограничивает перебор паролей,
+// twoFactor — второй шаг входа, passwords — требования к паролю при регистрации, accessTTL — срок жизни JWT, refreshTTL — сколько сессия
+// живёт без обновления, providers — источники учётных данных.
+func NewIdentityService(dbPool *pgxpool.Pool, keys *KeySet, guard *LoginGuard, twoFactor *TwoFactorService, passwords *PasswordPolicy, accessTTL, refreshTTL time.Duration, providers ...CredentialProvider) *IdentityService {
+	s := &IdentityService{
+		dbPool: dbPool, keys: keys, guard: guard, twoFactor: twoFactor, passwords: passwords,
+		providers: map[string]CredentialProvider{}, accessTTL: accessTTL, refreshTTL: refreshTTL,
+	}
+	for _, p := range providers {
+		s.providers[p.Name()] = p
+	}
+	return s
+}
+
+// HasProvider сообщает, настроен ли источник name.
+func (s *IdentityService) HasProvider(name string) bool {
+	_, ok := s.providers[name]
+	return ok
+}
+
+// userConflict переводит нарушение уникальности users в ErrLoginTaken или ErrEmailTaken.
+func userConflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	if pgErr.ConstraintName == "idx_users_email" {
+		return ErrEmailTaken
+	}
+	return ErrLoginTaken
+}
+
+// Register создаёт пользователя с системной ролью user; роль клиент не выбирает.
+// По inviteToken он сразу вступает в пространство в той же транзакции. Email не подтверждён:
+// приглашения на него станут видны пользователю после подтверждения (см. EmailVerificationService).
+// Занятый логин — ErrLoginTaken, занятый email — ErrEmailTaken.
+func (s *IdentityService) Register(ctx context.Context, req model.RegisterRequest) (*model.User, error) {
+	if err := s.guard.PasswordAllowed(); err != nil {
+		return nil, err
+	}
+	email, err := NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.passwords.Validate(req.Password, req.Login); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.passwords.Hash(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	const query = `
+        INSERT INTO users (name, surname, middlename, login, email, roleID, password)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), (SELECT id FROM roles WHERE scope = 'system' AND name = $6), $7)
+        RETURNING id, name, surname, middlename, login, email, roleID
+    `
+
+	var user model.User
+	err = tx.QueryRow(ctx, query,
+		req.Name,
+		req.Surname,
+		req.Middlename,
+		req.Login,
+		email,
+		SystemRoleUser,
+		hashedPassword,
+	).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Surname,
+		&user.Middlename,
+		&user.Login,
+		&user.Email,
+		&user.RoleID,
+	)
+	if err != nil {
+		return nil, userConflict(err)
+	}
+
+	if err := ClaimForNewUser(ctx, tx, user.ID, "", req.InviteToken); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login подтверждает личность через источник provider и открывает новую сессию: короткий
+// access-токен и refresh-токен. Если у пользователя включена 2FA, сессия не открывается —
+// возвращается challenge-токен для LoginTwoFactor.
+func (s *IdentityService) Login(ctx context.Context, provider string, cred Credentials, client model.ClientInfo) (*model.LoginResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, provider)
+	}
+	id, err := p.Verify(ctx, cred, client)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.completeLogin(ctx, id.User, client)
+	if err != nil {
+		return nil, err
+	}
+	res.Redirect = id.Redirect
+	return res, nil
+}
+
+// completeLogin завершает вход пользователя, личность которого уже подтверждена:
+// открывает сессию или, если включена 2FA, выдаёт challenge-токен.
+func (s *IdentityService) completeLogin(ctx context.Context, user *model.User, client model.ClientInfo) (*model.LoginResult, error) {
+	twoFactor, err := s.twoFactor.enabled(ctx, s.dbPool, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor {
+		ch, err := s.twoFactor.newChallenge(ctx, user.ID, client.Device)
+		if err != nil {
+			return nil, err
+		}
+		s.guard.Challenged(ctx, user.ID, user.Login, client)
+		return &model.LoginResult{Challenge: ch}, nil
+	}
+
+	if err := s.guard.Succeeded(ctx, user.ID, user.Login, client); err != nil {
+		return nil, err
+	}
+	pair, err := s.startSession(ctx, user.ID, user.RoleID, client)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{Tokens: pair, User: user}, nil
+}
+
+// LoginTwoFactor — второй шаг входа: challenge-токен и код из приложения (или код
+// восстановления) обмениваются на сессию.
+func (s *IdentityService) LoginTwoFactor(ctx context.Context, challengeToken, code string, client model.ClientInfo) (*model.LoginResult, error) {
+	user, device, err := s.twoFactor.redeemChallenge(ctx, challengeToken, code, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActive(ctx, s.dbPool, user.ID); err != nil {
+		return nil, err
+	}
+	if client.Device == "" {
+		client.Device = device
+	}
+	if err := s.guard.Succeeded(ctx, user.ID, user.Login, client); err != nil {
+		return nil, err
+	}
+	pair, err := s.startSession(ctx, user.ID, user.RoleID, client)
+	if err != nil {
+		return nil, err
+	}
+	return &model.LoginResult{Tokens: pair, User: user}, nil
+}
+
+// ValidateToken проверяет подпись (ключ по kid, алгоритм закреплён за ключом), exp, iss и aud.
+func (s *IdentityService) ValidateToken(tokenString string) (jwt.MapClaims, error) {
+	return s.keys.Parse(tokenString)
+}
+
+// JWKS — открытые ключи для проверки токенов другими сервисами.
+func (s *IdentityService) JWKS() model.JWKSet {
+	return s.keys.JWKS()
+}
+
+func (s *IdentityService) GetUserByID(ctx context.Context, userID int) (*model.User, error) {
+	const query = `
+        SELECT id, name, surname, middlename, login, email, roleID
+        FROM users WHERE id = $1
+    `
+
+	var user model.User
+	err := s.dbPool.QueryRow(ctx, query, userID).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Surname,
+		&user.Middlename,
+		&user.Login,
+		&user.Email,
+		&user.RoleID,
+	)
+
+	return &user, err
+}
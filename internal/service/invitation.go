@@ -0,0 +1,562 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInvitationNotFound — приглашения нет или оно адресовано другому пользователю.
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationClosed — приглашение истекло, отозвано, исчерпано или на него уже ответили.
+	ErrInvitationClosed = errors.New("invitation is no longer valid")
+	// ErrInvalidInvitation — неверные параметры приглашения.
+	ErrInvalidInvitation = errors.New("invalid invitation")
+	// ErrAlreadyMember — приглашаемый уже участник пространства.
+	ErrAlreadyMember = errors.New("user is already a member of the space")
+	// ErrInvalidEmail — email не разбирается как адрес.
+	ErrInvalidEmail = errors.New("invalid email")
+)
+
+// maxInvitationTTL — дольше приглашение не живёт, даже если об этом попросили.
+const maxInvitationTTL = 90 * 24 * time.Hour
+
+// InvitationService управляет приглашениями в пространства: адресными (пользователю по id, логину
+// или email, в том числе ещё не зарегистрированному) и ссылками с токеном.
+type InvitationService struct {
+	dbPool   *pgxpool.Pool
+	ttl      time.Duration
+	linkBase string
+}
+
+// NewInvitationService: ttl — срок жизни приглашения по умолчанию, linkBase — адрес страницы
+// вступления, к которому добавляется ?token=.
+func NewInvitationService(dbPool *pgxpool.Pool, ttl time.Duration, linkBase string) *InvitationService {
+	return &InvitationService{dbPool: dbPool, ttl: ttl, linkBase: linkBase}
+}
+
+// NormalizeEmail приводит email к нижнему регистру; пустая строка допустима.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", fmt.Errorf("%w: %q", ErrInvalidEmail, email)
+	}
+	return email, nil
+}
+
+// expiresAt считает срок приглашения: hours <= 0 — срок по умолчанию.
+func (s *InvitationService) expiresAt(hours int) (time.Time, error) {
+	if hours < 0 {
+		return time.Time{}, fmt.Errorf("%w: expiresInHours must be positive", ErrInvalidInvitation)
+	}
+	ttl := s.ttl
+	if hours > 0 {
+		ttl = time.Duration(hours) * time.Hour
+	}
+	if ttl > maxInvitationTTL {
+		ttl = maxInvitationTTL
+	}
+	return time.Now().Add(ttl), nil
+}
+
+func (s *InvitationService) link(token string) string {
+	return s.linkBase + "?token=" + url.QueryEscape(token)
+}
+
+// invitationColumns — столбцы для scanInvitation; истёкшие ожидающие приглашения отдаются со статусом expired.
+const invitationColumns = `
+	i.id::text, i.space_id, sp.name, i.kind, i.role, i.inviter_id, i.invitee_id, i.invitee_email,
+	i.max_uses, i.uses,
+	CASE WHEN i.status = 'pending' AND i.expires_at <= now() THEN 'expired' ELSE i.status END,
+	i.expires_at, i.created_at, i.responded_at
+`
+
+func scanInvitation(row pgx.Row) (*model.Invitation, error) {
+	var inv model.Invitation
+	err := row.Scan(&inv.ID, &inv.SpaceID, &inv.SpaceName, &inv.Kind, &inv.Role, &inv.InviterID, &inv.InviteeID,
+		&inv.InviteeEmail, &inv.MaxUses, &inv.Uses, &inv.Status, &inv.ExpiresAt, &inv.CreatedAt, &inv.RespondedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (s *InvitationService) getInvitation(ctx context.Context, q queryer, id string) (*model.Invitation, error) {
+	inv, err := scanInvitation(q.QueryRow(ctx, `
+		SELECT `+invitationColumns+`
+		FROM space_invitations i JOIN spaces sp ON sp.id = i.space_id
+		WHERE i.id::text = $1
+	`, id))
+	if err != nil {
+		return nil, fmt.Errorf("invitation %s: %w", id, err)
+	}
+	return inv, nil
+}
+
+// resolveInvitee находит приглашаемого по userId, login или email (ровно одно из них).
+// По email находится только пользователь, подтвердивший его; иначе email возвращается как есть —
+// приглашение дождётся, пока кто-то подтвердит этот email или предъявит токен.
+func resolveInvitee(ctx context.Context, q queryer, in model.InvitationInput) (*int, *string, error) {
+	given := 0
+	for _, set := range []bool{in.UserID != 0, strings.TrimSpace(in.Login) != "", strings.TrimSpace(in.Email) != ""} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, nil, fmt.Errorf("%w: exactly one of userId, login or email is required", ErrInvalidInvitation)
+	}
+
+	var userID int
+	var err error
+	switch {
+	case in.UserID != 0:
+		err = q.QueryRow(ctx, `SELECT id FROM users WHERE id = $1`, in.UserID).Scan(&userID)
+	case in.Login != "":
+		err = q.QueryRow(ctx, `SELECT id FROM users WHERE login = $1`, strings.TrimSpace(in.Login)).Scan(&userID)
+	default:
+		email, emailErr := NormalizeEmail(in.Email)
+		if emailErr != nil {
+			return nil, nil, emailErr
+		}
+		err = q.QueryRow(ctx, `SELECT id FROM users WHERE lower(email) = $1 AND email_verified_at IS NOT NULL`, email).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, &email, nil
+		}
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, ErrUserNotFound
+		}
+		return nil, nil, err
+	}
+	return &userID, nil, nil
+}
+
+// Invite создаёт адресное приглашение. Нужно право space.invite; роль — не выше прав приглашающего
+// (см. checkAssignableRole). Прежнее ожидающее приглашение того же адресата в это пространство
+// отзывается. Токен из ответа можно переслать приглашённому.
+func (s *InvitationService) Invite(ctx context.Context, spaceID string, actorID int, in model.InvitationInput) (*model.Invitation, error) {
+	if in.Role == "" {
+		in.Role = RoleMember
+	}
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceInvite, spaceID); err != nil {
+		return nil, err
+	}
+	if err := checkAssignableRole(ctx, s.dbPool, actorID, spaceID, in.Role); err != nil {
+		return nil, err
+	}
+	expires, err := s.expiresAt(in.ExpiresInHours)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	inviteeID, email, err := resolveInvitee(ctx, tx, in)
+	if err != nil {
+		return nil, err
+	}
+	if inviteeID != nil {
+		var member bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM space_memberships WHERE space_id = $1 AND user_id = $2)`,
+			spaceID, *inviteeID).Scan(&member); err != nil {
+			return nil, err
+		}
+		if member {
+			return nil, fmt.Errorf("user %d: %w", *inviteeID, ErrAlreadyMember)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE space_invitations SET status = 'revoked', responded_at = now()
+		WHERE space_id = $1 AND kind = 'user' AND status = 'pending'
+		  AND (invitee_id = $2 OR lower(invitee_email) = $3)
+	`, spaceID, inviteeID, email); err != nil {
+		return nil, err
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	var id string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO space_invitations (space_id, kind, role, inviter_id, invitee_id, invitee_email, token_hash, expires_at)
+		VALUES ($1, 'user', $2, $3, $4, $5, $6, $7)
+		RETURNING id::text
+	`, spaceID, in.Role, actorID, inviteeID, email, hash, expires).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.getInvitation(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	inv.Token, inv.Link = token, s.link(token)
+	return inv, nil
+}
+
+// CreateLink создаёт ссылку-приглашение: вступить по ней может любой пользователь с токеном.
+// MaxUses = 1 — одноразовая, 0 — без ограничения. Нужно право space.invite; роль — как в Invite.
+func (s *InvitationService) CreateLink(ctx context.Context, spaceID string, actorID int, in model.InvitationInput) (*model.Invitation, error) {
+	if in.Role == "" {
+		in.Role = RoleMember
+	}
+	if in.MaxUses < 0 {
+		return nil, fmt.Errorf("%w: maxUses must not be negative", ErrInvalidInvitation)
+	}
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceInvite, spaceID); err != nil {
+		return nil, err
+	}
+	if err := checkAssignableRole(ctx, s.dbPool, actorID, spaceID, in.Role); err != nil {
+		return nil, err
+	}
+	expires, err := s.expiresAt(in.ExpiresInHours)
+	if err != nil {
+		return nil, err
+	}
+	var maxUses *int
+	if in.MaxUses > 0 {
+		maxUses = &in.MaxUses
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	var id string
+	err = s.dbPool.QueryRow(ctx, `
+		INSERT INTO space_invitations (space_id, kind, role, inviter_id, token_hash, max_uses, expires_at)
+		VALUES ($1, 'link', $2, $3, $4, $5, $6)
+		RETURNING id::text
+	`, spaceID, in.Role, actorID, hash, maxUses, expires).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.getInvitation(ctx, s.dbPool, id)
+	if err != nil {
+		return nil, err
+	}
+	inv.Token, inv.Link = token, s.link(token)
+	return inv, nil
+}
+
+// ListSpaceInvitations возвращает приглашения пространства. Нужно право space.invite.
+// status: пусто — ожидающие (в том числе истёкшие), all — все.
+func (s *InvitationService) ListSpaceInvitations(ctx context.Context, spaceID string, actorID int, status string) ([]model.Invitation, error) {
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceInvite, spaceID); err != nil {
+		return nil, err
+	}
+	if status == "" {
+		status = model.InvitationPending
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT `+invitationColumns+`
+		FROM space_invitations i JOIN spaces sp ON sp.id = i.space_id
+		WHERE i.space_id = $1 AND ($2 = 'all' OR i.status = $2)
+		ORDER BY i.created_at DESC
+	`, spaceID, status)
+	if err != nil {
+		return nil, err
+	}
+	return collectInvitations(rows)
+}
+
+// ListMine возвращает ожидающие непросроченные адресные приглашения пользователя,
+// включая отправленные на его email, если он его подтвердил.
+func (s *InvitationService) ListMine(ctx context.Context, userID int) ([]model.Invitation, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT `+invitationColumns+`
+		FROM space_invitations i JOIN spaces sp ON sp.id = i.space_id
+		WHERE i.kind = 'user' AND i.status = 'pending' AND i.expires_at > now()
+		  AND (i.invitee_id = $1 OR (i.invitee_id IS NULL
+		       AND lower(i.invitee_email) = (SELECT lower(email) FROM users WHERE id = $1 AND email_verified_at IS NOT NULL)))
+		ORDER BY i.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return collectInvitations(rows)
+}
+
+func collectInvitations(rows pgx.Rows) ([]model.Invitation, error) {
+	defer rows.Close()
+	list := []model.Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *inv)
+	}
+	return list, rows.Err()
+}
+
+// Revoke отзывает ожидающее приглашение или ссылку. Нужно право space.invite в его пространстве.
+func (s *InvitationService) Revoke(ctx context.Context, invitationID string, actorID int) error {
+	inv, err := s.getInvitation(ctx, s.dbPool, invitationID)
+	if err != nil {
+		return err
+	}
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceInvite, inv.SpaceID); err != nil {
+		if errors.Is(err, ErrNotMember) {
+			return fmt.Errorf("invitation %s: %w", invitationID, ErrInvitationNotFound)
+		}
+		return err
+	}
+	tag, err := s.dbPool.Exec(ctx, `
+		UPDATE space_invitations SET status = 'revoked', responded_at = now()
+		WHERE id::text = $1 AND status = 'pending'
+	`, invitationID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("invitation %s: %w", invitationID, ErrInvitationClosed)
+	}
+	return nil
+}
+
+// pendingInvitation — приглашение, заблокированное для ответа.
+type pendingInvitation struct {
+	id        string
+	spaceID   string
+	kind      string
+	role      string
+	inviterID *int
+	inviteeID *int
+	email     *string
+	maxUses   *int
+	uses      int
+	status    string
+	expiresAt time.Time
+}
+
+// lockInvitation читает приглашение по условию where с блокировкой строки.
+func lockInvitation(ctx context.Context, tx pgx.Tx, where string, arg any) (*pendingInvitation, error) {
+	var p pendingInvitation
+	err := tx.QueryRow(ctx, `
+		SELECT id::text, space_id, kind, role, inviter_id, invitee_id, invitee_email, max_uses, uses, status, expires_at
+		FROM space_invitations WHERE `+where+` FOR UPDATE
+	`, arg).Scan(&p.id, &p.spaceID, &p.kind, &p.role, &p.inviterID, &p.inviteeID, &p.email, &p.maxUses, &p.uses,
+		&p.status, &p.expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// addressedTo — адресовано ли приглашение пользователю: по id или, пока не востребовано, по его
+// подтверждённому email. Неподтверждённый email мог указать при регистрации кто угодно.
+func (p *pendingInvitation) addressedTo(ctx context.Context, q queryer, userID int) (bool, error) {
+	if p.inviteeID != nil {
+		return *p.inviteeID == userID, nil
+	}
+	if p.email == nil {
+		return false, nil
+	}
+	var match bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND lower(email) = lower($2) AND email_verified_at IS NOT NULL)
+	`, userID, *p.email).Scan(&match)
+	return match, err
+}
+
+// accept добавляет пользователя в пространство по приглашению и отмечает использование.
+// Для адресного приглашения повторное вступление уже участника просто закрывает приглашение,
+// ссылка в этом случае не расходуется — ErrAlreadyMember.
+func (p *pendingInvitation) accept(ctx context.Context, tx pgx.Tx, userID int) error {
+	if p.status != model.InvitationPending || !p.expiresAt.After(time.Now()) {
+		return fmt.Errorf("invitation %s: %w", p.id, ErrInvitationClosed)
+	}
+	var archived bool
+	if err := tx.QueryRow(ctx, `SELECT archived_at IS NOT NULL FROM spaces WHERE id = $1`, p.spaceID).Scan(&archived); err != nil {
+		return err
+	}
+	if archived {
+		return fmt.Errorf("space %s: %w", p.spaceID, ErrSpaceArchived)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO space_memberships (space_id, user_id, role, invited_by, invitation_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (space_id, user_id) DO NOTHING
+	`, p.spaceID, userID, p.role, p.inviterID, p.id)
+	if err != nil {
+		return err
+	}
+	joined := tag.RowsAffected() == 1
+
+	if p.kind == model.InvitationKindLink {
+		if !joined {
+			return fmt.Errorf("user %d: %w", userID, ErrAlreadyMember)
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE space_invitations
+			SET uses = uses + 1,
+			    status = CASE WHEN max_uses IS NOT NULL AND uses + 1 >= max_uses THEN 'used' ELSE status END
+			WHERE id::text = $1
+		`, p.id)
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE space_invitations SET status = 'accepted', invitee_id = $2, uses = 1, responded_at = now()
+		WHERE id::text = $1
+	`, p.id, userID)
+	return err
+}
+
+func (p *pendingInvitation) decline(ctx context.Context, tx pgx.Tx, userID int) error {
+	if p.status != model.InvitationPending || !p.expiresAt.After(time.Now()) {
+		return fmt.Errorf("invitation %s: %w", p.id, ErrInvitationClosed)
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE space_invitations SET status = 'declined', invitee_id = $2, responded_at = now()
+		WHERE id::text = $1
+	`, p.id, userID)
+	return err
+}
+
+// respond принимает или отклоняет адресное приглашение от имени приглашённого.
+func (s *InvitationService) respond(ctx context.Context, invitationID string, userID int, accept bool) (*model.Invitation, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	p, err := lockInvitation(ctx, tx, `id::text = $1 AND kind = 'user'`, invitationID)
+	if err != nil {
+		return nil, fmt.Errorf("invitation %s: %w", invitationID, err)
+	}
+	ok, err := p.addressedTo(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invitation %s: %w", invitationID, ErrInvitationNotFound)
+	}
+
+	if accept {
+		err = p.accept(ctx, tx, userID)
+	} else {
+		err = p.decline(ctx, tx, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := s.getInvitation(ctx, tx, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	return inv, tx.Commit(ctx)
+}
+
+// Accept принимает адресное приглашение: пользователь становится участником с ролью из приглашения.
+func (s *InvitationService) Accept(ctx context.Context, invitationID string, userID int) (*model.Invitation, error) {
+	return s.respond(ctx, invitationID, userID, true)
+}
+
+// Decline отклоняет адресное приглашение.
+func (s *InvitationService) Decline(ctx context.Context, invitationID string, userID int) (*model.Invitation, error) {
+	return s.respond(ctx, invitationID, userID, false)
+}
+
+// Join вступает в пространство по токену. Токен ссылки подходит любому пользователю, токен
+// адресного приглашения — только адресату или, если приглашение на email ещё не востребовано, любому:
+// токен подтверждает доступ к письму. Возвращает пространство, в которое вступил пользователь.
+func (s *InvitationService) Join(ctx context.Context, token string, userID int) (*model.Invitation, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	id, err := joinByToken(ctx, tx, token, userID)
+	if err != nil {
+		return nil, err
+	}
+	inv, err := s.getInvitation(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return inv, tx.Commit(ctx)
+}
+
+func joinByToken(ctx context.Context, tx pgx.Tx, token string, userID int) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("%w: token is required", ErrInvalidInvitation)
+	}
+	p, err := lockInvitation(ctx, tx, `token_hash = $1`, hashToken(token))
+	if err != nil {
+		return "", err
+	}
+	if p.kind == model.InvitationKindUser && p.inviteeID != nil && *p.inviteeID != userID {
+		return "", ErrInvitationNotFound
+	}
+	return p.id, p.accept(ctx, tx, userID)
+}
+
+// ClaimForNewUser вызывается при регистрации в транзакции создания пользователя: приглашения
+// на его email становятся адресованными ему, а по inviteToken он сразу вступает в пространство.
+// email передаётся, только если он уже подтверждён (LDAP, SCIM, OIDC); неподтверждённый — пустой.
+func ClaimForNewUser(ctx context.Context, tx pgx.Tx, userID int, email, inviteToken string) error {
+	if email != "" {
+		if _, err := tx.Exec(ctx, `
+			UPDATE space_invitations SET invitee_id = $1
+			WHERE kind = 'user' AND status = 'pending' AND invitee_id IS NULL AND lower(invitee_email) = $2
+		`, userID, email); err != nil {
+			return err
+		}
+	}
+	if inviteToken != "" {
+		if _, err := joinByToken(ctx, tx, inviteToken, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
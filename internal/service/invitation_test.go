@@ -0,0 +1,88 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+)
+
+func TestEmailInvitationNeedsVerifiedEmail(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	s := service.NewInvitationService(db, time.Hour, "http://tasker.test/join")
+	owner := testutil.User(t, db, service.SystemRoleUser)
+	spaceID := testutil.Space(t, db, owner)
+
+	email := strings.ToLower(testutil.Name("invitee")) + "@example.org"
+	inv, err := s.Invite(ctx, spaceID, owner, model.InvitationInput{Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// кто-то зарегистрировался с этим email, но не подтвердил его
+	squatter := testutil.User(t, db, service.SystemRoleUser)
+	if _, err := db.Exec(ctx, `UPDATE users SET email = $2 WHERE id = $1`, squatter, email); err != nil {
+		t.Fatal(err)
+	}
+
+	mine, err := s.ListMine(ctx, squatter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 0 {
+		t.Errorf("unverified email sees %d invitations, want none", len(mine))
+	}
+	if _, err := s.Accept(ctx, inv.ID, squatter); !errors.Is(err, service.ErrInvitationNotFound) {
+		t.Errorf("accept with unverified email: err = %v, want ErrInvitationNotFound", err)
+	}
+	// новое приглашение на этот email тоже не адресуется ему
+	again, err := s.Invite(ctx, spaceID, owner, model.InvitationInput{Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.InviteeID != nil {
+		t.Errorf("invitation addressed to user %d with unverified email", *again.InviteeID)
+	}
+
+	// подтвердив email, пользователь видит приглашение и может его принять
+	if _, err := db.Exec(ctx, `UPDATE users SET email_verified_at = now() WHERE id = $1`, squatter); err != nil {
+		t.Fatal(err)
+	}
+	mine, err = s.ListMine(ctx, squatter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 1 || mine[0].ID != again.ID {
+		t.Fatalf("verified email sees %+v, want invitation %s", mine, again.ID)
+	}
+	if _, err := s.Accept(ctx, again.ID, squatter); err != nil {
+		t.Errorf("accept with verified email: %v", err)
+	}
+}
+
+func TestEmailInvitationJoinByToken(t *testing.T) {
+	// токен доказывает доступ к письму: с ним вступить можно и без подтверждённого email
+	db := testutil.DB(t)
+	ctx := context.Background()
+	s := service.NewInvitationService(db, time.Hour, "http://tasker.test/join")
+	owner := testutil.User(t, db, service.SystemRoleUser)
+	spaceID := testutil.Space(t, db, owner)
+
+	inv, err := s.Invite(ctx, spaceID, owner, model.InvitationInput{Email: strings.ToLower(testutil.Name("invitee")) + "@example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := testutil.User(t, db, service.SystemRoleUser)
+	joined, err := s.Join(ctx, inv.Token, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if joined.Status != model.InvitationAccepted || joined.InviteeID == nil || *joined.InviteeID != user {
+		t.Errorf("joined invitation = %+v", *joined)
+	}
+}
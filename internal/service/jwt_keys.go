@@ -0,0 +1,256 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Поддерживаемые алгоритмы подписи JWT.
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
+// hmacKeyID — kid общего секрета: его нельзя публиковать, поэтому и отпечаток не считаем.
+const hmacKeyID = "hs256"
+
+// KeySetConfig — откуда брать ключи подписи.
+type KeySetConfig struct {
+	// Algorithm — HS256 (общий Secret), RS256 или EdDSA (ключи из PEM-файлов).
+	Algorithm string
+	Secret    string
+	// SigningKeyFile — закрытый ключ, которым подписываются новые токены.
+	SigningKeyFile string
+	// VerifyKeyFiles — дополнительные ключи (открытые или закрытые), токены которых ещё принимаются:
+	// новый ключ при ротации и старый до истечения выданных им токенов.
+	VerifyKeyFiles []string
+	Issuer         string
+	Audience       string
+}
+
+// verifyKey — ключ проверки; алгоритм закреплён за ключом, поэтому токен с другим alg
+// (например, HS256, подписанный открытым RSA-ключом) отклоняется.
+type verifyKey struct {
+	alg string
+	key any
+}
+
+// KeySet подписывает access-токены текущим ключом и проверяет их любым из активных ключей по kid.
+type KeySet struct {
+	signMethod jwt.SigningMethod
+	signKID    string
+	signKey    any
+	verify     map[string]verifyKey
+	issuer     string
+	audience   string
+}
+
+// LoadKeySet читает ключи по конфигурации. Ключ подписи всегда входит в ключи проверки.
+func LoadKeySet(cfg KeySetConfig) (*KeySet, error) {
+	ks := &KeySet{verify: map[string]verifyKey{}, issuer: cfg.Issuer, audience: cfg.Audience}
+
+	switch cfg.Algorithm {
+	case JWTAlgHS256:
+		if cfg.Secret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		ks.signMethod, ks.signKID, ks.signKey = jwt.SigningMethodHS256, hmacKeyID, []byte(cfg.Secret)
+		ks.verify[hmacKeyID] = verifyKey{alg: JWTAlgHS256, key: []byte(cfg.Secret)}
+	case JWTAlgRS256, JWTAlgEdDSA:
+		if cfg.SigningKeyFile == "" {
+			return nil, fmt.Errorf("signing key file is required for %s", cfg.Algorithm)
+		}
+		priv, err := readPEMKey(cfg.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: not a private key", cfg.SigningKeyFile)
+		}
+		alg, kid, err := describeKey(signer.Public())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.SigningKeyFile, err)
+		}
+		if alg != cfg.Algorithm {
+			return nil, fmt.Errorf("%s: key is for %s, configured algorithm is %s", cfg.SigningKeyFile, alg, cfg.Algorithm)
+		}
+		ks.signMethod, ks.signKID, ks.signKey = jwt.GetSigningMethod(alg), kid, signer
+		ks.verify[kid] = verifyKey{alg: alg, key: signer.Public()}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	for _, path := range cfg.VerifyKeyFiles {
+		key, err := readPEMKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		alg, kid, err := describeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ks.verify[kid] = verifyKey{alg: alg, key: key}
+	}
+	return ks, nil
+}
+
+// readPEMKey читает ключ из PEM: PKCS#8/PKCS#1 закрытый или PKIX/PKCS#1 открытый.
+func readPEMKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// describeKey возвращает алгоритм открытого ключа и его kid — отпечаток JWK по RFC 7638,
+// поэтому kid одинаков на всех репликах и не требует настройки.
+func describeKey(pub any) (string, string, error) {
+	jwk, err := publicJWK(pub, "")
+	if err != nil {
+		return "", "", err
+	}
+	var canonical string
+	switch jwk.Kty {
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return jwk.Alg, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func publicJWK(pub any, kid string) (model.JWK, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return model.JWK{}, errors.New("RSA key must be at least 2048 bits")
+		}
+		return model.JWK{
+			Kty: "RSA", Use: "sig", Alg: JWTAlgRS256, Kid: kid,
+			N: base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return model.JWK{
+			Kty: "OKP", Use: "sig", Alg: JWTAlgEdDSA, Kid: kid, Crv: "Ed25519",
+			X: base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+	return model.JWK{}, fmt.Errorf("unsupported key type %T", pub)
+}
+
+// Sign подписывает claims текущим ключом, добавляя iss, aud, iat и kid в заголовок.
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = ks.issuer
+	claims["aud"] = ks.audience
+	claims["iat"] = time.Now().Unix()
+	token := jwt.NewWithClaims(ks.signMethod, claims)
+	token.Header["kid"] = ks.signKID
+	return token.SignedString(ks.signKey)
+}
+
+// Parse проверяет подпись ключом из kid с закреплённым за ним алгоритмом, а также exp, iss и aud.
+// Дополнительные опции (например, jwt.WithoutClaimsValidation) добавляются к обязательным.
+func (ks *KeySet) Parse(tokenString string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	algs := make([]string, 0, len(ks.verify))
+	for _, k := range ks.verify {
+		if !slices.Contains(algs, k.alg) {
+			algs = append(algs, k.alg)
+		}
+	}
+	opts = append([]jwt.ParserOption{
+		jwt.WithValidMethods(algs),
+		jwt.WithIssuer(ks.issuer),
+		jwt.WithAudience(ks.audience),
+		jwt.WithExpirationRequired(),
+	}, opts...)
+
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, ok := ks.verify[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		if t.Method.Alg() != k.alg {
+			return nil, fmt.Errorf("algorithm %s is not allowed for kid %q", t.Method.Alg(), kid)
+		}
+		return k.key, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// JWKS — открытые ключи проверки для других сервисов. Общий секрет HS256 не публикуется.
+func (ks *KeySet) JWKS() model.JWKSet {
+	set := model.JWKSet{Keys: []model.JWK{}}
+	for kid, k := range ks.verify {
+		if k.alg == JWTAlgHS256 {
+			continue
+		}
+		if jwk, err := publicJWK(k.key, kid); err == nil {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	slices.SortFunc(set.Keys, func(a, b model.JWK) int {
+		switch {
+		case a.Kid == ks.signKID:
+			return -1
+		case b.Kid == ks.signKID:
+			return 1
+		case a.Kid < b.Kid:
+			return -1
+		case a.Kid > b.Kid:
+			return 1
+		}
+		return 0
+	})
+	return set
+}
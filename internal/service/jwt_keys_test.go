@@ -0,0 +1,246 @@
+package service_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tasker/internal/service"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writePEM сохраняет блок PEM во временный файл и возвращает путь.
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func rsaKeyFiles(t *testing.T, bits int) (private, public string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		writePEM(t, "rsa.pub.pem", "PUBLIC KEY", pub)
+}
+
+func ed25519KeyFile(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "ed25519.pem", "PRIVATE KEY", der)
+}
+
+func loadKeySet(t *testing.T, cfg service.KeySetConfig) *service.KeySet {
+	t.Helper()
+	if cfg.Issuer == "" {
+		cfg.Issuer, cfg.Audience = "tasker", "tasker-api"
+	}
+	ks, err := service.LoadKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func sign(t *testing.T, ks *service.KeySet) string {
+	t.Helper()
+	token, err := ks.Sign(jwt.MapClaims{"sub": 1, "exp": time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// kidOf достаёт kid из заголовка токена без проверки подписи.
+func kidOf(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeySetLoadAndRotation(t *testing.T) {
+	rsaFile, _ := rsaKeyFiles(t, 2048)
+	edFile := ed25519KeyFile(t)
+
+	// текущий ключ — RSA, Ed25519 — ключ, токены которого ещё принимаются
+	current := loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgRS256, SigningKeyFile: rsaFile, VerifyKeyFiles: []string{edFile}})
+	previous := loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgEdDSA, SigningKeyFile: edFile})
+
+	jwks := current.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Alg != service.JWTAlgRS256 || jwks.Keys[1].Alg != service.JWTAlgEdDSA {
+		t.Fatalf("JWKS = %+v, want the RS256 signing key first and the Ed25519 key", jwks.Keys)
+	}
+	token := sign(t, current)
+	if kid := kidOf(t, token); kid != jwks.Keys[0].Kid {
+		t.Errorf("token kid %q, want signing key kid %q", kid, jwks.Keys[0].Kid)
+	}
+	if _, err := current.Parse(token); err != nil {
+		t.Errorf("token of the signing key: %v", err)
+	}
+	// токен прежнего ключа проверяется по своему kid
+	old := sign(t, previous)
+	if kid := kidOf(t, old); kid != jwks.Keys[1].Kid {
+		t.Errorf("previous key kid %q, want %q", kid, jwks.Keys[1].Kid)
+	}
+	if _, err := current.Parse(old); err != nil {
+		t.Errorf("token of the previous key: %v", err)
+	}
+	// а токен нового ключа прежним набором — нет: такого kid там нет
+	if _, err := previous.Parse(token); err == nil {
+		t.Error("token of an unknown kid accepted")
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	rsaFile, rsaPub := rsaKeyFiles(t, 2048)
+	weakFile, _ := rsaKeyFiles(t, 1024)
+	cases := []struct {
+		name string
+		cfg  service.KeySetConfig
+	}{
+		{name: "HS256 without secret", cfg: service.KeySetConfig{Algorithm: service.JWTAlgHS256}},
+		{name: "RS256 without key", cfg: service.KeySetConfig{Algorithm: service.JWTAlgRS256}},
+		{name: "key of another algorithm", cfg: service.KeySetConfig{Algorithm: service.JWTAlgEdDSA, SigningKeyFile: rsaFile}},
+		{name: "public key for signing", cfg: service.KeySetConfig{Algorithm: service.JWTAlgRS256, SigningKeyFile: rsaPub}},
+		{name: "short RSA key", cfg: service.KeySetConfig{Algorithm: service.JWTAlgRS256, SigningKeyFile: weakFile}},
+		{name: "unknown algorithm", cfg: service.KeySetConfig{Algorithm: "none"}},
+		{name: "missing verify key", cfg: service.KeySetConfig{Algorithm: service.JWTAlgRS256, SigningKeyFile: rsaFile,
+			VerifyKeyFiles: []string{filepath.Join(t.TempDir(), "missing.pem")}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := service.LoadKeySet(tc.cfg); err == nil {
+				t.Error("LoadKeySet succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestKeySetPinsAlgorithmToKid(t *testing.T) {
+	_, rsaPub := rsaKeyFiles(t, 2048)
+	pubPEM, err := os.ReadFile(rsaPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HS256 и RS256 принимаются оба, но каждый только под своим kid
+	ks := loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "hs-secret", VerifyKeyFiles: []string{rsaPub}})
+	rsKid := ks.JWKS().Keys[0].Kid
+
+	// классическая подмена: HS256, подписанный открытым RSA-ключом как секретом, под kid RSA-ключа
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 1, "iss": "tasker", "aud": "tasker-api", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = rsKid
+	token, err := forged.SignedString(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(token); err == nil || !strings.Contains(err.Error(), "not allowed for kid") {
+		t.Errorf("HS256 token under an RS256 kid: err = %v, want the algorithm pinned to the kid", err)
+	}
+
+	// и тот же токен под kid общего секрета, но подписанный не им, тоже не проходит
+	forged.Header["kid"] = "hs256"
+	if token, err = forged.SignedString(pubPEM); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(token); err == nil {
+		t.Error("HS256 token signed with a foreign key accepted")
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub": 1, "iss": "tasker", "aud": "tasker-api", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	unsigned.Header["kid"] = rsKid
+	token, err = unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Parse(token); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
+
+func TestKeySetValidatesClaims(t *testing.T) {
+	ks := loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "hs-secret"})
+	cases := []struct {
+		name   string
+		signer *service.KeySet
+		claims jwt.MapClaims
+		ok     bool
+	}{
+		{name: "valid", signer: ks, claims: jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}, ok: true},
+		{name: "expired", signer: ks, claims: jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}},
+		{name: "without exp", signer: ks, claims: jwt.MapClaims{}},
+		{name: "another issuer", claims: jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()},
+			signer: loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "hs-secret", Issuer: "other", Audience: "tasker-api"})},
+		{name: "another audience", claims: jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()},
+			signer: loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "hs-secret", Issuer: "tasker", Audience: "other"})},
+		{name: "another secret", claims: jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()},
+			signer: loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "other-secret"})},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, err := tc.signer.Sign(tc.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ks.Parse(token); (err == nil) != tc.ok {
+				t.Errorf("Parse error = %v, want ok = %v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestJWKSDoesNotExposeSecret(t *testing.T) {
+	const secret = "hs-secret-that-must-stay-private"
+	_, rsaPub := rsaKeyFiles(t, 2048)
+	ks := loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: secret, VerifyKeyFiles: []string{rsaPub}})
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "RSA" {
+		t.Fatalf("JWKS = %+v, want only the RSA key", jwks.Keys)
+	}
+	body, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{secret, "hs256", `"k"`, `"oct"`} {
+		if strings.Contains(string(body), leak) {
+			t.Errorf("JWKS %s contains %s", body, leak)
+		}
+	}
+
+	if keys := loadKeySet(t, service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: secret}).JWKS().Keys; len(keys) != 0 {
+		t.Errorf("HS256-only JWKS = %+v, want no keys", keys)
+	}
+}
@@ -0,0 +1,446 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrLDAPUnavailable — каталог недоступен или ответил ошибкой, не связанной с паролем.
+	ErrLDAPUnavailable = errors.New("directory is unavailable")
+	// ErrLDAPAccessDenied — пароль верен, но пользователь не входит в группу, которой разрешён вход.
+	ErrLDAPAccessDenied = errors.New("not a member of the required directory group")
+)
+
+// ProviderLDAP — вход по логину и паролю каталога LDAP / Active Directory.
+const ProviderLDAP = "ldap"
+
+// ldapIssuer — issuer привязок каталога в user_identities; subject — значение IDAttribute или DN.
+const ldapIssuer = "ldap"
+
+// LDAPConfig — настройки входа через каталог. Пользователь находится одним из двух способов:
+// DN собирается из BindDNTemplate или ищется по UserFilter под BaseDN (от имени BindDN).
+type LDAPConfig struct {
+	// URL — ldap://host:389 или ldaps://host:636.
+	URL string
+	// StartTLS — перейти на TLS после подключения по ldap://.
+	StartTLS bool
+	// CAFile — сертификаты, которым доверяем (PEM); пусто — системные.
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+
+	// BindDNTemplate — DN пользователя, %s заменяется логином (uid=%s,ou=people,dc=example,dc=org).
+	BindDNTemplate string
+	// BindDN и BindPassword — служебная учётная запись для поиска; пусто — анонимный поиск.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter — фильтр поиска пользователя, %s заменяется логином: (uid=%s), в AD — (sAMAccountName=%s).
+	UserFilter string
+
+	// IDAttribute — неизменный идентификатор записи (entryUUID, в AD objectGUID); пусто — DN.
+	IDAttribute      string
+	LoginAttribute   string
+	EmailAttribute   string
+	NameAttribute    string
+	SurnameAttribute string
+	MiddleAttribute  string
+	GroupBaseDN      string
+	// GroupFilter — фильтр групп пользователя: %s — его DN, %u — логин. (member=%s), для posixGroup — (memberUid=%u).
+	GroupFilter string
+	// RequiredGroup — DN группы, участникам которой разрешён вход; пусто — всем.
+	RequiredGroup string
+	// SyncGroups — при входе приводить участие в пространствах с ldap_group к группам пользователя.
+	SyncGroups bool
+	// LinkByLogin привязывает запись каталога к существующему пользователю с тем же логином.
+	LinkByLogin bool
+}
+
+// ldapUser — пользователь каталога, прошедший проверку пароля.
+type ldapUser struct {
+	DN         string
+	Subject    string
+	Login      string
+	Email      string
+	Name       string
+	Surname    string
+	Middlename string
+	// Groups — нормализованные DN групп в нижнем регистре.
+	Groups []string
+}
+
+// LDAPService — источник учётных данных «каталог LDAP»: пароль проверяется bind'ом в каталоге,
+// локальный пользователь создаётся или обновляется по атрибутам записи, участие в пространствах,
+// привязанных к группам каталога, синхронизируется при каждом входе.
+type LDAPService struct {
+	dbPool *pgxpool.Pool
+	guard  *LoginGuard
+	cfg    LDAPConfig
+	tls    *tls.Config
+}
+
+// NewLDAPService проверяет настройки; к каталогу сервер подключается только при входе.
+func NewLDAPService(dbPool *pgxpool.Pool, guard *LoginGuard, cfg LDAPConfig) (*LDAPService, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("LDAP URL must be ldap:// or ldaps://, got %q", cfg.URL)
+	}
+	if cfg.StartTLS && u.Scheme == "ldaps" {
+		return nil, errors.New("LDAP StartTLS cannot be used with ldaps://")
+	}
+	if cfg.BindDNTemplate != "" {
+		if !strings.Contains(cfg.BindDNTemplate, "%s") {
+			return nil, errors.New("LDAP bind DN template must contain %s")
+		}
+	} else if cfg.BaseDN == "" || !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, errors.New("LDAP needs either a bind DN template or a base DN and a user filter with %s")
+	}
+	if (cfg.RequiredGroup != "" || cfg.SyncGroups) && (cfg.GroupBaseDN == "" || cfg.GroupFilter == "") {
+		return nil, errors.New("LDAP required group and group sync need a group base DN and a group filter")
+	}
+	if cfg.RequiredGroup != "" {
+		if cfg.RequiredGroup, err = normalizeDN(cfg.RequiredGroup); err != nil {
+			return nil, fmt.Errorf("LDAP required group: %w", err)
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	tc := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: u.Hostname(), InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read LDAP CA file: %w", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in LDAP CA file %s", cfg.CAFile)
+		}
+	}
+	return &LDAPService{dbPool: dbPool, guard: guard, cfg: cfg, tls: tc}, nil
+}
+
+func (s *LDAPService) Name() string { return ProviderLDAP }
+
+// Verify проверяет логин и пароль в каталоге с учётом блокировок LoginGuard и возвращает
+// локального пользователя, созданного или обновлённого по записи каталога.
+func (s *LDAPService) Verify(ctx context.Context, cred Credentials, client model.ClientInfo) (*Identity, error) {
+	if err := s.guard.Check(ctx, cred.Login, client); err != nil {
+		return nil, err
+	}
+	entry, err := s.authenticate(ctx, strings.TrimSpace(cred.Login), cred.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		if err := s.guard.Failed(ctx, cred.Login, nil, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.resolveUser(ctx, entry, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActive(ctx, s.dbPool, user.ID); err != nil {
+		return nil, err
+	}
+	if s.cfg.SyncGroups {
+		if err := syncLDAPGroups(ctx, s.dbPool, user.ID, entry.Groups); err != nil {
+			return nil, err
+		}
+	}
+	return &Identity{User: user}, nil
+}
+
+// dial подключается к каталогу; соединение закрывается и при отмене ctx.
+func (s *LDAPService) dial(ctx context.Context) (*ldap.Conn, func(), error) {
+	conn, err := ldap.DialURL(s.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: s.cfg.Timeout}),
+		ldap.DialWithTLSConfig(s.tls))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrLDAPUnavailable, err)
+	}
+	conn.SetTimeout(s.cfg.Timeout)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	closeConn := func() {
+		stop()
+		conn.Close()
+	}
+	if s.cfg.StartTLS {
+		if err := conn.StartTLS(s.tls); err != nil {
+			closeConn()
+			return nil, nil, fmt.Errorf("%w: StartTLS: %v", ErrLDAPUnavailable, err)
+		}
+	}
+	return conn, closeConn, nil
+}
+
+// authenticate находит DN пользователя, проверяет пароль bind'ом и читает атрибуты и группы.
+// Неизвестный логин, неоднозначный поиск и неверный пароль одинаково дают ErrInvalidCredentials,
+// пользователь вне RequiredGroup — ErrLDAPAccessDenied.
+func (s *LDAPService) authenticate(ctx context.Context, login, password string) (*ldapUser, error) {
+	// bind с пустым паролем — анонимный, и сервер его примет
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, closeConn, err := s.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	var userDN string
+	if s.cfg.BindDNTemplate != "" {
+		userDN = strings.ReplaceAll(s.cfg.BindDNTemplate, "%s", ldap.EscapeDN(login))
+	} else {
+		if err := s.serviceBind(conn); err != nil {
+			return nil, err
+		}
+		filter := strings.ReplaceAll(s.cfg.UserFilter, "%s", ldap.EscapeFilter(login))
+		res, err := conn.Search(ldap.NewSearchRequest(s.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			2, int(s.cfg.Timeout.Seconds()), false, filter, []string{"1.1"}, nil))
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("%w: search user: %v", ErrLDAPUnavailable, err)
+		}
+		if res == nil || len(res.Entries) != 1 {
+			return nil, ErrInvalidCredentials
+		}
+		userDN = res.Entries[0].DN
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: bind: %v", ErrLDAPUnavailable, err)
+	}
+
+	// атрибуты читаем с правами самого пользователя: свою запись он видит всегда
+	attrs := slices.DeleteFunc([]string{s.cfg.IDAttribute, s.cfg.LoginAttribute, s.cfg.EmailAttribute,
+		s.cfg.NameAttribute, s.cfg.SurnameAttribute, s.cfg.MiddleAttribute}, func(a string) bool { return a == "" })
+	res, err := conn.Search(ldap.NewSearchRequest(userDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		1, int(s.cfg.Timeout.Seconds()), false, "(objectClass=*)", attrs, nil))
+	if err != nil || len(res.Entries) != 1 {
+		return nil, fmt.Errorf("%w: read user entry %s: %v", ErrLDAPUnavailable, userDN, err)
+	}
+	u := s.directoryUser(res.Entries[0], login)
+
+	if s.cfg.GroupBaseDN != "" && s.cfg.GroupFilter != "" {
+		if u.Groups, err = s.groups(conn, u.DN, login); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.RequiredGroup != "" && !slices.Contains(u.Groups, strings.ToLower(s.cfg.RequiredGroup)) {
+		return nil, ErrLDAPAccessDenied
+	}
+	return u, nil
+}
+
+// serviceBind входит служебной учётной записью; без неё поиск анонимный.
+func (s *LDAPService) serviceBind(conn *ldap.Conn) error {
+	if s.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(s.cfg.BindDN, s.cfg.BindPassword); err != nil {
+		return fmt.Errorf("%w: service bind: %v", ErrLDAPUnavailable, err)
+	}
+	return nil
+}
+
+// groups ищет группы пользователя (от имени служебной учётной записи, если она задана).
+func (s *LDAPService) groups(conn *ldap.Conn, userDN, login string) ([]string, error) {
+	if err := s.serviceBind(conn); err != nil {
+		return nil, err
+	}
+	filter := strings.NewReplacer("%s", ldap.EscapeFilter(userDN), "%u", ldap.EscapeFilter(login)).Replace(s.cfg.GroupFilter)
+	res, err := conn.SearchWithPaging(ldap.NewSearchRequest(s.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(s.cfg.Timeout.Seconds()), false, filter, []string{"1.1"}, nil), 500)
+	if err != nil {
+		return nil, fmt.Errorf("%w: search groups: %v", ErrLDAPUnavailable, err)
+	}
+	groups := make([]string, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		dn, err := normalizeDN(e.DN)
+		if err != nil {
+			continue
+		}
+		groups = append(groups, strings.ToLower(dn))
+	}
+	return groups, nil
+}
+
+// directoryUser переносит атрибуты записи в профиль; без имени подставляется логин.
+func (s *LDAPService) directoryUser(e *ldap.Entry, login string) *ldapUser {
+	get := func(attr string) string {
+		if attr == "" {
+			return ""
+		}
+		return strings.TrimSpace(e.GetAttributeValue(attr))
+	}
+	u := &ldapUser{
+		DN:         e.DN,
+		Login:      cmp.Or(get(s.cfg.LoginAttribute), login),
+		Email:      get(s.cfg.EmailAttribute),
+		Name:       get(s.cfg.NameAttribute),
+		Surname:    get(s.cfg.SurnameAttribute),
+		Middlename: get(s.cfg.MiddleAttribute),
+	}
+	if u.Name == "" {
+		u.Name = u.Login
+	}
+	u.Subject = ldapSubject(e.GetRawAttributeValue(s.cfg.IDAttribute))
+	if u.Subject == "" {
+		dn, err := normalizeDN(e.DN)
+		if err != nil {
+			dn = e.DN
+		}
+		u.Subject = "dn:" + strings.ToLower(dn)
+	}
+	return u
+}
+
+// ldapSubject — текстовый идентификатор как есть, двоичный (objectGUID) — в hex.
+func ldapSubject(raw []byte) string {
+	for _, b := range raw {
+		if b < 0x20 || b > 0x7e {
+			return hex.EncodeToString(raw)
+		}
+	}
+	return string(raw)
+}
+
+// normalizeDN приводит DN к каноническому виду, чтобы "CN=Dev, OU=Groups" и "cn=Dev,ou=Groups"
+// совпадали; регистр значений сравнивается отдельно (lower).
+func normalizeDN(dn string) (string, error) {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil {
+		return "", err
+	}
+	if len(parsed.RDNs) == 0 {
+		return "", errors.New("empty DN")
+	}
+	return parsed.String(), nil
+}
+
+// resolveUser находит пользователя по привязке к записи каталога; если её нет — привязывает
+// к пользователю с тем же логином (LinkByLogin) или создаёт нового. Имя, отчество и email
+// обновляются из каталога при каждом входе.
+func (s *LDAPService) resolveUser(ctx context.Context, entry *ldapUser, client model.ClientInfo) (*model.User, error) {
+	email, err := NormalizeEmail(entry.Email)
+	if err != nil {
+		email = ""
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	event := ""
+	var userID int
+	err = tx.QueryRow(ctx, `
+		UPDATE user_identities SET last_login_at = now(), email = NULLIF($3, '')
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id
+	`, ldapIssuer, entry.Subject, email).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = tx.QueryRow(ctx, `SELECT id FROM users WHERE lower(login) = lower($1)`, entry.Login).Scan(&userID)
+		switch {
+		case err == nil && !s.cfg.LinkByLogin:
+			return nil, fmt.Errorf("directory user %q: %w", entry.Login, ErrLoginTaken)
+		case err == nil:
+			event = model.AuthEventLDAPLinked
+		case errors.Is(err, pgx.ErrNoRows):
+			event = model.AuthEventLDAPProvisioned
+			err = tx.QueryRow(ctx, `
+				INSERT INTO users (name, surname, login, roleID, password)
+				VALUES ($1, $2, $3, (SELECT id FROM roles WHERE scope = 'system' AND name = $4), '!')
+				RETURNING id
+			`, entry.Name, entry.Surname, entry.Login, SystemRoleUser).Scan(&userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO user_identities (issuer, subject, user_id, email, last_login_at) VALUES ($1, $2, $3, NULLIF($4, ''), now())
+		`, ldapIssuer, entry.Subject, userID, email); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// каталог — источник истины для имени и email; занятый другим пользователем email не трогаем,
+	// а email из каталога считается подтверждённым
+	var user model.User
+	err = tx.QueryRow(ctx, `
+		UPDATE users u SET name = $2, surname = $3, middlename = NULLIF($4, ''),
+			email = CASE WHEN t.skip THEN email ELSE $5 END,
+			email_verified_at = CASE WHEN t.skip THEN email_verified_at
+				WHEN lower(email) = $5 THEN COALESCE(email_verified_at, now()) ELSE now() END
+		FROM (SELECT $5 = '' OR EXISTS (SELECT 1 FROM users o WHERE lower(o.email) = $5 AND o.id <> $1) AS skip) t
+		WHERE u.id = $1
+		RETURNING id, name, surname, middlename, login, email, roleID
+	`, userID, entry.Name, entry.Surname, entry.Middlename, email).Scan(
+		&user.ID, &user.Name, &user.Surname, &user.Middlename, &user.Login, &user.Email, &user.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if event == model.AuthEventLDAPProvisioned && user.Email != nil {
+		if err := ClaimForNewUser(ctx, tx, user.ID, *user.Email, ""); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	if event != "" {
+		s.guard.record(ctx, model.AuthEvent{Event: event, Login: user.Login, UserID: &user.ID, IP: client.IP, UserAgent: client.UserAgent})
+	}
+	return &user, nil
+}
+
+// syncLDAPGroups приводит участие пользователя в пространствах, привязанных к группам каталога,
+// к его текущим группам: добавляет с ролью member (роль уже состоящих не меняется) и удаляет
+// из остальных привязанных. Владельца из его пространства не удаляем. Пространства без
+// ldap_group не затрагиваются.
+func syncLDAPGroups(ctx context.Context, q execer, userID int, groups []string) error {
+	if _, err := q.Exec(ctx, `
+		INSERT INTO space_memberships (space_id, user_id, role)
+		SELECT id, $1, $3 FROM spaces WHERE lower(ldap_group) = ANY($2)
+		ON CONFLICT (space_id, user_id) DO NOTHING
+	`, userID, groups, RoleMember); err != nil {
+		return err
+	}
+	_, err := q.Exec(ctx, `
+		DELETE FROM space_memberships m USING spaces s
+		WHERE m.space_id = s.id AND m.user_id = $1 AND s.ldap_group IS NOT NULL
+			AND s.owner_id <> $1 AND NOT (lower(s.ldap_group) = ANY($2))
+	`, userID, groups)
+	return err
+}
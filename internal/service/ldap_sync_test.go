@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"tasker/internal/mockldap"
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/storage"
+	"tasker/internal/testutil"
+)
+
+func TestLDAPSyncGroups(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+
+	d, err := mockldap.Load("../../cmd/mockldap/directory.ldif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() { _ = d.Serve(l) }()
+
+	const (
+		people   = "ou=people,dc=example,dc=org"
+		backend  = "cn=backend,ou=groups,dc=example,dc=org"
+		frontend = "cn=frontend,ou=groups,dc=example,dc=org"
+	)
+	// группа привязывается только к одному пространству — снимаем привязки прошлых запусков
+	if _, err := db.Exec(ctx, `UPDATE spaces SET ldap_group = NULL WHERE lower(ldap_group) IN ($1, $2)`, backend, frontend); err != nil {
+		t.Fatal(err)
+	}
+	admin := testutil.User(t, db, service.SystemRoleAdmin)
+	spaces := service.NewSpaceService(db, nil)
+	backendSpace := testutil.Space(t, db, admin)
+	frontendSpace := testutil.Space(t, db, admin)
+	if err := spaces.SetLDAPGroup(ctx, backendSpace, admin, backend); err != nil {
+		t.Fatal(err)
+	}
+	if err := spaces.SetLDAPGroup(ctx, frontendSpace, admin, frontend); err != nil {
+		t.Fatal(err)
+	}
+
+	guard := service.NewLoginGuard(db, storage.NewMemoryAttemptStore(), service.LoginPolicy{
+		MaxFailures: 100, MaxIPFailures: 100, Lockout: time.Minute, Window: time.Minute,
+	})
+	s, err := service.NewLDAPService(db, guard, service.LDAPConfig{
+		URL:            "ldap://" + l.Addr().String(),
+		Timeout:        5 * time.Second,
+		BindDNTemplate: "uid=%s," + people,
+		IDAttribute:    "entryUUID",
+		LoginAttribute: "uid",
+		NameAttribute:  "givenName",
+		GroupBaseDN:    "ou=groups,dc=example,dc=org",
+		GroupFilter:    "(member=%s)",
+		SyncGroups:     true,
+		LinkByLogin:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := func() int {
+		t.Helper()
+		id, err := s.Verify(ctx, service.Credentials{Login: "ivanov", Password: "ivanov-password"}, model.ClientInfo{IP: "127.0.0.1"})
+		if err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+		return id.User.ID
+	}
+	isMember := func(spaceID string, userID int) bool {
+		t.Helper()
+		var ok bool
+		if err := db.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM space_memberships WHERE space_id = $1 AND user_id = $2)
+		`, spaceID, userID).Scan(&ok); err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	userID := login()
+	if !isMember(backendSpace, userID) || isMember(frontendSpace, userID) {
+		t.Fatalf("first login: backend %v, frontend %v; want only backend",
+			isMember(backendSpace, userID), isMember(frontendSpace, userID))
+	}
+
+	// ivanov переходит из backend во frontend
+	if err := d.Set(backend, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(frontend, "member", "uid=petrova,"+people, "uid=ivanov,"+people); err != nil {
+		t.Fatal(err)
+	}
+	if got := login(); got != userID {
+		t.Fatalf("second login resolved user %d, want %d", got, userID)
+	}
+	if isMember(backendSpace, userID) || !isMember(frontendSpace, userID) {
+		t.Errorf("after group change: backend %v, frontend %v; want only frontend",
+			isMember(backendSpace, userID), isMember(frontendSpace, userID))
+	}
+}
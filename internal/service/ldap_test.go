@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"tasker/internal/mockldap"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testPeopleDN = "ou=people,dc=example,dc=org"
+	testGroupsDN = "ou=groups,dc=example,dc=org"
+)
+
+// startMockLDAP поднимает mockldap с каталогом из cmd/mockldap на свободном порту.
+func startMockLDAP(t *testing.T) (*mockldap.Directory, string) {
+	t.Helper()
+	d, err := mockldap.Load("../../cmd/mockldap/directory.ldif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() { _ = d.Serve(l) }()
+	return d, "ldap://" + l.Addr().String()
+}
+
+// testLDAPConfig — атрибуты и группы как в cmd/mockldap/directory.ldif.
+func testLDAPConfig(url string) LDAPConfig {
+	return LDAPConfig{
+		URL:              url,
+		Timeout:          5 * time.Second,
+		IDAttribute:      "entryUUID",
+		LoginAttribute:   "uid",
+		EmailAttribute:   "mail",
+		NameAttribute:    "givenName",
+		SurnameAttribute: "sn",
+		MiddleAttribute:  "initials",
+		GroupBaseDN:      testGroupsDN,
+		GroupFilter:      "(member=%s)",
+	}
+}
+
+func templateConfig(url string) LDAPConfig {
+	cfg := testLDAPConfig(url)
+	cfg.BindDNTemplate = "uid=%s," + testPeopleDN
+	return cfg
+}
+
+func searchConfig(url string) LDAPConfig {
+	cfg := testLDAPConfig(url)
+	cfg.BindDN = "cn=tasker,ou=services,dc=example,dc=org"
+	cfg.BindPassword = "tasker-secret"
+	cfg.BaseDN = testPeopleDN
+	cfg.UserFilter = "(uid=%s)"
+	return cfg
+}
+
+func newTestLDAP(t *testing.T, cfg LDAPConfig) *LDAPService {
+	t.Helper()
+	s, err := NewLDAPService(nil, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLDAPAuthenticateBindTemplate(t *testing.T) {
+	_, url := startMockLDAP(t)
+	s := newTestLDAP(t, templateConfig(url))
+
+	u, err := s.authenticate(context.Background(), "ivanov", "ivanov-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ldapUser{
+		DN:         "uid=ivanov," + testPeopleDN,
+		Subject:    "5a1c2f1e-3b7d-4c61-9a52-0e4b7f6c1a01",
+		Login:      "ivanov",
+		Email:      "ivanov@example.org",
+		Name:       "Иван",
+		Surname:    "Иванов",
+		Middlename: "Иванович",
+	}
+	groups := u.Groups
+	u.Groups = nil
+	if !reflect.DeepEqual(*u, want) {
+		t.Errorf("user = %+v, want %+v", *u, want)
+	}
+	slices.Sort(groups)
+	wantGroups := []string{"cn=backend," + testGroupsDN, "cn=tasker-users," + testGroupsDN}
+	if !slices.Equal(groups, wantGroups) {
+		t.Errorf("groups = %v, want %v", groups, wantGroups)
+	}
+}
+
+func TestLDAPAuthenticateSearchThenBind(t *testing.T) {
+	_, url := startMockLDAP(t)
+	s := newTestLDAP(t, searchConfig(url))
+
+	u, err := s.authenticate(context.Background(), "petrova", "petrova-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DN != "uid=petrova,"+testPeopleDN || u.Login != "petrova" || u.Middlename != "" {
+		t.Errorf("user = %+v", *u)
+	}
+	slices.Sort(u.Groups)
+	wantGroups := []string{"cn=frontend," + testGroupsDN, "cn=tasker-users," + testGroupsDN}
+	if !slices.Equal(u.Groups, wantGroups) {
+		t.Errorf("groups = %v, want %v", u.Groups, wantGroups)
+	}
+}
+
+func TestLDAPAuthenticateInvalidCredentials(t *testing.T) {
+	_, url := startMockLDAP(t)
+	modes := map[string]LDAPConfig{"template": templateConfig(url), "search": searchConfig(url)}
+	cases := []struct{ name, login, password string }{
+		{"wrong password", "ivanov", "petrova-password"},
+		{"unknown login", "nobody", "ivanov-password"},
+		{"empty password", "ivanov", ""},
+		{"empty login", "", "ivanov-password"},
+		{"filter wildcard", "*", "ivanov-password"},
+	}
+	for mode, cfg := range modes {
+		s := newTestLDAP(t, cfg)
+		for _, tc := range cases {
+			t.Run(mode+"/"+tc.name, func(t *testing.T) {
+				_, err := s.authenticate(context.Background(), tc.login, tc.password)
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("err = %v, want ErrInvalidCredentials", err)
+				}
+			})
+		}
+	}
+}
+
+func TestLDAPRequiredGroup(t *testing.T) {
+	_, url := startMockLDAP(t)
+	cfg := searchConfig(url)
+	// DN группы в другом регистре и с пробелами: сравнение идёт по нормализованному виду
+	cfg.RequiredGroup = "CN=Tasker-Users, OU=groups, DC=example, DC=org"
+	s := newTestLDAP(t, cfg)
+
+	if _, err := s.authenticate(context.Background(), "ivanov", "ivanov-password"); err != nil {
+		t.Errorf("member of the required group: %v", err)
+	}
+	if _, err := s.authenticate(context.Background(), "sidorov", "sidorov-password"); !errors.Is(err, ErrLDAPAccessDenied) {
+		t.Errorf("outside the required group: err = %v, want ErrLDAPAccessDenied", err)
+	}
+	if _, err := s.authenticate(context.Background(), "sidorov", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password outside the group: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPGroupChanges(t *testing.T) {
+	d, url := startMockLDAP(t)
+	s := newTestLDAP(t, templateConfig(url))
+	ctx := context.Background()
+
+	if err := d.Set("cn=frontend,"+testGroupsDN, "member", "uid=petrova,"+testPeopleDN, "uid=ivanov,"+testPeopleDN); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("cn=backend,"+testGroupsDN, "member"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.authenticate(ctx, "ivanov", "ivanov-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(u.Groups)
+	want := []string{"cn=frontend," + testGroupsDN, "cn=tasker-users," + testGroupsDN}
+	if !slices.Equal(u.Groups, want) {
+		t.Errorf("groups = %v, want %v", u.Groups, want)
+	}
+}
+
+func TestLDAPUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ldap://" + l.Addr().String()
+	_ = l.Close()
+
+	s := newTestLDAP(t, templateConfig(url))
+	if _, err := s.authenticate(context.Background(), "ivanov", "ivanov-password"); !errors.Is(err, ErrLDAPUnavailable) {
+		t.Errorf("err = %v, want ErrLDAPUnavailable", err)
+	}
+}
+
+func TestDirectoryUser(t *testing.T) {
+	guid := string([]byte{0x01, 0x9f, 0x00, 0xab})
+	cases := []struct {
+		name  string
+		cfg   LDAPConfig
+		entry *ldap.Entry
+		login string
+		want  ldapUser
+	}{
+		{
+			name: "all attributes",
+			cfg:  testLDAPConfig("ldap://localhost"),
+			entry: ldap.NewEntry("uid=ivanov,ou=people,dc=example,dc=org", map[string][]string{
+				"entryUUID": {"uuid-1"}, "uid": {"Ivanov"}, "mail": {" ivanov@example.org "},
+				"givenName": {"Иван"}, "sn": {"Иванов"}, "initials": {"Иванович"},
+			}),
+			login: "ivanov",
+			want: ldapUser{DN: "uid=ivanov,ou=people,dc=example,dc=org", Subject: "uuid-1", Login: "Ivanov",
+				Email: "ivanov@example.org", Name: "Иван", Surname: "Иванов", Middlename: "Иванович"},
+		},
+		{
+			name:  "binary objectGUID",
+			cfg:   LDAPConfig{IDAttribute: "objectGUID", LoginAttribute: "sAMAccountName"},
+			entry: ldap.NewEntry("CN=Ivanov,OU=Users,DC=corp", map[string][]string{"objectGUID": {guid}, "sAMAccountName": {"ivanov"}}),
+			login: "IVANOV",
+			want:  ldapUser{DN: "CN=Ivanov,OU=Users,DC=corp", Subject: "019f00ab", Login: "ivanov", Name: "ivanov"},
+		},
+		{
+			name:  "no id attribute and no name",
+			cfg:   LDAPConfig{},
+			entry: ldap.NewEntry("UID=Petrova, OU=People, DC=Example, DC=org", nil),
+			login: "petrova",
+			want: ldapUser{DN: "UID=Petrova, OU=People, DC=Example, DC=org", Subject: "dn:uid=petrova,ou=people,dc=example,dc=org",
+				Login: "petrova", Name: "petrova"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &LDAPService{cfg: tc.cfg}
+			if got := s.directoryUser(tc.entry, tc.login); !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("directoryUser = %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDN(t *testing.T) {
+	cases := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{in: "cn=backend,ou=groups,dc=example,dc=org", want: "cn=backend,ou=groups,dc=example,dc=org"},
+		{in: "CN=Backend, OU=Groups, DC=Example, DC=org", want: "cn=Backend,ou=Groups,dc=Example,dc=org"},
+		{in: `cn=Smith\, John,ou=people`, want: `cn=Smith\, John,ou=people`},
+		{in: "", wantErr: true},
+		{in: "backend", wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := normalizeDN(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("normalizeDN(%q) error = %v, wantErr %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("normalizeDN(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
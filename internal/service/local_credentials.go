@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LocalCredentials — пароли, хранящиеся в users.password (bcrypt).
+type LocalCredentials struct {
+	dbPool    *pgxpool.Pool
+	guard     *LoginGuard
+	passwords *PasswordPolicy
+}
+
+func NewLocalCredentials(dbPool *pgxpool.Pool, guard *LoginGuard, passwords *PasswordPolicy) *LocalCredentials {
+	return &LocalCredentials{dbPool: dbPool, guard: guard, passwords: passwords}
+}
+
+func (p *LocalCredentials) Name() string { return ProviderLocal }
+
+// Verify проверяет логин и пароль с учётом блокировок LoginGuard: заблокированный логин или
+// адрес — LoginBlockedError, неверная пара — ErrInvalidCredentials (неизвестный логин неотличим
+// от неверного пароля). Хеш, посчитанный с устаревшей стоимостью bcrypt, пересчитывается.
+func (p *LocalCredentials) Verify(ctx context.Context, cred Credentials, client model.ClientInfo) (*Identity, error) {
+	if err := p.guard.PasswordAllowed(); err != nil {
+		return nil, err
+	}
+	if err := p.guard.Check(ctx, cred.Login, client); err != nil {
+		return nil, err
+	}
+
+	const query = `
+        SELECT id, name, surname, middlename, login, email, roleID, password
+        FROM users WHERE login = $1
+    `
+
+	var user model.User
+	err := p.dbPool.QueryRow(ctx, query, cred.Login).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Surname,
+		&user.Middlename,
+		&user.Login,
+		&user.Email,
+		&user.RoleID,
+		&user.Password,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// сравниваем с заглушкой, чтобы время ответа не выдавало отсутствие пользователя
+		_ = bcrypt.CompareHashAndPassword(p.passwords.dummyHash, []byte(cred.Password))
+		if err := p.guard.Failed(ctx, cred.Login, nil, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(cred.Password)); err != nil {
+		if err := p.guard.Failed(ctx, cred.Login, &user.ID, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if p.passwords.needsRehash(user.Password) {
+		p.rehash(ctx, user.ID, user.Password, cred.Password)
+	}
+
+	user.Password = ""
+	// пароль верен, поэтому можно честно сказать, что учётная запись отключена
+	if err := checkActive(ctx, p.dbPool, user.ID); err != nil {
+		return nil, err
+	}
+	return &Identity{User: &user}, nil
+}
+
+// rehash пересчитывает хеш с текущей стоимостью. Ошибка входу не мешает: попробуем в следующий раз.
+func (p *LocalCredentials) rehash(ctx context.Context, userID int, oldHash, password string) {
+	hash, err := p.passwords.Hash(password)
+	if err == nil {
+		// пароль мог смениться параллельно — тогда новый хеш не нужен
+		_, err = p.dbPool.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1 AND password = $3`, userID, hash, oldHash)
+	}
+	if err != nil {
+		slog.Warn("Failed to upgrade password hash", "userID", userID, "error", err)
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLoginBlocked — слишком много неудачных попыток входа с этим логином или с этого адреса.
+var ErrLoginBlocked = errors.New("too many failed login attempts")
+
+// ErrPasswordLoginDisabled — вход по паролю отключён в этой установке, доступен только SSO.
+var ErrPasswordLoginDisabled = errors.New("password login is disabled")
+
+// LoginBlockedError сообщает, до какого момента вход заблокирован; errors.Is(err, ErrLoginBlocked) — true.
+type LoginBlockedError struct {
+	Until time.Time
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrLoginBlocked, e.Until.Format(time.RFC3339))
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return ErrLoginBlocked
+}
+
+// LoginPolicy — ограничения на неудачные попытки входа.
+type LoginPolicy struct {
+	// MaxFailures — после стольких неудач подряд логин блокируется на Lockout.
+	MaxFailures int
+	// MaxIPFailures — то же для IP-адреса (по любым логинам).
+	MaxIPFailures int
+	// BaseDelay — первая задержка; после половины лимита каждая неудача удваивает её.
+	BaseDelay time.Duration
+	Lockout   time.Duration
+	// Window — неудачи старше этого не учитываются.
+	Window time.Duration
+	// PasswordLoginDisabled отключает вход, регистрацию и сброс по паролю — остаётся только SSO.
+	PasswordLoginDisabled bool
+}
+
+// backoff возвращает блокировку после n-й неудачи при лимите limit: первые limit/2 неудач
+// бесплатны, дальше BaseDelay, 2·BaseDelay, 4·BaseDelay…, на limit-й — Lockout.
+func (p LoginPolicy) backoff(limit int) func(n int) time.Duration {
+	return func(n int) time.Duration {
+		if n >= limit {
+			return p.Lockout
+		}
+		free := limit / 2
+		if n <= free {
+			return 0
+		}
+		shift := n - free - 1
+		if shift > 30 {
+			return p.Lockout
+		}
+		return min(p.BaseDelay<<shift, p.Lockout)
+	}
+}
+
+// LoginGuard ограничивает перебор паролей по логину и по IP и пишет журнал входов.
+// Логин считается и тогда, когда такого пользователя нет, — так ответ не выдаёт, существует ли он.
+type LoginGuard struct {
+	dbPool *pgxpool.Pool
+	store  storage.AttemptStore
+	policy LoginPolicy
+	now    func() time.Time
+}
+
+func NewLoginGuard(dbPool *pgxpool.Pool, store storage.AttemptStore, policy LoginPolicy) *LoginGuard {
+	return &LoginGuard{dbPool: dbPool, store: store, policy: policy, now: time.Now}
+}
+
+func loginAttemptKey(login string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(login))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// PasswordAllowed возвращает ErrPasswordLoginDisabled, если вход по паролю отключён.
+func (g *LoginGuard) PasswordAllowed() error {
+	if g.policy.PasswordLoginDisabled {
+		return ErrPasswordLoginDisabled
+	}
+	return nil
+}
+
+// Check вызывается до проверки пароля: заблокированный логин или адрес получает LoginBlockedError,
+// попытка при этом не засчитывается.
+func (g *LoginGuard) Check(ctx context.Context, login string, client model.ClientInfo) error {
+	now := g.now()
+	var until time.Time
+	for _, key := range []string{loginAttemptKey(login), ipAttemptKey(client.IP)} {
+		a, err := g.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if a.Blocked(now) && a.BlockedUntil.After(until) {
+			until = a.BlockedUntil
+		}
+	}
+	if until.IsZero() {
+		return nil
+	}
+	g.record(ctx, model.AuthEvent{Event: model.AuthEventLoginBlocked, Login: login, IP: client.IP, UserAgent: client.UserAgent})
+	return &LoginBlockedError{Until: until}
+}
+
+// Failed засчитывает неудачную попытку; userID — nil, если логин не найден.
+func (g *LoginGuard) Failed(ctx context.Context, login string, userID *int, client model.ClientInfo) error {
+	a, err := g.store.Fail(ctx, loginAttemptKey(login), g.policy.Window, g.policy.backoff(g.policy.MaxFailures))
+	if err != nil {
+		return err
+	}
+	if _, err := g.store.Fail(ctx, ipAttemptKey(client.IP), g.policy.Window, g.policy.backoff(g.policy.MaxIPFailures)); err != nil {
+		return err
+	}
+
+	ev := model.AuthEvent{Event: model.AuthEventLoginFailed, Login: login, UserID: userID, IP: client.IP, UserAgent: client.UserAgent}
+	g.record(ctx, ev)
+	if a.Failures >= g.policy.MaxFailures {
+		ev.Event = model.AuthEventAccountLocked
+		g.record(ctx, ev)
+		slog.Warn("Login locked after failed attempts", "login", login, "failures", a.Failures, "ip", client.IP, "until", a.BlockedUntil)
+	}
+	return nil
+}
+
+// Succeeded сбрасывает счётчик логина. Счётчик IP не сбрасывается: иначе вход в свою учётную
+// запись позволял бы дальше перебирать чужие с того же адреса.
+func (g *LoginGuard) Succeeded(ctx context.Context, userID int, login string, client model.ClientInfo) error {
+	if err := g.store.Reset(ctx, loginAttemptKey(login)); err != nil {
+		return err
+	}
+	g.record(ctx, model.AuthEvent{Event: model.AuthEventLoginSucceeded, Login: login, UserID: &userID, IP: client.IP, UserAgent: client.UserAgent})
+	return nil
+}
+
+// Challenged отмечает в журнале верный пароль пользователя с 2FA; счётчик логина
+// сбрасывается только после верного кода.
+func (g *LoginGuard) Challenged(ctx context.Context, userID int, login string, client model.ClientInfo) {
+	g.record(ctx, model.AuthEvent{Event: model.AuthEventTwoFactorChallenge, Login: login, UserID: &userID, IP: client.IP, UserAgent: client.UserAgent})
+}
+
+// PasswordReset снимает блокировку логина после сброса пароля по ссылке из письма:
+// владелец почты подтвердил, что учётная запись его.
+func (g *LoginGuard) PasswordReset(ctx context.Context, userID int, login string, client model.ClientInfo) error {
+	if err := g.store.Reset(ctx, loginAttemptKey(login)); err != nil {
+		return err
+	}
+	g.record(ctx, model.AuthEvent{Event: model.AuthEventPasswordReset, Login: login, UserID: &userID, IP: client.IP, UserAgent: client.UserAgent})
+	return nil
+}
+
+// Unlock снимает блокировку входа пользователя userID.
+func (g *LoginGuard) Unlock(ctx context.Context, actorID, userID int) error {
+	var login string
+	err := g.dbPool.QueryRow(ctx, `SELECT login FROM users WHERE id = $1`, userID).Scan(&login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user %d: %w", userID, ErrUserNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if err := g.store.Reset(ctx, loginAttemptKey(login)); err != nil {
+		return err
+	}
+	g.record(ctx, model.AuthEvent{Event: model.AuthEventAccountUnlock, Login: login, UserID: &userID, ActorID: &actorID})
+	return nil
+}
+
+// record пишет событие в журнал; ошибка записи не должна мешать входу, поэтому только логируется.
+func (g *LoginGuard) record(ctx context.Context, ev model.AuthEvent) {
+	_, err := g.dbPool.Exec(ctx, `
+		INSERT INTO auth_events (event, login, user_id, actor_id, ip, user_agent) VALUES ($1, $2, $3, $4, $5, $6)
+	`, ev.Event, ev.Login, ev.UserID, ev.ActorID, ev.IP, ev.UserAgent)
+	if err != nil {
+		slog.Error("Failed to record auth event", "event", ev.Event, "login", ev.Login, "error", err)
+	}
+}
+
+const maxAuthEventsLimit = 500
+
+// ListEvents возвращает журнал входов, новые сначала. login и event — необязательные фильтры.
+func (g *LoginGuard) ListEvents(ctx context.Context, login, event string, limit int) ([]model.AuthEvent, error) {
+	if limit <= 0 || limit > maxAuthEventsLimit {
+		limit = 100
+	}
+	rows, err := g.dbPool.Query(ctx, `
+		SELECT id, event, login, user_id, actor_id, ip, user_agent, created_at
+		FROM auth_events
+		WHERE ($1 = '' OR lower(login) = lower($1)) AND ($2 = '' OR event = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, strings.TrimSpace(login), event, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.AuthEvent{}
+	for rows.Next() {
+		var ev model.AuthEvent
+		if err := rows.Scan(&ev.ID, &ev.Event, &ev.Login, &ev.UserID, &ev.ActorID, &ev.IP, &ev.UserAgent, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// RunPruner периодически удаляет устаревшие счётчики попыток, пока ctx не отменён.
+func (g *LoginGuard) RunPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := g.store.Prune(ctx, g.policy.Window); err != nil {
+			slog.Error("Failed to prune login attempts", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/storage"
+	"tasker/internal/testutil"
+)
+
+func TestLoginGuardBackoffLockoutAndUnlock(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	guard := service.NewLoginGuard(db, storage.NewMemoryAttemptStore(), service.LoginPolicy{
+		MaxFailures: 6, MaxIPFailures: 100, BaseDelay: time.Second, Lockout: 15 * time.Minute, Window: time.Hour,
+	})
+	clock := time.Now()
+	service.SetLoginGuardClock(guard, func() time.Time { return clock })
+
+	admin := testutil.User(t, db, service.SystemRoleAdmin)
+	userID := testutil.User(t, db, service.SystemRoleUser)
+	var login string
+	if err := db.QueryRow(ctx, `SELECT login FROM users WHERE id = $1`, userID).Scan(&login); err != nil {
+		t.Fatal(err)
+	}
+	client := model.ClientInfo{IP: testutil.Name("ip")}
+
+	// fail засчитывает неудачу и возвращает, до какого момента действует блокировка
+	fail := func(want time.Duration) {
+		t.Helper()
+		before := time.Now()
+		if err := guard.Failed(ctx, login, &userID, client); err != nil {
+			t.Fatal(err)
+		}
+		after := time.Now()
+		err := guard.Check(ctx, login, client)
+		if want == 0 {
+			if err != nil {
+				t.Fatalf("free failure: Check = %v", err)
+			}
+			return
+		}
+		var blocked *service.LoginBlockedError
+		if !errors.As(err, &blocked) {
+			t.Fatalf("Check = %v, want LoginBlockedError for %v", err, want)
+		}
+		if blocked.Until.Before(before.Add(want)) || blocked.Until.After(after.Add(want)) {
+			t.Fatalf("blocked until %v, want %v after the failure", blocked.Until, want)
+		}
+		// блокировка закончилась — попытки снова принимаются
+		clock = blocked.Until
+		if err := guard.Check(ctx, login, client); err != nil {
+			t.Fatalf("after the block expired: Check = %v", err)
+		}
+		clock = time.Now()
+	}
+
+	// MaxFailures = 6: первые 3 неудачи бесплатны, дальше 1s, 2s, на 6-й — Lockout
+	fail(0)
+	fail(0)
+	fail(0)
+	fail(time.Second)
+	fail(2 * time.Second)
+
+	if err := guard.Failed(ctx, login, &userID, client); err != nil {
+		t.Fatal(err)
+	}
+	var blocked *service.LoginBlockedError
+	if err := guard.Check(ctx, login, client); !errors.As(err, &blocked) || blocked.Until.Before(clock.Add(14*time.Minute)) {
+		t.Fatalf("after 6 failures: Check = %v, want a lockout of 15m", err)
+	}
+
+	// администратор снимает блокировку раньше срока
+	if err := guard.Unlock(ctx, admin, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := guard.Check(ctx, login, client); err != nil {
+		t.Errorf("after unlock: Check = %v", err)
+	}
+	if err := guard.Unlock(ctx, admin, -1); !errors.Is(err, service.ErrUserNotFound) {
+		t.Errorf("unlock of an unknown user: err = %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginPolicyBackoff(t *testing.T) {
+	p := LoginPolicy{BaseDelay: time.Second, Lockout: 15 * time.Minute}
+	cases := []struct {
+		name  string
+		limit int
+		n     int
+		want  time.Duration
+	}{
+		{name: "first failure is free", limit: 10, n: 1},
+		{name: "half of the limit is free", limit: 10, n: 5},
+		{name: "base delay after half", limit: 10, n: 6, want: time.Second},
+		{name: "doubles", limit: 10, n: 7, want: 2 * time.Second},
+		{name: "doubles again", limit: 10, n: 9, want: 8 * time.Second},
+		{name: "lockout at the limit", limit: 10, n: 10, want: 15 * time.Minute},
+		{name: "lockout past the limit", limit: 10, n: 11, want: 15 * time.Minute},
+		// задержка не превышает Lockout и не переполняется на больших лимитах
+		{name: "capped by lockout", limit: 40, n: 31, want: 15 * time.Minute},
+		{name: "no overflow", limit: 200, n: 150, want: 15 * time.Minute},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := p.backoff(tc.limit)(tc.n); got != tc.want {
+				t.Errorf("backoff(%d)(%d) = %v, want %v", tc.limit, tc.n, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,640 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInvalidOIDCState — state не найден, уже использован или истёк: вход нужно начать заново.
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	// ErrOIDCFailed — провайдер вернул ошибку или некорректный ответ.
+	ErrOIDCFailed = errors.New("single sign-on failed")
+	// ErrSSOUserNotFound — учётная запись провайдера не привязана, а автосоздание выключено.
+	ErrSSOUserNotFound = errors.New("no account is linked to this identity")
+)
+
+const (
+	// oidcMetadataTTL — как долго кешируются discovery-документ и ключи провайдера.
+	oidcMetadataTTL = time.Hour
+	// oidcKeysMinRefresh — не чаще этого перечитываем JWKS при незнакомом kid (ротация у провайдера).
+	oidcKeysMinRefresh = time.Minute
+	// oidcMaxResponse — предел размера ответа провайдера.
+	oidcMaxResponse = 1 << 20
+	// oidcClockSkew — допустимое расхождение часов с провайдером.
+	oidcClockSkew = time.Minute
+)
+
+// OIDCConfig — настройки входа через OpenID Connect.
+type OIDCConfig struct {
+	// Issuer — адрес провайдера; discovery-документ берётся с Issuer/.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL — адрес /api/oidc/callback, зарегистрированный у провайдера.
+	RedirectURL string
+	Scopes      []string
+	// LinkByEmail привязывает вход к существующему пользователю с тем же подтверждённым email.
+	LinkByEmail bool
+	// AutoProvision создаёт пользователя при первом входе, если привязать не к кому.
+	AutoProvision bool
+	// StateTTL — сколько ждём возврата от провайдера.
+	StateTTL time.Duration
+	// PostLoginURL — страница фронтенда, куда браузер попадает после входа.
+	PostLoginURL string
+}
+
+// oidcMetadata — нужная часть discovery-документа провайдера.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims — утверждения ID-токена, по которым находится или создаётся пользователь.
+type oidcClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	GivenName         string
+	FamilyName        string
+	PreferredUsername string
+}
+
+// OIDCService реализует вход через OpenID Connect: authorization code + PKCE. Discovery-документ
+// и ключи провайдера загружаются при первом входе и кешируются, поэтому сервер стартует
+// и при недоступном провайдере.
+type OIDCService struct {
+	dbPool *pgxpool.Pool
+	guard  *LoginGuard
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	meta     *oidcMetadata
+	metaAt   time.Time
+	keys     map[string]verifyKey
+	keysAt   time.Time
+	postBase *url.URL
+}
+
+// NewOIDCService: client — HTTP-клиент для запросов к провайдеру (nil — с таймаутом 10s).
+func NewOIDCService(dbPool *pgxpool.Pool, guard *LoginGuard, cfg OIDCConfig, client *http.Client) (*OIDCService, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("OIDC issuer, client id and redirect URL are required")
+	}
+	postBase, err := url.Parse(cfg.PostLoginURL)
+	if err != nil || !postBase.IsAbs() {
+		return nil, fmt.Errorf("OIDC post-login URL must be absolute: %q", cfg.PostLoginURL)
+	}
+	if !slices.Contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCService{dbPool: dbPool, guard: guard, cfg: cfg, client: client, postBase: postBase}, nil
+}
+
+// randomString — случайная строка для state, nonce и code_verifier (43 символа base64url).
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthURL начинает вход: сохраняет state, nonce и PKCE-верификатор и возвращает адрес страницы
+// входа провайдера и state (handler привязывает его к браузеру cookie). redirect — путь
+// фронтенда, куда вернуть пользователя; чужие адреса заменяются на PostLoginURL.
+func (s *OIDCService) AuthURL(ctx context.Context, redirect string) (string, string, error) {
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	// заодно убираем давно истёкшие состояния брошенных входов
+	if _, err := s.dbPool.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < now()`); err != nil {
+		return "", "", err
+	}
+	if _, err := s.dbPool.Exec(ctx, `
+		INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, redirect, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hashToken(state), nonce, verifier, s.postLoginURL(redirect), time.Now().Add(s.cfg.StateTTL)); err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {s.cfg.ClientID},
+		"redirect_uri":          {s.cfg.RedirectURL},
+		"scope":                 {strings.Join(s.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), state, nil
+}
+
+// postLoginURL допускает только путь внутри фронтенда — иначе ссылка на вход стала бы открытым редиректом.
+func (s *OIDCService) postLoginURL(redirect string) string {
+	if redirect == "" || !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, `\`) {
+		return s.postBase.String()
+	}
+	ref, err := url.Parse(redirect)
+	if err != nil || ref.IsAbs() || ref.Host != "" {
+		return s.postBase.String()
+	}
+	return s.postBase.ResolveReference(ref).String()
+}
+
+func (s *OIDCService) Name() string { return ProviderOIDC }
+
+// Verify завершает вход по обратному вызову провайдера (cred.Code, cred.State): проверяет
+// state, обменивает code на токены, проверяет ID-токен и находит (привязывает, создаёт)
+// пользователя. В Identity.Redirect — адрес фронтенда, переданный при начале входа.
+func (s *OIDCService) Verify(ctx context.Context, cred Credentials, client model.ClientInfo) (*Identity, error) {
+	var (
+		nonce, verifier, redirect string
+		expiresAt                 time.Time
+	)
+	// state одноразовый: удаляется при первом же возврате, даже истёкший
+	err := s.dbPool.QueryRow(ctx, `
+		DELETE FROM oidc_login_states WHERE state_hash = $1
+		RETURNING nonce, code_verifier, redirect, expires_at
+	`, hashToken(cred.State)).Scan(&nonce, &verifier, &redirect, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && time.Now().After(expiresAt)) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := s.exchange(ctx, cred.Code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.resolveUser(ctx, claims, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActive(ctx, s.dbPool, user.ID); err != nil {
+		return nil, err
+	}
+	return &Identity{User: user, Redirect: redirect}, nil
+}
+
+// metadata возвращает discovery-документ провайдера, перечитывая его раз в oidcMetadataTTL.
+func (s *OIDCService) metadata(ctx context.Context) (*oidcMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.meta != nil && time.Since(s.metaAt) < oidcMetadataTTL {
+		return s.meta, nil
+	}
+
+	var meta oidcMetadata
+	wellKnown := strings.TrimSuffix(s.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := s.getJSON(ctx, wellKnown, &meta); err != nil {
+		if s.meta != nil {
+			// провайдер недоступен — продолжаем с прежним документом
+			slog.Warn("Failed to refresh OIDC discovery document", "error", err)
+			return s.meta, nil
+		}
+		return nil, err
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != strings.TrimSuffix(s.cfg.Issuer, "/") {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrOIDCFailed, meta.Issuer, s.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrOIDCFailed)
+	}
+	s.meta, s.metaAt = &meta, time.Now()
+	return s.meta, nil
+}
+
+func (s *OIDCService) getJSON(ctx context.Context, target string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: GET %s: %s", ErrOIDCFailed, target, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponse)).Decode(v); err != nil {
+		return fmt.Errorf("%w: decode %s: %v", ErrOIDCFailed, target, err)
+	}
+	return nil
+}
+
+// exchange обменивает код авторизации на ID-токен (token endpoint, client_secret_basic).
+func (s *OIDCService) exchange(ctx context.Context, code, verifier string) (string, error) {
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if s.cfg.ClientSecret == "" {
+		// публичный клиент: защищён только PKCE
+		form.Set("client_id", s.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.cfg.ClientSecret))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponse)).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: token endpoint: %s", ErrOIDCFailed, resp.Status)
+	}
+	if body.Error != "" {
+		return "", fmt.Errorf("%w: %s: %s", ErrOIDCFailed, body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("%w: token endpoint returned no id_token (%s)", ErrOIDCFailed, resp.Status)
+	}
+	return body.IDToken, nil
+}
+
+// providerKey возвращает ключ провайдера по kid; незнакомый kid перечитывает JWKS (не чаще
+// oidcKeysMinRefresh) — так подхватывается ротация ключей провайдера.
+func (s *OIDCService) providerKey(ctx context.Context, kid string) (verifyKey, error) {
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return verifyKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[kid]
+	stale := time.Since(s.keysAt) > oidcMetadataTTL
+	if ok && !stale {
+		return k, nil
+	}
+	if !ok && !stale && time.Since(s.keysAt) < oidcKeysMinRefresh {
+		return verifyKey{}, fmt.Errorf("%w: unknown key id %q", ErrOIDCFailed, kid)
+	}
+
+	var set model.JWKSet
+	if err := s.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		if ok {
+			return k, nil
+		}
+		return verifyKey{}, err
+	}
+	keys := map[string]verifyKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		alg, key, err := jwkPublicKey(jwk)
+		if err != nil {
+			slog.Warn("Skipping OIDC provider key", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = verifyKey{alg: alg, key: key}
+	}
+	s.keys, s.keysAt = keys, time.Now()
+	if k, ok = keys[kid]; !ok {
+		// провайдер с единственным ключом может не указывать kid
+		if kid == "" && len(keys) == 1 {
+			for _, only := range keys {
+				return only, nil
+			}
+		}
+		return verifyKey{}, fmt.Errorf("%w: unknown key id %q", ErrOIDCFailed, kid)
+	}
+	return k, nil
+}
+
+// jwkPublicKey разбирает открытый ключ провайдера: RSA, EC P-256 или Ed25519.
+func jwkPublicKey(jwk model.JWK) (string, any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return "", nil, errors.New("invalid RSA exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return "", nil, errors.New("RSA key must be at least 2048 bits")
+		}
+		alg := jwk.Alg
+		if alg == "" {
+			alg = JWTAlgRS256
+		}
+		if !slices.Contains([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}, alg) {
+			return "", nil, fmt.Errorf("unsupported RSA algorithm %q", alg)
+		}
+		return alg, key, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return "", nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return "", nil, errors.New("EC point is not on curve")
+		}
+		return "ES256", key, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil || jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return "", nil, errors.New("invalid Ed25519 key")
+		}
+		return JWTAlgEdDSA, ed25519.PublicKey(x), nil
+	}
+	return "", nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+// verifyIDToken проверяет подпись ID-токена ключом провайдера, iss, aud (и azp), exp, iat и nonce.
+func (s *OIDCService) verifyIDToken(ctx context.Context, raw, nonce string) (*oidcClaims, error) {
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.Parse(raw, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		k, err := s.providerKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != k.alg {
+			return nil, fmt.Errorf("algorithm %s is not allowed for kid %q", t.Method.Alg(), kid)
+		}
+		return k.key, nil
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", JWTAlgEdDSA}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(s.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id_token: %v", ErrOIDCFailed, err)
+	}
+	mc, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid id_token claims", ErrOIDCFailed)
+	}
+
+	if got, _ := mc["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: id_token nonce mismatch", ErrOIDCFailed)
+	}
+	if aud, _ := mc.GetAudience(); len(aud) > 1 {
+		if azp, _ := mc["azp"].(string); azp != s.cfg.ClientID {
+			return nil, fmt.Errorf("%w: id_token azp mismatch", ErrOIDCFailed)
+		}
+	}
+
+	str := func(name string) string {
+		v, _ := mc[name].(string)
+		return strings.TrimSpace(v)
+	}
+	claims := &oidcClaims{
+		Subject:           str("sub"),
+		Email:             str("email"),
+		Name:              str("name"),
+		GivenName:         str("given_name"),
+		FamilyName:        str("family_name"),
+		PreferredUsername: str("preferred_username"),
+	}
+	// некоторые провайдеры отдают email_verified строкой
+	switch v := mc["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = v
+	case string:
+		claims.EmailVerified = v == "true"
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: id_token has no subject", ErrOIDCFailed)
+	}
+	return claims, nil
+}
+
+// resolveUser находит пользователя по привязке (issuer, sub); если её нет — привязывает
+// к пользователю с тем же email, если его подтвердили и провайдер, и сам пользователь,
+// или создаёт нового (по настройкам).
+func (s *OIDCService) resolveUser(ctx context.Context, claims *oidcClaims, client model.ClientInfo) (*model.User, error) {
+	const userColumns = `u.id, u.name, u.surname, u.middlename, u.login, u.email, u.roleID`
+	scan := func(row pgx.Row) (*model.User, error) {
+		var u model.User
+		if err := row.Scan(&u.ID, &u.Name, &u.Surname, &u.Middlename, &u.Login, &u.Email, &u.RoleID); err != nil {
+			return nil, err
+		}
+		return &u, nil
+	}
+
+	user, err := scan(s.dbPool.QueryRow(ctx, `
+		UPDATE user_identities i SET last_login_at = now(), email = NULLIF($3, '')
+		FROM users u
+		WHERE u.id = i.user_id AND i.issuer = $1 AND i.subject = $2
+		RETURNING `+userColumns, s.cfg.Issuer, claims.Subject, claims.Email))
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		if email, err = NormalizeEmail(claims.Email); err != nil {
+			email = ""
+		}
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	event := model.AuthEventSSOLinked
+	user = nil
+	if email != "" {
+		var verified bool
+		user, err = scan(tx.QueryRow(ctx, `SELECT `+userColumns+` FROM users u WHERE lower(u.email) = $1`, email))
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		if user != nil {
+			if err := tx.QueryRow(ctx, `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`, user.ID).Scan(&verified); err != nil {
+				return nil, err
+			}
+		}
+		// неподтверждённый локальный email мог указать кто угодно: привязка к нему отдала бы
+		// учётную запись тому, кто зарегистрировался с чужим адресом раньше владельца
+		if user != nil && (!s.cfg.LinkByEmail || !verified) {
+			if !s.cfg.AutoProvision {
+				return nil, ErrSSOUserNotFound
+			}
+			// email занят пользователем, к которому привязывать нельзя, — новый создаём без email
+			user, email = nil, ""
+		}
+	}
+	if user == nil {
+		if !s.cfg.AutoProvision {
+			return nil, ErrSSOUserNotFound
+		}
+		if user, err = provisionSSOUser(ctx, tx, claims, email); err != nil {
+			return nil, err
+		}
+		event = model.AuthEventSSOProvisioned
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO user_identities (issuer, subject, user_id, email, last_login_at) VALUES ($1, $2, $3, NULLIF($4, ''), now())
+	`, s.cfg.Issuer, claims.Subject, user.ID, claims.Email); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	s.guard.record(ctx, model.AuthEvent{Event: event, Login: user.Login, UserID: &user.ID, IP: client.IP, UserAgent: client.UserAgent})
+	return user, nil
+}
+
+var loginUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// provisionSSOUser создаёт пользователя с системной ролью user. Пароль не задаётся («!» не
+// совпадает ни с одним bcrypt-хешем), войти можно только через SSO или после сброса пароля.
+// email передаётся, только если его подтвердил провайдер, поэтому он сразу подтверждён.
+func provisionSSOUser(ctx context.Context, tx pgx.Tx, claims *oidcClaims, email string) (*model.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(loginUnsafeChars.ReplaceAllString(base, ""), ".-_")
+	if base == "" {
+		base = "user"
+	}
+	base = truncate(base, 50)
+
+	login := base
+	for i := 2; ; i++ {
+		var taken bool
+		if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE lower(login) = lower($1))`, login).Scan(&taken); err != nil {
+			return nil, err
+		}
+		if !taken {
+			break
+		}
+		if i > 100 {
+			return nil, fmt.Errorf("no free login for %q", base)
+		}
+		login = fmt.Sprintf("%s%d", base, i)
+	}
+
+	name, surname := claims.GivenName, claims.FamilyName
+	if name == "" {
+		name = claims.Name
+	}
+	if name == "" {
+		name = login
+	}
+
+	user := model.User{Name: name, Surname: surname, Login: login}
+	err := tx.QueryRow(ctx, `
+		INSERT INTO users (name, surname, login, email, email_verified_at, roleID, password)
+		VALUES ($1, $2, $3, NULLIF($4, ''), CASE WHEN $4 <> '' THEN now() END,
+			(SELECT id FROM roles WHERE scope = 'system' AND name = $5), '!')
+		RETURNING id, email, roleID
+	`, name, surname, login, email, SystemRoleUser).Scan(&user.ID, &user.Email, &user.RoleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ClaimForNewUser(ctx, tx, user.ID, email, ""); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
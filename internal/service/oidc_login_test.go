@@ -0,0 +1,223 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tasker/internal/mockidp"
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/storage"
+	"tasker/internal/testutil"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// oidcFixture — mockidp с новым пользователем провайдера и OIDCService, настроенный на него.
+type oidcFixture struct {
+	db     *pgxpool.Pool
+	idp    *mockidp.Provider
+	oidc   *service.OIDCService
+	client *http.Client
+	email  string
+}
+
+func newOIDCFixture(t *testing.T, linkByEmail, autoProvision bool) *oidcFixture {
+	t.Helper()
+	db := testutil.DB(t)
+	// каждый тест — свой пользователь провайдера и свой email
+	sub := testutil.Name("sub")
+	email := strings.ToLower(testutil.Name("sso")) + "@example.org"
+	idp, err := mockidp.New("", "tasker", "secret", map[string]any{
+		"sub":                sub,
+		"email":              email,
+		"email_verified":     true,
+		"given_name":         "Single",
+		"family_name":        "Sign-On",
+		"preferred_username": "sso",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(idp)
+	t.Cleanup(srv.Close)
+	idp.Issuer = srv.URL
+
+	guard := service.NewLoginGuard(db, storage.NewMemoryAttemptStore(), service.LoginPolicy{
+		MaxFailures: 100, MaxIPFailures: 100, Lockout: time.Minute, Window: time.Minute,
+	})
+	s, err := service.NewOIDCService(db, guard, service.OIDCConfig{
+		Issuer:        srv.URL,
+		ClientID:      "tasker",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://tasker.test/api/oidc/callback",
+		PostLoginURL:  "http://tasker.test/",
+		LinkByEmail:   linkByEmail,
+		AutoProvision: autoProvision,
+		StateTTL:      time.Minute,
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := *srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &oidcFixture{db: db, idp: idp, oidc: s, client: &client, email: email}
+}
+
+// start начинает вход и «входит» у провайдера; возвращает code и state обратного вызова.
+func (f *oidcFixture) start(t *testing.T) (code, state string) {
+	t.Helper()
+	authURL, state, err := f.oidc.AuthURL(context.Background(), "/tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := f.client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Query().Get("state") != state || loc.Query().Get("code") == "" {
+		t.Fatalf("authorize redirect %q, want code and state %q", loc, state)
+	}
+	return loc.Query().Get("code"), state
+}
+
+func (f *oidcFixture) verify(code, state string) (*service.Identity, error) {
+	return f.oidc.Verify(context.Background(), service.Credentials{Code: code, State: state}, model.ClientInfo{IP: "127.0.0.1"})
+}
+
+func (f *oidcFixture) login(t *testing.T) (*service.Identity, error) {
+	t.Helper()
+	return f.verify(f.start(t))
+}
+
+// existingUser создаёт пользователя с email провайдера; verified — подтвердил ли он этот email.
+func (f *oidcFixture) existingUser(t *testing.T, verified bool) int {
+	t.Helper()
+	id := testutil.User(t, f.db, service.SystemRoleUser)
+	if _, err := f.db.Exec(context.Background(), `
+		UPDATE users SET email = $2, email_verified_at = CASE WHEN $3 THEN now() END WHERE id = $1
+	`, id, f.email, verified); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestOIDCLoginProvisions(t *testing.T) {
+	f := newOIDCFixture(t, false, true)
+	id, err := f.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := id.User
+	if u.Name != "Single" || u.Surname != "Sign-On" || !strings.HasPrefix(u.Login, "sso") || u.Email == nil || *u.Email != f.email {
+		t.Errorf("provisioned user = %+v", *u)
+	}
+	if id.Redirect != "http://tasker.test/tasks" {
+		t.Errorf("redirect = %q", id.Redirect)
+	}
+
+	again, err := f.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.User.ID != u.ID {
+		t.Errorf("second login resolved user %d, want %d", again.User.ID, u.ID)
+	}
+}
+
+func TestOIDCState(t *testing.T) {
+	f := newOIDCFixture(t, false, true)
+
+	code, _ := f.start(t)
+	if _, err := f.verify(code, "unknown-state"); !errors.Is(err, service.ErrInvalidOIDCState) {
+		t.Errorf("unknown state: err = %v, want ErrInvalidOIDCState", err)
+	}
+
+	// код выдан для одного входа, а state — от другого: верификатор PKCE не совпадёт
+	code, _ = f.start(t)
+	_, other := f.start(t)
+	if _, err := f.verify(code, other); !errors.Is(err, service.ErrOIDCFailed) {
+		t.Errorf("code of another login: err = %v, want ErrOIDCFailed", err)
+	}
+	// state одноразовый, даже если вход по нему не удался
+	if _, err := f.verify(code, other); !errors.Is(err, service.ErrInvalidOIDCState) {
+		t.Errorf("reused state: err = %v, want ErrInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCLinkByEmail(t *testing.T) {
+	f := newOIDCFixture(t, true, false)
+	existing := f.existingUser(t, true)
+	id, err := f.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.User.ID != existing {
+		t.Errorf("linked user %d, want %d", id.User.ID, existing)
+	}
+}
+
+func TestOIDCUnverifiedLocalEmailIsNotLinked(t *testing.T) {
+	// кто-то зарегистрировался с чужим email до владельца: вход владельца через SSO
+	// не должен попасть в эту учётную запись
+	f := newOIDCFixture(t, true, true)
+	squatter := f.existingUser(t, false)
+	id, err := f.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.User.ID == squatter || id.User.Email != nil {
+		t.Errorf("unverified local email: user %d with email %v, want a new user without email", id.User.ID, id.User.Email)
+	}
+
+	// без автосоздания вход невозможен
+	f = newOIDCFixture(t, true, false)
+	f.existingUser(t, false)
+	if _, err := f.login(t); !errors.Is(err, service.ErrSSOUserNotFound) {
+		t.Errorf("unverified local email without provisioning: err = %v, want ErrSSOUserNotFound", err)
+	}
+}
+
+func TestOIDCUnverifiedEmailIsNotLinked(t *testing.T) {
+	f := newOIDCFixture(t, true, true)
+	existing := f.existingUser(t, true)
+	f.idp.SetClaim("email_verified", false)
+	id, err := f.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.User.ID == existing || id.User.Email != nil {
+		t.Errorf("unverified email: user %d with email %v, want a new user without email", id.User.ID, id.User.Email)
+	}
+}
+
+func TestOIDCEmailTakenWithoutLinking(t *testing.T) {
+	// привязка по email выключена: создаётся новый пользователь без email
+	f := newOIDCFixture(t, false, true)
+	existing := f.existingUser(t, true)
+	id, err := f.login(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.User.ID == existing || id.User.Email != nil {
+		t.Errorf("user %d with email %v, want a new user without email", id.User.ID, id.User.Email)
+	}
+
+	// и без автосоздания вход невозможен
+	f = newOIDCFixture(t, false, false)
+	f.existingUser(t, true)
+	if _, err := f.login(t); !errors.Is(err, service.ErrSSOUserNotFound) {
+		t.Errorf("no linking and no provisioning: err = %v, want ErrSSOUserNotFound", err)
+	}
+}
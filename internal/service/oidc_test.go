@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"tasker/internal/mockidp"
+)
+
+const testRedirectURL = "http://tasker.test/api/oidc/callback"
+
+// startMockIDP поднимает mockidp и OIDCService, настроенный на него (без базы: только обмен кода
+// и проверка ID-токена).
+func startMockIDP(t *testing.T) (*mockidp.Provider, *OIDCService) {
+	t.Helper()
+	p, err := mockidp.New("", "tasker", "secret", map[string]any{
+		"sub":            "alice",
+		"email":          "alice@example.org",
+		"email_verified": true,
+		"given_name":     "Alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	p.Issuer = srv.URL
+
+	s, err := NewOIDCService(nil, nil, OIDCConfig{
+		Issuer:       srv.URL,
+		ClientID:     "tasker",
+		ClientSecret: "secret",
+		RedirectURL:  testRedirectURL,
+		PostLoginURL: "http://tasker.test/",
+	}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, s
+}
+
+// authorizeCode проходит /authorize провайдера с PKCE-вызовом для verifier и возвращает код.
+func authorizeCode(t *testing.T, s *OIDCService, nonce, verifier string) string {
+	t.Helper()
+	meta, err := s.metadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"tasker"},
+		"redirect_uri":          {testRedirectURL},
+		"nonce":                 {nonce},
+		"state":                 {"state"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	client := *s.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(meta.AuthorizationEndpoint + "?" + q.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Query().Get("code") == "" {
+		t.Fatalf("authorize: %s, Location %q", resp.Status, resp.Header.Get("Location"))
+	}
+	return loc.Query().Get("code")
+}
+
+func TestOIDCCodeExchange(t *testing.T) {
+	_, s := startMockIDP(t)
+	ctx := context.Background()
+
+	code := authorizeCode(t, s, "nonce-1", "verifier-1")
+	raw, err := s.exchange(ctx, code, "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.verifyIDToken(ctx, raw, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := oidcClaims{Subject: "alice", Email: "alice@example.org", EmailVerified: true, GivenName: "Alice"}
+	if *claims != want {
+		t.Errorf("claims = %+v, want %+v", *claims, want)
+	}
+
+	// код одноразовый
+	if _, err := s.exchange(ctx, code, "verifier-1"); !errors.Is(err, ErrOIDCFailed) {
+		t.Errorf("reused code: err = %v, want ErrOIDCFailed", err)
+	}
+}
+
+func TestOIDCWrongVerifier(t *testing.T) {
+	_, s := startMockIDP(t)
+	code := authorizeCode(t, s, "nonce-1", "verifier-1")
+	if _, err := s.exchange(context.Background(), code, "verifier-2"); !errors.Is(err, ErrOIDCFailed) {
+		t.Errorf("err = %v, want ErrOIDCFailed", err)
+	}
+}
+
+func TestOIDCNonceMismatch(t *testing.T) {
+	_, s := startMockIDP(t)
+	ctx := context.Background()
+	raw, err := s.exchange(ctx, authorizeCode(t, s, "nonce-1", "verifier-1"), "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifyIDToken(ctx, raw, "nonce-2"); !errors.Is(err, ErrOIDCFailed) {
+		t.Errorf("other nonce: err = %v, want ErrOIDCFailed", err)
+	}
+
+	// без nonce в запросе провайдер выдаёт токен без nonce — такой тоже не принимаем
+	raw, err = s.exchange(ctx, authorizeCode(t, s, "", "verifier-1"), "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifyIDToken(ctx, raw, ""); !errors.Is(err, ErrOIDCFailed) {
+		t.Errorf("empty nonce: err = %v, want ErrOIDCFailed", err)
+	}
+}
+
+func TestOIDCAudience(t *testing.T) {
+	p, s := startMockIDP(t)
+	ctx := context.Background()
+	cases := []struct {
+		name    string
+		aud     any
+		azp     any
+		wantErr bool
+	}{
+		{name: "single audience", aud: "tasker"},
+		{name: "other audience", aud: "other", wantErr: true},
+		{name: "several audiences without azp", aud: []string{"tasker", "other"}, wantErr: true},
+		{name: "several audiences, other azp", aud: []string{"tasker", "other"}, azp: "other", wantErr: true},
+		{name: "several audiences, our azp", aud: []string{"tasker", "other"}, azp: "tasker"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p.SetClaim("aud", tc.aud)
+			p.SetClaim("azp", tc.azp)
+			raw, err := s.exchange(ctx, authorizeCode(t, s, "nonce-1", "verifier-1"), "verifier-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = s.verifyIDToken(ctx, raw, "nonce-1")
+			if tc.wantErr && !errors.Is(err, ErrOIDCFailed) {
+				t.Errorf("err = %v, want ErrOIDCFailed", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"tasker/internal/mail"
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrWrongPassword — текущий пароль указан неверно.
+	ErrWrongPassword = errors.New("current password is incorrect")
+	// ErrInvalidPassword — новый пароль не подходит.
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrInvalidResetToken — токен сброса не найден, уже использован или истёк.
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+// resetRequestInterval — не чаще одного письма со сбросом пароля на пользователя за этот интервал.
+const resetRequestInterval = time.Minute
+
+// mailSendTimeout — сколько ждём почтовый сервер при фоновой отправке.
+const mailSendTimeout = 30 * time.Second
+
+// PasswordService меняет и сбрасывает пароли.
+type PasswordService struct {
+	dbPool   *pgxpool.Pool
+	policy   *PasswordPolicy
+	guard    *LoginGuard
+	mailer   mail.Mailer
+	resetTTL time.Duration
+	linkBase string
+}
+
+// NewPasswordService: resetTTL — срок жизни ссылки сброса, linkBase — адрес страницы
+// сброса пароля во фронтенде; к нему добавляется ?token=.
+func NewPasswordService(dbPool *pgxpool.Pool, policy *PasswordPolicy, guard *LoginGuard, mailer mail.Mailer, resetTTL time.Duration, linkBase string) *PasswordService {
+	return &PasswordService{dbPool: dbPool, policy: policy, guard: guard, mailer: mailer, resetTTL: resetTTL, linkBase: linkBase}
+}
+
+// ChangePassword меняет пароль после проверки текущего и отзывает все остальные сессии
+// пользователя: украденные refresh-токены перестают работать.
+func (s *PasswordService) ChangePassword(ctx context.Context, userID int, currentPassword, newPassword, currentSessionID string, client model.ClientInfo) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
+	}
+	var login, hash string
+	err := s.dbPool.QueryRow(ctx, `SELECT login, password FROM users WHERE id = $1`, userID).Scan(&login, &hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(currentPassword)); err != nil {
+		return ErrWrongPassword
+	}
+	if err := s.policy.Validate(newPassword, login); err != nil {
+		return err
+	}
+	newHash, err := s.policy.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	if _, err := tx.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1`, userID, newHash); err != nil {
+		return err
+	}
+	if _, err := revokeSessions(ctx, tx, `user_id = $1 AND id::text <> $2`, RevokePasswordChange, userID, currentSessionID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.guard.record(ctx, model.AuthEvent{Event: model.AuthEventPasswordChanged, Login: login, UserID: &userID, IP: client.IP, UserAgent: client.UserAgent})
+	return nil
+}
+
+// RequestPasswordReset отправляет письмо со ссылкой сброса пользователю с таким логином или email.
+// Ответ всегда успешный — по нему нельзя узнать, есть ли пользователь. Прежние ссылки
+// перестают действовать; повторный запрос чаще resetRequestInterval игнорируется.
+// Пользователям каталога LDAP ссылка не отправляется: их пароль меняется в каталоге.
+func (s *PasswordService) RequestPasswordReset(ctx context.Context, loginOrEmail string, client model.ClientInfo) error {
+	if err := s.guard.PasswordAllowed(); err != nil {
+		return err
+	}
+	loginOrEmail = strings.TrimSpace(loginOrEmail)
+	if loginOrEmail == "" {
+		return nil
+	}
+
+	var (
+		userID int
+		login  string
+		email  *string
+	)
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT id, login, email FROM users
+		WHERE (lower(login) = lower($1) OR lower(email) = lower($1)) AND deactivated_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = users.id AND i.issuer = $2)
+		ORDER BY lower(login) = lower($1) DESC
+		LIMIT 1
+	`, loginOrEmail, ldapIssuer).Scan(&userID, &login, &email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if email == nil || *email == "" {
+		slog.Info("Password reset requested for user without email", "userID", userID)
+		return nil
+	}
+
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var recent bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM password_resets WHERE user_id = $1 AND created_at > $2)
+	`, userID, time.Now().Add(-resetRequestInterval)).Scan(&recent)
+	if err != nil {
+		return err
+	}
+	if recent {
+		return nil
+	}
+	// старые ссылки закрываем, давно истёкшие удаляем
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM password_resets WHERE user_id = $1 AND expires_at < now() - interval '1 day'
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL
+	`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO password_resets (token_hash, user_id, ip, expires_at) VALUES ($1, $2, $3, $4)
+	`, hash, userID, client.IP, time.Now().Add(s.resetTTL)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.guard.record(ctx, model.AuthEvent{Event: model.AuthEventPasswordResetRequest, Login: login, UserID: &userID, IP: client.IP, UserAgent: client.UserAgent})
+
+	// письмо уходит в фоне: время ответа не должно зависеть от того, нашёлся ли пользователь
+	msg := mail.Message{
+		To:      *email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует до %s и сработает один раз.\nЕсли вы не запрашивали сброс пароля, просто проигнорируйте это письмо.\n",
+			login, s.resetLink(token), time.Now().Add(s.resetTTL).UTC().Format("02.01.2006 15:04 MST")),
+	}
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, msg); err != nil {
+			slog.Error("Failed to send password reset mail", "userID", userID, "error", err)
+		}
+	}()
+	return nil
+}
+
+func (s *PasswordService) resetLink(token string) string {
+	return s.linkBase + "?token=" + url.QueryEscape(token)
+}
+
+// ResetPassword задаёт новый пароль по токену из письма. Токен одноразовый; все сессии
+// пользователя отзываются, а блокировка входа по логину снимается.
+func (s *PasswordService) ResetPassword(ctx context.Context, token, newPassword string, client model.ClientInfo) error {
+	if err := s.guard.PasswordAllowed(); err != nil {
+		return err
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var (
+		userID int
+		login  string
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT r.user_id, u.login
+		FROM password_resets r JOIN users u ON u.id = r.user_id
+		WHERE r.token_hash = $1 AND r.used_at IS NULL AND r.expires_at > now() AND u.deactivated_at IS NULL
+		FOR UPDATE OF r
+	`, hashToken(token)).Scan(&userID, &login)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Validate(newPassword, login); err != nil {
+		return err
+	}
+	newHash, err := s.policy.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE password_resets SET used_at = now() WHERE token_hash = $1`, hashToken(token)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1`, userID, newHash); err != nil {
+		return err
+	}
+	if _, err := revokeSessions(ctx, tx, `user_id = $1`, RevokePasswordReset, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return s.guard.PasswordReset(ctx, userID, login, client)
+}
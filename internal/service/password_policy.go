@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordBytes — bcrypt учитывает только первые 72 байта, более длинный пароль отклоняем.
+const maxPasswordBytes = 72
+
+// PasswordPolicy — требования к новым паролям при регистрации, смене и сбросе и параметры их хранения.
+type PasswordPolicy struct {
+	MinLength int
+	// Cost — стоимость bcrypt для новых хешей; более дешёвые хеши пересчитываются при входе.
+	Cost int
+	// breached — SHA-1 (hex, верхний регистр) паролей из утечек.
+	breached map[string]struct{}
+	// dummyHash — хеш той же стоимости для сравнения при неизвестном логине.
+	dummyHash []byte
+}
+
+// LoadPasswordPolicy читает список скомпрометированных паролей из breachedFile (пустой путь — без списка).
+// Строка файла — сам пароль или его SHA-1 в hex, в том числе в формате Have I Been Pwned «HASH:count».
+func LoadPasswordPolicy(minLength, cost int, breachedFile string) (*PasswordPolicy, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cost)
+	}
+	dummy, err := bcrypt.GenerateFromPassword([]byte("tasker-dummy-password"), cost)
+	if err != nil {
+		return nil, err
+	}
+	p := &PasswordPolicy{MinLength: minLength, Cost: cost, breached: map[string]struct{}{}, dummyHash: dummy}
+	if breachedFile == "" {
+		return p, nil
+	}
+	f, err := os.Open(breachedFile)
+	if err != nil {
+		return nil, fmt.Errorf("open breached passwords: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		p.breached[passwordSHA1(line)] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read breached passwords: %w", err)
+	}
+	return p, nil
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func passwordSHA1(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Validate проверяет новый пароль пользователя login; ошибка оборачивает ErrInvalidPassword.
+func (p *PasswordPolicy) Validate(password, login string) error {
+	switch {
+	case password == "":
+		return fmt.Errorf("%w: must not be empty", ErrInvalidPassword)
+	case utf8.RuneCountInString(password) < p.MinLength:
+		return fmt.Errorf("%w: must be at least %d characters", ErrInvalidPassword, p.MinLength)
+	case len(password) > maxPasswordBytes:
+		return fmt.Errorf("%w: must be at most %d bytes", ErrInvalidPassword, maxPasswordBytes)
+	case login != "" && strings.EqualFold(password, strings.TrimSpace(login)):
+		return fmt.Errorf("%w: must not match the login", ErrInvalidPassword)
+	}
+	if _, ok := p.breached[passwordSHA1(password)]; ok {
+		return fmt.Errorf("%w: found in a list of breached passwords", ErrInvalidPassword)
+	}
+	return nil
+}
+
+// Hash возвращает bcrypt-хеш пароля со стоимостью политики.
+func (p *PasswordPolicy) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// needsRehash — хеш посчитан с меньшей стоимостью, чем требует политика.
+func (p *PasswordPolicy) needsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost < p.Cost
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotMember — пользователь не состоит в пространстве ресурса. Снаружи отдаётся как 404,
+// чтобы не раскрывать существование чужих задач.
+var ErrNotMember = errors.New("user is not a member of the space")
+
+// ErrSpaceArchived — пространство в архиве: доступны только чтение и space.manage (чтобы разархивировать).
+var ErrSpaceArchived = errors.New("space is archived")
+
+// archiveAllows — права, которые действуют в архивном пространстве.
+func archiveAllows(perm Permission) bool {
+	return perm == PermTaskRead || perm == PermSpaceManage
+}
+
+// grant — что разрешено пользователю: право из системной роли действует везде,
+// право роли в пространстве — только в нём.
+type grant struct {
+	system    bool
+	member    bool
+	spaceRole string
+	inSpace   bool
+	archived  bool
+	// needs2FA — пространство требует 2FA, а у пользователя она не включена.
+	needs2FA bool
+}
+
+func (g grant) allowed() bool {
+	return g.system || g.inSpace
+}
+
+// loadGrant читает системную роль пользователя, его роль в spaceID (пустой — только системную),
+// признак архивного пространства и требование 2FA.
+func loadGrant(ctx context.Context, q queryer, userID int, perm Permission, spaceID string) (grant, error) {
+	var g grant
+	var spaceRole sql.NullString
+	err := q.QueryRow(ctx, `
+		SELECT
+			EXISTS (
+				SELECT 1 FROM users u JOIN roles r ON r.id = u.roleid
+				WHERE u.id = $1 AND r.scope = 'system' AND $2 = ANY(r.permissions)
+			),
+			m.role,
+			COALESCE($2 = ANY(sr.permissions), false),
+			EXISTS (SELECT 1 FROM spaces WHERE id = $3 AND archived_at IS NOT NULL),
+			EXISTS (SELECT 1 FROM spaces WHERE id = $3 AND require_2fa) AND NOT EXISTS (
+				SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)
+		FROM (SELECT 1) AS one
+		LEFT JOIN space_memberships m ON m.space_id = $3 AND m.user_id = $1
+		LEFT JOIN roles sr ON sr.scope = 'space' AND sr.name = m.role
+	`, userID, string(perm), spaceID).Scan(&g.system, &spaceRole, &g.inSpace, &g.archived, &g.needs2FA)
+	if err != nil {
+		return g, err
+	}
+	g.member = spaceRole.Valid
+	g.spaceRole = spaceRole.String
+	return g, nil
+}
+
+// authorize проверяет право perm пользователя. spaceID — пространство для прав пространства,
+// пустая строка — для системных прав. Возвращает роль пользователя в пространстве.
+// Не участник без системного права — ErrNotMember, права нет — ErrForbidden,
+// пространство требует 2FA, а она не включена, — ErrTwoFactorRequired,
+// пространство в архиве — ErrSpaceArchived. Для запроса с персональным токеном действуют
+// ещё и ограничения токена.
+func authorize(ctx context.Context, q queryer, userID int, perm Permission, spaceID string) (string, error) {
+	if err := checkTokenScope(ctx, perm, spaceID); err != nil {
+		return "", err
+	}
+	g, err := loadGrant(ctx, q, userID, perm, spaceID)
+	if err != nil {
+		return "", err
+	}
+	if !g.allowed() {
+		if spaceID != "" && !g.member {
+			return "", fmt.Errorf("space %s: %w", spaceID, ErrNotMember)
+		}
+		return g.spaceRole, fmt.Errorf("%s: %w", perm, ErrForbidden)
+	}
+	if g.needs2FA {
+		return g.spaceRole, fmt.Errorf("space %s: %w", spaceID, ErrTwoFactorRequired)
+	}
+	if g.archived && !archiveAllows(perm) {
+		return g.spaceRole, fmt.Errorf("%s in space %s: %w", perm, spaceID, ErrSpaceArchived)
+	}
+	return g.spaceRole, nil
+}
+
+// memberSpacesSQL — подзапрос пространств пользователя userArg (плейсхолдер вида $2) для списков:
+// пространства, которые требуют 2FA, видны только при включённой 2FA.
+func memberSpacesSQL(userArg string) string {
+	return `SELECT m.space_id FROM space_memberships m JOIN spaces sp ON sp.id = m.space_id
+		WHERE m.user_id = ` + userArg + ` AND (NOT sp.require_2fa OR EXISTS (
+			SELECT 1 FROM user_totp WHERE user_id = m.user_id AND confirmed_at IS NOT NULL))`
+}
+
+// can — проверка права без различия «не участник» и «нет права»; для проверок внутри сервисов.
+// В архивном пространстве разрешено только то, что допускает archiveAllows.
+func can(ctx context.Context, q queryer, userID int, perm Permission, spaceID string) (bool, error) {
+	if checkTokenScope(ctx, perm, spaceID) != nil {
+		return false, nil
+	}
+	g, err := loadGrant(ctx, q, userID, perm, spaceID)
+	if err != nil {
+		return false, err
+	}
+	return g.allowed() && !g.needs2FA && (!g.archived || archiveAllows(perm)), nil
+}
+
+// PolicyService решает, может ли пользователь выполнить действие над ресурсом.
+type PolicyService struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewPolicyService(dbPool *pgxpool.Pool) *PolicyService {
+	return &PolicyService{dbPool: dbPool}
+}
+
+// Can проверяет право perm пользователя, см. authorize. resource — id пространства
+// для прав пространства, пустая строка — для системных прав.
+func (p *PolicyService) Can(ctx context.Context, userID int, perm Permission, resource string) (string, error) {
+	return authorize(ctx, p.dbPool, userID, perm, resource)
+}
+
+// spaceOf выполняет запрос, возвращающий пространство ресурса; пустое пространство
+// (задачи, созданные до появления spaces) считаем недоступным.
+func (p *PolicyService) spaceOf(ctx context.Context, query, id string, notFound error) (string, error) {
+	var space sql.NullString
+	if err := p.dbPool.QueryRow(ctx, query, id).Scan(&space); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", id, notFound)
+		}
+		return "", err
+	}
+	if !space.Valid || space.String == "" {
+		return "", fmt.Errorf("%s has no space: %w", id, notFound)
+	}
+	return space.String, nil
+}
+
+// TaskSpace возвращает пространство задачи, не лежащей в корзине.
+func (p *PolicyService) TaskSpace(ctx context.Context, taskID string) (string, error) {
+	return p.spaceOf(ctx, `SELECT space FROM tasks WHERE id::text = $1 AND deleted_at IS NULL`, taskID, ErrTaskNotFound)
+}
+
+// AnyTaskSpace возвращает пространство задачи, в том числе из корзины.
+func (p *PolicyService) AnyTaskSpace(ctx context.Context, taskID string) (string, error) {
+	return p.spaceOf(ctx, `SELECT space FROM tasks WHERE id::text = $1`, taskID, ErrTaskNotFound)
+}
+
+// CommentSpace возвращает пространство задачи, к которой относится комментарий.
+func (p *PolicyService) CommentSpace(ctx context.Context, commentID string) (string, error) {
+	return p.spaceOf(ctx, `
+		SELECT t.space FROM task_comments c
+		JOIN tasks t ON t.id = c.task_id
+		WHERE c.id::text = $1 AND t.deleted_at IS NULL
+	`, commentID, ErrCommentNotFound)
+}
+
+// AttachmentSpace возвращает пространство вложения.
+func (p *PolicyService) AttachmentSpace(ctx context.Context, attachmentID string) (string, error) {
+	return p.spaceOf(ctx, `
+		SELECT a.space_id FROM attachments a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE a.id::text = $1 AND t.deleted_at IS NULL
+	`, attachmentID, ErrAttachmentNotFound)
+}
+
+// SpaceByID проверяет, что пространство существует, и возвращает его id.
+func (p *PolicyService) SpaceByID(ctx context.Context, spaceID string) (string, error) {
+	return p.spaceOf(ctx, `SELECT id FROM spaces WHERE id = $1`, spaceID, ErrSpaceNotFound)
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	// база часовых поясов в бинарнике: в минимальных контейнерах её нет
+	_ "time/tzdata"
+
+	"tasker/internal/model"
+	"tasker/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidProfile — недопустимое значение поля профиля.
+	ErrInvalidProfile = errors.New("invalid profile")
+	// ErrAvatarTooLarge — файл аватара больше допустимого.
+	ErrAvatarTooLarge = errors.New("avatar is too large")
+	// ErrAvatarType — аватар не картинка поддерживаемого формата.
+	ErrAvatarType = errors.New("avatar must be a PNG, JPEG, GIF or WebP image")
+	// ErrAvatarNotFound — у пользователя нет аватара.
+	ErrAvatarNotFound = errors.New("avatar not found")
+)
+
+// avatarTypes — форматы аватара (по содержимому файла).
+var avatarTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// ProfileLimits — ограничения профиля.
+type ProfileLimits struct {
+	AvatarMaxSize int64
+	// Locales — языки интерфейса, которые можно выбрать.
+	Locales []string
+}
+
+// avatarURL — адрес аватара; версия меняется при каждой загрузке, поэтому ответ можно кешировать.
+func avatarURL(userID int, updatedAt *time.Time) *string {
+	if updatedAt == nil {
+		return nil
+	}
+	u := "/users/" + strconv.Itoa(userID) + "/avatar?v=" + strconv.FormatInt(updatedAt.Unix(), 10)
+	return &u
+}
+
+// GetProfile возвращает профиль пользователя.
+func (s *UserService) GetProfile(ctx context.Context, userID int) (*model.UserProfile, error) {
+	var p model.UserProfile
+	var avatarAt *time.Time
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT u.id, u.login, u.name, u.surname, u.middlename, u.email, u.email_verified_at IS NOT NULL,
+			u.timezone, u.locale, a.updated_at
+		FROM users u
+		LEFT JOIN user_avatars a ON a.user_id = u.id
+		WHERE u.id = $1
+	`, userID).Scan(&p.ID, &p.Login, &p.Name, &p.Surname, &p.Middlename, &p.Email, &p.EmailVerified,
+		&p.Timezone, &p.Locale, &avatarAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", userID, ErrUserNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.AvatarURL = avatarURL(p.ID, avatarAt)
+	return &p, nil
+}
+
+// optionalField приводит необязательное поле: пустая строка — NULL.
+func optionalField(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// UpdateProfile меняет имя, часовой пояс и язык. Логин и email здесь не меняются: от email
+// зависят сброс пароля и привязка SSO, его задаёт администратор или SCIM. По персональному токену
+// профиль не меняется.
+func (s *UserService) UpdateProfile(ctx context.Context, userID int, in model.ProfileUpdate) (*model.UserProfile, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	current, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, surname := current.Name, current.Surname
+	middlename, timezone, locale := current.Middlename, current.Timezone, current.Locale
+	if in.Name != nil {
+		if name = strings.TrimSpace(*in.Name); name == "" {
+			return nil, fmt.Errorf("%w: name is required", ErrInvalidProfile)
+		}
+	}
+	if in.Surname != nil {
+		if surname = strings.TrimSpace(*in.Surname); surname == "" {
+			return nil, fmt.Errorf("%w: surname is required", ErrInvalidProfile)
+		}
+	}
+	if in.Middlename != nil {
+		middlename = optionalField(strings.TrimSpace(*in.Middlename))
+	}
+	if in.Timezone != nil {
+		tz := strings.TrimSpace(*in.Timezone)
+		if tz != "" {
+			// "Local" — зона сервера, а не пользователя
+			if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+				return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidProfile, tz)
+			}
+		}
+		timezone = optionalField(tz)
+	}
+	if in.Locale != nil {
+		l := strings.TrimSpace(*in.Locale)
+		if l != "" && !slices.Contains(s.profile.Locales, l) {
+			return nil, fmt.Errorf("%w: locale must be one of %s", ErrInvalidProfile, strings.Join(s.profile.Locales, ", "))
+		}
+		locale = optionalField(l)
+	}
+	for _, v := range []string{name, surname} {
+		if len(v) > 200 {
+			return nil, fmt.Errorf("%w: name is too long", ErrInvalidProfile)
+		}
+	}
+	if middlename != nil && len(*middlename) > 200 {
+		return nil, fmt.Errorf("%w: middlename is too long", ErrInvalidProfile)
+	}
+
+	_, err = s.dbPool.Exec(ctx, `
+		UPDATE users SET name = $2, surname = $3, middlename = $4, timezone = $5, locale = $6 WHERE id = $1
+	`, userID, name, surname, middlename, timezone, locale)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetProfile(ctx, userID)
+}
+
+// SetAvatar сохраняет аватар: тип проверяется по содержимому, старый файл удаляется после замены.
+// Аватар, как и профиль, по персональному токену не меняется.
+func (s *UserService) SetAvatar(ctx context.Context, userID int, size int64, r io.Reader) (*model.UserProfile, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrAvatarType)
+	}
+	if size > s.profile.AvatarMaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, max %d", ErrAvatarTooLarge, size, s.profile.AvatarMaxSize)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := sniffContentType(head)
+	if !slices.Contains(avatarTypes, contentType) {
+		return nil, fmt.Errorf("%w: got %s", ErrAvatarType, contentType)
+	}
+
+	key := "avatars/" + strconv.Itoa(userID) + "/" + uuid.New().String()
+	if err := s.store.Put(ctx, key, io.MultiReader(bytes.NewReader(head), r), size, contentType); err != nil {
+		return nil, fmt.Errorf("store avatar: %w", err)
+	}
+
+	var oldKey *string
+	err = s.dbPool.QueryRow(ctx, `
+		WITH old AS (SELECT storage_key FROM user_avatars WHERE user_id = $1 FOR UPDATE)
+		INSERT INTO user_avatars (user_id, storage_key, content_type, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET storage_key = EXCLUDED.storage_key, content_type = EXCLUDED.content_type,
+		    size = EXCLUDED.size, updated_at = now()
+		RETURNING (SELECT storage_key FROM old)
+	`, userID, key, contentType, size).Scan(&oldKey)
+	if err != nil {
+		s.deleteBlob(ctx, key)
+		return nil, err
+	}
+	if oldKey != nil {
+		s.deleteBlob(ctx, *oldKey)
+	}
+	return s.GetProfile(ctx, userID)
+}
+
+// DeleteAvatar удаляет аватар пользователя.
+func (s *UserService) DeleteAvatar(ctx context.Context, userID int) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
+	}
+	var key string
+	err := s.dbPool.QueryRow(ctx, `DELETE FROM user_avatars WHERE user_id = $1 RETURNING storage_key`, userID).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user %d: %w", userID, ErrAvatarNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	s.deleteBlob(ctx, key)
+	return nil
+}
+
+// OpenAvatar возвращает тип, размер и содержимое аватара; reader нужно закрыть.
+func (s *UserService) OpenAvatar(ctx context.Context, userID int) (string, int64, io.ReadCloser, error) {
+	var key, contentType string
+	var size int64
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT storage_key, content_type, size FROM user_avatars WHERE user_id = $1
+	`, userID).Scan(&key, &contentType, &size)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", 0, nil, fmt.Errorf("user %d: %w", userID, ErrAvatarNotFound)
+	}
+	if err != nil {
+		return "", 0, nil, err
+	}
+	rc, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", 0, nil, fmt.Errorf("user %d avatar content: %w", userID, ErrAvatarNotFound)
+	}
+	if err != nil {
+		return "", 0, nil, err
+	}
+	return contentType, size, rc, nil
+}
+
+func (s *UserService) deleteBlob(ctx context.Context, key string) {
+	if err := s.store.Delete(ctx, key); err != nil {
+		slog.Error("Failed to delete avatar blob", "key", key, "error", err)
+	}
+}
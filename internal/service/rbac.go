@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrRoleNotFound возвращается, если роли нет.
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists — роль с таким именем в этой области уже есть.
+	ErrRoleExists = errors.New("role already exists")
+	// ErrRoleInUse — роль назначена пользователям или участникам пространств.
+	ErrRoleInUse = errors.New("role is in use")
+	// ErrBuiltinRole — встроенную роль нельзя удалить или переименовать.
+	ErrBuiltinRole = errors.New("builtin role cannot be removed or renamed")
+)
+
+// Permission — имя права.
+type Permission string
+
+// Системные права.
+const (
+	PermRoleManage      Permission = "role.manage"
+	PermSpaceCreate     Permission = "space.create"
+	PermDashboardManage Permission = "dashboard.manage"
+	PermUserManage      Permission = "user.manage"
+)
+
+// Права в пространстве.
+const (
+	PermTaskRead         Permission = "task.read"
+	PermTaskCreate       Permission = "task.create"
+	PermTaskUpdate       Permission = "task.update"
+	PermTaskDelete       Permission = "task.delete"
+	PermTaskApprove      Permission = "task.approve"
+	PermCommentCreate    Permission = "comment.create"
+	PermCommentModerate  Permission = "comment.moderate"
+	PermAttachmentUpload Permission = "attachment.upload"
+	PermAttachmentManage Permission = "attachment.manage"
+	PermSpaceInvite      Permission = "space.invite"
+	PermSpaceManage      Permission = "space.manage"
+)
+
+// permissionCatalog — все известные права; роли могут ссылаться только на них.
+var permissionCatalog = []model.PermissionInfo{
+	{Name: string(PermRoleManage), Scope: model.RoleScopeSystem, Description: "управление ролями и назначение системных ролей"},
+	{Name: string(PermSpaceCreate), Scope: model.RoleScopeSystem, Description: "создание пространств"},
+	{Name: string(PermDashboardManage), Scope: model.RoleScopeSystem, Description: "создание дашбордов"},
+	{Name: string(PermUserManage), Scope: model.RoleScopeSystem, Description: "журнал входов, разблокировка учётных записей и SCIM-провизионирование"},
+	{Name: string(PermTaskRead), Scope: model.RoleScopeSpace, Description: "просмотр задач, комментариев, вложений и истории"},
+	{Name: string(PermTaskCreate), Scope: model.RoleScopeSpace, Description: "создание задач"},
+	{Name: string(PermTaskUpdate), Scope: model.RoleScopeSpace, Description: "изменение и завершение задач, блокеры, запрос одобрения"},
+	{Name: string(PermTaskDelete), Scope: model.RoleScopeSpace, Description: "удаление и восстановление задач"},
+	{Name: string(PermTaskApprove), Scope: model.RoleScopeSpace, Description: "одобрение и отклонение задач"},
+	{Name: string(PermCommentCreate), Scope: model.RoleScopeSpace, Description: "комментарии и правка своих комментариев"},
+	{Name: string(PermCommentModerate), Scope: model.RoleScopeSpace, Description: "удаление чужих комментариев"},
+	{Name: string(PermAttachmentUpload), Scope: model.RoleScopeSpace, Description: "загрузка вложений и удаление своих"},
+	{Name: string(PermAttachmentManage), Scope: model.RoleScopeSpace, Description: "удаление чужих вложений"},
+	{Name: string(PermSpaceInvite), Scope: model.RoleScopeSpace, Description: "приглашение участников"},
+	{Name: string(PermSpaceManage), Scope: model.RoleScopeSpace, Description: "рабочий процесс, политика одобрения, квота вложений"},
+}
+
+func permissionsOf(scope string) []string {
+	var perms []string
+	for _, p := range permissionCatalog {
+		if scope == "" || p.Scope == scope {
+			perms = append(perms, p.Name)
+		}
+	}
+	return perms
+}
+
+// Встроенные роли. Системный admin получает все права, в том числе права в любом пространстве.
+const (
+	SystemRoleAdmin = "admin"
+	SystemRoleUser  = "user"
+
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+func builtinRoles() []model.Role {
+	return []model.Role{
+		{Name: SystemRoleAdmin, Scope: model.RoleScopeSystem, Permissions: permissionsOf("")},
+		{Name: SystemRoleUser, Scope: model.RoleScopeSystem, Permissions: []string{string(PermSpaceCreate)}},
+		{Name: RoleAdmin, Scope: model.RoleScopeSpace, Permissions: permissionsOf(model.RoleScopeSpace)},
+		{Name: RoleMember, Scope: model.RoleScopeSpace, Permissions: []string{
+			string(PermTaskRead), string(PermTaskCreate), string(PermTaskUpdate), string(PermTaskApprove),
+			string(PermCommentCreate), string(PermAttachmentUpload),
+		}},
+		{Name: RoleViewer, Scope: model.RoleScopeSpace, Permissions: []string{string(PermTaskRead)}},
+	}
+}
+
+// RoleService управляет ролями и их правами.
+type RoleService struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewRoleService(dbPool *pgxpool.Pool) *RoleService {
+	return &RoleService{dbPool: dbPool}
+}
+
+// Permissions возвращает каталог прав.
+func (s *RoleService) Permissions() []model.PermissionInfo {
+	return permissionCatalog
+}
+
+// EnsureBuiltinRoles создаёт встроенные роли, если их нет. У существующих ролей с теми же
+// именами без прав права заполняются, а системный admin всегда получает весь каталог (в том числе
+// новые права). Пользователи с несуществующей ролью получают роль user.
+func (s *RoleService) EnsureBuiltinRoles(ctx context.Context) error {
+	for _, r := range builtinRoles() {
+		_, err := s.dbPool.Exec(ctx, `
+			INSERT INTO roles (name, scope, permissions, builtin)
+			VALUES ($1, $2, $3, true)
+			ON CONFLICT (scope, name) DO UPDATE SET
+				builtin = true,
+				permissions = CASE
+					WHEN roles.permissions = '{}' OR (roles.scope = 'system' AND roles.name = $4) THEN EXCLUDED.permissions
+					ELSE roles.permissions
+				END
+		`, r.Name, r.Scope, r.Permissions, SystemRoleAdmin)
+		if err != nil {
+			return fmt.Errorf("ensure role %s/%s: %w", r.Scope, r.Name, err)
+		}
+	}
+
+	_, err := s.dbPool.Exec(ctx, `
+		UPDATE users SET roleid = (SELECT id FROM roles WHERE scope = 'system' AND name = $1)
+		WHERE roleid NOT IN (SELECT id FROM roles WHERE scope = 'system')
+	`, SystemRoleUser)
+	return err
+}
+
+// BootstrapAdmin назначает системную роль admin пользователю login (например, первому администратору).
+func (s *RoleService) BootstrapAdmin(ctx context.Context, login string) error {
+	tag, err := s.dbPool.Exec(ctx, `
+		UPDATE users SET roleid = (SELECT id FROM roles WHERE scope = 'system' AND name = $2)
+		WHERE login = $1
+	`, login, SystemRoleAdmin)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("bootstrap admin: user %q not found", login)
+	}
+	return nil
+}
+
+const roleColumns = `id, name, scope, permissions, builtin`
+
+func scanRole(row pgx.Row) (*model.Role, error) {
+	var r model.Role
+	if err := row.Scan(&r.ID, &r.Name, &r.Scope, &r.Permissions, &r.Builtin); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListRoles возвращает роли области scope (пустая — все).
+func (s *RoleService) ListRoles(ctx context.Context, scope string) ([]model.Role, error) {
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT `+roleColumns+` FROM roles
+		WHERE $1 = '' OR scope = $1
+		ORDER BY scope, name
+	`, scope)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Role, error) {
+		r, err := scanRole(row)
+		if err != nil {
+			return model.Role{}, err
+		}
+		return *r, nil
+	})
+}
+
+// GetRole возвращает роль по id.
+func (s *RoleService) GetRole(ctx context.Context, id int) (*model.Role, error) {
+	r, err := scanRole(s.dbPool.QueryRow(ctx, `SELECT `+roleColumns+` FROM roles WHERE id = $1`, id))
+	if err != nil {
+		return nil, fmt.Errorf("role %d: %w", id, err)
+	}
+	return r, nil
+}
+
+// validateRole проверяет имя, область и права: у роли пространства могут быть только права пространства.
+func validateRole(in *model.RoleInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRole)
+	}
+	if in.Scope != model.RoleScopeSystem && in.Scope != model.RoleScopeSpace {
+		return fmt.Errorf("%w: scope must be %q or %q", ErrInvalidRole, model.RoleScopeSystem, model.RoleScopeSpace)
+	}
+	allowed := permissionsOf("")
+	if in.Scope == model.RoleScopeSpace {
+		allowed = permissionsOf(model.RoleScopeSpace)
+	}
+	for _, p := range in.Permissions {
+		if !slices.Contains(allowed, p) {
+			return fmt.Errorf("%w: permission %q is not allowed in %s role", ErrInvalidRole, p, in.Scope)
+		}
+	}
+	if in.Permissions == nil {
+		in.Permissions = []string{}
+	}
+	slices.Sort(in.Permissions)
+	in.Permissions = slices.Compact(in.Permissions)
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// CreateRole создаёт роль.
+func (s *RoleService) CreateRole(ctx context.Context, in model.RoleInput) (*model.Role, error) {
+	if err := validateRole(&in); err != nil {
+		return nil, err
+	}
+	r, err := scanRole(s.dbPool.QueryRow(ctx, `
+		INSERT INTO roles (name, scope, permissions) VALUES ($1, $2, $3)
+		RETURNING `+roleColumns, in.Name, in.Scope, in.Permissions))
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%s/%s: %w", in.Scope, in.Name, ErrRoleExists)
+	}
+	return r, err
+}
+
+// UpdateRole меняет имя и права роли. Область роли не меняется; встроенную роль нельзя
+// переименовать. При переименовании роли пространства обновляются и членства.
+func (s *RoleService) UpdateRole(ctx context.Context, id int, in model.RoleInput) (*model.Role, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	current, err := scanRole(tx.QueryRow(ctx, `SELECT `+roleColumns+` FROM roles WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		return nil, fmt.Errorf("role %d: %w", id, err)
+	}
+	if in.Scope == "" {
+		in.Scope = current.Scope
+	}
+	if in.Scope != current.Scope {
+		return nil, fmt.Errorf("%w: scope cannot be changed", ErrInvalidRole)
+	}
+	if err := validateRole(&in); err != nil {
+		return nil, err
+	}
+	if current.Builtin && in.Name != current.Name {
+		return nil, ErrBuiltinRole
+	}
+
+	r, err := scanRole(tx.QueryRow(ctx, `
+		UPDATE roles SET name = $2, permissions = $3 WHERE id = $1
+		RETURNING `+roleColumns, id, in.Name, in.Permissions))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%s/%s: %w", in.Scope, in.Name, ErrRoleExists)
+		}
+		return nil, err
+	}
+	if current.Scope == model.RoleScopeSpace && in.Name != current.Name {
+		if _, err := tx.Exec(ctx, `UPDATE space_memberships SET role = $2 WHERE role = $1`, current.Name, in.Name); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// DeleteRole удаляет неиспользуемую невстроенную роль.
+func (s *RoleService) DeleteRole(ctx context.Context, id int) error {
+	r, err := s.GetRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	if r.Builtin {
+		return ErrBuiltinRole
+	}
+
+	var inUse bool
+	err = s.dbPool.QueryRow(ctx, `
+		SELECT CASE WHEN $2 = 'system'
+			THEN EXISTS (SELECT 1 FROM users WHERE roleid = $1)
+			ELSE EXISTS (SELECT 1 FROM space_memberships WHERE role = $3)
+		END
+	`, r.ID, r.Scope, r.Name).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return fmt.Errorf("role %s: %w", r.Name, ErrRoleInUse)
+	}
+
+	_, err = s.dbPool.Exec(ctx, `DELETE FROM roles WHERE id = $1`, id)
+	return err
+}
+
+// SetUserRole назначает пользователю системную роль.
+func (s *RoleService) SetUserRole(ctx context.Context, userID, roleID int) error {
+	r, err := s.GetRole(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if r.Scope != model.RoleScopeSystem {
+		return fmt.Errorf("%w: %s is not a system role", ErrInvalidRole, r.Name)
+	}
+	tag, err := s.dbPool.Exec(ctx, `UPDATE users SET roleid = $2 WHERE id = $1`, userID, roleID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// defaultTaskDuration — плановая длительность незавершённой задачи.
+	defaultTaskDuration = 24 * time.Hour
+	// minRemaining — сколько минимум осталось делать незавершённой задаче, даже если плановое время вышло.
+	minRemaining = time.Hour
+)
+
+type ReportService struct {
+	dbPool    *pgxpool.Pool
+	workflows *WorkflowService
+}
+
+func NewReportService(dbPool *pgxpool.Pool, workflows *WorkflowService) *ReportService {
+	return &ReportService{dbPool: dbPool, workflows: workflows}
+}
+
+// scheduleNode — исходные данные задачи для расчёта расписания.
+type scheduleNode struct {
+	task      model.ScheduleTask
+	startedAt *time.Time
+	doneAt    *time.Time
+	remaining time.Duration
+}
+
+// parseDeadline понимает "2006-01-02" (дедлайн — конец дня по UTC) и RFC3339.
+func parseDeadline(s string) *time.Time {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		end := t.Add(24 * time.Hour)
+		return &end
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t
+	}
+	return nil
+}
+
+func hours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
+
+// plannedDuration — длительность задачи: фактическая для завершённых, иначе defaultTaskDuration
+// (оценок у задач пока нет). Начатая задача, которая идёт дольше, оценивается прошедшим временем:
+// сколько ей ещё осталось, ограничивает снизу minRemaining. Дедлайн в оценку не входит —
+// иначе начатая задача всегда заканчивалась бы точно к нему.
+func plannedDuration(n *scheduleNode, now time.Time) time.Duration {
+	if n.task.Done && n.startedAt != nil && n.doneAt != nil {
+		return n.doneAt.Sub(*n.startedAt)
+	}
+	if n.startedAt != nil {
+		if elapsed := now.Sub(*n.startedAt); elapsed > defaultTaskDuration {
+			return elapsed
+		}
+	}
+	return defaultTaskDuration
+}
+
+// buildSchedule считает ранние сроки, резерв времени и критический путь по графу блокеров.
+// Незавершённая задача может начаться не раньше now и не раньше, чем закончатся все её блокеры.
+func buildSchedule(nodes []*scheduleNode, now time.Time) (*model.ScheduleReport, error) {
+	byID := make(map[string]*scheduleNode, len(nodes))
+	for _, n := range nodes {
+		byID[n.task.ID] = n
+	}
+
+	// топологическая сортировка (Kahn), рёбра blocker -> task
+	indegree := map[string]int{}
+	dependents := map[string][]string{}
+	for _, n := range nodes {
+		indegree[n.task.ID] += 0
+		for _, b := range n.task.BlockedBy {
+			if _, ok := byID[b]; ok {
+				indegree[n.task.ID]++
+				dependents[b] = append(dependents[b], n.task.ID)
+			}
+		}
+	}
+	var queue, order []string
+	for _, n := range nodes {
+		if indegree[n.task.ID] == 0 {
+			queue = append(queue, n.task.ID)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		order = append(order, id)
+		for _, dep := range dependents[id] {
+			indegree[dep]--
+			if indegree[dep] == 0 {
+				queue = append(queue, dep)
+			}
+		}
+	}
+	if len(order) != len(nodes) {
+		return nil, fmt.Errorf("%w: schedule cannot be computed", ErrDependencyCycle)
+	}
+
+	// прямой проход: ранние сроки
+	driver := map[string]string{}
+	for _, id := range order {
+		n := byID[id]
+		duration := plannedDuration(n, now)
+		n.task.DurationHours = hours(duration)
+
+		if n.task.Done {
+			n.task.Finish = now
+			if n.doneAt != nil {
+				n.task.Finish = *n.doneAt
+			}
+			n.task.Start = n.task.Finish
+			if n.startedAt != nil {
+				n.task.Start = *n.startedAt
+			}
+			continue
+		}
+
+		ready := now
+		for _, b := range n.task.BlockedBy {
+			if bn, ok := byID[b]; ok && bn.task.Finish.After(ready) {
+				ready = bn.task.Finish
+				driver[id] = b
+			}
+		}
+
+		n.remaining = duration
+		if n.startedAt != nil {
+			n.remaining = duration - now.Sub(*n.startedAt)
+		}
+		if n.remaining < minRemaining {
+			n.remaining = minRemaining
+		}
+
+		n.task.Start = ready
+		if n.startedAt != nil {
+			n.task.Start = *n.startedAt
+		}
+		n.task.Finish = ready.Add(n.remaining)
+
+		if n.task.Deadline != nil && n.task.Finish.After(*n.task.Deadline) {
+			n.task.MissesDeadline = true
+			// без блокеров успели бы — значит, срыв из-за них
+			n.task.DelayedByBlockers = !now.Add(n.remaining).After(*n.task.Deadline)
+		}
+	}
+
+	report := &model.ScheduleReport{GeneratedAt: now, CriticalPath: []string{}, AtRisk: []string{}, Tasks: []model.ScheduleTask{}}
+
+	var last *scheduleNode
+	for _, n := range nodes {
+		if !n.task.Done && (last == nil || n.task.Finish.After(last.task.Finish)) {
+			last = n
+		}
+	}
+	if last != nil {
+		end := last.task.Finish
+		report.ProjectedFinish = &end
+
+		// обратный проход: поздние сроки и резерв относительно общего окончания
+		latestFinish := map[string]time.Time{}
+		for i := len(order) - 1; i >= 0; i-- {
+			n := byID[order[i]]
+			if n.task.Done {
+				continue
+			}
+			lf := end
+			for _, dep := range dependents[n.task.ID] {
+				dn := byID[dep]
+				if dn.task.Done {
+					continue
+				}
+				if ls := latestFinish[dep].Add(-dn.remaining); ls.Before(lf) {
+					lf = ls
+				}
+			}
+			latestFinish[n.task.ID] = lf
+			slack := lf.Sub(n.task.Finish)
+			n.task.SlackHours = hours(slack)
+			n.task.Critical = slack < time.Minute
+		}
+
+		// критический путь — цепочка блокеров, определивших срок последней задачи
+		for id := last.task.ID; id != ""; id = driver[id] {
+			report.CriticalPath = append([]string{id}, report.CriticalPath...)
+		}
+	}
+
+	for _, n := range nodes {
+		if n.task.MissesDeadline {
+			report.AtRisk = append(report.AtRisk, n.task.ID)
+		}
+		report.Tasks = append(report.Tasks, n.task)
+	}
+	sort.SliceStable(report.Tasks, func(i, j int) bool { return report.Tasks[i].Start.Before(report.Tasks[j].Start) })
+
+	return report, nil
+}
+
+// loadScheduleNodes загружает задачи из пространств, где userID — участник.
+func (s *ReportService) loadScheduleNodes(ctx context.Context, userID int, where string, arg any) ([]*scheduleNode, error) {
+	// запрос с персональным токеном одного пространства видит только его задачи
+	spaceID, _, err := scopedSpace(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT t.id::text, t.title, t.status, COALESCE(t.space, ''), t."assignerID",
+		       t."started_At", t.done_at, t.deadline,
+		       ARRAY(SELECT d.blocker_id::text FROM task_dependencies d JOIN tasks b ON b.id = d.blocker_id AND b.deleted_at IS NULL WHERE d.task_id = t.id ORDER BY d.blocker_id)
+		FROM tasks t
+		WHERE t.space IN (`+memberSpacesSQL("$2")+`) AND t.deleted_at IS NULL AND ($3 = '' OR t.space = $3) AND `+where, arg, userID, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []*scheduleNode
+	var spaces []string
+	for rows.Next() {
+		n := &scheduleNode{}
+		var space, deadline string
+		if err := rows.Scan(&n.task.ID, &n.task.Title, &n.task.Status, &space, &n.task.AssignerID,
+			&n.startedAt, &n.doneAt, &deadline, &n.task.BlockedBy); err != nil {
+			return nil, err
+		}
+		n.task.Deadline = parseDeadline(deadline)
+		nodes = append(nodes, n)
+		spaces = append(spaces, space)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	workflows := map[string]*model.Workflow{}
+	for i, n := range nodes {
+		wf, ok := workflows[spaces[i]]
+		if !ok {
+			if wf, err = s.workflows.GetWorkflow(ctx, spaces[i]); err != nil {
+				return nil, err
+			}
+			workflows[spaces[i]] = wf
+		}
+		st, _ := workflowStatus(wf, n.task.Status)
+		n.task.Done = st.Category == model.StatusCategoryDone
+	}
+	return nodes, nil
+}
+
+// externalBlockersSQL — задачи из $1 и все их блокеры транзитивно (как проверка циклов в insertBlocker).
+const externalBlockersSQL = `t.id IN (
+	WITH RECURSIVE chain(id) AS (
+		SELECT id::uuid FROM unnest($1::text[]) id
+		UNION
+		SELECT d.blocker_id FROM task_dependencies d JOIN chain c ON d.task_id = c.id
+	)
+	SELECT id FROM chain
+)`
+
+// schedule строит отчёт по задачам области и их блокерам из других областей (External).
+func (s *ReportService) schedule(ctx context.Context, userID int, where string, arg any) (*model.ScheduleReport, error) {
+	nodes, err := s.loadScheduleNodes(ctx, userID, where, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	inScope := map[string]bool{}
+	for _, n := range nodes {
+		inScope[n.task.ID] = true
+	}
+	var external []string
+	seen := map[string]bool{}
+	for _, n := range nodes {
+		for _, b := range n.task.BlockedBy {
+			if !inScope[b] && !seen[b] {
+				seen[b] = true
+				external = append(external, b)
+			}
+		}
+	}
+	// блокеры вне области загружаются со всей цепочкой их блокеров, иначе срок внешнего блокера
+	// считался бы от now, хотя он сам ждёт других задач
+	if len(external) > 0 {
+		extNodes, err := s.loadScheduleNodes(ctx, userID, externalBlockersSQL, external)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range extNodes {
+			// цепочка может вернуться в область: такие задачи уже загружены
+			if inScope[n.task.ID] {
+				continue
+			}
+			n.task.External = true
+			nodes = append(nodes, n)
+		}
+	}
+
+	return buildSchedule(nodes, time.Now())
+}
+
+// DashboardSchedule — отчёт по задачам дашборда.
+func (s *ReportService) DashboardSchedule(ctx context.Context, userID int, dashboardID string) (*model.ScheduleReport, error) {
+	report, err := s.schedule(ctx, userID, `t."dashboardID" = $1`, dashboardID)
+	if err != nil {
+		return nil, err
+	}
+	report.DashboardID = dashboardID
+	return report, nil
+}
+
+// SpaceSchedule — отчёт по задачам пространства.
+func (s *ReportService) SpaceSchedule(ctx context.Context, userID int, spaceID string) (*model.ScheduleReport, error) {
+	report, err := s.schedule(ctx, userID, `t.space = $1`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	report.SpaceID = spaceID
+	return report, nil
+}
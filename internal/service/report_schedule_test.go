@@ -0,0 +1,64 @@
+package service_test
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+)
+
+func TestDashboardScheduleLoadsBlockerChain(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	owner := testutil.User(t, db, service.SystemRoleUser)
+	spaceID := testutil.Space(t, db, owner)
+	workflows := service.NewWorkflowService(db)
+	tasks := service.NewTaskService(db, service.NewSpaceService(db, nil), workflows, service.NewEventBus())
+	reports := service.NewReportService(db, workflows)
+
+	dashboard, other := testutil.Name("dash"), testutil.Name("dash")
+	newTask := func(title, dashboardID string, blockedBy ...string) string {
+		t.Helper()
+		task, err := tasks.CreateTask(ctx, model.Task{
+			Title:       title,
+			ReporterID:  strconv.Itoa(owner),
+			ApproverID:  strconv.Itoa(owner),
+			DashboardID: dashboardID,
+			BlockedBy:   blockedBy,
+			Space:       &spaceID,
+		}, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task.ID
+	}
+	// на дашборде только target; его блокер и блокер блокера — на другом дашборде
+	first := newTask("first", other)
+	second := newTask("second", other, first)
+	target := newTask("target", dashboard, second)
+
+	report, err := reports.DashboardSchedule(ctx, owner, dashboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]model.ScheduleTask{}
+	for _, task := range report.Tasks {
+		got[task.ID] = task
+	}
+	if len(got) != 3 || !got[first].External || !got[second].External || got[target].External {
+		t.Fatalf("tasks %+v, want target plus two external blockers", report.Tasks)
+	}
+	// target ждёт всю цепочку: два дня блокеров до него
+	if wait := got[target].Start.Sub(got[first].Start); wait < 47*time.Hour {
+		t.Errorf("target starts %s after the first blocker, want the whole chain", wait)
+	}
+	want := []string{first, second, target}
+	if !slices.Equal(report.CriticalPath, want) {
+		t.Errorf("critical path %v, want %v", report.CriticalPath, want)
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"tasker/internal/model"
+)
+
+var scheduleNow = time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC)
+
+// hoursFromNow — момент через h часов от scheduleNow.
+func hoursFromNow(h float64) *time.Time {
+	t := scheduleNow.Add(time.Duration(h * float64(time.Hour)))
+	return &t
+}
+
+func schedNode(id string, blockedBy ...string) *scheduleNode {
+	return &scheduleNode{task: model.ScheduleTask{ID: id, Title: id, BlockedBy: blockedBy}}
+}
+
+func asExternal(n *scheduleNode) *scheduleNode {
+	n.task.External = true
+	return n
+}
+
+func asDone(n *scheduleNode, startedAt, doneAt float64) *scheduleNode {
+	n.task.Done = true
+	n.startedAt, n.doneAt = hoursFromNow(startedAt), hoursFromNow(doneAt)
+	return n
+}
+
+func asStarted(n *scheduleNode, startedAt float64) *scheduleNode {
+	n.startedAt = hoursFromNow(startedAt)
+	return n
+}
+
+func withDeadline(n *scheduleNode, h float64) *scheduleNode {
+	n.task.Deadline = hoursFromNow(h)
+	return n
+}
+
+// wantTask — ожидаемые сроки задачи в часах от scheduleNow.
+type wantTask struct {
+	start, finish, slack float64
+	critical             bool
+	missesDeadline       bool
+	delayedByBlockers    bool
+}
+
+func TestBuildSchedule(t *testing.T) {
+	cases := []struct {
+		name     string
+		nodes    []*scheduleNode
+		want     map[string]wantTask
+		path     []string
+		atRisk   []string
+		finishAt float64
+	}{
+		{
+			name:  "chain",
+			nodes: []*scheduleNode{schedNode("c", "b"), schedNode("b", "a"), schedNode("a")},
+			want: map[string]wantTask{
+				"a": {start: 0, finish: 24, critical: true},
+				"b": {start: 24, finish: 48, critical: true},
+				"c": {start: 48, finish: 72, critical: true},
+			},
+			path:     []string{"a", "b", "c"},
+			finishAt: 72,
+		},
+		{
+			// ветка через b на сутки длиннее ветки через c: у c резерв, на критическом пути её нет
+			name: "diamond",
+			nodes: []*scheduleNode{
+				schedNode("a"),
+				schedNode("b", "a"),
+				schedNode("b2", "b"),
+				schedNode("c", "a"),
+				schedNode("d", "b2", "c"),
+			},
+			want: map[string]wantTask{
+				"a":  {start: 0, finish: 24, critical: true},
+				"b":  {start: 24, finish: 48, critical: true},
+				"b2": {start: 48, finish: 72, critical: true},
+				"c":  {start: 24, finish: 48, slack: 24},
+				"d":  {start: 72, finish: 96, critical: true},
+			},
+			path:     []string{"a", "b", "b2", "d"},
+			finishAt: 96,
+		},
+		{
+			name: "isolated",
+			nodes: []*scheduleNode{
+				asDone(schedNode("x"), -48, -24),
+				schedNode("y"),
+				withDeadline(schedNode("z"), 12),
+			},
+			want: map[string]wantTask{
+				"x": {start: -48, finish: -24},
+				"y": {start: 0, finish: 24, critical: true},
+				"z": {start: 0, finish: 24, critical: true, missesDeadline: true},
+			},
+			path:     []string{"y"},
+			atRisk:   []string{"z"},
+			finishAt: 24,
+		},
+		{
+			// начатая задача оценивается в сутки, а не до дедлайна: резерв у параллельной ветки
+			// и срыв срока видны; затянувшейся задаче остаётся minRemaining
+			name: "started",
+			nodes: []*scheduleNode{
+				withDeadline(asStarted(schedNode("a"), -6), 72),
+				schedNode("b", "a"),
+				withDeadline(asStarted(schedNode("c"), -8), 10),
+				withDeadline(asStarted(schedNode("late"), -30), 48),
+			},
+			want: map[string]wantTask{
+				"a":    {start: -6, finish: 18, critical: true},
+				"b":    {start: 18, finish: 42, critical: true},
+				"c":    {start: -8, finish: 16, slack: 26, missesDeadline: true},
+				"late": {start: -30, finish: 1, slack: 41},
+			},
+			path:     []string{"a", "b"},
+			atRisk:   []string{"c"},
+			finishAt: 42,
+		},
+		{
+			// внешний блокер сам ждёт внешнюю задачу: срок считается по всей цепочке;
+			// ссылка на незагруженную задачу (нет доступа или в корзине) не учитывается
+			name: "external blocker",
+			nodes: []*scheduleNode{
+				withDeadline(schedNode("t", "e", "ghost"), 36),
+				asExternal(schedNode("e", "f")),
+				asExternal(schedNode("f")),
+			},
+			want: map[string]wantTask{
+				"f": {start: 0, finish: 24, critical: true},
+				"e": {start: 24, finish: 48, critical: true},
+				"t": {start: 48, finish: 72, critical: true, missesDeadline: true, delayedByBlockers: true},
+			},
+			path:     []string{"f", "e", "t"},
+			atRisk:   []string{"t"},
+			finishAt: 72,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := buildSchedule(tc.nodes, scheduleNow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Tasks) != len(tc.want) {
+				t.Fatalf("%d tasks, want %d", len(report.Tasks), len(tc.want))
+			}
+			for _, got := range report.Tasks {
+				w := tc.want[got.ID]
+				if !got.Start.Equal(*hoursFromNow(w.start)) || !got.Finish.Equal(*hoursFromNow(w.finish)) {
+					t.Errorf("%s: %s – %s, want %s – %s", got.ID, got.Start, got.Finish, hoursFromNow(w.start), hoursFromNow(w.finish))
+				}
+				if got.SlackHours != w.slack || got.Critical != w.critical {
+					t.Errorf("%s: slack %v critical %v, want %v %v", got.ID, got.SlackHours, got.Critical, w.slack, w.critical)
+				}
+				if got.MissesDeadline != w.missesDeadline || got.DelayedByBlockers != w.delayedByBlockers {
+					t.Errorf("%s: missesDeadline %v delayedByBlockers %v, want %v %v",
+						got.ID, got.MissesDeadline, got.DelayedByBlockers, w.missesDeadline, w.delayedByBlockers)
+				}
+			}
+			if !slices.Equal(report.CriticalPath, tc.path) {
+				t.Errorf("critical path %v, want %v", report.CriticalPath, tc.path)
+			}
+			if !slices.Equal(report.AtRisk, tc.atRisk) {
+				t.Errorf("at risk %v, want %v", report.AtRisk, tc.atRisk)
+			}
+			if report.ProjectedFinish == nil || !report.ProjectedFinish.Equal(*hoursFromNow(tc.finishAt)) {
+				t.Errorf("projected finish %v, want %s", report.ProjectedFinish, hoursFromNow(tc.finishAt))
+			}
+		})
+	}
+}
+
+func TestBuildScheduleCycle(t *testing.T) {
+	_, err := buildSchedule([]*scheduleNode{schedNode("a", "b"), schedNode("b", "a"), schedNode("c")}, scheduleNow)
+	if !errors.Is(err, ErrDependencyCycle) {
+		t.Errorf("err = %v, want ErrDependencyCycle", err)
+	}
+}
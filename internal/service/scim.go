@@ -0,0 +1,824 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"tasker/internal/model"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrSCIMInvalidFilter — фильтр не поддерживается (поддерживается только «attr eq "value"»).
+	ErrSCIMInvalidFilter = errors.New("unsupported filter")
+	// ErrSCIMInvalidValue — недопустимое значение атрибута или операции.
+	ErrSCIMInvalidValue = errors.New("invalid value")
+	// ErrSCIMInvalidPath — путь PATCH-операции не поддерживается.
+	ErrSCIMInvalidPath = errors.New("invalid path")
+	// ErrSCIMConflict — userName или externalId уже заняты.
+	ErrSCIMConflict = errors.New("resource already exists")
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+// SCIMService реализует провизионирование по SCIM 2.0: пользователи — это users,
+// группы — пространства, участники группы — space_memberships. Email, заданный провайдером,
+// считается подтверждённым.
+type SCIMService struct {
+	dbPool    *pgxpool.Pool
+	passwords *PasswordPolicy
+}
+
+func NewSCIMService(dbPool *pgxpool.Pool, passwords *PasswordPolicy) *SCIMService {
+	return &SCIMService{dbPool: dbPool, passwords: passwords}
+}
+
+var scimFilterRe = regexp.MustCompile(`(?i)^\s*([a-z][\w.\[\]" ]*?)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// parseSCIMFilter разбирает фильтр вида `userName eq "ivanov"` в SQL-условие из allowed
+// (ключ — атрибут в нижнем регистре, условие использует $1). Пустой фильтр — без условия.
+func parseSCIMFilter(filter string, allowed map[string]string) (string, []any, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "TRUE", nil, nil
+	}
+	m := scimFilterRe.FindStringSubmatch(filter)
+	if m == nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrSCIMInvalidFilter, filter)
+	}
+	cond, ok := allowed[strings.ToLower(m[1])]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: attribute %s", ErrSCIMInvalidFilter, m[1])
+	}
+	value, err := strconv.Unquote(m[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s", ErrSCIMInvalidFilter, filter)
+	}
+	return cond, []any{value}, nil
+}
+
+// scimPage нормализует startIndex (с 1) и count.
+func scimPage(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count <= 0 {
+		count = scimDefaultCount
+	}
+	count = min(count, scimMaxCount)
+	return startIndex, count
+}
+
+func scimString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("%w: expected string", ErrSCIMInvalidValue)
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// scimBool принимает и строки "True"/"False": так active присылают некоторые провайдеры.
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+	s, err := scimString(raw)
+	if err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("%w: expected boolean", ErrSCIMInvalidValue)
+}
+
+// scimAttr приводит имя атрибута к нижнему регистру и убирает префикс схемы.
+func scimAttr(path, schema string) string {
+	p := strings.ToLower(strings.TrimSpace(path))
+	return strings.TrimPrefix(p, strings.ToLower(schema)+":")
+}
+
+// --- пользователи ---
+
+const scimUserColumns = `id, login, name, surname, middlename, email, external_id, deactivated_at IS NOT NULL`
+
+var scimUserFilters = map[string]string{
+	"username":                     "lower(login) = lower($1)",
+	"externalid":                   "external_id = $1",
+	"emails.value":                 "lower(email) = lower($1)",
+	`emails[type eq "work"].value`: "lower(email) = lower($1)",
+}
+
+func scanSCIMUser(row pgx.Row) (*model.SCIMUser, error) {
+	var (
+		id                     int
+		login, name, surname   string
+		middlename, email, ext *string
+		deactivated            bool
+	)
+	if err := row.Scan(&id, &login, &name, &surname, &middlename, &email, &ext, &deactivated); err != nil {
+		return nil, err
+	}
+	active := !deactivated
+	u := &model.SCIMUser{
+		Schemas:  []string{model.SCIMSchemaUser},
+		ID:       strconv.Itoa(id),
+		UserName: login,
+		Name:     model.SCIMName{GivenName: name, FamilyName: surname},
+		Active:   &active,
+		Meta:     &model.SCIMMeta{ResourceType: "User"},
+	}
+	if middlename != nil {
+		u.Name.MiddleName = *middlename
+	}
+	u.Name.Formatted = strings.Join(strings.Fields(name+" "+u.Name.MiddleName+" "+surname), " ")
+	u.DisplayName = u.Name.Formatted
+	if email != nil && *email != "" {
+		u.Emails = []model.SCIMEmail{{Value: *email, Type: "work", Primary: true}}
+	}
+	if ext != nil {
+		u.ExternalID = *ext
+	}
+	return u, nil
+}
+
+// ListUsers возвращает страницу пользователей, подходящих под filter.
+func (s *SCIMService) ListUsers(ctx context.Context, filter string, startIndex, count int) (*model.SCIMListResponse, error) {
+	where, args, err := parseSCIMFilter(filter, scimUserFilters)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+
+	var total int
+	if err := s.dbPool.QueryRow(ctx, `SELECT count(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	n := len(args)
+	rows, err := s.dbPool.Query(ctx, fmt.Sprintf(`SELECT %s FROM users WHERE %s ORDER BY id OFFSET $%d LIMIT $%d`,
+		scimUserColumns, where, n+1, n+2), append(args, startIndex-1, count)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.SCIMUser{}
+	for rows.Next() {
+		u, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &model.SCIMListResponse{
+		Schemas:      []string{model.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    users,
+	}, nil
+}
+
+func (s *SCIMService) GetUser(ctx context.Context, id string) (*model.SCIMUser, error) {
+	return getSCIMUser(ctx, s.dbPool, id)
+}
+
+func getSCIMUser(ctx context.Context, q queryer, id string) (*model.SCIMUser, error) {
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("user %q: %w", id, ErrUserNotFound)
+	}
+	u, err := scanSCIMUser(q.QueryRow(ctx, `SELECT `+scimUserColumns+` FROM users WHERE id = $1`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("user %q: %w", id, ErrUserNotFound)
+	}
+	return u, err
+}
+
+// scimUserFields — проверенные значения для записи в users.
+type scimUserFields struct {
+	login, name, surname, middlename, email, externalID string
+	// passwordHash пустой — пароль не меняется
+	passwordHash string
+	// active nil — признак не передан и не меняется
+	active *bool
+}
+
+func (s *SCIMService) userFields(in *model.SCIMUser) (*scimUserFields, error) {
+	f := &scimUserFields{
+		login:      strings.TrimSpace(in.UserName),
+		name:       strings.TrimSpace(in.Name.GivenName),
+		surname:    strings.TrimSpace(in.Name.FamilyName),
+		middlename: strings.TrimSpace(in.Name.MiddleName),
+		externalID: strings.TrimSpace(in.ExternalID),
+		active:     in.Active,
+	}
+	if f.login == "" {
+		return nil, fmt.Errorf("%w: userName is required", ErrSCIMInvalidValue)
+	}
+	if f.name == "" {
+		f.name = strings.TrimSpace(in.DisplayName)
+	}
+	if f.name == "" {
+		f.name = f.login
+	}
+
+	// у пользователя один email: основной или первый из списка
+	for i, e := range in.Emails {
+		if e.Primary || i == 0 {
+			f.email = e.Value
+		}
+	}
+	email, err := NormalizeEmail(f.email)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidValue, err)
+	}
+	f.email = email
+
+	if in.Password != "" {
+		if err := s.passwords.Validate(in.Password, f.login); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidValue, err)
+		}
+		hash, err := s.passwords.Hash(in.Password)
+		if err != nil {
+			return nil, err
+		}
+		f.passwordHash = hash
+	}
+	return f, nil
+}
+
+// CreateUser создаёт пользователя с системной ролью user. Без password войти можно только
+// через SSO или после сброса пароля.
+func (s *SCIMService) CreateUser(ctx context.Context, in model.SCIMUser) (*model.SCIMUser, error) {
+	f, err := s.userFields(&in)
+	if err != nil {
+		return nil, err
+	}
+	if f.passwordHash == "" {
+		f.passwordHash = "!"
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (name, surname, middlename, login, email, email_verified_at, external_id, roleID, password)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), CASE WHEN $5 <> '' THEN now() END, NULLIF($6, ''),
+			(SELECT id FROM roles WHERE scope = 'system' AND name = $7), $8)
+		RETURNING id
+	`, f.name, f.surname, f.middlename, f.login, f.email, f.externalID, SystemRoleUser, f.passwordHash).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("user %q: %w", f.login, ErrSCIMConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ClaimForNewUser(ctx, tx, id, f.email, ""); err != nil {
+		return nil, err
+	}
+	if err := setUserActive(ctx, tx, id, f.active == nil || *f.active); err != nil {
+		return nil, err
+	}
+	u, err := getSCIMUser(ctx, tx, strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	return u, tx.Commit(ctx)
+}
+
+// privilegedPermissions — системные права, которые SCIM-клиент может затронуть у пользователя,
+// только если обладает ими сам: иначе user.manage хватило бы, чтобы сменить пароль администратору.
+var privilegedPermissions = []string{string(PermRoleManage), string(PermUserManage)}
+
+// checkCanModifyUser — ErrForbidden, если у системной роли пользователя userID есть право
+// из privilegedPermissions, которого нет у actorID.
+func checkCanModifyUser(ctx context.Context, q queryer, actorID, userID int) error {
+	var outranked bool
+	err := q.QueryRow(ctx, `
+		SELECT EXISTS (
+			(SELECT unnest(r.permissions) FROM users u JOIN roles r ON r.id = u.roleid WHERE u.id = $2
+			 INTERSECT SELECT unnest($3::text[]))
+			EXCEPT
+			SELECT unnest(r.permissions) FROM users u JOIN roles r ON r.id = u.roleid WHERE u.id = $1
+		)
+	`, actorID, userID, privilegedPermissions).Scan(&outranked)
+	if err != nil {
+		return err
+	}
+	if outranked {
+		return fmt.Errorf("user %d has privileges the actor lacks: %w", userID, ErrForbidden)
+	}
+	return nil
+}
+
+// ReplaceUser перезаписывает атрибуты пользователя (PUT) от имени actorID. active: false
+// деактивирует его и отзывает сессии, active: true возвращает доступ, без active признак не меняется.
+// Новый пароль отзывает все сессии пользователя.
+func (s *SCIMService) ReplaceUser(ctx context.Context, actorID int, id string, in model.SCIMUser) (*model.SCIMUser, error) {
+	if _, err := s.GetUser(ctx, id); err != nil {
+		return nil, err
+	}
+	userID, _ := strconv.Atoi(id)
+	f, err := s.userFields(&in)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err := checkCanModifyUser(ctx, tx, actorID, userID); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE users SET name = $2, surname = $3, middlename = NULLIF($4, ''), login = $5,
+			email = NULLIF($6, ''), external_id = NULLIF($7, ''), password = COALESCE(NULLIF($8, ''), password),
+			email_verified_at = CASE WHEN $6 = '' THEN NULL
+				WHEN lower(email) = $6 THEN COALESCE(email_verified_at, now()) ELSE now() END
+		WHERE id = $1
+	`, userID, f.name, f.surname, f.middlename, f.login, f.email, f.externalID, f.passwordHash)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("user %q: %w", f.login, ErrSCIMConflict)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.passwordHash != "" {
+		if _, err := revokeSessions(ctx, tx, `user_id = $1`, RevokePasswordChange, userID); err != nil {
+			return nil, err
+		}
+	}
+	if f.active != nil {
+		if err := setUserActive(ctx, tx, userID, *f.active); err != nil {
+			return nil, err
+		}
+	}
+	u, err := getSCIMUser(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return u, tx.Commit(ctx)
+}
+
+// PatchUser применяет операции PatchOp к текущему состоянию пользователя и сохраняет результат.
+func (s *SCIMService) PatchUser(ctx context.Context, actorID int, id string, patch model.SCIMPatch) (*model.SCIMUser, error) {
+	u, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range patch.Operations {
+		if err := applySCIMPatch(op, func(kind, path string, value json.RawMessage) error {
+			return patchUserAttr(u, kind, path, value)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return s.ReplaceUser(ctx, actorID, id, *u)
+}
+
+// DeactivateUser — DELETE: пользователь не удаляется (его задачи и история остаются),
+// а деактивируется, как при active: false.
+func (s *SCIMService) DeactivateUser(ctx context.Context, actorID int, id string) error {
+	if _, err := s.GetUser(ctx, id); err != nil {
+		return err
+	}
+	userID, _ := strconv.Atoi(id)
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	if err := checkCanModifyUser(ctx, tx, actorID, userID); err != nil {
+		return err
+	}
+	if err := setUserActive(ctx, tx, userID, false); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// applySCIMPatch разбирает операцию: без path значение — объект «атрибут: значение»,
+// каждый атрибут применяется отдельно.
+func applySCIMPatch(op model.SCIMPatchOperation, apply func(kind, path string, value json.RawMessage) error) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return fmt.Errorf("%w: unsupported op %q", ErrSCIMInvalidValue, op.Op)
+	}
+	if op.Path != "" {
+		return apply(kind, op.Path, op.Value)
+	}
+	if kind == "remove" {
+		return fmt.Errorf("%w: remove requires a path", ErrSCIMInvalidPath)
+	}
+	var attrs map[string]json.RawMessage
+	if err := json.Unmarshal(op.Value, &attrs); err != nil {
+		return fmt.Errorf("%w: value must be an object when path is omitted", ErrSCIMInvalidValue)
+	}
+	for path, value := range attrs {
+		if err := apply(kind, path, value); err != nil && !errors.Is(err, ErrSCIMInvalidPath) {
+			// атрибуты, которых у нас нет (например, из расширений схемы), пропускаем
+			return err
+		}
+	}
+	return nil
+}
+
+func patchUserAttr(u *model.SCIMUser, kind, path string, value json.RawMessage) error {
+	remove := kind == "remove"
+	p := scimAttr(path, model.SCIMSchemaUser)
+
+	var err error
+	switch {
+	case p == "active" && !remove:
+		var b bool
+		b, err = scimBool(value)
+		u.Active = &b
+	case p == "username" && !remove:
+		u.UserName, err = scimString(value)
+	case p == "password" && !remove:
+		u.Password, err = scimString(value)
+	case p == "externalid":
+		u.ExternalID = ""
+		if !remove {
+			u.ExternalID, err = scimString(value)
+		}
+	case p == "displayname", p == "name.formatted":
+		// вычисляются из имени и фамилии
+	case p == "name":
+		var name model.SCIMName
+		if !remove {
+			if err := json.Unmarshal(value, &name); err != nil {
+				return fmt.Errorf("%w: name must be an object", ErrSCIMInvalidValue)
+			}
+		}
+		if kind == "add" {
+			name.GivenName = cmp.Or(name.GivenName, u.Name.GivenName)
+			name.FamilyName = cmp.Or(name.FamilyName, u.Name.FamilyName)
+			name.MiddleName = cmp.Or(name.MiddleName, u.Name.MiddleName)
+		}
+		u.Name = name
+	case p == "name.givenname", p == "name.familyname", p == "name.middlename":
+		var v string
+		if !remove {
+			if v, err = scimString(value); err != nil {
+				return err
+			}
+		}
+		switch p {
+		case "name.givenname":
+			u.Name.GivenName = v
+		case "name.familyname":
+			u.Name.FamilyName = v
+		default:
+			u.Name.MiddleName = v
+		}
+	case p == "emails":
+		u.Emails = nil
+		if !remove {
+			err = json.Unmarshal(value, &u.Emails)
+		}
+	case strings.HasPrefix(p, "emails[") || p == "emails.value":
+		u.Emails = nil
+		if !remove {
+			var v string
+			v, err = scimString(value)
+			u.Emails = []model.SCIMEmail{{Value: v, Type: "work", Primary: true}}
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrSCIMInvalidPath, path)
+	}
+	if err != nil && !errors.Is(err, ErrSCIMInvalidValue) {
+		err = fmt.Errorf("%w: %s", ErrSCIMInvalidValue, path)
+	}
+	return err
+}
+
+// --- группы ---
+
+var scimGroupFilters = map[string]string{
+	"displayname": "lower(name) = lower($1)",
+	"externalid":  "external_id = $1",
+}
+
+// ListGroups возвращает страницу групп (неархивных пространств). withMembers = false
+// (excludedAttributes=members) экономит запросы для больших групп.
+func (s *SCIMService) ListGroups(ctx context.Context, filter string, startIndex, count int, withMembers bool) (*model.SCIMListResponse, error) {
+	where, args, err := parseSCIMFilter(filter, scimGroupFilters)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+	where = "archived_at IS NULL AND " + where
+
+	var total int
+	if err := s.dbPool.QueryRow(ctx, `SELECT count(*) FROM spaces WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	n := len(args)
+	rows, err := s.dbPool.Query(ctx, fmt.Sprintf(`SELECT id, name, external_id FROM spaces WHERE %s ORDER BY created_at, id OFFSET $%d LIMIT $%d`,
+		where, n+1, n+2), append(args, startIndex-1, count)...)
+	if err != nil {
+		return nil, err
+	}
+	groups := []model.SCIMGroup{}
+	for rows.Next() {
+		g, err := scanSCIMGroup(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if withMembers {
+		for i := range groups {
+			if groups[i].Members, err = scimGroupMembers(ctx, s.dbPool, groups[i].ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &model.SCIMListResponse{
+		Schemas:      []string{model.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    groups,
+	}, nil
+}
+
+func scanSCIMGroup(row pgx.Row) (*model.SCIMGroup, error) {
+	var (
+		g   model.SCIMGroup
+		ext *string
+	)
+	if err := row.Scan(&g.ID, &g.DisplayName, &ext); err != nil {
+		return nil, err
+	}
+	g.Schemas = []string{model.SCIMSchemaGroup}
+	g.Meta = &model.SCIMMeta{ResourceType: "Group"}
+	if ext != nil {
+		g.ExternalID = *ext
+	}
+	return &g, nil
+}
+
+func scimGroupMembers(ctx context.Context, q queryer, spaceID string) ([]model.SCIMMember, error) {
+	rows, err := q.Query(ctx, `
+		SELECT u.id, u.login FROM space_memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.space_id = $1 ORDER BY u.id
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []model.SCIMMember{}
+	for rows.Next() {
+		var (
+			id    int
+			login string
+		)
+		if err := rows.Scan(&id, &login); err != nil {
+			return nil, err
+		}
+		members = append(members, model.SCIMMember{Value: strconv.Itoa(id), Display: login})
+	}
+	return members, rows.Err()
+}
+
+func (s *SCIMService) GetGroup(ctx context.Context, id string, withMembers bool) (*model.SCIMGroup, error) {
+	return getSCIMGroup(ctx, s.dbPool, id, withMembers)
+}
+
+func getSCIMGroup(ctx context.Context, q queryer, id string, withMembers bool) (*model.SCIMGroup, error) {
+	g, err := scanSCIMGroup(q.QueryRow(ctx, `SELECT id, name, external_id FROM spaces WHERE id = $1 AND archived_at IS NULL`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("group %q: %w", id, ErrSpaceNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if withMembers {
+		if g.Members, err = scimGroupMembers(ctx, q, id); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// CreateGroup создаёт пространство; его владельцем становится actorID — владелец токена SCIM.
+func (s *SCIMService) CreateGroup(ctx context.Context, actorID int, in model.SCIMGroup) (*model.SCIMGroup, error) {
+	name, err := validateSpaceName(in.DisplayName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidValue, err)
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	id := uuid.New().String()
+	if _, err := createSpace(ctx, tx, id, name, actorID); err != nil {
+		return nil, err
+	}
+	if err := s.saveGroup(ctx, tx, id, actorID, name, in); err != nil {
+		return nil, err
+	}
+	g, err := getSCIMGroup(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	return g, tx.Commit(ctx)
+}
+
+// ReplaceGroup перезаписывает название и состав группы (PUT). Новые участники получают роль
+// member, роли оставшихся не меняются; владельца пространства исключить нельзя — он остаётся.
+func (s *SCIMService) ReplaceGroup(ctx context.Context, id string, in model.SCIMGroup) (*model.SCIMGroup, error) {
+	name, err := validateSpaceName(in.DisplayName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSCIMInvalidValue, err)
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var ownerID int
+	err = tx.QueryRow(ctx, `SELECT owner_id FROM spaces WHERE id = $1 AND archived_at IS NULL FOR UPDATE`, id).Scan(&ownerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("group %q: %w", id, ErrSpaceNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveGroup(ctx, tx, id, ownerID, name, in); err != nil {
+		return nil, err
+	}
+	g, err := getSCIMGroup(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	return g, tx.Commit(ctx)
+}
+
+// saveGroup записывает название, externalId и состав участников.
+func (s *SCIMService) saveGroup(ctx context.Context, tx pgx.Tx, id string, ownerID int, name string, in model.SCIMGroup) error {
+	_, err := tx.Exec(ctx, `UPDATE spaces SET name = $2, external_id = NULLIF($3, '') WHERE id = $1`,
+		id, name, strings.TrimSpace(in.ExternalID))
+	if isUniqueViolation(err) {
+		return fmt.Errorf("group %q: %w", in.ExternalID, ErrSCIMConflict)
+	}
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(in.Members))
+	for _, m := range in.Members {
+		userID, err := strconv.Atoi(m.Value)
+		if err != nil {
+			return fmt.Errorf("%w: member %q", ErrSCIMInvalidValue, m.Value)
+		}
+		if !slices.Contains(ids, userID) {
+			ids = append(ids, userID)
+		}
+	}
+	var known int
+	if err := tx.QueryRow(ctx, `SELECT count(*) FROM users WHERE id = ANY($1)`, ids).Scan(&known); err != nil {
+		return err
+	}
+	if known != len(ids) {
+		return fmt.Errorf("%w: unknown member", ErrSCIMInvalidValue)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM space_memberships WHERE space_id = $1 AND user_id <> $2 AND NOT (user_id = ANY($3))
+	`, id, ownerID, ids); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO space_memberships (space_id, user_id, role)
+		SELECT $1, unnest($2::int[]), $3
+		ON CONFLICT (space_id, user_id) DO NOTHING
+	`, id, ids, RoleMember)
+	return err
+}
+
+// PatchGroup применяет операции PatchOp: чаще всего это add/remove участников.
+func (s *SCIMService) PatchGroup(ctx context.Context, id string, patch model.SCIMPatch) (*model.SCIMGroup, error) {
+	g, err := s.GetGroup(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range patch.Operations {
+		if err := applySCIMPatch(op, func(kind, path string, value json.RawMessage) error {
+			return patchGroupAttr(g, kind, path, value)
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return s.ReplaceGroup(ctx, id, *g)
+}
+
+var scimMemberPathRe = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+("(?:[^"\\]|\\.)*")\s*\]$`)
+
+func patchGroupAttr(g *model.SCIMGroup, kind, path string, value json.RawMessage) error {
+	remove := kind == "remove"
+	p := scimAttr(path, model.SCIMSchemaGroup)
+
+	switch {
+	case p == "displayname" && !remove:
+		name, err := scimString(value)
+		if err != nil {
+			return err
+		}
+		g.DisplayName = name
+	case p == "externalid":
+		g.ExternalID = ""
+		if !remove {
+			ext, err := scimString(value)
+			if err != nil {
+				return err
+			}
+			g.ExternalID = ext
+		}
+	case p == "members":
+		var members []model.SCIMMember
+		if len(value) > 0 && string(value) != "null" {
+			if err := json.Unmarshal(value, &members); err != nil {
+				return fmt.Errorf("%w: members must be an array", ErrSCIMInvalidValue)
+			}
+		}
+		switch {
+		case kind == "replace":
+			g.Members = members
+		case kind == "add":
+			g.Members = append(g.Members, members...)
+		case len(members) == 0:
+			g.Members = nil
+		default:
+			g.Members = slices.DeleteFunc(g.Members, func(m model.SCIMMember) bool {
+				return slices.ContainsFunc(members, func(r model.SCIMMember) bool { return r.Value == m.Value })
+			})
+		}
+	case remove && scimMemberPathRe.MatchString(p):
+		v, err := strconv.Unquote(scimMemberPathRe.FindStringSubmatch(p)[1])
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrSCIMInvalidPath, path)
+		}
+		g.Members = slices.DeleteFunc(g.Members, func(m model.SCIMMember) bool { return m.Value == v })
+	default:
+		return fmt.Errorf("%w: %s", ErrSCIMInvalidPath, path)
+	}
+	return nil
+}
+
+// ArchiveGroup — DELETE: пространство с задачами не удаляется, а архивируется и отвязывается от группы.
+func (s *SCIMService) ArchiveGroup(ctx context.Context, id string) error {
+	tag, err := s.dbPool.Exec(ctx, `
+		UPDATE spaces SET archived_at = now(), external_id = NULL WHERE id = $1 AND archived_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("group %q: %w", id, ErrSpaceNotFound)
+	}
+	return nil
+}
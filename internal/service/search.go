@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidSearch — пустой или слишком длинный запрос.
+var ErrInvalidSearch = errors.New("invalid search query")
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchQueryLen  = 200
+	// fuzzySnippetLen — длина сниппета описания в режиме fuzzy (без подсветки).
+	fuzzySnippetLen = 200
+)
+
+// Маркеры подсветки из ts_headline: управляющие символы не встречаются в тексте задач,
+// поэтому после экранирования HTML их можно безопасно заменить на <mark>.
+const (
+	markStart = "\x01"
+	markStop  = "\x02"
+)
+
+var headlineOptions = `StartSel="` + markStart + `", StopSel="` + markStop + `", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`
+
+// highlight экранирует текст и превращает маркеры ts_headline в <mark>.
+func highlight(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	return strings.ReplaceAll(s, markStop, "</mark>")
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+type SearchService struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewSearchService(dbPool *pgxpool.Pool) *SearchService {
+	return &SearchService{dbPool: dbPool}
+}
+
+// fullTextQuery ищет по search_vector задач и комментариев. Запрос разбирается
+// websearch_to_tsquery в обеих конфигурациях; из комментариев берётся лучший по рангу.
+// Подсветка строится конфигурацией russian: латиница в ней стеммится английским словарём.
+var fullTextQuery = `
+	WITH q AS (
+		SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS query
+	)
+	SELECT t.id::text, t.title, t.status, COALESCE(t.space, ''), t."dashboardID",
+	       ts_rank(t.search_vector, q.query) + COALESCE(c.rank, 0) * 0.5 AS rank,
+	       ts_headline('russian', t.title, q.query, $6),
+	       ts_headline('russian', t.description, q.query, $6),
+	       c.id,
+	       ts_headline('russian', c.body, q.query, $6)
+	FROM tasks t
+	CROSS JOIN q
+	LEFT JOIN LATERAL (
+		SELECT tc.id::text AS id, tc.body, ts_rank(tc.search_vector, q.query) AS rank
+		FROM task_comments tc
+		WHERE tc.task_id = t.id AND tc.deleted_at IS NULL AND tc.search_vector @@ q.query
+		ORDER BY rank DESC
+		LIMIT 1
+	) c ON true
+	WHERE t.deleted_at IS NULL
+	  AND t.space IN (` + memberSpacesSQL("$2") + `)
+	  AND ($3 = '' OR t.space = $3)
+	  AND (t.search_vector @@ q.query OR c.id IS NOT NULL)
+	ORDER BY rank DESC, t.updated_at DESC, t.id
+	LIMIT $4 OFFSET $5
+`
+
+// fuzzyQuery — запасной поиск по триграммам: находит части слов и слова с опечатками.
+var fuzzyQuery = `
+	SELECT t.id::text, t.title, t.status, COALESCE(t.space, ''), t."dashboardID",
+	       GREATEST(word_similarity($1, t.title), word_similarity($1, t.description)) AS rank,
+	       t.title, t.description
+	FROM tasks t
+	WHERE t.deleted_at IS NULL
+	  AND t.space IN (` + memberSpacesSQL("$2") + `)
+	  AND ($3 = '' OR t.space = $3)
+	  AND ($1 <% t.title OR $1 <% t.description)
+	ORDER BY rank DESC, t.updated_at DESC, t.id
+	LIMIT $4 OFFSET $5
+`
+
+// Search ищет задачи в пространствах пользователя (или в одном spaceID). Режим выбирается
+// один раз на запрос: без mode — полнотекстовый, если он находит что-то с начала выдачи, иначе
+// по триграммам. Выбранный режим возвращается в ответе; следующие страницы запрашиваются с ним,
+// чтобы выдача не переключалась между режимами на середине.
+func (s *SearchService) Search(ctx context.Context, userID int, query, spaceID, mode string, limit, offset int) (*model.TaskSearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: query is required", ErrInvalidSearch)
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLen {
+		return nil, fmt.Errorf("%w: query is longer than %d characters", ErrInvalidSearch, maxSearchQueryLen)
+	}
+	switch mode {
+	case "", model.SearchModeFullText, model.SearchModeFuzzy:
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidSearch, mode)
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	result := &model.TaskSearchResult{Query: query, Mode: mode, Items: []model.TaskSearchHit{}}
+	if result.Mode == "" {
+		result.Mode = model.SearchModeFullText
+	}
+	spaceID, ok, err := scopedSpace(ctx, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return result, nil
+	}
+
+	var hits []model.TaskSearchHit
+	if mode != model.SearchModeFuzzy {
+		if hits, err = s.fullText(ctx, userID, query, spaceID, limit, offset); err != nil {
+			return nil, err
+		}
+		if mode == "" {
+			found := len(hits) > 0
+			if !found && offset > 0 {
+				// пустая не первая страница ещё не значит, что полнотекстовый поиск ничего не нашёл
+				probe, err := s.fullText(ctx, userID, query, spaceID, 1, 0)
+				if err != nil {
+					return nil, err
+				}
+				found = len(probe) > 0
+			}
+			if !found {
+				result.Mode = model.SearchModeFuzzy
+			}
+		}
+	}
+	if result.Mode == model.SearchModeFuzzy {
+		if hits, err = s.fuzzy(ctx, userID, query, spaceID, limit, offset); err != nil {
+			return nil, err
+		}
+	}
+	result.Items = hits
+	return result, nil
+}
+
+func (s *SearchService) fullText(ctx context.Context, userID int, query, spaceID string, limit, offset int) ([]model.TaskSearchHit, error) {
+	rows, err := s.dbPool.Query(ctx, fullTextQuery, query, userID, spaceID, limit, offset, headlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.TaskSearchHit, error) {
+		var h model.TaskSearchHit
+		err := row.Scan(&h.ID, &h.Title, &h.Status, &h.Space, &h.DashboardID, &h.Rank,
+			&h.TitleSnippet, &h.Snippet, &h.CommentID, &h.CommentSnippet)
+		h.TitleSnippet = highlight(h.TitleSnippet)
+		h.Snippet = highlight(h.Snippet)
+		if h.CommentSnippet != nil {
+			v := highlight(*h.CommentSnippet)
+			h.CommentSnippet = &v
+		}
+		return h, err
+	})
+}
+
+func (s *SearchService) fuzzy(ctx context.Context, userID int, query, spaceID string, limit, offset int) ([]model.TaskSearchHit, error) {
+	rows, err := s.dbPool.Query(ctx, fuzzyQuery, query, userID, spaceID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.TaskSearchHit, error) {
+		var h model.TaskSearchHit
+		err := row.Scan(&h.ID, &h.Title, &h.Status, &h.Space, &h.DashboardID, &h.Rank, &h.TitleSnippet, &h.Snippet)
+		h.TitleSnippet = html.EscapeString(h.TitleSnippet)
+		h.Snippet = html.EscapeString(truncateRunes(h.Snippet, fuzzySnippetLen))
+		return h, err
+	})
+}
@@ -0,0 +1,58 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+)
+
+func TestSearchModeIsKeptAcrossPages(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	owner := testutil.User(t, db, service.SystemRoleUser)
+	spaceID := testutil.Space(t, db, owner)
+	spaces := service.NewSpaceService(db, nil)
+	tasks := service.NewTaskService(db, spaces, service.NewWorkflowService(db), service.NewEventBus())
+	for i := range 3 {
+		if _, err := tasks.CreateTask(ctx, model.Task{
+			Title:      "Авторизация пользователей " + strconv.Itoa(i),
+			ReporterID: strconv.Itoa(owner),
+			ApproverID: strconv.Itoa(owner),
+			Space:      &spaceID,
+		}, owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	search := service.NewSearchService(db)
+
+	// часть слова полнотекстовый поиск не находит — сработает поиск по триграммам
+	page := func(mode string, offset int) *model.TaskSearchResult {
+		t.Helper()
+		res, err := search.Search(ctx, owner, "авториз", spaceID, mode, 2, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res := page("", 0); res.Mode != model.SearchModeFuzzy || len(res.Items) != 2 {
+		t.Errorf("first page: mode %s, %d items; want fuzzy, 2", res.Mode, len(res.Items))
+	}
+	if res := page("", 2); res.Mode != model.SearchModeFuzzy || len(res.Items) != 1 {
+		t.Errorf("second page without mode: mode %s, %d items; want fuzzy, 1", res.Mode, len(res.Items))
+	}
+	if res := page(model.SearchModeFuzzy, 2); res.Mode != model.SearchModeFuzzy || len(res.Items) != 1 {
+		t.Errorf("second page in fuzzy mode: mode %s, %d items; want fuzzy, 1", res.Mode, len(res.Items))
+	}
+	if res := page(model.SearchModeFullText, 0); res.Mode != model.SearchModeFullText || len(res.Items) != 0 {
+		t.Errorf("explicit fulltext: mode %s, %d items; want fulltext, 0", res.Mode, len(res.Items))
+	}
+
+	if _, err := search.Search(ctx, owner, "авториз", spaceID, "regex", 2, 0); !errors.Is(err, service.ErrInvalidSearch) {
+		t.Errorf("unknown mode: err = %v, want ErrInvalidSearch", err)
+	}
+}
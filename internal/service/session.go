@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidRefreshToken — refresh-токен не найден или сессия истекла.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused — предъявлен уже обменянный refresh-токен; сессия отозвана целиком.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+	// ErrSessionRevoked — сессия токена отозвана или истекла.
+	ErrSessionRevoked = errors.New("session revoked")
+	// ErrSessionNotFound — у пользователя нет такой активной сессии.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Причины отзыва сессии.
+const (
+	RevokeLogout         = "logout"
+	RevokeByUser         = "revoked"
+	RevokeRefreshReuse   = "refresh_reuse"
+	RevokePasswordChange = "password_change"
+	RevokePasswordReset  = "password_reset"
+)
+
+// maxClientField — длина, до которой обрезаются device и user agent.
+const maxClientField = 255
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// startSession создаёт сессию и выдаёт первую пару токенов. Заодно удаляет давно
+// истёкшие и отозванные сессии пользователя.
+func (s *IdentityService) startSession(ctx context.Context, userID, roleID int, client model.ClientInfo) (*model.TokenPair, error) {
+	if client.Device == "" {
+		client.Device = client.UserAgent
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND (expires_at < now() - interval '30 days' OR revoked_at < now() - interval '30 days')
+	`, userID); err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(s.refreshTTL)
+	var sessionID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, device, ip, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id::text
+	`, userID, truncate(client.Device, maxClientField), client.IP, truncate(client.UserAgent, maxClientField), expires).Scan(&sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := s.issueTokens(ctx, tx, sessionID, userID, roleID, expires)
+	if err != nil {
+		return nil, err
+	}
+	return pair, tx.Commit(ctx)
+}
+
+// issueTokens записывает новый refresh-токен сессии и подписывает access-токен с её id (sid).
+func (s *IdentityService) issueTokens(ctx context.Context, tx pgx.Tx, sessionID string, userID, roleID int, refreshExpires time.Time) (*model.TokenPair, error) {
+	refresh, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1, $2)`, hash, sessionID); err != nil {
+		return nil, err
+	}
+
+	exp := time.Now().Add(s.accessTTL)
+	access, err := s.keys.Sign(jwt.MapClaims{
+		"sub":  userID,
+		"role": roleID,
+		"sid":  sessionID,
+		"exp":  exp.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TokenPair{
+		AccessToken:      access,
+		ExpiresAt:        exp,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpires,
+		SessionID:        sessionID,
+	}, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару (ротация): старый токен помечается использованным,
+// сессия продлевается. Повторное предъявление использованного токена означает, что его украли, —
+// сессия отзывается целиком, вместе со всеми её токенами.
+func (s *IdentityService) Refresh(ctx context.Context, refreshToken string, client model.ClientInfo) (*model.TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var (
+		sessionID      string
+		userID, roleID int
+		usedAt         *time.Time
+		revoked        bool
+		expiresAt      time.Time
+	)
+	hash := hashToken(refreshToken)
+	err = tx.QueryRow(ctx, `
+		SELECT se.id::text, se.user_id, u.roleid, rt.used_at, se.revoked_at IS NOT NULL, se.expires_at
+		FROM refresh_tokens rt
+		JOIN sessions se ON se.id = rt.session_id
+		JOIN users u ON u.id = se.user_id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, se
+	`, hash).Scan(&sessionID, &userID, &roleID, &usedAt, &revoked, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("session %s: %w", sessionID, ErrSessionRevoked)
+	}
+	if usedAt != nil {
+		if _, err := revokeSessions(ctx, tx, `id::text = $1`, RevokeRefreshReuse, sessionID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		slog.Warn("Refresh token reuse detected, session revoked", "sessionID", sessionID, "userID", userID, "ip", client.IP)
+		return nil, fmt.Errorf("session %s: %w", sessionID, ErrRefreshTokenReused)
+	}
+	if !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("session %s expired: %w", sessionID, ErrInvalidRefreshToken)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE token_hash = $1`, hash); err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(s.refreshTTL)
+	if _, err := tx.Exec(ctx, `
+		UPDATE sessions SET last_used_at = now(), expires_at = $2, ip = $3, user_agent = $4 WHERE id::text = $1
+	`, sessionID, expires, client.IP, truncate(client.UserAgent, maxClientField)); err != nil {
+		return nil, err
+	}
+
+	pair, err := s.issueTokens(ctx, tx, sessionID, userID, roleID, expires)
+	if err != nil {
+		return nil, err
+	}
+	return pair, tx.Commit(ctx)
+}
+
+// Authenticate проверяет access-токен и то, что его сессия не отозвана и не истекла.
+func (s *IdentityService) Authenticate(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims == nil {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	sid, ok := claims["sid"].(string)
+	if !ok || sid == "" {
+		return nil, fmt.Errorf("token without session: %w", ErrSessionRevoked)
+	}
+
+	var active bool
+	if err := s.dbPool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM sessions WHERE id::text = $1 AND revoked_at IS NULL AND expires_at > now())
+	`, sid).Scan(&active); err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, fmt.Errorf("session %s: %w", sid, ErrSessionRevoked)
+	}
+	return claims, nil
+}
+
+// Logout отзывает сессию, найденную по refresh-токену или, если его нет, по access-токену
+// (в том числе истёкшему). Неизвестные токены молча игнорируются.
+func (s *IdentityService) Logout(ctx context.Context, accessToken, refreshToken string) error {
+	if refreshToken != "" {
+		_, err := revokeSessions(ctx, s.dbPool, `id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1)`,
+			RevokeLogout, hashToken(refreshToken))
+		return err
+	}
+	if accessToken == "" {
+		return nil
+	}
+	// подпись проверяется, срок — нет: выйти можно и с истёкшим токеном
+	claims, err := s.keys.Parse(accessToken, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil
+	}
+	if sid, ok := claims["sid"].(string); ok && sid != "" {
+		_, err = revokeSessions(ctx, s.dbPool, `id::text = $1`, RevokeLogout, sid)
+	}
+	return err
+}
+
+// ListSessions возвращает активные сессии пользователя; currentID отмечает текущую.
+func (s *IdentityService) ListSessions(ctx context.Context, userID int, currentID string) ([]model.Session, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT id::text, device, ip, user_agent, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var se model.Session
+		if err := rows.Scan(&se.ID, &se.Device, &se.IP, &se.UserAgent, &se.CreatedAt, &se.LastUsedAt, &se.ExpiresAt); err != nil {
+			return nil, err
+		}
+		se.Current = se.ID == currentID
+		sessions = append(sessions, se)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession отзывает одну активную сессию пользователя.
+func (s *IdentityService) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
+	}
+	n, err := revokeSessions(ctx, s.dbPool, `id::text = $1 AND user_id = $2`, RevokeByUser, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("session %s: %w", sessionID, ErrSessionNotFound)
+	}
+	return nil
+}
+
+// RevokeAllSessions отзывает все сессии пользователя, кроме exceptID (пустой — все).
+// Вызывается при смене пароля и по запросу пользователя. Возвращает число отозванных сессий.
+func (s *IdentityService) RevokeAllSessions(ctx context.Context, userID int, exceptID, reason string) (int, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return 0, err
+	}
+	return revokeSessions(ctx, s.dbPool, `user_id = $1 AND id::text <> $2`, reason, userID, exceptID)
+}
+
+// revokeSessions отзывает активные сессии по условию where; аргументы условия начинаются с $1.
+func revokeSessions(ctx context.Context, e execer, where, reason string, args ...any) (int, error) {
+	reasonArg := fmt.Sprintf("$%d", len(args)+1)
+	tag, err := e.Exec(ctx, `
+		UPDATE sessions SET revoked_at = now(), revoke_reason = `+reasonArg+`
+		WHERE revoked_at IS NULL AND `+where, append(args, reason)...)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
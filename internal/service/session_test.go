@@ -0,0 +1,48 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"tasker/internal/service"
+)
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	f := newIdentityFixture(t)
+	ctx := context.Background()
+	first := f.login(t).Tokens
+
+	second, err := f.identity.Refresh(ctx, first.RefreshToken, f.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.SessionID != first.SessionID || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("rotation: session %s → %s, refresh token changed = %v",
+			first.SessionID, second.SessionID, second.RefreshToken != first.RefreshToken)
+	}
+	if _, err := f.identity.Authenticate(ctx, second.AccessToken); err != nil {
+		t.Fatalf("access token after rotation: %v", err)
+	}
+
+	// старый токен предъявлен повторно — его украли: сессия отзывается целиком
+	if _, err := f.identity.Refresh(ctx, first.RefreshToken, f.client); !errors.Is(err, service.ErrRefreshTokenReused) {
+		t.Fatalf("replayed refresh token: err = %v, want ErrRefreshTokenReused", err)
+	}
+	var reason *string
+	if err := f.db.QueryRow(ctx, `SELECT revoke_reason FROM sessions WHERE id::text = $1 AND revoked_at IS NOT NULL`,
+		first.SessionID).Scan(&reason); err != nil {
+		t.Fatalf("session is not revoked: %v", err)
+	}
+	if reason == nil || *reason != service.RevokeRefreshReuse {
+		t.Errorf("revoke reason = %v, want %q", reason, service.RevokeRefreshReuse)
+	}
+
+	// вместе с ней перестают работать и токены, выданные после ротации
+	if _, err := f.identity.Refresh(ctx, second.RefreshToken, f.client); !errors.Is(err, service.ErrSessionRevoked) {
+		t.Errorf("refresh token of the revoked session: err = %v, want ErrSessionRevoked", err)
+	}
+	if _, err := f.identity.Authenticate(ctx, second.AccessToken); !errors.Is(err, service.ErrSessionRevoked) {
+		t.Errorf("access token of the revoked session: err = %v, want ErrSessionRevoked", err)
+	}
+}
@@ -3,25 +3,67 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"tasker/internal/model"
+	"tasker/internal/storage"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrSpaceNotFound возвращается, если пространства нет.
+var ErrSpaceNotFound = errors.New("space not found")
+
+// ErrInvalidRole — неизвестная роль или роль не той области.
+var ErrInvalidRole = errors.New("invalid role")
+
+var (
+	// ErrMemberNotFound — пользователь не участник пространства.
+	ErrMemberNotFound = errors.New("space member not found")
+	// ErrOwnerMembership — владельца нельзя удалить из пространства или понизить; сначала нужно передать владение.
+	ErrOwnerMembership = errors.New("space owner must stay an admin, transfer ownership first")
+	// ErrSpaceNotArchived — удалить можно только архивное пространство.
+	ErrSpaceNotArchived = errors.New("space must be archived before deletion")
+	// ErrInvalidSpace — пустое или слишком длинное название.
+	ErrInvalidSpace = errors.New("invalid space")
+	// ErrLDAPGroupTaken — группа каталога уже привязана к другому пространству.
+	ErrLDAPGroupTaken = errors.New("LDAP group is already linked to another space")
+)
+
+const maxSpaceNameLen = 200
+
 type SpaceService struct {
 	dbPool *pgxpool.Pool
+	blobs  storage.BlobStore
 }
 
-func NewSpaceService(dbPool *pgxpool.Pool) *SpaceService {
-	return &SpaceService{dbPool: dbPool}
+// NewSpaceService принимает хранилище вложений, чтобы при удалении пространства удалять их содержимое.
+func NewSpaceService(dbPool *pgxpool.Pool, blobs storage.BlobStore) *SpaceService {
+	return &SpaceService{dbPool: dbPool, blobs: blobs}
+}
+
+func validateSpaceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrInvalidSpace)
+	}
+	if len([]rune(name)) > maxSpaceNameLen {
+		return "", fmt.Errorf("%w: name is longer than %d characters", ErrInvalidSpace, maxSpaceNameLen)
+	}
+	return name, nil
 }
 
 // CreateSpace создаёт запись в spaces и добавляет создателя в space_memberships (в транзакции).
 func (s *SpaceService) CreateSpace(ctx context.Context, name string, creatorID int) (model.Space, error) {
+	name, err := validateSpaceName(name)
+	if err != nil {
+		return model.Space{}, err
+	}
 	id := uuid.New().String()
 	// Acquire соединение из пула и начинаем транзакцию
 	conn, err := s.dbPool.Acquire(ctx)
@@ -39,35 +81,433 @@ func (s *SpaceService) CreateSpace(ctx context.Context, name string, creatorID i
 		_ = tx.Rollback(ctx)
 	}()
 
-	q1 := `INSERT INTO spaces (id, name, creator_id) VALUES ($1, $2, $3)`
-	if _, err := tx.Exec(ctx, q1, id, name, creatorID); err != nil {
+	createdAt, err := createSpace(ctx, tx, id, name, creatorID)
+	if err != nil {
+		return model.Space{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return model.Space{}, err
 	}
 
+	return model.Space{ID: id, Name: name, CreatorID: creatorID, OwnerID: creatorID, CreatedAt: createdAt}, nil
+}
+
+// createSpace добавляет пространство и его создателя (владельца с ролью admin) в транзакции tx.
+func createSpace(ctx context.Context, tx pgx.Tx, id, name string, creatorID int) (time.Time, error) {
+	var createdAt time.Time
+	q1 := `INSERT INTO spaces (id, name, creator_id, owner_id) VALUES ($1, $2, $3, $3) RETURNING created_at`
+	if err := tx.QueryRow(ctx, q1, id, name, creatorID).Scan(&createdAt); err != nil {
+		return time.Time{}, err
+	}
+
 	q2 := `INSERT INTO space_memberships (space_id, user_id, role) VALUES ($1,$2,'admin')`
 	if _, err := tx.Exec(ctx, q2, id, creatorID); err != nil {
-		return model.Space{}, err
+		return time.Time{}, err
+	}
+	return createdAt, nil
+}
+
+// SetMemberRole меняет роль участника пространства. Нужно право space.invite; без space.manage
+// и новая, и прежняя роль участника не должны давать прав сверх прав самого actorID.
+// Роль владельца менять нельзя — он всегда admin. Новые участники приходят через приглашения.
+func (s *SpaceService) SetMemberRole(ctx context.Context, spaceID string, actorID, userID int, role string) error {
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceInvite, spaceID); err != nil {
+		return err
+	}
+	if err := checkAssignableRole(ctx, s.dbPool, actorID, spaceID, role); err != nil {
+		return err
+	}
+	var current string
+	err := s.dbPool.QueryRow(ctx, `SELECT role FROM space_memberships WHERE space_id = $1 AND user_id = $2`,
+		spaceID, userID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("user %d in space %s: %w", userID, spaceID, ErrMemberNotFound)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkAssignableRole(ctx, s.dbPool, actorID, spaceID, current); err != nil {
+		return err
+	}
+	ownerID, err := s.ownerOf(ctx, s.dbPool, spaceID)
+	if err != nil {
+		return err
+	}
+	if userID == ownerID && role != RoleAdmin {
+		return fmt.Errorf("user %d: %w", userID, ErrOwnerMembership)
+	}
+	tag, err := s.dbPool.Exec(ctx, `UPDATE space_memberships SET role = $3 WHERE space_id = $1 AND user_id = $2`,
+		spaceID, userID, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %d in space %s: %w", userID, spaceID, ErrMemberNotFound)
+	}
+	return nil
+}
+
+// checkSpaceRole проверяет, что роль пространства с таким именем существует.
+func checkSpaceRole(ctx context.Context, q queryer, role string) error {
+	var exists bool
+	if err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE scope = 'space' AND name = $1)`, role).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: unknown space role %q", ErrInvalidRole, role)
+	}
+	return nil
+}
+
+// checkAssignableRole проверяет, что роль существует и actorID может её выдать: с правом space.manage —
+// любую, иначе только роль, все права которой есть у него самого (по роли в пространстве или системной).
+// Так участник с одним space.invite не выдаст admin ни себе через приглашение, ни другому.
+func checkAssignableRole(ctx context.Context, q queryer, actorID int, spaceID, role string) error {
+	if err := checkSpaceRole(ctx, q, role); err != nil {
+		return err
+	}
+	manage, err := can(ctx, q, actorID, PermSpaceManage, spaceID)
+	if err != nil || manage {
+		return err
+	}
+	var exceeds bool
+	err = q.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT unnest(permissions) FROM roles WHERE scope = 'space' AND name = $3
+			EXCEPT
+			SELECT unnest(r.permissions) FROM space_memberships m
+			JOIN roles r ON r.scope = 'space' AND r.name = m.role
+			WHERE m.space_id = $2 AND m.user_id = $1
+			EXCEPT
+			SELECT unnest(r.permissions) FROM users u JOIN roles r ON r.id = u.roleid WHERE u.id = $1
+		)
+	`, actorID, spaceID, role).Scan(&exceeds)
+	if err != nil {
+		return err
+	}
+	if exceeds {
+		return fmt.Errorf("role %s grants more than the actor has: %w", role, ErrForbidden)
+	}
+	return nil
+}
+
+// ownerOf возвращает владельца пространства.
+func (s *SpaceService) ownerOf(ctx context.Context, q queryer, spaceID string) (int, error) {
+	var ownerID int
+	err := q.QueryRow(ctx, `SELECT owner_id FROM spaces WHERE id = $1`, spaceID).Scan(&ownerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+	}
+	return ownerID, err
+}
+
+// ListSpaces возвращает пространства, где состоит пользователь, с его ролью,
+// числом участников и задач (без корзины). Архивные пространства тоже попадают в список.
+func (s *SpaceService) ListSpaces(ctx context.Context, userID int) ([]model.SpaceSummary, error) {
+	spaceID, _, err := scopedSpace(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT s.id, s.name, s.creator_id, s.owner_id, s.created_at, s.archived_at, s.require_2fa, s.ldap_group, m.role,
+			(SELECT COUNT(*) FROM space_memberships sm WHERE sm.space_id = s.id),
+			(SELECT COUNT(*) FROM tasks t WHERE t.space = s.id AND t.deleted_at IS NULL)
+		FROM space_memberships m
+		JOIN spaces s ON s.id = m.space_id
+		WHERE m.user_id = $1 AND ($2 = '' OR s.id = $2)
+		ORDER BY s.archived_at IS NOT NULL, s.name
+	`, userID, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spaces := []model.SpaceSummary{}
+	for rows.Next() {
+		var sp model.SpaceSummary
+		if err := rows.Scan(&sp.ID, &sp.Name, &sp.CreatorID, &sp.OwnerID, &sp.CreatedAt, &sp.ArchivedAt, &sp.Require2FA, &sp.LDAPGroup,
+			&sp.Role, &sp.MemberCount, &sp.TaskCount); err != nil {
+			return nil, err
+		}
+		spaces = append(spaces, sp)
+	}
+	return spaces, rows.Err()
+}
+
+// GetSpace возвращает пространство с участниками. Нужно право task.read.
+func (s *SpaceService) GetSpace(ctx context.Context, spaceID string, actorID int) (*model.SpaceDetails, error) {
+	role, err := authorize(ctx, s.dbPool, actorID, PermTaskRead, spaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := model.SpaceDetails{Role: role, Members: []model.SpaceMember{}}
+	err = s.dbPool.QueryRow(ctx, `
+		SELECT id, name, creator_id, owner_id, created_at, archived_at, require_2fa, ldap_group FROM spaces WHERE id = $1
+	`, spaceID).Scan(&d.ID, &d.Name, &d.CreatorID, &d.OwnerID, &d.CreatedAt, &d.ArchivedAt, &d.Require2FA, &d.LDAPGroup)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+		}
+		return nil, err
+	}
+
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT u.id, u.login, u.name, u.surname, m.role, m.joined_at, m.invited_by,
+			EXISTS (SELECT 1 FROM user_totp t WHERE t.user_id = u.id AND t.confirmed_at IS NOT NULL),
+			u.deactivated_at IS NOT NULL
+		FROM space_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.space_id = $1
+		ORDER BY m.joined_at, u.id
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m model.SpaceMember
+		if err := rows.Scan(&m.UserID, &m.Login, &m.Name, &m.Surname, &m.Role, &m.JoinedAt, &m.InvitedBy, &m.TwoFactor, &m.Deactivated); err != nil {
+			return nil, err
+		}
+		d.Members = append(d.Members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// RenameSpace меняет название пространства. Нужно право space.manage.
+func (s *SpaceService) RenameSpace(ctx context.Context, spaceID string, actorID int, name string) error {
+	name, err := validateSpaceName(name)
+	if err != nil {
+		return err
+	}
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceManage, spaceID); err != nil {
+		return err
+	}
+	tag, err := s.dbPool.Exec(ctx, `UPDATE spaces SET name = $2 WHERE id = $1`, spaceID, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+	}
+	return nil
+}
+
+// SetArchived архивирует или возвращает пространство из архива. Нужно право space.manage.
+// В архивном пространстве задачи только читаются (см. archiveAllows).
+func (s *SpaceService) SetArchived(ctx context.Context, spaceID string, actorID int, archived bool) error {
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceManage, spaceID); err != nil {
+		return err
+	}
+	q := `UPDATE spaces SET archived_at = NULL WHERE id = $1`
+	if archived {
+		q = `UPDATE spaces SET archived_at = COALESCE(archived_at, now()) WHERE id = $1`
+	}
+	tag, err := s.dbPool.Exec(ctx, q, spaceID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+	}
+	return nil
+}
+
+// SetRequireTwoFactor включает или снимает требование 2FA для участников. Нужно право space.manage;
+// включить требование может только пользователь с включённой 2FA, чтобы не потерять доступ самому.
+// Участники без 2FA теряют доступ к пространству, пока её не включат.
+func (s *SpaceService) SetRequireTwoFactor(ctx context.Context, spaceID string, actorID int, required bool) error {
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceManage, spaceID); err != nil {
+		return err
+	}
+	if required {
+		var enabled bool
+		if err := s.dbPool.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)
+		`, actorID).Scan(&enabled); err != nil {
+			return err
+		}
+		if !enabled {
+			return fmt.Errorf("enable two-factor authentication before requiring it: %w", ErrTwoFactorNotEnabled)
+		}
+	}
+	tag, err := s.dbPool.Exec(ctx, `UPDATE spaces SET require_2fa = $2 WHERE id = $1`, spaceID, required)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+	}
+	return nil
+}
+
+// SetLDAPGroup привязывает пространство к группе каталога LDAP (DN) или, если group пустой,
+// отвязывает. Состав пространства обновляется при входе участников через LDAP, см. LDAPService.
+// Привязка раздаёт членство любому участнику группы, поэтому нужно системное право user.manage,
+// как для провизионирования через SCIM.
+func (s *SpaceService) SetLDAPGroup(ctx context.Context, spaceID string, actorID int, group string) error {
+	if _, err := authorize(ctx, s.dbPool, actorID, PermUserManage, ""); err != nil {
+		return err
+	}
+	var dn *string
+	if group = strings.TrimSpace(group); group != "" {
+		normalized, err := normalizeDN(group)
+		if err != nil {
+			return fmt.Errorf("%w: invalid LDAP group DN %q", ErrInvalidSpace, group)
+		}
+		dn = &normalized
+	}
+	tag, err := s.dbPool.Exec(ctx, `UPDATE spaces SET ldap_group = $2 WHERE id = $1`, spaceID, dn)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("group %q: %w", group, ErrLDAPGroupTaken)
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+	}
+	return nil
+}
+
+// DeleteSpace окончательно удаляет пространство. Удалить может только владелец и только
+// архивное пространство. Задачи пространства (в том числе из корзины) удаляются вместе с
+// комментариями и вложениями, история задач остаётся.
+func (s *SpaceService) DeleteSpace(ctx context.Context, spaceID string, actorID int) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var ownerID int
+	var archived bool
+	err = tx.QueryRow(ctx, `SELECT owner_id, archived_at IS NOT NULL FROM spaces WHERE id = $1 FOR UPDATE`, spaceID).
+		Scan(&ownerID, &archived)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+		}
+		return err
+	}
+	if ownerID != actorID {
+		if _, err := authorize(ctx, tx, actorID, PermTaskRead, spaceID); err != nil {
+			return err
+		}
+		return fmt.Errorf("only the owner can delete space %s: %w", spaceID, ErrForbidden)
+	}
+	if !archived {
+		return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotArchived)
 	}
 
+	// ключи вложений собираем до удаления: строки attachments уйдут каскадом
+	rows, err := tx.Query(ctx, `SELECT storage_key FROM attachments WHERE space_id = $1`, spaceID)
+	if err != nil {
+		return err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+
+	// у tasks.space нет FK, поэтому задачи удаляем явно
+	if _, err := tx.Exec(ctx, `DELETE FROM tasks WHERE space = $1`, spaceID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM spaces WHERE id = $1`, spaceID); err != nil {
+		return err
+	}
 	if err := tx.Commit(ctx); err != nil {
-		return model.Space{}, err
+		return err
+	}
+
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			slog.Error("Failed to delete attachment blob", "key", key, "error", err)
+		}
+	}
+	return nil
+}
+
+// RemoveMember исключает участника из пространства. Нужно право space.invite; владельца исключить нельзя.
+func (s *SpaceService) RemoveMember(ctx context.Context, spaceID string, actorID, userID int) error {
+	if _, err := authorize(ctx, s.dbPool, actorID, PermSpaceInvite, spaceID); err != nil {
+		return err
+	}
+	return s.removeMember(ctx, spaceID, userID)
+}
+
+// LeaveSpace — пользователь сам выходит из пространства. Владелец должен сначала передать владение.
+func (s *SpaceService) LeaveSpace(ctx context.Context, spaceID string, userID int) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
 	}
+	return s.removeMember(ctx, spaceID, userID)
+}
 
-	return model.Space{ID: id, Name: name, CreatorID: creatorID, CreatedAt: time.Now()}, nil
+func (s *SpaceService) removeMember(ctx context.Context, spaceID string, userID int) error {
+	ownerID, err := s.ownerOf(ctx, s.dbPool, spaceID)
+	if err != nil {
+		return err
+	}
+	if userID == ownerID {
+		return fmt.Errorf("user %d: %w", userID, ErrOwnerMembership)
+	}
+	tag, err := s.dbPool.Exec(ctx, `DELETE FROM space_memberships WHERE space_id = $1 AND user_id = $2`, spaceID, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %d in space %s: %w", userID, spaceID, ErrMemberNotFound)
+	}
+	return nil
 }
 
-// AddMember добавляет/обновляет членство (invite / set role)
-func (s *SpaceService) AddMember(ctx context.Context, spaceID string, userID int, role string) error {
-	if role == "" {
-		role = "member"
+// TransferOwnership передаёт владение другому участнику, который становится admin.
+// Передать может только текущий владелец; его собственная роль не меняется.
+func (s *SpaceService) TransferOwnership(ctx context.Context, spaceID string, actorID, newOwnerID int) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var ownerID int
+	err = tx.QueryRow(ctx, `SELECT owner_id FROM spaces WHERE id = $1 FOR UPDATE`, spaceID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("space %s: %w", spaceID, ErrSpaceNotFound)
+		}
+		return err
+	}
+	if ownerID != actorID {
+		if _, err := authorize(ctx, tx, actorID, PermTaskRead, spaceID); err != nil {
+			return err
+		}
+		return fmt.Errorf("only the owner can transfer space %s: %w", spaceID, ErrForbidden)
+	}
+
+	tag, err := tx.Exec(ctx, `UPDATE space_memberships SET role = $3 WHERE space_id = $1 AND user_id = $2`,
+		spaceID, newOwnerID, RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %d in space %s: %w", newOwnerID, spaceID, ErrMemberNotFound)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE spaces SET owner_id = $2 WHERE id = $1`, spaceID, newOwnerID); err != nil {
+		return err
 	}
-	q := `
-		INSERT INTO space_memberships (space_id, user_id, role)
-		VALUES ($1,$2,$3)
-		ON CONFLICT (space_id,user_id) DO UPDATE SET role = EXCLUDED.role
-	`
-	_, err := s.dbPool.Exec(ctx, q, spaceID, userID, role)
-	return err
+	return tx.Commit(ctx)
 }
 
 // IsMember проверяет есть ли пользователь в пространстве и возвращает роль.
@@ -14,17 +14,53 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	// ErrTaskNotFound возвращается, если задачи с указанным id нет.
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskBlocked — задачу нельзя завершить, пока у неё есть блокеры.
+	ErrTaskBlocked = errors.New("task is blocked")
+	// ErrApprovalRequired — задачу нельзя завершить без одобрения.
+	ErrApprovalRequired = errors.New("task needs approval")
+	// ErrInvalidApproveStatus — approveStatus нельзя выставить напрямую, только через одобрение.
+	ErrInvalidApproveStatus = errors.New("invalid approve status")
+)
+
 type TaskService struct {
-	dbPool *pgxpool.Pool
-	spaces *SpaceService
+	dbPool    *pgxpool.Pool
+	spaces    *SpaceService
+	workflows *WorkflowService
+	events    *EventBus
 }
 
-// NewTaskService принимает пул и инстанс SpaceService (для проверки членства).
-func NewTaskService(dbPool *pgxpool.Pool, spaces *SpaceService) *TaskService {
-	return &TaskService{dbPool: dbPool, spaces: spaces}
+// NewTaskService принимает пул, SpaceService (для проверки членства),
+// WorkflowService (для проверки переходов статусов) и шину событий.
+func NewTaskService(dbPool *pgxpool.Pool, spaces *SpaceService, workflows *WorkflowService, events *EventBus) *TaskService {
+	return &TaskService{dbPool: dbPool, spaces: spaces, workflows: workflows, events: events}
 }
 
-func (s *TaskService) CreateTask(ctx context.Context, task model.Task) (*model.Task, error) {
+// applyStatusStamps проставляет started_At/done_at в зависимости от категории нового статуса.
+// Возвращает новые значения; nil для done_at означает «очистить».
+func applyStatusStamps(target model.WorkflowStatus, startedAt, doneAt *time.Time, now time.Time) (*time.Time, *time.Time) {
+	switch target.Category {
+	case model.StatusCategoryInProgress:
+		if startedAt == nil {
+			startedAt = &now
+		}
+		doneAt = nil
+	case model.StatusCategoryDone:
+		if startedAt == nil {
+			startedAt = &now
+		}
+		if doneAt == nil {
+			doneAt = &now
+		}
+	default:
+		doneAt = nil
+	}
+	return startedAt, doneAt
+}
+
+func (s *TaskService) CreateTask(ctx context.Context, task model.Task, actorID int) (*model.Task, error) {
 	// валидация поля space
 	if task.Space == nil || *task.Space == "" {
 		return nil, fmt.Errorf("space cannot be empty")
@@ -43,9 +79,30 @@ func (s *TaskService) CreateTask(ctx context.Context, task model.Task) (*model.T
 		return nil, fmt.Errorf("reporter is not a member of the space")
 	}
 
-	// статус по умолчанию, если не задан
+	// статус проверяем по рабочему процессу пространства: новая задача начинается с начального
+	// статуса (категория todo), по умолчанию — с первого из них
+	wf, err := s.workflows.GetWorkflow(ctx, *task.Space)
+	if err != nil {
+		return nil, err
+	}
 	if task.Status == "" {
-		task.Status = "to-do"
+		task.Status = initialStatus(wf).Name
+	}
+	target, err := checkTransition(wf, "", task.Status)
+	if err != nil {
+		return nil, err
+	}
+	task.StartedAt, task.CompletedAt = applyStatusStamps(target, nil, nil, time.Now())
+
+	// approved/rejected выставляются только через ApprovalService; одобрение, запрошенное
+	// при создании, запрашивает создатель — как в RequestApproval, сам он его не одобрит
+	if task.ApproveStatus != "" && task.ApproveStatus != model.ApproveStatusNeedApproval {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidApproveStatus, task.ApproveStatus)
+	}
+	var requestedBy *string
+	if task.ApproveStatus == model.ApproveStatusNeedApproval {
+		actor := strconv.Itoa(actorID)
+		requestedBy = &actor
 	}
 
 	const query = `
@@ -60,20 +117,25 @@ func (s *TaskService) CreateTask(ctx context.Context, task model.Task) (*model.T
         "approveStatus",
         deadline,
         "dashboardID",
-        "blockedBy",
-        space
+        space,
+        "started_At",
+        done_at,
+        approval_requested_by
     )
-    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+    VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)
     RETURNING id, created_at, updated_at, "started_At", done_at
     `
 
-	var blockedBy []string
-	if len(task.BlockedBy) > 0 {
-		blockedBy = task.BlockedBy
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
 
 	// выполняем вставку и считываем автогенерируемые поля
-	err = s.dbPool.QueryRow(ctx, query,
+	err = tx.QueryRow(ctx, query,
 		task.Title,
 		task.Description,
 		task.Status,
@@ -84,8 +146,10 @@ func (s *TaskService) CreateTask(ctx context.Context, task model.Task) (*model.T
 		task.ApproveStatus,
 		task.DeadLine,
 		task.DashboardID,
-		blockedBy,
 		task.Space,
+		task.StartedAt,
+		task.CompletedAt,
+		requestedBy,
 	).Scan(
 		&task.ID,
 		&task.CreatedAt,
@@ -97,6 +161,23 @@ func (s *TaskService) CreateTask(ctx context.Context, task model.Task) (*model.T
 		return nil, err
 	}
 
+	// блокеры хранятся в task_dependencies
+	if len(task.BlockedBy) > 0 {
+		if err := replaceBlockers(ctx, tx, task.ID, task.BlockedBy); err != nil {
+			return nil, err
+		}
+	} else {
+		task.BlockedBy = []string{}
+	}
+
+	if err := recordHistory(ctx, tx, task.ID, model.TaskActionCreate, &actorID, snapshotChanges(&task)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
 	return &task, nil
 }
 
@@ -105,7 +186,7 @@ func (s *TaskService) GetTaskByID(ctx context.Context, id string) (*model.Task,
     SELECT
       t.id, t.title, t.description, t.status, t."reporterD", t."assignerID", t."reviewerID", t."approverID",
       t."approveStatus", t.created_at, t.updated_at, t."started_At", t.done_at,
-      t.deadline, t."dashboardID", t."blockedBy", t.space,
+      t.deadline, t."dashboardID", t.space,
       (rep.name || ' ' || rep.surname) AS reporter_name,
       (ass.name || ' ' || ass.surname) AS assigner_name,
       (app.name || ' ' || app.surname) AS approver_name,
@@ -115,7 +196,7 @@ func (s *TaskService) GetTaskByID(ctx context.Context, id string) (*model.Task,
     LEFT JOIN users ass ON ass.id::text = t."assignerID"
     LEFT JOIN users app ON app.id::text = t."approverID"
     LEFT JOIN dashboards d ON d.id::text = t."dashboardID"
-    WHERE t.id = $1
+    WHERE t.id = $1 AND t.deleted_at IS NULL
     `
 
 	var task model.Task
@@ -124,7 +205,6 @@ func (s *TaskService) GetTaskByID(ctx context.Context, id string) (*model.Task,
 	var approverName sql.NullString
 	var dashboardName sql.NullString
 	var space sql.NullString
-	var blockedBy []string
 
 	err := s.dbPool.QueryRow(ctx, query, id).Scan(
 		&task.ID,
@@ -142,7 +222,6 @@ func (s *TaskService) GetTaskByID(ctx context.Context, id string) (*model.Task,
 		&task.CompletedAt,
 		&task.DeadLine,
 		&task.DashboardID,
-		&blockedBy,
 		&space,
 		&reporterName,
 		&assignerName,
@@ -151,17 +230,25 @@ func (s *TaskService) GetTaskByID(ctx context.Context, id string) (*model.Task,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("task %s not found", id)
+			return nil, fmt.Errorf("task %s: %w", id, ErrTaskNotFound)
 		}
 		return nil, err
 	}
 
-	task.BlockedBy = blockedBy
 	if space.Valid {
 		sv := space.String
 		task.Space = &sv
 	}
 
+	// блокеры с названиями и статусами
+	if task.Blockers, err = s.GetBlockers(ctx, task.ID); err != nil {
+		return nil, err
+	}
+	task.BlockedBy = make([]string, 0, len(task.Blockers))
+	for _, b := range task.Blockers {
+		task.BlockedBy = append(task.BlockedBy, b.ID)
+	}
+
 	if reporterName.Valid {
 		v := reporterName.String
 		task.ReporterName = &v
@@ -182,73 +269,25 @@ func (s *TaskService) GetTaskByID(ctx context.Context, id string) (*model.Task,
 	return &task, nil
 }
 
-func (s *TaskService) ListTasks(ctx context.Context) ([]model.Task, error) {
-	const query = `
-        SELECT 
-            id, title, description, status, "reporterD", "assignerID", "reviewerID", 
-            "approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
-            deadline, "dashboardID", "blockedBy", space
-        FROM tasks
-    `
-	rows, err := s.dbPool.Query(ctx, query)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var tasks []model.Task
-	for rows.Next() {
-		var task model.Task
-		var blockedBy []string
-		var space sql.NullString
-
-		if err := rows.Scan(
-			&task.ID,
-			&task.Title,
-			&task.Description,
-			&task.Status,
-			&task.ReporterID,
-			&task.AssignerID,
-			&task.ReviewerID,
-			&task.ApproverID,
-			&task.ApproveStatus,
-			&task.CreatedAt,
-			&task.UpdatedAt,
-			&task.StartedAt,
-			&task.CompletedAt,
-			&task.DeadLine,
-			&task.DashboardID,
-			&blockedBy,
-			&space,
-		); err != nil {
-			return nil, err
-		}
-
-		task.BlockedBy = blockedBy
-		if space.Valid {
-			sv := space.String
-			task.Space = &sv
-		}
-		tasks = append(tasks, task)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return tasks, nil
-}
-
-func (s *TaskService) GetTasksByDashboardID(ctx context.Context, dashboardID string) ([]model.Task, error) {
-	const query = `
+// GetTasksByDashboardID возвращает задачи дашборда из пространств, где состоит userID.
+func (s *TaskService) GetTasksByDashboardID(ctx context.Context, dashboardID string, userID int) ([]model.Task, error) {
+	query := `
 		SELECT 
 			id, title, description, status, "reporterD", "assignerID", "reviewerID", 
 			"approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
-			deadline, "dashboardID", "blockedBy", space
-		FROM tasks WHERE "dashboardID" = $1
+			deadline, "dashboardID", ` + blockedByExpr + `, space
+		FROM tasks
+		WHERE "dashboardID" = $1 AND deleted_at IS NULL
+		  AND space IN (` + memberSpacesSQL("$2") + `)
+		  AND ($3 = '' OR space = $3)
 	`
 
-	rows, err := s.dbPool.Query(ctx, query, dashboardID)
+	// запрос с персональным токеном одного пространства видит только его задачи
+	spaceID, _, err := scopedSpace(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.dbPool.Query(ctx, query, dashboardID, userID, spaceID)
 	if err != nil {
 		return nil, err
 	}
@@ -297,7 +336,8 @@ func (s *TaskService) GetTasksByDashboardID(ctx context.Context, dashboardID str
 	return tasks, nil
 }
 
-func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (*model.Task, error) {
+// UpdateTask применяет patch от имени actorID; изменённые поля попадают в историю задачи.
+func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any, actorID int) (*model.Task, error) {
 	// Приводим вход к model.TaskPatch (если передали model.Task - создаём patch из всех полей)
 	var patch model.TaskPatch
 
@@ -310,37 +350,31 @@ func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (
 		}
 	case model.Task:
 		patch = model.TaskPatch{
-			Title:         &v.Title,
-			Description:   &v.Description,
-			Status:        &v.Status,
-			AssignerID:    v.AssignerID,
-			ReviewerID:    v.ReviewerID,
-			ApproveStatus: &v.ApproveStatus,
-			StartedAt:     v.StartedAt,
-			CompletedAt:   v.CompletedAt,
-			DeadLine:      &v.DeadLine,
-			DashboardID:   &v.DashboardID,
-			BlockedBy:     &v.BlockedBy,
-			ReporterID:    &v.ReporterID,
-			ApproverID:    &v.ApproverID,
+			Title:       &v.Title,
+			Description: &v.Description,
+			Status:      &v.Status,
+			AssignerID:  v.AssignerID,
+			ReviewerID:  v.ReviewerID,
+			DeadLine:    &v.DeadLine,
+			DashboardID: &v.DashboardID,
+			BlockedBy:   &v.BlockedBy,
+			ReporterID:  &v.ReporterID,
+			ApproverID:  &v.ApproverID,
 			// добавьте остальные поля по необходимости
 		}
 	case *model.Task:
 		if v != nil {
 			patch = model.TaskPatch{
-				Title:         &v.Title,
-				Description:   &v.Description,
-				Status:        &v.Status,
-				AssignerID:    v.AssignerID,
-				ReviewerID:    v.ReviewerID,
-				ApproveStatus: &v.ApproveStatus,
-				StartedAt:     v.StartedAt,
-				CompletedAt:   v.CompletedAt,
-				DeadLine:      &v.DeadLine,
-				DashboardID:   &v.DashboardID,
-				BlockedBy:     &v.BlockedBy,
-				ReporterID:    &v.ReporterID,
-				ApproverID:    &v.ApproverID,
+				Title:       &v.Title,
+				Description: &v.Description,
+				Status:      &v.Status,
+				AssignerID:  v.AssignerID,
+				ReviewerID:  v.ReviewerID,
+				DeadLine:    &v.DeadLine,
+				DashboardID: &v.DashboardID,
+				BlockedBy:   &v.BlockedBy,
+				ReporterID:  &v.ReporterID,
+				ApproverID:  &v.ApproverID,
 				// ...
 			}
 		}
@@ -359,6 +393,45 @@ func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (
 		idx++
 	}
 
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// строка блокируется до конца транзакции; снимок «до» нужен для истории
+	before, err := lockTask(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// смена статуса проверяется по рабочему процессу, started_At/done_at проставляются сервером
+	completed := false
+	if patch.Status != nil {
+		wf, err := s.workflows.GetWorkflow(ctx, deref(before.Space))
+		if err != nil {
+			return nil, err
+		}
+		target, err := checkTransition(wf, before.Status, *patch.Status)
+		if err != nil {
+			return nil, err
+		}
+		if target.Name != before.Status {
+			// в done-категорию — по тем же правилам, что и MarkTaskDone
+			if cur, _ := workflowStatus(wf, before.Status); target.Category == model.StatusCategoryDone && cur.Category != model.StatusCategoryDone {
+				if err := s.checkCanComplete(ctx, id, before.ApproveStatus); err != nil {
+					return nil, err
+				}
+				completed = true
+			}
+			newStarted, newDone := applyStatusStamps(target, before.StartedAt, before.CompletedAt, time.Now())
+			push(`"started_At"`, newStarted)
+			push("done_at", newDone)
+		}
+	}
+
 	if patch.Title != nil {
 		push("title", *patch.Title)
 	}
@@ -374,14 +447,10 @@ func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (
 	if patch.ReviewerID != nil {
 		push(`"reviewerID"`, *patch.ReviewerID)
 	}
+	// одобрение запрашивается только через ApprovalService.RequestApproval: он запоминает
+	// запросившего, который в этом раунде не может одобрить задачу сам
 	if patch.ApproveStatus != nil {
-		push(`"approveStatus"`, *patch.ApproveStatus)
-	}
-	if patch.StartedAt != nil {
-		push(`"started_At"`, *patch.StartedAt)
-	}
-	if patch.CompletedAt != nil {
-		push("done_at", *patch.CompletedAt)
+		return nil, fmt.Errorf("%w: request approval via /task/%s/request-approval", ErrInvalidApproveStatus, id)
 	}
 	if patch.DeadLine != nil {
 		push("deadline", *patch.DeadLine)
@@ -390,14 +459,24 @@ func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (
 		push(`"dashboardID"`, *patch.DashboardID)
 	}
 	if patch.BlockedBy != nil {
-		push(`"blockedBy"`, *patch.BlockedBy)
+		if err := replaceBlockers(ctx, tx, id, *patch.BlockedBy); err != nil {
+			return nil, err
+		}
 	}
 	if patch.ReporterID != nil {
 		push(`"reporterD"`, *patch.ReporterID)
 	}
+	// решения по одобрению принимались при прежнем согласующем: раунд начинается заново, и
+	// сменивший согласующего считается запросившим (иначе можно назначить себя и одобрить)
+	approverChanged := patch.ApproverID != nil && *patch.ApproverID != before.ApproverID &&
+		(before.ApproveStatus == model.ApproveStatusNeedApproval || before.ApproveStatus == model.ApproveStatusApproved)
 	if patch.ApproverID != nil {
 		push(`"approverID"`, *patch.ApproverID)
 	}
+	if approverChanged {
+		push(`"approveStatus"`, model.ApproveStatusNeedApproval)
+		push("approval_requested_by", strconv.Itoa(actorID))
+	}
 
 	// всегда обновляем updated_at
 	push("updated_at", time.Now())
@@ -409,11 +488,11 @@ func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (
         RETURNING
             id, title, description, status, "reporterD", "assignerID", "reviewerID",
             "approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
-            deadline, "dashboardID", "blockedBy", space
-    `, strings.Join(set, ", "))
+            deadline, "dashboardID", %s, space
+    `, strings.Join(set, ", "), blockedByExpr)
 
 	var updated model.Task
-	err := s.dbPool.QueryRow(ctx, query, args...).Scan(
+	err = tx.QueryRow(ctx, query, args...).Scan(
 		&updated.ID,
 		&updated.Title,
 		&updated.Description,
@@ -434,63 +513,145 @@ func (s *TaskService) UpdateTask(ctx context.Context, id string, patchAny any) (
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("task %s not found", id)
+			return nil, fmt.Errorf("task %s: %w", id, ErrTaskNotFound)
 		}
 		return nil, err
 	}
 
+	if approverChanged {
+		if _, err := tx.Exec(ctx, `UPDATE task_approvals SET superseded = true WHERE task_id = $1`, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if changes := diffTask(before, &updated, patchedFields(patch)); len(changes) > 0 {
+		if err := recordHistory(ctx, tx, id, model.TaskActionUpdate, &actorID, changes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if completed {
+		s.resolveDependents(ctx, id)
+	}
+
 	return &updated, nil
 }
 
-func (s *TaskService) DeleteTask(ctx context.Context, id string) error {
-	_, err := s.dbPool.Exec(ctx, "DELETE FROM tasks WHERE id = $1", id)
-	return err
+// checkCanComplete проверяет, что у задачи нет незакрытых блокеров и она не ждёт одобрения.
+func (s *TaskService) checkCanComplete(ctx context.Context, id, approveStatus string) error {
+	open, err := s.unresolvedBlockers(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("cannot mark done: %w by %v", ErrTaskBlocked, open)
+	}
+	if approveStatus == model.ApproveStatusNeedApproval || approveStatus == model.ApproveStatusRejected {
+		return fmt.Errorf("cannot mark done: %w", ErrApprovalRequired)
+	}
+	return nil
 }
 
-func (s *TaskService) MarkTaskDone(ctx context.Context, id string) (*model.Task, error) {
-	const selectQuery = `
-        SELECT blockedBy, "approveStatus"
-        FROM tasks
-        WHERE id = $1
-    `
-	var blockedBy []string
-	var approveStatus string
+// DeleteTask переносит задачу в корзину пространства. Нужно право task.delete.
+// Задачи, которые ждали только её, разблокируются.
+func (s *TaskService) DeleteTask(ctx context.Context, id string, actorID int) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
 
-	err := s.dbPool.QueryRow(ctx, selectQuery, id).Scan(&blockedBy, &approveStatus)
+	task, err := lockTask(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkCanManage(ctx, task, actorID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE tasks SET deleted_at = NOW(), deleted_by = $2 WHERE id = $1
+	`, id, actorID); err != nil {
+		return err
+	}
+	if err := recordHistory(ctx, tx, id, model.TaskActionDelete, &actorID, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	s.resolveDependents(ctx, id)
+	return nil
+}
+
+// checkCanManage — удалять и восстанавливать задачу можно с правом task.delete.
+func (s *TaskService) checkCanManage(ctx context.Context, task *model.Task, actorID int) error {
+	ok, err := can(ctx, s.dbPool, actorID, PermTaskDelete, deref(task.Space))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// MarkTaskDone переводит задачу в статус выполнения completionStatus. Если перехода в него из
+// текущего статуса нет (или такого статуса нет в рабочем процессе), возвращается TransitionError.
+func (s *TaskService) MarkTaskDone(ctx context.Context, id string, actorID int) (*model.Task, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	before, err := lockTask(ctx, tx, id)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("task with id %q not found", id)
-		}
 		return nil, err
 	}
 
-	// 2) Проверяем, заблокирована ли задача
-	if len(blockedBy) > 0 {
-		return nil, fmt.Errorf("cannot mark done: task is blocked by %v", blockedBy)
+	// 2) Проверяем незакрытые блокеры и статус одобрения
+	if err := s.checkCanComplete(ctx, id, before.ApproveStatus); err != nil {
+		return nil, err
 	}
 
-	// 3) Проверяем статус одобрения
-	if approveStatus == "need-approval" {
-		return nil, errors.New("cannot mark done: task needs approval")
+	// 3) Переводим в статус выполнения; отмена (другие done-статусы) сюда не подходит
+	wf, err := s.workflows.GetWorkflow(ctx, deref(before.Space))
+	if err != nil {
+		return nil, err
 	}
+	target, err := checkTransition(wf, before.Status, completionStatus)
+	if err != nil {
+		return nil, err
+	}
+	newStarted, newDone := applyStatusStamps(target, before.StartedAt, before.CompletedAt, time.Now())
 
 	const query = `
         UPDATE tasks SET
-            status = 'done',
-            done_at = NOW(),
+            status = $2,
+            "started_At" = $3,
+            done_at = $4,
             updated_at = NOW()
         WHERE id = $1
         RETURNING 
             id, title, description, status, "reporterD", "assignerID", "reviewerID", 
             "approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
-            deadline, "dashboardID", "blockedBy", space
+            deadline, "dashboardID", ` + blockedByExpr + `, space
     `
 
 	var task model.Task
 	var blocked []string
 	var space sql.NullString
 
-	err = s.dbPool.QueryRow(ctx, query, id).Scan(
+	err = tx.QueryRow(ctx, query, id, target.Name, newStarted, newDone).Scan(
 		&task.ID,
 		&task.Title,
 		&task.Description,
@@ -519,7 +680,59 @@ func (s *TaskService) MarkTaskDone(ctx context.Context, id string) (*model.Task,
 		task.Space = &sv
 	}
 
+	if err := recordHistory(ctx, tx, id, model.TaskActionDone, &actorID, diffTask(before, &task, nil)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	s.resolveDependents(ctx, task.ID)
+
+	return &task, nil
+}
+
+// lockTask загружает задачу и блокирует её строку до конца транзакции.
+func lockTask(ctx context.Context, tx pgx.Tx, id string) (*model.Task, error) {
+	var task model.Task
+	err := tx.QueryRow(ctx, `
+		SELECT id, title, description, status, "reporterD", "assignerID", "reviewerID",
+		       "approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
+		       deadline, "dashboardID", `+blockedByExpr+`, space
+		FROM tasks
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id).Scan(
+		&task.ID,
+		&task.Title,
+		&task.Description,
+		&task.Status,
+		&task.ReporterID,
+		&task.AssignerID,
+		&task.ReviewerID,
+		&task.ApproverID,
+		&task.ApproveStatus,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.StartedAt,
+		&task.CompletedAt,
+		&task.DeadLine,
+		&task.DashboardID,
+		&task.BlockedBy,
+		&task.Space,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("task %s: %w", id, ErrTaskNotFound)
+		}
+		return nil, err
+	}
 	return &task, nil
 }
 
-// TODO: UpdateApproveStatuses
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,466 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrDependencyCycle — новая зависимость замкнула бы цикл.
+	ErrDependencyCycle = errors.New("dependency would create a cycle")
+	// ErrInvalidDependency — блокер не существует, из другого пространства или совпадает с самой задачей.
+	ErrInvalidDependency = errors.New("invalid dependency")
+)
+
+// blockedByExpr — id блокеров задачи tasks.id из task_dependencies (бывшая колонка "blockedBy").
+// Блокеры в корзине не учитываются.
+const blockedByExpr = `ARRAY(SELECT d.blocker_id::text FROM task_dependencies d JOIN tasks b ON b.id = d.blocker_id AND b.deleted_at IS NULL WHERE d.task_id = tasks.id ORDER BY d.created_at, d.blocker_id)`
+
+// lockDependencies сериализует изменения графа зависимостей, чтобы параллельные
+// вставки не могли вместе образовать цикл.
+func lockDependencies(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `LOCK TABLE task_dependencies IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+// insertBlocker добавляет ребро taskID -> blockerID с проверкой существования и циклов.
+// Блокер должен быть из того же пространства, что и задача: задача другого пространства для
+// пользователя может быть чужой, поэтому она неотличима от несуществующей.
+// Вызывать внутри транзакции после lockDependencies.
+func insertBlocker(ctx context.Context, tx pgx.Tx, taskID, blockerID string) error {
+	if taskID == blockerID {
+		return fmt.Errorf("%w: task cannot block itself", ErrInvalidDependency)
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM tasks b JOIN tasks t ON t.id::text = $2
+			WHERE b.id::text = $1 AND b.deleted_at IS NULL AND b.space IS NOT DISTINCT FROM t.space
+		)
+	`, blockerID, taskID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: blocker %s not found", ErrInvalidDependency, blockerID)
+	}
+
+	// цикл появится, если блокер уже (транзитивно) зависит от задачи
+	var cycle bool
+	err := tx.QueryRow(ctx, `
+		WITH RECURSIVE chain(id) AS (
+			SELECT blocker_id FROM task_dependencies WHERE task_id::text = $1
+			UNION
+			SELECT d.blocker_id FROM task_dependencies d JOIN chain c ON d.task_id = c.id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id::text = $2)
+	`, blockerID, taskID).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return fmt.Errorf("%w: %s already depends on %s", ErrDependencyCycle, blockerID, taskID)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO task_dependencies (task_id, blocker_id)
+		VALUES ($1::uuid, $2::uuid)
+		ON CONFLICT DO NOTHING
+	`, taskID, blockerID)
+	return err
+}
+
+// replaceBlockers заменяет набор блокеров задачи.
+func replaceBlockers(ctx context.Context, tx pgx.Tx, taskID string, blockers []string) error {
+	if err := lockDependencies(ctx, tx); err != nil {
+		return err
+	}
+	// связи с блокерами из корзины сохраняем: после восстановления блокера они снова действуют
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM task_dependencies d USING tasks b
+		WHERE d.task_id::text = $1 AND b.id = d.blocker_id AND b.deleted_at IS NULL
+	`, taskID); err != nil {
+		return err
+	}
+	for _, blockerID := range blockers {
+		if err := insertBlocker(ctx, tx, taskID, blockerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taskRefs загружает связанные задачи и помечает выполненные (категория done в их пространстве).
+func (s *TaskService) taskRefs(ctx context.Context, query string, taskID string) ([]model.TaskRef, error) {
+	rows, err := s.dbPool.Query(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type refRow struct {
+		ref   model.TaskRef
+		space string
+	}
+	var loaded []refRow
+	for rows.Next() {
+		var r refRow
+		if err := rows.Scan(&r.ref.ID, &r.ref.Title, &r.ref.Status, &r.space); err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	workflows := map[string]*model.Workflow{}
+	refs := make([]model.TaskRef, 0, len(loaded))
+	for _, r := range loaded {
+		wf, ok := workflows[r.space]
+		if !ok {
+			if wf, err = s.workflows.GetWorkflow(ctx, r.space); err != nil {
+				return nil, err
+			}
+			workflows[r.space] = wf
+		}
+		st, _ := workflowStatus(wf, r.ref.Status)
+		r.ref.Done = st.Category == model.StatusCategoryDone
+		refs = append(refs, r.ref)
+	}
+	return refs, nil
+}
+
+// GetBlockers возвращает задачи, которые блокируют taskID.
+func (s *TaskService) GetBlockers(ctx context.Context, taskID string) ([]model.TaskRef, error) {
+	return s.taskRefs(ctx, `
+		SELECT b.id::text, b.title, b.status, COALESCE(b.space, '')
+		FROM task_dependencies d
+		JOIN tasks b ON b.id = d.blocker_id AND b.deleted_at IS NULL
+		WHERE d.task_id::text = $1
+		ORDER BY d.created_at, b.id
+	`, taskID)
+}
+
+// GetBlocking возвращает задачи, которые ждут taskID (обратная связь).
+func (s *TaskService) GetBlocking(ctx context.Context, taskID string) ([]model.TaskRef, error) {
+	return s.taskRefs(ctx, `
+		SELECT t.id::text, t.title, t.status, COALESCE(t.space, '')
+		FROM task_dependencies d
+		JOIN tasks t ON t.id = d.task_id AND t.deleted_at IS NULL
+		WHERE d.blocker_id::text = $1
+		ORDER BY d.created_at, t.id
+	`, taskID)
+}
+
+// unresolvedBlockers — id блокеров, которые ещё не в категории done.
+func (s *TaskService) unresolvedBlockers(ctx context.Context, taskID string) ([]string, error) {
+	blockers, err := s.GetBlockers(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	var open []string
+	for _, b := range blockers {
+		if !b.Done {
+			open = append(open, b.ID)
+		}
+	}
+	return open, nil
+}
+
+// currentBlockers — блокеры задачи в том виде, в каком поле blockedBy попадает в историю:
+// без блокеров из корзины, отсортированы, как в taskFields.
+func currentBlockers(ctx context.Context, q queryer, taskID string) ([]string, error) {
+	rows, err := q.Query(ctx, `
+		SELECT d.blocker_id::text
+		FROM task_dependencies d
+		JOIN tasks b ON b.id = d.blocker_id AND b.deleted_at IS NULL
+		WHERE d.task_id::text = $1
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	slices.Sort(blockers)
+	return blockers, err
+}
+
+// recordBlockersChange пишет в историю изменение blockedBy, если набор блокеров изменился.
+func recordBlockersChange(ctx context.Context, tx pgx.Tx, taskID string, actorID int, before []string) error {
+	after, err := currentBlockers(ctx, tx, taskID)
+	if err != nil || slices.Equal(before, after) {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE tasks SET updated_at = NOW() WHERE id::text = $1`, taskID); err != nil {
+		return err
+	}
+	return recordHistory(ctx, tx, taskID, model.TaskActionUpdate, &actorID, []model.FieldChange{
+		{Field: "blockedBy", Old: before, New: after},
+	})
+}
+
+// AddBlocker добавляет блокер задаче; изменение попадает в историю задачи.
+func (s *TaskService) AddBlocker(ctx context.Context, taskID, blockerID string, actorID int) ([]model.TaskRef, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tasks WHERE id::text = $1 AND deleted_at IS NULL)`, taskID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+	}
+
+	if err := lockDependencies(ctx, tx); err != nil {
+		return nil, err
+	}
+	before, err := currentBlockers(ctx, tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertBlocker(ctx, tx, taskID, blockerID); err != nil {
+		return nil, err
+	}
+	if err := recordBlockersChange(ctx, tx, taskID, actorID, before); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return s.GetBlockers(ctx, taskID)
+}
+
+// RemoveBlocker удаляет блокер задачи; если блокеров не осталось, задача разблокируется.
+// Изменение попадает в историю задачи.
+func (s *TaskService) RemoveBlocker(ctx context.Context, taskID, blockerID string, actorID int) ([]model.TaskRef, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	before, err := currentBlockers(ctx, tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM task_dependencies WHERE task_id::text = $1 AND blocker_id::text = $2
+	`, taskID, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordBlockersChange(ctx, tx, taskID, actorID, before); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	if tag.RowsAffected() > 0 {
+		if err := s.unblockIfResolved(ctx, taskID); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetBlockers(ctx, taskID)
+}
+
+// resolveDependents вызывается, когда задача перешла в категорию done:
+// задачи, у которых это был последний незакрытый блокер, разблокируются.
+func (s *TaskService) resolveDependents(ctx context.Context, taskID string) {
+	dependents, err := s.GetBlocking(ctx, taskID)
+	if err != nil {
+		slog.Error("Failed to load dependent tasks", "taskID", taskID, "error", err)
+		return
+	}
+	for _, dep := range dependents {
+		if dep.Done {
+			continue
+		}
+		if err := s.unblockIfResolved(ctx, dep.ID); err != nil {
+			slog.Error("Failed to unblock task", "taskID", dep.ID, "error", err)
+		}
+	}
+}
+
+// blockedStatus — статус ожидания блокеров в рабочем процессе по умолчанию. В своём рабочем
+// процессе пространство может его не иметь; тогда при разблокировке статус задачи не меняется.
+const blockedStatus = "blocked"
+
+// unblockTarget — статус, в который переводится разблокированная задача: первый разрешённый
+// из blockedStatus статус категории in-progress. false — статус не меняется: задача не в
+// blockedStatus, такого статуса нет в рабочем процессе или из него некуда перейти.
+func unblockTarget(wf *model.Workflow, status string) (string, bool) {
+	if status != blockedStatus {
+		return "", false
+	}
+	if _, ok := workflowStatus(wf, blockedStatus); !ok {
+		return "", false
+	}
+	for _, name := range allowedTransitions(wf, blockedStatus) {
+		if st, _ := workflowStatus(wf, name); st.Category == model.StatusCategoryInProgress {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// blockTarget — обратное unblockTarget: задача, которую разблокировка перевела бы из blockedStatus
+// в status, при новом незакрытом блокере возвращается в blockedStatus.
+func blockTarget(wf *model.Workflow, status string) bool {
+	target, ok := unblockTarget(wf, blockedStatus)
+	return ok && target == status
+}
+
+// unblockIfResolved публикует EventTaskUnblocked, если у задачи не осталось незакрытых блокеров.
+// Задача в статусе blockedStatus при этом переводится в статус из unblockTarget. Строка задачи
+// заблокирована до конца проверки, чтобы не перезаписать статус, параллельно изменённый пользователем.
+func (s *TaskService) unblockIfResolved(ctx context.Context, taskID string) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	task, err := lockTask(ctx, tx, taskID)
+	if errors.Is(err, ErrTaskNotFound) {
+		// задача в корзине: разблокировать нечего
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	open, err := s.unresolvedBlockers(ctx, taskID)
+	if err != nil || len(open) > 0 {
+		return err
+	}
+	status, space := task.Status, deref(task.Space)
+
+	wf, err := s.workflows.GetWorkflow(ctx, space)
+	if err != nil {
+		return err
+	}
+	if st, _ := workflowStatus(wf, status); st.Category == model.StatusCategoryDone {
+		return nil
+	}
+
+	payload := map[string]any{"previousStatus": status}
+	if target, ok := unblockTarget(wf, status); ok {
+		if _, err := tx.Exec(ctx, `
+			UPDATE tasks
+			SET status = $2, "started_At" = COALESCE("started_At", $3), updated_at = NOW()
+			WHERE id::text = $1
+		`, taskID, target, time.Now()); err != nil {
+			return err
+		}
+		// системное изменение — без автора
+		if err := recordHistory(ctx, tx, taskID, model.TaskActionUpdate, nil, []model.FieldChange{
+			{Field: "status", Old: status, New: target},
+		}); err != nil {
+			return err
+		}
+		payload["status"] = target
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if s.events != nil {
+		s.events.Publish(ctx, Event{Type: EventTaskUnblocked, TaskID: taskID, SpaceID: space, Payload: payload})
+	}
+	return nil
+}
+
+// blockDependents вызывается, когда задача снова стала незакрытым блокером (восстановлена из
+// корзины): зависимые задачи, у которых других незакрытых блокеров нет, блокируются снова.
+func (s *TaskService) blockDependents(ctx context.Context, taskID string) {
+	dependents, err := s.GetBlocking(ctx, taskID)
+	if err != nil {
+		slog.Error("Failed to load dependent tasks", "taskID", taskID, "error", err)
+		return
+	}
+	for _, dep := range dependents {
+		if dep.Done {
+			continue
+		}
+		if err := s.blockIfReopened(ctx, dep.ID, taskID); err != nil {
+			slog.Error("Failed to block task", "taskID", dep.ID, "error", err)
+		}
+	}
+}
+
+// blockIfReopened публикует EventTaskBlocked, если blockerID — единственный незакрытый блокер
+// задачи, то есть до его появления задача была разблокирована. Задача в статусе, куда её
+// перевела бы разблокировка, возвращается в blockedStatus (см. blockTarget).
+func (s *TaskService) blockIfReopened(ctx context.Context, taskID, blockerID string) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	task, err := lockTask(ctx, tx, taskID)
+	if errors.Is(err, ErrTaskNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	open, err := s.unresolvedBlockers(ctx, taskID)
+	if err != nil || len(open) != 1 || open[0] != blockerID {
+		return err
+	}
+	status, space := task.Status, deref(task.Space)
+
+	wf, err := s.workflows.GetWorkflow(ctx, space)
+	if err != nil {
+		return err
+	}
+	if st, _ := workflowStatus(wf, status); st.Category == model.StatusCategoryDone {
+		return nil
+	}
+
+	payload := map[string]any{"previousStatus": status, "blockerId": blockerID}
+	if blockTarget(wf, status) {
+		if _, err := tx.Exec(ctx, `
+			UPDATE tasks SET status = $2, updated_at = NOW() WHERE id::text = $1
+		`, taskID, blockedStatus); err != nil {
+			return err
+		}
+		// системное изменение — без автора
+		if err := recordHistory(ctx, tx, taskID, model.TaskActionUpdate, nil, []model.FieldChange{
+			{Field: "status", Old: status, New: blockedStatus},
+		}); err != nil {
+			return err
+		}
+		payload["status"] = blockedStatus
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if s.events != nil {
+		s.events.Publish(ctx, Event{Type: EventTaskBlocked, TaskID: taskID, SpaceID: space, Payload: payload})
+	}
+	return nil
+}
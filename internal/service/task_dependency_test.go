@@ -0,0 +1,88 @@
+package service
+
+import (
+	"testing"
+
+	"tasker/internal/model"
+)
+
+func TestUnblockTarget(t *testing.T) {
+	// свой рабочий процесс: статуса blocked нет
+	noBlocked := &model.Workflow{
+		Statuses: []model.WorkflowStatus{
+			{Name: "new", Category: model.StatusCategoryTodo},
+			{Name: "doing", Category: model.StatusCategoryInProgress},
+			{Name: "closed", Category: model.StatusCategoryDone},
+		},
+		Transitions: []model.WorkflowTransition{{From: "new", To: "doing"}, {From: "doing", To: "closed"}},
+	}
+	// blocked есть, но из него можно только вернуться в очередь
+	backToQueue := &model.Workflow{
+		Statuses: []model.WorkflowStatus{
+			{Name: "new", Category: model.StatusCategoryTodo},
+			{Name: "blocked", Category: model.StatusCategoryInProgress},
+			{Name: "closed", Category: model.StatusCategoryDone},
+		},
+		Transitions: []model.WorkflowTransition{{From: "blocked", To: "new"}, {From: "blocked", To: "closed"}},
+	}
+	// из blocked несколько статусов in-progress: берётся первый по position
+	custom := &model.Workflow{
+		Statuses: []model.WorkflowStatus{
+			{Name: "new", Category: model.StatusCategoryTodo},
+			{Name: "doing", Category: model.StatusCategoryInProgress},
+			{Name: "blocked", Category: model.StatusCategoryInProgress},
+			{Name: "testing", Category: model.StatusCategoryInProgress},
+			{Name: "closed", Category: model.StatusCategoryDone},
+		},
+		Transitions: []model.WorkflowTransition{{From: "blocked", To: "testing"}, {From: "blocked", To: "doing"}},
+	}
+	cases := []struct {
+		name   string
+		wf     *model.Workflow
+		status string
+		want   string // пусто — статус не меняется
+	}{
+		{name: "default workflow", wf: DefaultWorkflow(""), status: "blocked", want: "in-progress"},
+		{name: "not blocked", wf: DefaultWorkflow(""), status: "review"},
+		{name: "workflow without blocked", wf: noBlocked, status: "blocked"},
+		{name: "no in-progress transition", wf: backToQueue, status: "blocked"},
+		{name: "first by position", wf: custom, status: "blocked", want: "doing"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := unblockTarget(tc.wf, tc.status)
+			if got != tc.want || ok != (tc.want != "") {
+				t.Errorf("unblockTarget = %q, %v; want %q", got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestBlockTarget(t *testing.T) {
+	backToQueue := &model.Workflow{
+		Statuses: []model.WorkflowStatus{
+			{Name: "new", Category: model.StatusCategoryTodo},
+			{Name: "blocked", Category: model.StatusCategoryInProgress},
+		},
+		Transitions: []model.WorkflowTransition{{From: "blocked", To: "new"}},
+	}
+	cases := []struct {
+		name   string
+		wf     *model.Workflow
+		status string
+		want   bool
+	}{
+		{name: "unblocked status", wf: DefaultWorkflow(""), status: "in-progress", want: true},
+		{name: "other in-progress status", wf: DefaultWorkflow(""), status: "review"},
+		{name: "todo", wf: DefaultWorkflow(""), status: "to-do"},
+		{name: "already blocked", wf: DefaultWorkflow(""), status: "blocked"},
+		{name: "unblock does not move", wf: backToQueue, status: "new"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := blockTarget(tc.wf, tc.status); got != tc.want {
+				t.Errorf("blockTarget(%q) = %v, want %v", tc.status, got, tc.want)
+			}
+		})
+	}
+}
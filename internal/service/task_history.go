@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// execer — общее у pgxpool.Pool и pgx.Tx для записи истории.
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// taskField — значение поля задачи для сравнения в истории.
+type taskField struct {
+	name  string
+	value any
+}
+
+func optString(v *string) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func optTime(v *time.Time) any {
+	if v == nil {
+		return nil
+	}
+	return v.UTC()
+}
+
+// taskFields — отслеживаемые поля задачи в порядке вывода; указатели разыменованы,
+// блокеры отсортированы, чтобы сравнение не зависело от порядка.
+func taskFields(t *model.Task) []taskField {
+	blockedBy := slices.Clone(t.BlockedBy)
+	if blockedBy == nil {
+		blockedBy = []string{}
+	}
+	slices.Sort(blockedBy)
+	return []taskField{
+		{"title", t.Title},
+		{"description", t.Description},
+		{"status", t.Status},
+		{"reporterId", t.ReporterID},
+		{"assignerId", optString(t.AssignerID)},
+		{"reviewerId", optString(t.ReviewerID)},
+		{"approverId", t.ApproverID},
+		{"approveStatus", t.ApproveStatus},
+		{"deadline", t.DeadLine},
+		{"dashboardId", t.DashboardID},
+		{"blockedBy", blockedBy},
+		{"space", optString(t.Space)},
+		{"startedAt", optTime(t.StartedAt)},
+		{"completedAt", optTime(t.CompletedAt)},
+	}
+}
+
+// patchedFields — поля, которые затрагивает patch. startedAt/completedAt проставляет сервер
+// при смене статуса, поэтому они идут вместе со status.
+func patchedFields(patch model.TaskPatch) map[string]bool {
+	touched := map[string]bool{
+		"title":       patch.Title != nil,
+		"description": patch.Description != nil,
+		"status":      patch.Status != nil,
+		"reporterId":  patch.ReporterID != nil,
+		"assignerId":  patch.AssignerID != nil,
+		"reviewerId":  patch.ReviewerID != nil,
+		"approverId":  patch.ApproverID != nil,
+		"deadline":    patch.DeadLine != nil,
+		"dashboardId": patch.DashboardID != nil,
+		"blockedBy":   patch.BlockedBy != nil,
+	}
+	touched["startedAt"] = touched["status"]
+	touched["completedAt"] = touched["status"]
+	// approveStatus через patch не меняется, но смена согласующего начинает новый раунд одобрения
+	touched["approveStatus"] = touched["approverId"]
+	return touched
+}
+
+// diffTask сравнивает задачу до и после изменения по полям из touched (nil — по всем).
+func diffTask(before, after *model.Task, touched map[string]bool) []model.FieldChange {
+	changes := []model.FieldChange{}
+	afterFields := taskFields(after)
+	for i, f := range taskFields(before) {
+		if touched != nil && !touched[f.name] {
+			continue
+		}
+		if !reflect.DeepEqual(f.value, afterFields[i].value) {
+			changes = append(changes, model.FieldChange{Field: f.name, Old: f.value, New: afterFields[i].value})
+		}
+	}
+	return changes
+}
+
+// snapshotChanges — все поля новой задачи как изменения из пустоты.
+func snapshotChanges(t *model.Task) []model.FieldChange {
+	changes := []model.FieldChange{}
+	for _, f := range taskFields(t) {
+		changes = append(changes, model.FieldChange{Field: f.name, New: f.value})
+	}
+	return changes
+}
+
+// recordHistory добавляет запись в журнал задачи. Вызывать в той же транзакции, что и изменение.
+func recordHistory(ctx context.Context, q execer, taskID, action string, actorID *int, changes []model.FieldChange) error {
+	if changes == nil {
+		changes = []model.FieldChange{}
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		INSERT INTO task_history (task_id, action, actor_id, changes)
+		VALUES ($1::uuid, $2, $3, $4)
+	`, taskID, action, actorID, data)
+	return err
+}
+
+// GetHistory возвращает журнал изменений задачи от старых записей к новым.
+// История удалённой задачи остаётся доступной.
+func (s *TaskService) GetHistory(ctx context.Context, taskID string) ([]model.TaskHistoryEntry, error) {
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT h.id, h.task_id::text, h.action, h.actor_id, (u.name || ' ' || u.surname), h.changes, h.created_at
+		FROM task_history h
+		LEFT JOIN users u ON u.id = h.actor_id
+		WHERE h.task_id::text = $1
+		ORDER BY h.created_at, h.id
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.TaskHistoryEntry{}
+	for rows.Next() {
+		var e model.TaskHistoryEntry
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.TaskID, &e.Action, &e.ActorID, &e.ActorName, &data, &e.At); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e.Changes); err != nil {
+			return nil, fmt.Errorf("task history %d: %w", e.ID, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		var exists bool
+		if err := s.dbPool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tasks WHERE id::text = $1)`, taskID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("task %s: %w", taskID, ErrTaskNotFound)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,97 @@
+package service_test
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+)
+
+// lastChange — последняя запись истории задачи; в ней должно быть ровно одно изменение.
+func lastChange(t *testing.T, tasks *service.TaskService, taskID string) (model.TaskHistoryEntry, model.FieldChange) {
+	t.Helper()
+	history, err := tasks.GetHistory(context.Background(), taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := history[len(history)-1]
+	if len(last.Changes) != 1 {
+		t.Fatalf("last history entry %+v, want one change", last)
+	}
+	return last, last.Changes[0]
+}
+
+func TestBlockerAndApproverHistory(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	owner := testutil.User(t, db, service.SystemRoleUser)
+	member := testutil.User(t, db, service.SystemRoleUser)
+	spaceID := testutil.Space(t, db, owner)
+	testutil.Member(t, db, spaceID, member, service.RoleMember)
+
+	spaces := service.NewSpaceService(db, nil)
+	workflows := service.NewWorkflowService(db)
+	tasks := service.NewTaskService(db, spaces, workflows, service.NewEventBus())
+	approvals := service.NewApprovalService(db, spaces, workflows)
+	newTask := func(title string) string {
+		t.Helper()
+		task, err := tasks.CreateTask(ctx, model.Task{
+			Title:      title,
+			ReporterID: strconv.Itoa(owner),
+			ApproverID: strconv.Itoa(owner),
+			Space:      &spaceID,
+		}, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task.ID
+	}
+	taskID, blockerID := newTask("task"), newTask("blocker")
+
+	if _, err := tasks.AddBlocker(ctx, taskID, blockerID, member); err != nil {
+		t.Fatal(err)
+	}
+	entry, change := lastChange(t, tasks, taskID)
+	want := model.FieldChange{Field: "blockedBy", Old: []any{}, New: []any{blockerID}}
+	if entry.ActorID == nil || *entry.ActorID != member || !reflect.DeepEqual(change, want) {
+		t.Errorf("after AddBlocker: %+v %+v, want %+v by %d", entry, change, want, member)
+	}
+
+	if _, err := tasks.RemoveBlocker(ctx, taskID, blockerID, owner); err != nil {
+		t.Fatal(err)
+	}
+	entry, change = lastChange(t, tasks, taskID)
+	want = model.FieldChange{Field: "blockedBy", Old: []any{blockerID}, New: []any{}}
+	if entry.ActorID == nil || *entry.ActorID != owner || !reflect.DeepEqual(change, want) {
+		t.Errorf("after RemoveBlocker: %+v %+v, want %+v by %d", entry, change, want, owner)
+	}
+
+	if _, err := approvals.SetApprovers(ctx, taskID, owner, []string{strconv.Itoa(member)}); err != nil {
+		t.Fatal(err)
+	}
+	_, change = lastChange(t, tasks, taskID)
+	want = model.FieldChange{Field: "approvers", Old: []any{}, New: []any{strconv.Itoa(member)}}
+	if !reflect.DeepEqual(change, want) {
+		t.Errorf("after SetApprovers: %+v, want %+v", change, want)
+	}
+
+	// тот же список ещё раз — в истории ничего нового
+	history, err := tasks.GetHistory(ctx, taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := approvals.SetApprovers(ctx, taskID, owner, []string{strconv.Itoa(member)}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := tasks.GetHistory(ctx, taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(history) {
+		t.Errorf("unchanged approvers added %d history entries", len(again)-len(history))
+	}
+}
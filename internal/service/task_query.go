@@ -0,0 +1,373 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidTaskQuery — неверный фильтр, сортировка или курсор списка задач.
+var ErrInvalidTaskQuery = errors.New("invalid task query")
+
+const (
+	defaultTaskPageSize = 50
+	maxTaskPageSize     = 200
+)
+
+var datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+type sortKind int
+
+const (
+	sortText sortKind = iota
+	sortTime
+)
+
+type taskSortField struct {
+	column string
+	kind   sortKind
+	value  func(t *model.Task) string
+}
+
+// taskSortFields — поля, по которым можно сортировать /list. Все NOT NULL, поэтому
+// keyset-условие обходится без обработки NULL.
+var taskSortFields = map[string]taskSortField{
+	"updatedAt": {column: "updated_at", kind: sortTime, value: func(t *model.Task) string { return t.UpdatedAt.Format(time.RFC3339Nano) }},
+	"createdAt": {column: "created_at", kind: sortTime, value: func(t *model.Task) string { return t.CreatedAt.Format(time.RFC3339Nano) }},
+	"deadline":  {column: "deadline", kind: sortText, value: func(t *model.Task) string { return t.DeadLine }},
+	"title":     {column: "title", kind: sortText, value: func(t *model.Task) string { return t.Title }},
+	"status":    {column: "status", kind: sortText, value: func(t *model.Task) string { return t.Status }},
+}
+
+// defaultTaskSort — свежие изменения первыми (по индексу idx_tasks_updated_at).
+var defaultTaskSort = []model.TaskSort{{Field: "updatedAt", Desc: true}}
+
+// ParseTaskSort разбирает сортировку вида "-updatedAt,title" ("-" — по убыванию).
+func ParseTaskSort(spec string) ([]model.TaskSort, error) {
+	var sorts []model.TaskSort
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		s := model.TaskSort{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if _, ok := taskSortFields[s.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidTaskQuery, s.Field)
+		}
+		if seen[s.Field] {
+			return nil, fmt.Errorf("%w: duplicate sort field %q", ErrInvalidTaskQuery, s.Field)
+		}
+		seen[s.Field] = true
+		sorts = append(sorts, s)
+	}
+	return sorts, nil
+}
+
+func sortSpec(sorts []model.TaskSort) string {
+	parts := make([]string, len(sorts))
+	for i, s := range sorts {
+		parts[i] = s.Field
+		if s.Desc {
+			parts[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// taskCursor — позиция последней выданной задачи. Sort хранится, чтобы курсор
+// нельзя было применить к выборке с другой сортировкой.
+type taskCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     string   `json:"id"`
+}
+
+func encodeTaskCursor(c taskCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(raw string) (*taskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidTaskQuery)
+	}
+	var c taskCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidTaskQuery)
+	}
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidTaskQuery)
+	}
+	return &c, nil
+}
+
+// queryBuilder собирает WHERE с позиционными параметрами.
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+// unresolvedBlockerExpr — у задачи tasks есть блокер не в категории done. Категория берётся
+// из workflow_statuses пространства блокера, а если процесс не настроен — из DefaultWorkflow.
+const unresolvedBlockerExpr = `EXISTS (
+	SELECT 1 FROM task_dependencies d
+	JOIN tasks b ON b.id = d.blocker_id AND b.deleted_at IS NULL
+	WHERE d.task_id = tasks.id AND NOT (
+		CASE WHEN EXISTS (SELECT 1 FROM workflow_statuses ws WHERE ws.space_id = b.space)
+			THEN EXISTS (SELECT 1 FROM workflow_statuses ws WHERE ws.space_id = b.space AND ws.name = b.status AND ws.category = 'done')
+			ELSE b.status = ANY(%s)
+		END
+	)
+)`
+
+// defaultDoneStatuses — статусы категории done в процессе по умолчанию.
+func defaultDoneStatuses() []string {
+	var names []string
+	for _, st := range DefaultWorkflow("").Statuses {
+		if st.Category == model.StatusCategoryDone {
+			names = append(names, st.Name)
+		}
+	}
+	return names
+}
+
+// filterConditions переводит фильтр в условия WHERE (без курсора).
+func filterConditions(b *queryBuilder, userID int, f model.TaskFilter) error {
+	b.where("deleted_at IS NULL")
+	b.where("space IN (" + memberSpacesSQL(b.arg(userID)) + ")")
+
+	for _, eq := range []struct{ column, value string }{
+		{"space", f.SpaceID},
+		{`"dashboardID"`, f.DashboardID},
+		{`"assignerID"`, f.AssignerID},
+		{`"reporterD"`, f.ReporterID},
+		{`"approverID"`, f.ApproverID},
+		{`"approveStatus"`, f.ApproveStatus},
+	} {
+		if eq.value != "" {
+			b.where(eq.column + " = " + b.arg(eq.value))
+		}
+	}
+	if len(f.Statuses) > 0 {
+		b.where("status = ANY(" + b.arg(f.Statuses) + ")")
+	}
+
+	for _, d := range []string{f.DeadlineFrom, f.DeadlineTo} {
+		if d != "" && !datePattern.MatchString(d) {
+			return fmt.Errorf("%w: deadline must be YYYY-MM-DD, got %q", ErrInvalidTaskQuery, d)
+		}
+	}
+	if f.DeadlineFrom != "" {
+		b.where("deadline >= " + b.arg(f.DeadlineFrom))
+	}
+	if f.DeadlineTo != "" {
+		b.where("deadline <= " + b.arg(f.DeadlineTo))
+	}
+	if f.CreatedFrom != nil {
+		b.where("created_at >= " + b.arg(*f.CreatedFrom))
+	}
+	if f.CreatedTo != nil {
+		b.where("created_at < " + b.arg(*f.CreatedTo))
+	}
+	if f.UpdatedFrom != nil {
+		b.where("updated_at >= " + b.arg(*f.UpdatedFrom))
+	}
+	if f.UpdatedTo != nil {
+		b.where("updated_at < " + b.arg(*f.UpdatedTo))
+	}
+
+	if f.AssigneeDeactivated {
+		b.where(`"assignerID" IN (SELECT id::text FROM users WHERE deactivated_at IS NOT NULL)`)
+	}
+	if f.Blocked != nil {
+		expr := fmt.Sprintf(unresolvedBlockerExpr, b.arg(defaultDoneStatuses()))
+		if *f.Blocked {
+			b.where(expr)
+		} else {
+			b.where("NOT " + expr)
+		}
+	}
+	return nil
+}
+
+// keysetCondition — «строго после курсора» в порядке sorts + id:
+// (a > x) OR (a = x AND b > y) OR (a = x AND b = y AND id > z), с учётом направления каждого поля.
+func keysetCondition(b *queryBuilder, sorts []model.TaskSort, c *taskCursor) (string, error) {
+	if c.Sort != sortSpec(sorts) || len(c.Values) != len(sorts) {
+		return "", fmt.Errorf("%w: cursor does not match sort", ErrInvalidTaskQuery)
+	}
+
+	type key struct {
+		column string
+		op     string
+		param  string
+	}
+	keys := make([]key, 0, len(sorts)+1)
+	for i, s := range sorts {
+		field := taskSortFields[s.Field]
+		var v any = c.Values[i]
+		if field.kind == sortTime {
+			t, err := time.Parse(time.RFC3339Nano, c.Values[i])
+			if err != nil {
+				return "", fmt.Errorf("%w: malformed cursor", ErrInvalidTaskQuery)
+			}
+			v = t
+		}
+		op := ">"
+		if s.Desc {
+			op = "<"
+		}
+		keys = append(keys, key{column: field.column, op: op, param: b.arg(v)})
+	}
+	keys = append(keys, key{column: "id", op: ">", param: b.arg(c.ID) + "::uuid"})
+
+	ors := make([]string, 0, len(keys))
+	for i, k := range keys {
+		parts := make([]string, 0, i+1)
+		for _, prev := range keys[:i] {
+			parts = append(parts, prev.column+" = "+prev.param)
+		}
+		parts = append(parts, k.column+" "+k.op+" "+k.param)
+		ors = append(ors, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", nil
+}
+
+// ListTasks возвращает страницу задач из пространств пользователя с фильтрами,
+// сортировкой и keyset-пагинацией. Порядок всегда дополняется id, поэтому он однозначен.
+func (s *TaskService) ListTasks(ctx context.Context, userID int, f model.TaskFilter) (*model.TaskPage, error) {
+	sorts := f.Sort
+	if len(sorts) == 0 {
+		sorts = defaultTaskSort
+	}
+	limit := f.Limit
+	if limit <= 0 {
+		limit = defaultTaskPageSize
+	}
+	if limit > maxTaskPageSize {
+		limit = maxTaskPageSize
+	}
+
+	page := &model.TaskPage{Items: []model.Task{}}
+	spaceID, ok, err := scopedSpace(ctx, f.SpaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return page, nil
+	}
+	f.SpaceID = spaceID
+
+	var b queryBuilder
+	if err := filterConditions(&b, userID, f); err != nil {
+		return nil, err
+	}
+
+	if f.WithTotal {
+		var total int
+		err := s.dbPool.QueryRow(ctx, `SELECT COUNT(*) FROM tasks WHERE `+strings.Join(b.conds, " AND "), b.args...).Scan(&total)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	if f.Cursor != "" {
+		c, err := decodeTaskCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cond, err := keysetCondition(&b, sorts, c)
+		if err != nil {
+			return nil, err
+		}
+		b.where(cond)
+	}
+
+	order := make([]string, 0, len(sorts)+1)
+	for _, srt := range sorts {
+		dir := "ASC"
+		if srt.Desc {
+			dir = "DESC"
+		}
+		order = append(order, taskSortFields[srt.Field].column+" "+dir)
+	}
+	order = append(order, "id ASC")
+
+	query := `
+		SELECT
+			id, title, description, status, "reporterD", "assignerID", "reviewerID",
+			"approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
+			deadline, "dashboardID", ` + blockedByExpr + `, space
+		FROM tasks
+		WHERE ` + strings.Join(b.conds, " AND ") + `
+		ORDER BY ` + strings.Join(order, ", ") + `
+		LIMIT ` + b.arg(limit+1)
+
+	rows, err := s.dbPool.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task model.Task
+		if err := rows.Scan(
+			&task.ID,
+			&task.Title,
+			&task.Description,
+			&task.Status,
+			&task.ReporterID,
+			&task.AssignerID,
+			&task.ReviewerID,
+			&task.ApproverID,
+			&task.ApproveStatus,
+			&task.CreatedAt,
+			&task.UpdatedAt,
+			&task.StartedAt,
+			&task.CompletedAt,
+			&task.DeadLine,
+			&task.DashboardID,
+			&task.BlockedBy,
+			&task.Space,
+		); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := &page.Items[limit-1]
+		c := taskCursor{Sort: sortSpec(sorts), ID: last.ID, Values: make([]string, len(sorts))}
+		for i, srt := range sorts {
+			c.Values[i] = taskSortFields[srt.Field].value(last)
+		}
+		next := encodeTaskCursor(c)
+		page.NextCursor = &next
+	}
+	return page, nil
+}
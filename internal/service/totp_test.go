@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret — ключ SHA-1 из приложения B RFC 6238 («12345678901234567890») в base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// в RFC коды из 8 цифр; шестизначный код — их последние 6 цифр
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+	for _, tc := range cases {
+		if got := totpCode(key, tc.unix/int64(totpPeriod/time.Second)); got != tc.want {
+			t.Errorf("T = %d: code %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := now.Unix() / int64(totpPeriod/time.Second)
+	cases := []struct {
+		name  string
+		shift int64 // шаг кода относительно текущего
+		ok    bool
+	}{
+		{name: "current step", shift: 0, ok: true},
+		{name: "previous step", shift: -1, ok: true},
+		{name: "next step", shift: 1, ok: true},
+		{name: "two steps behind", shift: -2},
+		{name: "two steps ahead", shift: 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Secret, totpCode(key, current+tc.shift), now)
+			if ok != tc.ok || (ok && step != current+tc.shift) {
+				t.Errorf("matchTOTP = %d, %v; want step %d, %v", step, ok, current+tc.shift, tc.ok)
+			}
+		})
+	}
+
+	if _, ok := matchTOTP(rfc6238Secret, "12345", now); ok {
+		t.Error("short code accepted")
+	}
+	if _, ok := matchTOTP("not base32!", totpCode(key, current), now); ok {
+		t.Error("code accepted for a broken secret")
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TrashService — корзина задач: просмотр, восстановление и окончательная очистка
+// задач, удалённых раньше срока хранения.
+type TrashService struct {
+	dbPool    *pgxpool.Pool
+	tasks     *TaskService
+	blobs     storage.BlobStore
+	retention time.Duration
+}
+
+// NewTrashService принимает хранилище вложений, чтобы при очистке удалять и их содержимое.
+func NewTrashService(dbPool *pgxpool.Pool, tasks *TaskService, blobs storage.BlobStore, retention time.Duration) *TrashService {
+	return &TrashService{dbPool: dbPool, tasks: tasks, blobs: blobs, retention: retention}
+}
+
+// ListTrash возвращает задачи из корзины пространства, недавно удалённые первыми.
+// Смотреть корзину можно с правом task.read.
+func (s *TrashService) ListTrash(ctx context.Context, spaceID string, actorID int) ([]model.Task, error) {
+	ok, err := can(ctx, s.dbPool, actorID, PermTaskRead, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrForbidden
+	}
+
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT id, title, description, status, "reporterD", "assignerID", "reviewerID",
+		       "approverID", "approveStatus", created_at, updated_at, "started_At", done_at,
+		       deadline, "dashboardID", space, deleted_at, deleted_by
+		FROM tasks
+		WHERE space = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []model.Task{}
+	for rows.Next() {
+		var task model.Task
+		if err := rows.Scan(
+			&task.ID,
+			&task.Title,
+			&task.Description,
+			&task.Status,
+			&task.ReporterID,
+			&task.AssignerID,
+			&task.ReviewerID,
+			&task.ApproverID,
+			&task.ApproveStatus,
+			&task.CreatedAt,
+			&task.UpdatedAt,
+			&task.StartedAt,
+			&task.CompletedAt,
+			&task.DeadLine,
+			&task.DashboardID,
+			&task.Space,
+			&task.DeletedAt,
+			&task.DeletedBy,
+		); err != nil {
+			return nil, err
+		}
+		purgeAt := task.DeletedAt.Add(s.retention)
+		task.PurgeAt = &purgeAt
+		task.BlockedBy = []string{}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// RestoreTask возвращает задачу из корзины. Нужно право task.delete.
+// Связи восстановленной задачи снова действуют: зависимые от неё задачи блокируются.
+func (s *TrashService) RestoreTask(ctx context.Context, id string, actorID int) (*model.Task, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var task model.Task
+	err = tx.QueryRow(ctx, `
+		SELECT id, "reporterD", space FROM tasks WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE
+	`, id).Scan(&task.ID, &task.ReporterID, &task.Space)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("trashed task %s: %w", id, ErrTaskNotFound)
+		}
+		return nil, err
+	}
+	if err := s.tasks.checkCanManage(ctx, &task, actorID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE tasks SET deleted_at = NULL, deleted_by = NULL, updated_at = NOW() WHERE id = $1
+	`, id); err != nil {
+		return nil, err
+	}
+	if err := recordHistory(ctx, tx, id, model.TaskActionRestore, &actorID, nil); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	s.tasks.blockDependents(ctx, task.ID)
+	return s.tasks.GetTaskByID(ctx, id)
+}
+
+// PurgeExpired окончательно удаляет задачи, пролежавшие в корзине дольше срока хранения,
+// вместе с содержимым их вложений. История задач остаётся. Возвращает число удалённых задач.
+func (s *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	cutoff := time.Now().Add(-s.retention)
+
+	// ключи вложений собираем до удаления: строки attachments уйдут каскадом
+	rows, err := tx.Query(ctx, `
+		SELECT a.storage_key
+		FROM attachments a
+		JOIN tasks t ON t.id = a.task_id
+		WHERE t.deleted_at < $1
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM tasks WHERE deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			slog.Error("Failed to delete attachment blob", "key", key, "error", err)
+		}
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// RunPurger периодически очищает корзину, пока ctx не отменён.
+func (s *TrashService) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeExpired(ctx)
+		if err != nil {
+			slog.Error("Failed to purge trash", "error", err)
+		} else if n > 0 {
+			slog.Info("Purged trashed tasks", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package service_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/testutil"
+)
+
+func TestRestoreBlockerBlocksDependents(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+	owner := testutil.User(t, db, service.SystemRoleUser)
+	spaceID := testutil.Space(t, db, owner)
+
+	events := service.NewEventBus()
+	var got []string
+	events.Subscribe(func(_ context.Context, e service.Event) {
+		got = append(got, e.Type+" "+e.TaskID)
+	})
+	tasks := service.NewTaskService(db, service.NewSpaceService(db, nil), service.NewWorkflowService(db), events)
+	trash := service.NewTrashService(db, tasks, nil, time.Hour)
+	newTask := func(title string) string {
+		t.Helper()
+		task, err := tasks.CreateTask(ctx, model.Task{
+			Title:      title,
+			ReporterID: strconv.Itoa(owner),
+			ApproverID: strconv.Itoa(owner),
+			Space:      &spaceID,
+		}, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task.ID
+	}
+	status := func(taskID string) string {
+		t.Helper()
+		task, err := tasks.GetTaskByID(ctx, taskID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task.Status
+	}
+
+	// waiting ждёт только blocker, other — ещё и open, который не закрыт
+	blocker, waiting, other, open := newTask("blocker"), newTask("waiting"), newTask("other"), newTask("open")
+	for _, dep := range [][2]string{{waiting, blocker}, {other, blocker}, {other, open}} {
+		if _, err := tasks.AddBlocker(ctx, dep[0], dep[1], owner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(ctx, `UPDATE tasks SET status = 'blocked' WHERE id = ANY($1::uuid[])`, []string{waiting, other}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tasks.DeleteTask(ctx, blocker, owner); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(waiting); s != "in-progress" {
+		t.Fatalf("after the blocker was deleted status = %q, want in-progress", s)
+	}
+
+	got = nil
+	if _, err := trash.RestoreTask(ctx, blocker, owner); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(waiting); s != "blocked" {
+		t.Errorf("after the blocker was restored status = %q, want blocked", s)
+	}
+	_, change := lastChange(t, tasks, waiting)
+	if change.Field != "status" || change.Old != "in-progress" || change.New != "blocked" {
+		t.Errorf("last change = %+v, want status in-progress -> blocked", change)
+	}
+	// other всё это время оставался заблокированным: события о нём нет
+	if s := status(other); s != "blocked" {
+		t.Errorf("task with another open blocker: status = %q, want blocked", s)
+	}
+	if want := service.EventTaskBlocked + " " + waiting; len(got) != 1 || got[0] != want {
+		t.Errorf("events = %v, want [%s]", got, want)
+	}
+}
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrTwoFactorRequired — пространство требует 2FA, а у пользователя она не включена.
+	// Оборачивает ErrForbidden, поэтому везде отдаётся как 403.
+	ErrTwoFactorRequired = fmt.Errorf("two-factor authentication required: %w", ErrForbidden)
+	// ErrTwoFactorEnabled — 2FA уже включена (повторная настройка — только после отключения).
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnabled — 2FA не включена или не начата настройка.
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidTwoFactorCode — неверный, уже использованный или отсутствующий код.
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidLoginChallenge — challenge-токен не найден, истёк или уже использован.
+	ErrInvalidLoginChallenge = errors.New("invalid or expired login challenge")
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxChallengeAttempts — после стольких неверных кодов challenge-токен сгорает и нужно снова ввести пароль.
+	maxChallengeAttempts = 5
+)
+
+// TwoFactorService управляет TOTP-2FA пользователей и вторым шагом входа.
+type TwoFactorService struct {
+	dbPool       *pgxpool.Pool
+	guard        *LoginGuard
+	issuer       string
+	challengeTTL time.Duration
+}
+
+// NewTwoFactorService: issuer — название сервиса в приложении-аутентификаторе,
+// challengeTTL — сколько действует challenge-токен второго шага входа.
+func NewTwoFactorService(dbPool *pgxpool.Pool, guard *LoginGuard, issuer string, challengeTTL time.Duration) *TwoFactorService {
+	return &TwoFactorService{dbPool: dbPool, guard: guard, issuer: issuer, challengeTTL: challengeTTL}
+}
+
+// enabled — включена ли (подтверждена) 2FA у пользователя.
+func (s *TwoFactorService) enabled(ctx context.Context, q queryer, userID int) (bool, error) {
+	var on bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL)`, userID).Scan(&on)
+	return on, err
+}
+
+// Status возвращает состояние 2FA пользователя.
+func (s *TwoFactorService) Status(ctx context.Context, userID int) (*model.TwoFactorStatus, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	var st model.TwoFactorStatus
+	err := s.dbPool.QueryRow(ctx, `
+		SELECT t.confirmed_at,
+			(SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+		FROM (SELECT 1) AS one
+		LEFT JOIN user_totp t ON t.user_id = $1
+	`, userID).Scan(&st.ConfirmedAt, &st.RecoveryCodesLeft)
+	if err != nil {
+		return nil, err
+	}
+	st.Enabled = st.ConfirmedAt != nil
+	return &st, nil
+}
+
+// Enroll создаёт новый секрет TOTP. 2FA включится после Confirm; повторный Enroll до
+// подтверждения заменяет секрет.
+func (s *TwoFactorService) Enroll(ctx context.Context, userID int) (*model.TwoFactorEnrollment, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	var account string
+	if err := s.dbPool.QueryRow(ctx, `SELECT login FROM users WHERE id = $1`, userID).Scan(&account); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := s.dbPool.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = now(), last_step = NULL
+		WHERE user_totp.confirmed_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return &model.TwoFactorEnrollment{
+		Secret:     secret,
+		OtpauthURI: otpauthURI(s.issuer, account, secret),
+		Issuer:     s.issuer,
+		Account:    account,
+		Digits:     totpDigits,
+		Period:     int(totpPeriod / time.Second),
+	}, nil
+}
+
+// Confirm включает 2FA первым кодом из приложения и возвращает коды восстановления —
+// они показываются один раз, в базе хранятся только хеши.
+func (s *TwoFactorService) Confirm(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var (
+		secret    string
+		confirmed *time.Time
+	)
+	err = tx.QueryRow(ctx, `SELECT secret, confirmed_at FROM user_totp WHERE user_id = $1 FOR UPDATE`, userID).Scan(&secret, &confirmed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: enroll first", ErrTwoFactorNotEnabled)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if confirmed != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if _, err := tx.Exec(ctx, `UPDATE user_totp SET confirmed_at = now(), last_step = $2 WHERE user_id = $1`, userID, step); err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit(ctx)
+}
+
+// Disable отключает 2FA; нужен действующий код из приложения или код восстановления.
+// Доступ к пространствам, которые требуют 2FA, при этом пропадает.
+func (s *TwoFactorService) Disable(ctx context.Context, userID int, code string) error {
+	if err := interactiveOnly(ctx); err != nil {
+		return err
+	}
+	return s.withCode(ctx, userID, code, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// RegenerateRecoveryCodes выдаёт новые коды восстановления вместо старых.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID int, code string) ([]string, error) {
+	if err := interactiveOnly(ctx); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := s.withCode(ctx, userID, code, func(tx pgx.Tx) error {
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// withCode проверяет код и выполняет fn в той же транзакции.
+func (s *TwoFactorService) withCode(ctx context.Context, userID int, code string, fn func(tx pgx.Tx) error) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+	if err := verifyTwoFactorCode(ctx, tx, userID, code); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// verifyTwoFactorCode принимает код TOTP (не старше уже принятого) или неиспользованный код
+// восстановления и отмечает его использованным.
+func verifyTwoFactorCode(ctx context.Context, tx pgx.Tx, userID int, code string) error {
+	if !isTOTPCode(code) {
+		if code == "" {
+			return ErrInvalidTwoFactorCode
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE user_recovery_codes SET used_at = now()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		`, userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	var secret string
+	err := tx.QueryRow(ctx, `SELECT secret FROM user_totp WHERE user_id = $1 AND confirmed_at IS NOT NULL FOR UPDATE`, userID).Scan(&secret)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	// код действует весь свой шаг — повторно (перехваченный) он не принимается
+	tag, err := tx.Exec(ctx, `
+		UPDATE user_totp SET last_step = $2 WHERE user_id = $1 AND (last_step IS NULL OR last_step < $2)
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newChallenge выдаёт challenge-токен второго шага входа; в базе хранится его sha256.
+func (s *TwoFactorService) newChallenge(ctx context.Context, userID int, device string) (*model.LoginChallenge, error) {
+	token, hash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	// заодно убираем отработавшие токены этого пользователя
+	if _, err := s.dbPool.Exec(ctx, `
+		DELETE FROM login_challenges WHERE user_id = $1 AND (expires_at < now() OR used_at IS NOT NULL)
+	`, userID); err != nil {
+		return nil, err
+	}
+	ch := model.LoginChallenge{Token: token}
+	err = s.dbPool.QueryRow(ctx, `
+		INSERT INTO login_challenges (token_hash, user_id, device, expires_at)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+		RETURNING expires_at
+	`, hash, userID, device, s.challengeTTL.Seconds()).Scan(&ch.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// redeemChallenge проверяет код для challenge-токена. Неверный код засчитывается в LoginGuard
+// как неудачный вход; после maxChallengeAttempts неверных кодов токен сгорает.
+// Возвращает пользователя и устройство, указанное на первом шаге.
+func (s *TwoFactorService) redeemChallenge(ctx context.Context, token, code string, client model.ClientInfo) (*model.User, string, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var (
+		user   model.User
+		device string
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT u.id, u.name, u.surname, u.middlename, u.login, u.email, u.roleID, c.device
+		FROM login_challenges c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.token_hash = $1 AND c.used_at IS NULL AND c.expires_at > now()
+		FOR UPDATE OF c
+	`, hashToken(token)).Scan(&user.ID, &user.Name, &user.Surname, &user.Middlename, &user.Login, &user.Email, &user.RoleID, &device)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", ErrInvalidLoginChallenge
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.guard.Check(ctx, user.Login, client); err != nil {
+		return nil, "", err
+	}
+
+	codeErr := verifyTwoFactorCode(ctx, tx, user.ID, code)
+	if codeErr != nil && !errors.Is(codeErr, ErrInvalidTwoFactorCode) {
+		return nil, "", codeErr
+	}
+	if codeErr != nil {
+		if _, err := tx.Exec(ctx, `
+			UPDATE login_challenges SET attempts = attempts + 1,
+				used_at = CASE WHEN attempts + 1 >= $2 THEN now() END
+			WHERE token_hash = $1
+		`, hashToken(token), maxChallengeAttempts); err != nil {
+			return nil, "", err
+		}
+	} else if _, err := tx.Exec(ctx, `UPDATE login_challenges SET used_at = now() WHERE token_hash = $1`, hashToken(token)); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, "", err
+	}
+
+	if codeErr != nil {
+		if err := s.guard.Failed(ctx, user.Login, &user.ID, client); err != nil {
+			return nil, "", err
+		}
+		return nil, "", codeErr
+	}
+	return &user, device, nil
+}
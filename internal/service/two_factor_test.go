@@ -0,0 +1,103 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tasker/internal/model"
+	"tasker/internal/service"
+	"tasker/internal/storage"
+	"tasker/internal/testutil"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// identityFixture — IdentityService с локальными паролями и зарегистрированный пользователь.
+type identityFixture struct {
+	db        *pgxpool.Pool
+	identity  *service.IdentityService
+	twoFactor *service.TwoFactorService
+	user      *model.User
+	password  string
+	client    model.ClientInfo
+}
+
+func newIdentityFixture(t *testing.T) *identityFixture {
+	t.Helper()
+	db := testutil.DB(t)
+	guard := service.NewLoginGuard(db, storage.NewMemoryAttemptStore(), service.LoginPolicy{
+		MaxFailures: 100, MaxIPFailures: 100, Lockout: time.Minute, Window: time.Minute,
+	})
+	keys, err := service.LoadKeySet(service.KeySetConfig{Algorithm: service.JWTAlgHS256, Secret: "test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords, err := service.LoadPasswordPolicy(8, bcrypt.MinCost, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoFactor := service.NewTwoFactorService(db, guard, "Tasker", time.Minute)
+	identity := service.NewIdentityService(db, keys, guard, twoFactor, passwords, time.Minute, time.Hour,
+		service.NewLocalCredentials(db, guard, passwords))
+
+	f := &identityFixture{db: db, identity: identity, twoFactor: twoFactor, password: "correct-horse-battery",
+		client: model.ClientInfo{IP: "127.0.0.1", UserAgent: "test"}}
+	f.user, err = identity.Register(context.Background(), model.RegisterRequest{
+		Name: "Test", Surname: "User", Login: testutil.Name("user"), Password: f.password,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func (f *identityFixture) login(t *testing.T) *model.LoginResult {
+	t.Helper()
+	res, err := f.identity.Login(context.Background(), service.ProviderLocal,
+		service.Credentials{Login: f.user.Login, Password: f.password}, f.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestTwoFactorCodeReplay(t *testing.T) {
+	f := newIdentityFixture(t)
+	ctx := context.Background()
+	enrollment, err := f.twoFactor.Enroll(ctx, f.user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	code := service.TOTPAt(enrollment.Secret, now)
+	if _, err := f.twoFactor.Confirm(ctx, f.user.ID, code); err != nil {
+		t.Fatal(err)
+	}
+
+	res := f.login(t)
+	if res.Challenge == nil {
+		t.Fatal("login with 2FA enabled opened a session without a challenge")
+	}
+	// код, которым подтвердили 2FA, уже израсходован: его шаг записан в last_step
+	if _, err := f.identity.LoginTwoFactor(ctx, res.Challenge.Token, code, f.client); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+		t.Fatalf("replayed code: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	// код следующего шага (в пределах допуска часов) ещё не использовался
+	next := service.TOTPAt(enrollment.Secret, now.Add(30*time.Second))
+	done, err := f.identity.LoginTwoFactor(ctx, res.Challenge.Token, next, f.client)
+	if err != nil {
+		t.Fatalf("code of the next step: %v", err)
+	}
+	if done.Tokens == nil {
+		t.Fatal("second step did not open a session")
+	}
+
+	// и он тоже одноразовый
+	res = f.login(t)
+	if _, err := f.identity.LoginTwoFactor(ctx, res.Challenge.Token, next, f.client); !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+		t.Errorf("replayed code of the next step: err = %v, want ErrInvalidTwoFactorCode", err)
+	}
+}
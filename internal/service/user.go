@@ -2,88 +2,72 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"tasker/internal/model"
+	"tasker/internal/storage"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
-type UserService struct {
-	dbPool *pgxpool.Pool
-}
-
-func NewUserService(dbPool *pgxpool.Pool) *UserService {
-	return &UserService{dbPool: dbPool}
-}
-
-func (s *UserService) Register(ctx context.Context, req model.RegisterRequest) (*model.User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, err
-	}
+// ErrUserNotFound возвращается, если пользователя нет.
+var ErrUserNotFound = errors.New("user not found")
 
-	const query = `
-        INSERT INTO users (name, surname, middlename, login, roleID, password) 
-        VALUES ($1, $2, $3, $4, $5, $6)
-        RETURNING id
-    `
+// ErrAccountDisabled — учётная запись деактивирована, вход запрещён.
+var ErrAccountDisabled = errors.New("account is deactivated")
 
-	var userID int
-	err = s.dbPool.QueryRow(ctx, query,
-		req.Name,
-		req.Surname,
-		req.Middlename,
-		req.Login,
-		req.RoleID,
-		string(hashedPassword),
-	).Scan(&userID)
+// RevokeDeactivated — причина отзыва сессий деактивированного пользователя.
+const RevokeDeactivated = "deactivated"
 
+// checkActive возвращает ErrAccountDisabled, если пользователь деактивирован.
+func checkActive(ctx context.Context, q queryer, userID int) error {
+	var deactivated bool
+	err := q.QueryRow(ctx, `SELECT deactivated_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&deactivated)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	return &model.User{
-		ID:         userID,
-		Name:       req.Name,
-		Surname:    req.Surname,
-		Middlename: &req.Middlename,
-		Login:      req.Login,
-		RoleID:     req.RoleID,
-	}, nil
+	if deactivated {
+		return ErrAccountDisabled
+	}
+	return nil
 }
 
-func (s *UserService) Login(ctx context.Context, login, password string) (*model.User, error) {
-	const query = `
-        SELECT id, name, surname, middlename, login, roleID, password 
-        FROM users WHERE login = $1
-    `
-
-	var user model.User
-	err := s.dbPool.QueryRow(ctx, query, login).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Surname,
-		&user.Middlename,
-		&user.Login,
-		&user.RoleID,
-		&user.Password,
-	)
-
-	if err != nil {
-		return nil, err
+// setUserActive деактивирует пользователя (отзывая все его сессии) или возвращает ему доступ.
+// Персональные токены деактивированного не принимаются, пока он не активирован снова.
+func setUserActive(ctx context.Context, tx pgx.Tx, userID int, active bool) error {
+	if active {
+		_, err := tx.Exec(ctx, `UPDATE users SET deactivated_at = NULL WHERE id = $1`, userID)
+		return err
 	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, err
+	tag, err := tx.Exec(ctx, `UPDATE users SET deactivated_at = now() WHERE id = $1 AND deactivated_at IS NULL`, userID)
+	if err != nil || tag.RowsAffected() == 0 {
+		return err
 	}
+	_, err = revokeSessions(ctx, tx, `user_id = $1`, RevokeDeactivated, userID)
+	return err
+}
+
+// UserService — каталог пользователей: профиль, аватар, списки и деактивация.
+// Регистрация и вход — в IdentityService.
+type UserService struct {
+	dbPool *pgxpool.Pool
+	// store хранит аватары (то же хранилище, что и у вложений)
+	store   storage.BlobStore
+	profile ProfileLimits
+}
 
-	user.Password = ""
-	return &user, nil
+func NewUserService(dbPool *pgxpool.Pool, store storage.BlobStore, profile ProfileLimits) *UserService {
+	return &UserService{dbPool: dbPool, store: store, profile: profile}
 }
 
 func (s *UserService) GetUserByID(ctx context.Context, id int) (*model.User, error) {
 	const query = `
-        SELECT id, name, surname, middlename, login, roleID
+        SELECT id, name, surname, middlename, login, roleID, deactivated_at IS NOT NULL
         FROM users WHERE id = $1
     `
 
@@ -95,37 +79,229 @@ func (s *UserService) GetUserByID(ctx context.Context, id int) (*model.User, err
 		&user.Middlename,
 		&user.Login,
 		&user.RoleID,
+		&user.Deactivated,
 	)
 
 	return &user, err
 }
 
-func (s *UserService) GetAllUsers(ctx context.Context) ([]model.User, error) {
-	const query = `
-		SELECT id, name, surname, middlename
-		FROM users;
-	`
+const (
+	defaultUserPageSize = 100
+	maxUserPageSize     = 500
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetAllUsers возвращает страницу пользователей по алфавиту (для выбора исполнителя).
+// Деактивированные скрыты, если не просили IncludeDeactivated.
+func (s *UserService) GetAllUsers(ctx context.Context, q model.UserListQuery) ([]model.User, error) {
+	var b queryBuilder
+	if !q.IncludeDeactivated {
+		b.where("u.deactivated_at IS NULL")
+	}
+	for _, word := range strings.Fields(q.Search) {
+		b.where(`concat_ws(' ', u.name, u.surname, u.middlename, u.login) ILIKE ` + b.arg("%"+likeEscaper.Replace(word)+"%"))
+	}
+	where := "TRUE"
+	if len(b.conds) > 0 {
+		where = strings.Join(b.conds, " AND ")
+	}
 
-	rows, err := s.dbPool.Query(ctx, query)
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultUserPageSize
+	}
+	limit = min(limit, maxUserPageSize)
+
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT u.id, u.name, u.surname, u.middlename, u.deactivated_at IS NOT NULL, a.updated_at
+		FROM users u
+		LEFT JOIN user_avatars a ON a.user_id = u.id
+		WHERE `+where+`
+		ORDER BY u.surname, u.name, u.id
+		LIMIT `+b.arg(limit)+` OFFSET `+b.arg(max(q.Offset, 0)), b.args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []model.User
+	users := []model.User{}
 	for rows.Next() {
 		var user model.User
+		var avatarAt *time.Time
 		err := rows.Scan(
 			&user.ID,
 			&user.Name,
 			&user.Surname,
 			&user.Middlename,
+			&user.Deactivated,
+			&avatarAt,
 		)
 		if err != nil {
 			return nil, err
 		}
+		user.AvatarURL = avatarURL(user.ID, avatarAt)
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
+}
+
+// ErrSelfDeactivation — администратор не может деактивировать сам себя.
+var ErrSelfDeactivation = errors.New("cannot deactivate yourself")
+
+// ErrInvalidReassignee — задачи нельзя передать этому пользователю (нет такого или он деактивирован).
+var ErrInvalidReassignee = errors.New("invalid reassignee")
+
+// openTaskCond — задача не удалена и не завершена (done_at ставится при переходе в категорию done).
+const openTaskCond = `t.deleted_at IS NULL AND t.done_at IS NULL`
+
+// DeactivateUser отключает учётную запись и отзывает её сессии. Если указан reassignTo, открытые
+// задачи пользователя (исполнитель, основной или дополнительный согласующий) передаются ему в тех
+// пространствах, где он участник. Остальные задачи остаются за деактивированным и возвращаются
+// в FlaggedTasks; задачи такого исполнителя находит фильтр assigneeDeactivated=true.
+func (s *UserService) DeactivateUser(ctx context.Context, actorID, userID int, reassignTo *int) (*model.UserDeactivation, error) {
+	if userID == actorID {
+		return nil, ErrSelfDeactivation
+	}
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	if reassignTo != nil {
+		if *reassignTo == userID {
+			return nil, fmt.Errorf("%w: cannot reassign to the deactivated user", ErrInvalidReassignee)
+		}
+		if err := checkActive(ctx, tx, *reassignTo); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, ErrAccountDisabled) {
+				return nil, fmt.Errorf("%w: user %d", ErrInvalidReassignee, *reassignTo)
+			}
+			return nil, err
+		}
+	}
+	if err := setUserActive(ctx, tx, userID, false); err != nil {
+		return nil, err
+	}
+
+	res := &model.UserDeactivation{UserID: userID, ReassignedTo: reassignTo, ReassignedTasks: []string{}}
+	if reassignTo != nil {
+		if res.ReassignedTasks, err = reassignTasks(ctx, tx, actorID, userID, *reassignTo); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT t.id::text FROM tasks t
+		WHERE `+openTaskCond+` AND (
+			t."assignerID" = $1 OR t."approverID" = $1
+			OR EXISTS (SELECT 1 FROM task_approvers ta WHERE ta.task_id = t.id AND ta.user_id = $1)
+		)
+		ORDER BY t.id
+	`, strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+	res.FlaggedTasks, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	return res, tx.Commit(ctx)
+}
+
+// reassignTasks передаёт открытые задачи from пользователю to в пространствах, где to — участник.
+// Смена исполнителя и основного согласующего пишется в историю задачи.
+func reassignTasks(ctx context.Context, tx pgx.Tx, actorID, from, to int) ([]string, error) {
+	fromID, toID := strconv.Itoa(from), strconv.Itoa(to)
+	inToSpaces := `t.space IN (SELECT space_id FROM space_memberships WHERE user_id = $3)`
+
+	changed := map[string][]model.FieldChange{}
+	for _, f := range []struct{ column, field string }{
+		{`"assignerID"`, "assignerId"},
+		{`"approverID"`, "approverId"},
+	} {
+		rows, err := tx.Query(ctx, `
+			UPDATE tasks t SET `+f.column+` = $2, updated_at = now()
+			WHERE `+openTaskCond+` AND t.`+f.column+` = $1 AND `+inToSpaces+`
+			RETURNING t.id::text
+		`, fromID, toID, to)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			changed[id] = append(changed[id], model.FieldChange{Field: f.field, Old: fromID, New: toID})
+		}
+	}
+
+	// дополнительные согласующие: история по ним не ведётся (как и в SetApprovers)
+	rows, err := tx.Query(ctx, `
+		WITH moved AS (
+			DELETE FROM task_approvers ta USING tasks t
+			WHERE ta.task_id = t.id AND ta.user_id = $1 AND `+openTaskCond+` AND `+inToSpaces+`
+			RETURNING ta.task_id
+		), added AS (
+			INSERT INTO task_approvers (task_id, user_id)
+			SELECT task_id, $2 FROM moved
+			ON CONFLICT DO NOTHING
+		)
+		SELECT task_id::text FROM moved
+	`, fromID, toID, to)
+	if err != nil {
+		return nil, err
+	}
+	approverTasks, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	ids := approverTasks
+	for id, changes := range changed {
+		if err := recordHistory(ctx, tx, id, model.TaskActionUpdate, &actorID, changes); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// ReactivateUser возвращает пользователю доступ; войти он сможет с прежними учётными данными.
+func (s *UserService) ReactivateUser(ctx context.Context, userID int) error {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err := setUserActive(ctx, tx, userID, true); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// lockUser блокирует строку пользователя до конца транзакции.
+func lockUser(ctx context.Context, tx pgx.Tx, userID int) error {
+	tag, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %d: %w", userID, ErrUserNotFound)
+	}
+	return nil
 }
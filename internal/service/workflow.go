@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tasker/internal/model"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidWorkflow возвращается, если присланное описание рабочего процесса некорректно.
+var ErrInvalidWorkflow = errors.New("invalid workflow")
+
+// TransitionError описывает недопустимый переход статуса задачи.
+// Unknown == true означает, что целевого статуса нет в рабочем процессе пространства.
+type TransitionError struct {
+	From    string
+	To      string
+	Allowed []string
+	Unknown bool
+}
+
+func (e *TransitionError) Error() string {
+	if e.Unknown {
+		return fmt.Sprintf("unknown status %q", e.To)
+	}
+	return fmt.Sprintf("transition from %q to %q is not allowed", e.From, e.To)
+}
+
+// completionStatus — статус, в который задачу переводит PUT /done. Статусов категории done может
+// быть несколько (в рабочем процессе по умолчанию ещё canceled), поэтому выполнение — по имени.
+const completionStatus = "done"
+
+// DefaultWorkflow — рабочий процесс, который используется для пространств без собственной настройки.
+func DefaultWorkflow(spaceID string) *model.Workflow {
+	return &model.Workflow{
+		SpaceID: spaceID,
+		Statuses: []model.WorkflowStatus{
+			{Name: "to-do", Category: model.StatusCategoryTodo, Position: 0},
+			{Name: "in-progress", Category: model.StatusCategoryInProgress, Position: 1},
+			{Name: "blocked", Category: model.StatusCategoryInProgress, Position: 2},
+			{Name: "review", Category: model.StatusCategoryInProgress, Position: 3},
+			{Name: "done", Category: model.StatusCategoryDone, Position: 4},
+			{Name: "canceled", Category: model.StatusCategoryDone, Position: 5},
+		},
+		Transitions: []model.WorkflowTransition{
+			{From: "to-do", To: "in-progress"},
+			{From: "to-do", To: "canceled"},
+			{From: "in-progress", To: "to-do"},
+			{From: "in-progress", To: "blocked"},
+			{From: "in-progress", To: "review"},
+			{From: "in-progress", To: "done"},
+			{From: "in-progress", To: "canceled"},
+			{From: "blocked", To: "in-progress"},
+			{From: "blocked", To: "canceled"},
+			{From: "review", To: "in-progress"},
+			{From: "review", To: "done"},
+			{From: "done", To: "in-progress"},
+			{From: "canceled", To: "to-do"},
+		},
+	}
+}
+
+// workflowStatus ищет статус по имени.
+func workflowStatus(wf *model.Workflow, name string) (model.WorkflowStatus, bool) {
+	for _, st := range wf.Statuses {
+		if st.Name == name {
+			return st, true
+		}
+	}
+	return model.WorkflowStatus{}, false
+}
+
+// initialStatus — первый по порядку статус категории todo (или просто первый статус).
+func initialStatus(wf *model.Workflow) model.WorkflowStatus {
+	for _, st := range wf.Statuses {
+		if st.Category == model.StatusCategoryTodo {
+			return st
+		}
+	}
+	return wf.Statuses[0]
+}
+
+// initialStatuses — статусы категории todo, с которых может начинаться задача, в порядке position.
+func initialStatuses(wf *model.Workflow) []string {
+	names := []string{}
+	for _, st := range wf.Statuses {
+		if st.Category == model.StatusCategoryTodo {
+			names = append(names, st.Name)
+		}
+	}
+	return names
+}
+
+// allowedTransitions возвращает статусы, в которые можно перейти из from, в порядке position.
+func allowedTransitions(wf *model.Workflow, from string) []string {
+	allowed := []string{}
+	for _, st := range wf.Statuses {
+		for _, tr := range wf.Transitions {
+			if tr.From == from && tr.To == st.Name {
+				allowed = append(allowed, st.Name)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// checkTransition проверяет переход from -> to и возвращает целевой статус.
+// Переход в тот же статус всегда разрешён. Пустой from — создание задачи; из статуса, которого
+// нет в рабочем процессе (старые данные), можно перейти только в начальный статус.
+func checkTransition(wf *model.Workflow, from, to string) (model.WorkflowStatus, error) {
+	target, ok := workflowStatus(wf, to)
+	if !ok {
+		names := make([]string, 0, len(wf.Statuses))
+		for _, st := range wf.Statuses {
+			names = append(names, st.Name)
+		}
+		return model.WorkflowStatus{}, &TransitionError{From: from, To: to, Allowed: names, Unknown: true}
+	}
+	if from == to {
+		return target, nil
+	}
+	allowed := initialStatuses(wf)
+	if _, known := workflowStatus(wf, from); known {
+		allowed = allowedTransitions(wf, from)
+	}
+	for _, name := range allowed {
+		if name == to {
+			return target, nil
+		}
+	}
+	return model.WorkflowStatus{}, &TransitionError{From: from, To: to, Allowed: allowed}
+}
+
+// validateWorkflow проверяет согласованность статусов и переходов.
+func validateWorkflow(wf *model.Workflow) error {
+	if len(wf.Statuses) == 0 {
+		return fmt.Errorf("%w: at least one status is required", ErrInvalidWorkflow)
+	}
+
+	seen := map[string]bool{}
+	categories := map[string]bool{}
+	for _, st := range wf.Statuses {
+		name := strings.TrimSpace(st.Name)
+		if name == "" || name != st.Name {
+			return fmt.Errorf("%w: status name %q is empty or has surrounding spaces", ErrInvalidWorkflow, st.Name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: duplicate status %q", ErrInvalidWorkflow, name)
+		}
+		switch st.Category {
+		case model.StatusCategoryTodo, model.StatusCategoryInProgress, model.StatusCategoryDone:
+		default:
+			return fmt.Errorf("%w: status %q has unknown category %q", ErrInvalidWorkflow, name, st.Category)
+		}
+		seen[name] = true
+		categories[st.Category] = true
+	}
+	if !categories[model.StatusCategoryTodo] || !categories[model.StatusCategoryDone] {
+		return fmt.Errorf("%w: workflow needs at least one todo and one done status", ErrInvalidWorkflow)
+	}
+
+	for _, tr := range wf.Transitions {
+		if !seen[tr.From] || !seen[tr.To] {
+			return fmt.Errorf("%w: transition %q -> %q references unknown status", ErrInvalidWorkflow, tr.From, tr.To)
+		}
+		if tr.From == tr.To {
+			return fmt.Errorf("%w: transition %q -> %q is a loop", ErrInvalidWorkflow, tr.From, tr.To)
+		}
+	}
+	return nil
+}
+
+type WorkflowService struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewWorkflowService(dbPool *pgxpool.Pool) *WorkflowService {
+	return &WorkflowService{dbPool: dbPool}
+}
+
+// GetWorkflow возвращает рабочий процесс пространства или DefaultWorkflow, если он не настроен.
+func (s *WorkflowService) GetWorkflow(ctx context.Context, spaceID string) (*model.Workflow, error) {
+	if spaceID == "" {
+		return DefaultWorkflow(""), nil
+	}
+
+	rows, err := s.dbPool.Query(ctx, `
+		SELECT name, category, position
+		FROM workflow_statuses
+		WHERE space_id = $1
+		ORDER BY position, name
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wf := &model.Workflow{SpaceID: spaceID, Statuses: []model.WorkflowStatus{}, Transitions: []model.WorkflowTransition{}}
+	for rows.Next() {
+		var st model.WorkflowStatus
+		if err := rows.Scan(&st.Name, &st.Category, &st.Position); err != nil {
+			return nil, err
+		}
+		wf.Statuses = append(wf.Statuses, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(wf.Statuses) == 0 {
+		return DefaultWorkflow(spaceID), nil
+	}
+
+	trRows, err := s.dbPool.Query(ctx, `
+		SELECT from_status, to_status
+		FROM workflow_transitions
+		WHERE space_id = $1
+	`, spaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer trRows.Close()
+
+	for trRows.Next() {
+		var tr model.WorkflowTransition
+		if err := trRows.Scan(&tr.From, &tr.To); err != nil {
+			return nil, err
+		}
+		wf.Transitions = append(wf.Transitions, tr)
+	}
+	if err := trRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return wf, nil
+}
+
+// SetWorkflow заменяет рабочий процесс пространства целиком (в транзакции).
+// Статусы, которые ещё используются задачами пространства, удалить нельзя.
+func (s *WorkflowService) SetWorkflow(ctx context.Context, spaceID string, wf model.Workflow) (*model.Workflow, error) {
+	wf.SpaceID = spaceID
+	if wf.Transitions == nil {
+		wf.Transitions = []model.WorkflowTransition{}
+	}
+	sort.SliceStable(wf.Statuses, func(i, j int) bool { return wf.Statuses[i].Position < wf.Statuses[j].Position })
+	if err := validateWorkflow(&wf); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(wf.Statuses))
+	for _, st := range wf.Statuses {
+		names = append(names, st.Name)
+	}
+
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT status FROM tasks
+		WHERE space = $1 AND NOT (status = ANY($2))
+	`, spaceID, names)
+	if err != nil {
+		return nil, err
+	}
+	var orphaned []string
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		orphaned = append(orphaned, status)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(orphaned) > 0 {
+		return nil, fmt.Errorf("%w: statuses still used by tasks: %s", ErrInvalidWorkflow, strings.Join(orphaned, ", "))
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM workflow_transitions WHERE space_id = $1`, spaceID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM workflow_statuses WHERE space_id = $1`, spaceID); err != nil {
+		return nil, err
+	}
+	for i, st := range wf.Statuses {
+		wf.Statuses[i].Position = i
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO workflow_statuses (space_id, name, category, position)
+			VALUES ($1, $2, $3, $4)
+		`, spaceID, st.Name, st.Category, i); err != nil {
+			return nil, err
+		}
+	}
+	for _, tr := range wf.Transitions {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO workflow_transitions (space_id, from_status, to_status)
+			VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, spaceID, tr.From, tr.To); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	wf := DefaultWorkflow("")
+	cases := []struct {
+		name, from, to string
+		allowed        []string // nil — переход разрешён
+		unknown        bool
+	}{
+		{name: "regular transition", from: "to-do", to: "in-progress"},
+		{name: "same status", from: "review", to: "review"},
+		{name: "not allowed", from: "to-do", to: "done", allowed: []string{"in-progress", "canceled"}},
+		{name: "unknown target", from: "to-do", to: "todo", unknown: true},
+		{name: "new task in initial status", from: "", to: "to-do"},
+		{name: "new task already done", from: "", to: "done", allowed: []string{"to-do"}},
+		{name: "new task in progress", from: "", to: "in-progress", allowed: []string{"to-do"}},
+		{name: "legacy status back to initial", from: "todo", to: "to-do"},
+		{name: "legacy status elsewhere", from: "todo", to: "in-progress", allowed: []string{"to-do"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			st, err := checkTransition(wf, tc.from, tc.to)
+			if tc.allowed == nil && !tc.unknown {
+				if err != nil || st.Name != tc.to {
+					t.Errorf("checkTransition = %q, %v; want %q", st.Name, err, tc.to)
+				}
+				return
+			}
+			var trErr *TransitionError
+			if !errors.As(err, &trErr) {
+				t.Fatalf("err = %v, want TransitionError", err)
+			}
+			if trErr.Unknown != tc.unknown {
+				t.Errorf("Unknown = %v, want %v", trErr.Unknown, tc.unknown)
+			}
+			if tc.allowed != nil && !slices.Equal(trErr.Allowed, tc.allowed) {
+				t.Errorf("Allowed = %v, want %v", trErr.Allowed, tc.allowed)
+			}
+		})
+	}
+}
+
+func TestCompletionTransition(t *testing.T) {
+	wf := DefaultWorkflow("")
+	cases := []struct {
+		from    string
+		allowed []string // nil — задачу можно отметить выполненной
+	}{
+		{from: "in-progress"},
+		{from: "review"},
+		{from: "done"},
+		// отмена тоже в категории done, но /done в неё не переводит
+		{from: "to-do", allowed: []string{"in-progress", "canceled"}},
+		{from: "blocked", allowed: []string{"in-progress", "canceled"}},
+		{from: "canceled", allowed: []string{"to-do"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.from, func(t *testing.T) {
+			st, err := checkTransition(wf, tc.from, completionStatus)
+			if tc.allowed == nil {
+				if err != nil || st.Name != "done" {
+					t.Errorf("checkTransition = %q, %v; want done", st.Name, err)
+				}
+				return
+			}
+			var trErr *TransitionError
+			if !errors.As(err, &trErr) || trErr.Unknown || !slices.Equal(trErr.Allowed, tc.allowed) {
+				t.Errorf("err = %v, want TransitionError with allowed %v", err, tc.allowed)
+			}
+		})
+	}
+}
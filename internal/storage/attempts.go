@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Attempts — неудачные попытки входа по одному ключу (логин или IP).
+type Attempts struct {
+	// Failures — неудачи подряд; счётчик начинается заново, если прошлая неудача старше окна.
+	Failures int
+	// BlockedUntil — до этого момента попытки по ключу не принимаются; нулевое — не заблокирован.
+	BlockedUntil time.Time
+}
+
+// Blocked — действует ли блокировка на момент now.
+func (a Attempts) Blocked(now time.Time) bool {
+	return now.Before(a.BlockedUntil)
+}
+
+// AttemptStore хранит счётчики неудачных попыток входа.
+type AttemptStore interface {
+	// Get возвращает состояние ключа; для неизвестного ключа — нулевое.
+	Get(ctx context.Context, key string) (Attempts, error)
+	// Fail атомарно засчитывает неудачу и блокирует ключ на block(failures), если это больше нуля.
+	// Неудача старше window не учитывается.
+	Fail(ctx context.Context, key string, window time.Duration, block func(failures int) time.Duration) (Attempts, error)
+	// Reset забывает ключ (успешный вход или разблокировка администратором).
+	Reset(ctx context.Context, key string) error
+	// Prune удаляет ключи без действующей блокировки, последняя неудача которых старше window.
+	Prune(ctx context.Context, window time.Duration) (int64, error)
+}
+
+// MemoryAttemptStore — счётчики в памяти процесса; годится для одного экземпляра сервера.
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]*memoryAttempts
+	now     func() time.Time
+}
+
+type memoryAttempts struct {
+	Attempts
+	lastFailure time.Time
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{entries: map[string]*memoryAttempts{}, now: time.Now}
+}
+
+func (s *MemoryAttemptStore) Get(_ context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		return e.Attempts, nil
+	}
+	return Attempts{}, nil
+}
+
+func (s *MemoryAttemptStore) Fail(_ context.Context, key string, window time.Duration, block func(int) time.Duration) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &memoryAttempts{}
+		s.entries[key] = e
+	}
+	if now.Sub(e.lastFailure) > window {
+		e.Failures = 0
+	}
+	e.Failures++
+	e.lastFailure = now
+	if d := block(e.Failures); d > 0 {
+		e.BlockedUntil = now.Add(d)
+	}
+	return e.Attempts, nil
+}
+
+func (s *MemoryAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryAttemptStore) Prune(_ context.Context, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var n int64
+	for key, e := range s.entries {
+		if now.Sub(e.lastFailure) > window && !e.Blocked(now) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgAttemptStore хранит счётчики в таблице login_attempts, поэтому ограничения
+// действуют сразу на всех репликах.
+type PgAttemptStore struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewPgAttemptStore(dbPool *pgxpool.Pool) *PgAttemptStore {
+	return &PgAttemptStore{dbPool: dbPool}
+}
+
+func (s *PgAttemptStore) Get(ctx context.Context, key string) (Attempts, error) {
+	var (
+		a       Attempts
+		blocked *time.Time
+	)
+	err := s.dbPool.QueryRow(ctx, `SELECT failures, blocked_until FROM login_attempts WHERE key = $1`, key).
+		Scan(&a.Failures, &blocked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Attempts{}, nil
+	}
+	if err != nil {
+		return Attempts{}, err
+	}
+	if blocked != nil {
+		a.BlockedUntil = *blocked
+	}
+	return a, nil
+}
+
+// Fail увеличивает счётчик и ставит блокировку в одной транзакции: строка остаётся
+// заблокированной до коммита, так что параллельные неудачи считаются последовательно.
+func (s *PgAttemptStore) Fail(ctx context.Context, key string, window time.Duration, block func(int) time.Duration) (Attempts, error) {
+	tx, err := s.dbPool.Begin(ctx)
+	if err != nil {
+		return Attempts{}, err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var (
+		a       Attempts
+		blocked *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		INSERT INTO login_attempts (key, failures, last_failure) VALUES ($1, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure < now() - make_interval(secs => $2)
+				THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure = now()
+		RETURNING failures, blocked_until
+	`, key, window.Seconds()).Scan(&a.Failures, &blocked)
+	if err != nil {
+		return Attempts{}, err
+	}
+	if blocked != nil {
+		a.BlockedUntil = *blocked
+	}
+
+	if d := block(a.Failures); d > 0 {
+		if err := tx.QueryRow(ctx, `
+			UPDATE login_attempts SET blocked_until = now() + make_interval(secs => $2)
+			WHERE key = $1 RETURNING blocked_until
+		`, key, d.Seconds()).Scan(&a.BlockedUntil); err != nil {
+			return Attempts{}, err
+		}
+	}
+	return a, tx.Commit(ctx)
+}
+
+func (s *PgAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.dbPool.Exec(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
+
+func (s *PgAttemptStore) Prune(ctx context.Context, window time.Duration) (int64, error) {
+	tag, err := s.dbPool.Exec(ctx, `
+		DELETE FROM login_attempts
+		WHERE last_failure < now() - make_interval(secs => $1)
+		  AND (blocked_until IS NULL OR blocked_until < now())
+	`, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testClock — часы, которые двигает тест.
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time { return c.t }
+
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestMemoryStore() (*MemoryAttemptStore, *testClock) {
+	clock := &testClock{t: time.Date(2025, 8, 1, 10, 0, 0, 0, time.UTC)}
+	s := NewMemoryAttemptStore()
+	s.now = clock.now
+	return s, clock
+}
+
+// doubling — блокировка с третьей неудачи: 1s, 2s, 4s…
+func doubling(n int) time.Duration {
+	if n < 3 {
+		return 0
+	}
+	return time.Second << (n - 3)
+}
+
+func TestMemoryAttemptStoreBlocks(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newTestMemoryStore()
+
+	for n, want := range []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second} {
+		a, err := s.Fail(ctx, "login:ivanov", time.Hour, doubling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Failures != n+1 {
+			t.Errorf("failure %d: counter %d", n+1, a.Failures)
+		}
+		if want == 0 {
+			if a.Blocked(clock.t) {
+				t.Errorf("failure %d: blocked until %v, want no block", n+1, a.BlockedUntil)
+			}
+			continue
+		}
+		if !a.BlockedUntil.Equal(clock.t.Add(want)) {
+			t.Errorf("failure %d: blocked until %v, want %v", n+1, a.BlockedUntil, clock.t.Add(want))
+		}
+		clock.advance(want)
+		if got, _ := s.Get(ctx, "login:ivanov"); got.Blocked(clock.t) {
+			t.Errorf("failure %d: still blocked after %v", n+1, want)
+		}
+	}
+	// другие ключи не затронуты
+	if got, _ := s.Get(ctx, "ip:10.0.0.1"); got.Failures != 0 || got.Blocked(clock.t) {
+		t.Errorf("unrelated key = %+v", got)
+	}
+}
+
+func TestMemoryAttemptStoreWindow(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newTestMemoryStore()
+
+	for range 2 {
+		if _, err := s.Fail(ctx, "login:ivanov", time.Hour, doubling); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// неудача старше окна не учитывается: счёт начинается заново
+	clock.advance(time.Hour + time.Second)
+	a, err := s.Fail(ctx, "login:ivanov", time.Hour, doubling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Failures != 1 || a.Blocked(clock.t) {
+		t.Errorf("after the window = %+v, want the first failure without a block", a)
+	}
+}
+
+func TestMemoryAttemptStoreReset(t *testing.T) {
+	// сброс — то, что делают успешный вход и разблокировка администратором
+	ctx := context.Background()
+	s, clock := newTestMemoryStore()
+	for range 5 {
+		if _, err := s.Fail(ctx, "login:ivanov", time.Hour, doubling); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, _ := s.Get(ctx, "login:ivanov"); !a.Blocked(clock.t) {
+		t.Fatalf("after 5 failures = %+v, want blocked", a)
+	}
+	if err := s.Reset(ctx, "login:ivanov"); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := s.Get(ctx, "login:ivanov"); a.Failures != 0 || a.Blocked(clock.t) {
+		t.Errorf("after reset = %+v, want a clean state", a)
+	}
+}
+
+func TestMemoryAttemptStorePrune(t *testing.T) {
+	ctx := context.Background()
+	s, clock := newTestMemoryStore()
+	lockout := func(int) time.Duration { return 2 * time.Hour }
+
+	if _, err := s.Fail(ctx, "login:old", time.Hour, doubling); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fail(ctx, "login:locked", time.Hour, lockout); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(90 * time.Minute)
+	if _, err := s.Fail(ctx, "login:recent", time.Hour, doubling); err != nil {
+		t.Fatal(err)
+	}
+
+	// удаляется только ключ со старой неудачей без действующей блокировки
+	n, err := s.Prune(ctx, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("pruned %d keys, want 1", n)
+	}
+	if a, _ := s.Get(ctx, "login:locked"); !a.Blocked(clock.t) {
+		t.Error("pruned a key that is still locked")
+	}
+	if a, _ := s.Get(ctx, "login:recent"); a.Failures != 1 {
+		t.Error("pruned a key with a recent failure")
+	}
+}
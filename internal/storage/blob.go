@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound возвращается, если объекта с таким ключом нет.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore хранит содержимое вложений. Метаданные лежат в Postgres, здесь — только байты.
+type BlobStore interface {
+	// Put сохраняет size байт из r под ключом key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект на чтение; вызывающий обязан закрыть reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет объект; отсутствие объекта ошибкой не считается.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Примеры из документации AWS «Signature Calculations for the Authorization Header»
+// (Amazon S3, Signature Version 4).
+const (
+	awsExampleSecretKey = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+	emptySHA256         = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestSignV4AWSExamples(t *testing.T) {
+	s, err := NewS3Store(S3Config{Endpoint: "https://s3.amazonaws.com", Bucket: "examplebucket"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name          string
+		method, key   string
+		headers       map[string]string
+		signedHeaders []string
+		payloadHash   string
+		canonical     string
+		signature     string
+	}{
+		{
+			name:   "GET object",
+			method: http.MethodGet, key: "test.txt",
+			headers:       map[string]string{"Range": "bytes=0-9"},
+			signedHeaders: []string{"host", "range", "x-amz-content-sha256", "x-amz-date"},
+			payloadHash:   emptySHA256,
+			canonical: "GET\n/test.txt\n\n" +
+				"host:examplebucket.s3.amazonaws.com\nrange:bytes=0-9\n" +
+				"x-amz-content-sha256:" + emptySHA256 + "\nx-amz-date:20130524T000000Z\n\n" +
+				"host;range;x-amz-content-sha256;x-amz-date\n" + emptySHA256,
+			signature: "f0e8bdb87c964420e857bd35b5d6ed310bd44f0170aba48dd91039c6036bdb41",
+		},
+		{
+			name:   "PUT object",
+			method: http.MethodPut, key: "test$file.text",
+			headers: map[string]string{
+				"Date":                "Fri, 24 May 2013 00:00:00 GMT",
+				"x-amz-storage-class": "REDUCED_REDUNDANCY",
+			},
+			signedHeaders: []string{"date", "host", "x-amz-content-sha256", "x-amz-date", "x-amz-storage-class"},
+			payloadHash:   "44ce7dd67c959e0d3524ffac1771dfbba87d2b6b4b4e99e42034a8b803f8b072",
+			canonical: "PUT\n/test%24file.text\n\n" +
+				"date:Fri, 24 May 2013 00:00:00 GMT\nhost:examplebucket.s3.amazonaws.com\n" +
+				"x-amz-content-sha256:44ce7dd67c959e0d3524ffac1771dfbba87d2b6b4b4e99e42034a8b803f8b072\n" +
+				"x-amz-date:20130524T000000Z\nx-amz-storage-class:REDUCED_REDUNDANCY\n\n" +
+				"date;host;x-amz-content-sha256;x-amz-date;x-amz-storage-class\n" +
+				"44ce7dd67c959e0d3524ffac1771dfbba87d2b6b4b4e99e42034a8b803f8b072",
+			signature: "98ad721746da40c64f1a55b78f14c238d841ea1380cd77a1b5971af0ece108bd",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, s.objectURL(tc.key).String(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			req.Header.Set("x-amz-date", "20130524T000000Z")
+			req.Header.Set("x-amz-content-sha256", tc.payloadHash)
+
+			canonical := canonicalRequest(req, tc.signedHeaders, tc.payloadHash)
+			if canonical != tc.canonical {
+				t.Errorf("canonical request:\n%s\nwant:\n%s", canonical, tc.canonical)
+			}
+			scope, signature := signV4(awsExampleSecretKey, "us-east-1", now, canonical)
+			if scope != "20130524/us-east-1/s3/aws4_request" {
+				t.Errorf("scope = %q", scope)
+			}
+			if signature != tc.signature {
+				t.Errorf("signature = %s, want %s", signature, tc.signature)
+			}
+		})
+	}
+}
+
+// fakeS3 — S3 в памяти с адресацией path-style; проверяет подпись каждого запроса.
+type fakeS3 struct {
+	t      *testing.T
+	bucket string
+	delay  time.Duration
+
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.delay)
+	signed := r.Clone(r.Context())
+	signed.URL.Host = r.Host
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	now, err := time.Parse("20060102T150405Z", r.Header.Get("x-amz-date"))
+	if err != nil {
+		http.Error(w, "missing x-amz-date", http.StatusForbidden)
+		return
+	}
+	scope, signature := signV4("secret", "eu-central-1", now, canonicalRequest(signed, signedHeaders, r.Header.Get("x-amz-content-sha256")))
+	want := "AWS4-HMAC-SHA256 Credential=access/" + scope + ", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + signature
+	if r.Header.Get("Authorization") != want {
+		f.t.Errorf("%s %s: Authorization %q, want %q", r.Method, r.URL, r.Header.Get("Authorization"), want)
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			http.Error(w, "<Error><Code>IncompleteBody</Code></Error>", http.StatusBadRequest)
+			return
+		}
+		f.objects[key], f.types[key] = string(body), r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		_, _ = io.WriteString(w, body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeS3(t *testing.T, delay, timeout time.Duration) (*fakeS3, *S3Store) {
+	t.Helper()
+	f := &fakeS3{t: t, bucket: "attachments", delay: delay, objects: map[string]string{}, types: map[string]string{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	s, err := NewS3Store(S3Config{
+		Endpoint:  srv.URL,
+		Region:    "eu-central-1",
+		Bucket:    f.bucket,
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+		Timeout:   timeout,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, s
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	f, s := newFakeS3(t, 0, 5*time.Second)
+	ctx := context.Background()
+	const key = "spaces/42/отчёт за май.txt"
+	const body = "quarterly numbers"
+
+	if err := s.Put(ctx, key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if f.objects[key] != body || f.types[key] != "text/plain" {
+		t.Errorf("stored %q (%s)", f.objects[key], f.types[key])
+	}
+
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil || string(got) != body {
+		t.Errorf("Get = %q, %v; want %q", got, err, body)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestS3StoreTimeout(t *testing.T) {
+	_, s := newFakeS3(t, 200*time.Millisecond, 50*time.Millisecond)
+	if _, err := s.Get(context.Background(), "slow"); err == nil {
+		t.Fatal("Get from a stalled endpoint succeeded")
+	}
+}
@@ -0,0 +1,86 @@
+// Package testutil — общие помощники тестов, которым нужна база данных.
+// Тесты с базой запускаются, только если задан TEST_DATABASE_URL (пустая база, схему создаёт
+// database.NewPool); без него они пропускаются. Данные не удаляются: каждый тест создаёт
+// своих пользователей и пространства с уникальными именами.
+package testutil
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"tasker/internal/database"
+	"tasker/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	poolOnce sync.Once
+	pool     *pgxpool.Pool
+	poolErr  error
+)
+
+// DB возвращает пул к тестовой базе со встроенными ролями или пропускает тест.
+func DB(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	poolOnce.Do(func() {
+		ctx := context.Background()
+		if pool, poolErr = database.NewPool(ctx, url); poolErr != nil {
+			return
+		}
+		poolErr = service.NewRoleService(pool).EnsureBuiltinRoles(ctx)
+	})
+	if poolErr != nil {
+		t.Fatalf("test database: %v", poolErr)
+	}
+	return pool
+}
+
+// Name — уникальное имя с префиксом: логины, названия пространств.
+func Name(prefix string) string {
+	return prefix + "-" + uuid.NewString()[:8]
+}
+
+// User создаёт пользователя с системной ролью systemRole (user или admin) и возвращает его id.
+func User(t testing.TB, db *pgxpool.Pool, systemRole string) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(context.Background(), `
+		INSERT INTO users (name, surname, login, roleid, password)
+		VALUES ('Test', 'User', $1, (SELECT id FROM roles WHERE scope = 'system' AND name = $2), '!')
+		RETURNING id
+	`, Name("user"), systemRole).Scan(&id)
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return id
+}
+
+// Space создаёт пространство владельца ownerID и возвращает его id.
+func Space(t testing.TB, db *pgxpool.Pool, ownerID int) string {
+	t.Helper()
+	sp, err := service.NewSpaceService(db, nil).CreateSpace(context.Background(), Name("space"), ownerID)
+	if err != nil {
+		t.Fatalf("create space: %v", err)
+	}
+	return sp.ID
+}
+
+// Member добавляет пользователя в пространство с ролью role.
+func Member(t testing.TB, db *pgxpool.Pool, spaceID string, userID int, role string) {
+	t.Helper()
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO space_memberships (space_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (space_id, user_id) DO UPDATE SET role = EXCLUDED.role
+	`, spaceID, userID, role)
+	if err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+}